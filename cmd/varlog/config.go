@@ -1,29 +1,373 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"net"
+	"os"
 	"strconv"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/skormos/varlog-parser/cmd/varlog/http"
+	"github.com/skormos/varlog-parser/internal/audit"
+	"github.com/skormos/varlog-parser/internal/auth"
+	"github.com/skormos/varlog-parser/internal/cache"
+	"github.com/skormos/varlog-parser/internal/compression"
+	"github.com/skormos/varlog-parser/internal/config"
+	"github.com/skormos/varlog-parser/internal/handler/health"
+	"github.com/skormos/varlog-parser/internal/handler/varlog"
+	"github.com/skormos/varlog-parser/internal/lineindex"
+	"github.com/skormos/varlog-parser/internal/metrics"
+	vlos "github.com/skormos/varlog-parser/internal/os"
+	"github.com/skormos/varlog-parser/internal/policy"
+	"github.com/skormos/varlog-parser/internal/ratelimit"
+	"github.com/skormos/varlog-parser/internal/redact"
+	"github.com/skormos/varlog-parser/internal/searchindex"
+	"github.com/skormos/varlog-parser/internal/tracing"
 )
 
-type config struct {
-	dirPath string
-	http    httpConfig
-}
+type (
+	flags struct {
+		configPath string
+		logPath    string
+		httpPort   int
+		set        map[string]bool
+	}
 
-type httpConfig struct {
-	port string
-}
+	// rateLimits are the limiters shared by every request. They are kept across reloads, with only their limits
+	// replaced, so the tokens each client has used and the scans in progress still count.
+	rateLimits struct {
+		clients *ratelimit.ClientLimiter
+		scans   *ratelimit.ConcurrencyLimiter
+	}
+)
 
-func parseFlags() config {
-	logPath := flag.String("logPath", "/var/log", "Tells the service where to look for requested files. Default is `/var/log`.")
+func parseFlags() flags {
+	configPath := flag.String("config", "", "Path to a YAML configuration file. Values in the file can be overridden by VARLOG_* environment variables, and then by the flags below.")
+	logPath := flag.String("logPath", "/var/log", "Tells the service where to look for requested files. This can be a directory, or a .tar, .tar.gz, .tgz or .zip archive. Replaces every root in the configuration file. Default is `/var/log`.")
 	httpPort := flag.Int("httpPort", 8080, "The port on which the http server will listen. Default is 8080.")
 
 	flag.Parse()
 
-	return config{
-		dirPath: *logPath,
-		http: httpConfig{
-			port: strconv.Itoa(*httpPort),
-		},
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	return flags{
+		configPath: *configPath,
+		logPath:    *logPath,
+		httpPort:   *httpPort,
+		set:        set,
+	}
+}
+
+// loadConfig reads the configuration file and environment, applies any flags that were explicitly set, then validates
+// the result.
+func loadConfig(f flags) (config.Config, error) {
+	cfg, err := config.Load(f.configPath, os.Environ())
+	if err != nil {
+		return config.Config{}, err
+	}
+
+	if f.set["logPath"] {
+		cfg.Roots = []config.Root{{Name: "default", Path: f.logPath}}
+	}
+	if f.set["httpPort"] {
+		cfg.HTTP.Port = f.httpPort
+	}
+
+	source := "defaults, environment and flags"
+	if f.configPath != "" {
+		source = f.configPath + ", environment and flags"
+	}
+
+	if err := cfg.Validate(source); err != nil {
+		return config.Config{}, err
+	}
+
+	return cfg, nil
+}
+
+func rootsFrom(cfg config.Config) []vlos.Root {
+	out := make([]vlos.Root, 0, len(cfg.Roots))
+	for _, root := range cfg.Roots {
+		out = append(out, vlos.Root{Name: root.Name, Path: root.Path})
+	}
+
+	return out
+}
+
+func limitsFrom(cfg config.Config) varlog.Limits {
+	return varlog.Limits{
+		DefaultLines:  cfg.Limits.DefaultLines,
+		MaxLines:      cfg.Limits.MaxLines,
+		ChunkSize:     cfg.Limits.ChunkSize,
+		MaxLineLength: cfg.Limits.MaxLineLength,
+		MaxScanBytes:  cfg.Limits.MaxScanBytes,
+		MaxScanTime:   cfg.Limits.MaxScanTime,
+	}
+}
+
+// handlerOptions returns the options for the log parser handler, leaving out the audit sink, metrics, cache, line index
+// and search index when they are disabled.
+func handlerOptions(
+	cfg config.Config,
+	policies *policy.Set,
+	redactor *redact.Redactor,
+	limits rateLimits,
+	sink *audit.FileSink,
+	recorder *metrics.Metrics,
+	lineIndex *lineindex.Store,
+	searchIndex *searchindex.Store,
+) []varlog.HandlerOption {
+	options := []varlog.HandlerOption{
+		varlog.WithLimits(limitsFrom(cfg)),
+		varlog.WithPolicies(policies),
+		varlog.WithRedactor(redactor),
+		varlog.WithConcurrencyLimit(limits.scans),
+	}
+
+	if sink != nil {
+		options = append(options, varlog.WithAudit(sink))
+	}
+	if recorder != nil {
+		options = append(options, varlog.WithRecorder(recorder))
+	}
+	if lineIndex != nil {
+		options = append(options, varlog.WithLineIndex(lineIndex))
+	}
+	if searchIndex != nil {
+		options = append(options, varlog.WithSearchIndex(searchIndex))
+	}
+	// the cache is replaced on every reload, as the roots, limits and redactions its results were read with may change.
+	if cfg.Cache.MaxBytes > 0 {
+		results := cache.NewLRU(cfg.Cache.MaxBytes, cache.WithMaxResultBytes(cfg.Cache.MaxResultBytes))
+		options = append(options, varlog.WithCache(results))
+	}
+
+	return options
+}
+
+func rateLimitsFrom(cfg config.Config) rateLimits {
+	return rateLimits{
+		clients: ratelimit.NewClientLimiter(cfg.RateLimit.RequestsPerSecond, cfg.RateLimit.Burst),
+		scans: ratelimit.NewConcurrencyLimiter(
+			cfg.RateLimit.MaxConcurrentScans,
+			cfg.RateLimit.MaxQueuedScans,
+			cfg.RateLimit.QueueTimeout,
+		),
+	}
+}
+
+// apply replaces the limits with the ones in the configuration.
+func (l rateLimits) apply(cfg config.Config) {
+	l.clients.SetLimit(cfg.RateLimit.RequestsPerSecond, cfg.RateLimit.Burst)
+	l.scans.SetLimits(cfg.RateLimit.MaxConcurrentScans, cfg.RateLimit.MaxQueuedScans, cfg.RateLimit.QueueTimeout)
+}
+
+// metricsFrom registers the metrics, or returns nil when they are disabled.
+func metricsFrom(cfg config.Config) *metrics.Metrics {
+	if !cfg.Metrics.Enabled {
+		return nil
+	}
+
+	return metrics.New(metrics.WithFileLabels(cfg.Metrics.FileLabels))
+}
+
+// compressorFrom returns the compressor for API responses, or nil when compression is disabled.
+func compressorFrom(cfg config.Config) *compression.Compressor {
+	if !cfg.HTTP.Compression.Enabled {
+		return nil
+	}
+
+	// the encodings have already been validated, so the error can be ignored.
+	compressor, _ := compression.NewCompressor(compression.WithEncodings(cfg.HTTP.Compression.Encodings...))
+	return compressor
+}
+
+// tracerProviderFrom creates the tracer provider for the configured exporter, or returns nil when tracing is disabled.
+func tracerProviderFrom(cfg config.Config) (*sdktrace.TracerProvider, error) {
+	options := []tracing.Option{
+		tracing.WithSampleRatio(cfg.Tracing.SampleRatio),
+		tracing.WithVersion(health.BuildVersion().Version),
+	}
+
+	switch cfg.Tracing.Exporter {
+	case config.TracingStdout:
+		options = append(options, tracing.WithStdout(os.Stdout))
+	case config.TracingOTLP:
+		options = append(options, tracing.WithOTLP(cfg.Tracing.Endpoint, cfg.Tracing.Insecure))
+	}
+
+	return tracing.NewProvider(context.Background(), options...)
+}
+
+// auditSinkFrom opens the audit file, or returns nil when the audit log is disabled.
+func auditSinkFrom(cfg config.Config) (*audit.FileSink, error) {
+	if cfg.Audit.File == "" {
+		return nil, nil
+	}
+
+	return audit.NewFileSink(
+		cfg.Audit.File,
+		audit.WithMaxSize(cfg.Audit.MaxSize),
+		audit.WithMaxBackups(cfg.Audit.MaxBackups),
+	)
+}
+
+// lineIndexFrom opens the line index directory, or returns nil when the line index is disabled.
+func lineIndexFrom(cfg config.Config) (*lineindex.Store, error) {
+	if cfg.LineIndex.Dir == "" {
+		return nil, nil
+	}
+
+	return lineindex.NewStore(cfg.LineIndex.Dir, lineindex.WithInterval(cfg.LineIndex.Interval))
+}
+
+// searchIndexFrom opens the search index directory, or returns nil when the search index is disabled.
+func searchIndexFrom(cfg config.Config) (*searchindex.Store, error) {
+	if cfg.SearchIndex.Dir == "" {
+		return nil, nil
+	}
+
+	return searchindex.NewStore(cfg.SearchIndex.Dir, searchindex.WithBlockSize(cfg.SearchIndex.BlockSize))
+}
+
+// indexerSourceFrom opens the roots for the search indexer, which are kept apart from the ones serving requests, so
+// either can be closed on reload once it is no longer in use.
+func indexerSourceFrom(cfg config.Config) (*vlos.Roots, error) {
+	return vlos.NewRoots(rootsFrom(cfg), vlos.WithMemberMemoryLimit(cfg.Limits.ArchiveMemory))
+}
+
+// indexerOptions returns the options for the search indexer.
+func indexerOptions(cfg config.Config) []searchindex.IndexerOption {
+	return []searchindex.IndexerOption{
+		searchindex.WithRoots(cfg.SearchIndex.Roots...),
+		searchindex.WithFiles(cfg.SearchIndex.Files...),
+		searchindex.WithPassInterval(cfg.SearchIndex.Interval),
 	}
 }
+
+// authenticatorFrom builds an authenticator with every enabled method, in the order API keys, JWTs, then client
+// certificates.
+func authenticatorFrom(cfg config.Config) (*auth.Authenticator, error) {
+	methods := make([]auth.Method, 0)
+
+	if len(cfg.Auth.APIKeys) > 0 {
+		apiKeys, err := apiKeysFrom(cfg.Auth.APIKeys)
+		if err != nil {
+			return nil, err
+		}
+		methods = append(methods, apiKeys)
+	}
+
+	if cfg.Auth.JWT.JWKSFile != "" {
+		verifier, err := auth.NewJWTVerifier(
+			cfg.Auth.JWT.JWKSFile,
+			auth.WithIssuer(cfg.Auth.JWT.Issuer),
+			auth.WithAudience(cfg.Auth.JWT.Audience),
+			auth.WithGroupsClaim(cfg.Auth.JWT.GroupsClaim),
+		)
+		if err != nil {
+			return nil, err
+		}
+		methods = append(methods, verifier)
+	}
+
+	if cfg.Auth.ClientCertificates {
+		methods = append(methods, auth.NewClientCertificates(http.ClientSubject))
+	}
+
+	return auth.NewAuthenticator(methods, auth.WithAnonymous(cfg.Auth.Anonymous)), nil
+}
+
+// adminAuthenticatorFrom builds the authenticator for the admin listener, which only accepts the admin API keys.
+func adminAuthenticatorFrom(cfg config.Config) (*auth.Authenticator, error) {
+	apiKeys, err := apiKeysFrom(cfg.Admin.APIKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	return auth.NewAuthenticator([]auth.Method{apiKeys}), nil
+}
+
+func apiKeysFrom(configured []config.APIKey) (*auth.APIKeys, error) {
+	keys := make([]auth.APIKey, 0, len(configured))
+	for _, key := range configured {
+		keys = append(keys, auth.APIKey{Name: key.Name, Hash: key.Hash, Groups: key.Groups})
+	}
+
+	return auth.NewAPIKeys(keys)
+}
+
+// adminServerOptions listens on the admin address, which is either a unix socket or a host and port. The other
+// timeouts are left at their defaults, which leave enough time to collect a profile.
+func adminServerOptions(cfg config.Config) []http.ServerOption {
+	options := []http.ServerOption{http.WithShutdownTimeout(cfg.HTTP.ShutdownTimeout)}
+
+	if path, ok := config.UnixSocketPath(cfg.Admin.Listen); ok {
+		return append(options, http.WithoutHostPort(), http.WithUnixSocket(http.UnixSocket{Path: path, Mode: 0600}))
+	}
+
+	// the address has already been validated, so the error can be ignored. A TCP address is served with the same TLS
+	// files as the main listener, so the admin keys are never sent in plain text when TLS is configured.
+	host, port, _ := net.SplitHostPort(cfg.Admin.Listen)
+	return append(append(options, http.WithHostPort(host, port)), tlsOptions(cfg)...)
+}
+
+func serverOptions(cfg config.Config) []http.ServerOption {
+	options := []http.ServerOption{
+		http.WithHostPort(cfg.HTTP.Host, strconv.Itoa(cfg.HTTP.Port)),
+		http.WithReadTimeout(cfg.HTTP.ReadTimeout),
+		http.WithReadHeaderTimeout(cfg.HTTP.ReadHeaderTimeout),
+		http.WithWriteTimeout(cfg.HTTP.WriteTimeout),
+		http.WithIdleTimeout(cfg.HTTP.IdleTimeout),
+		http.WithShutdownTimeout(cfg.HTTP.ShutdownTimeout),
+	}
+
+	options = append(options, tlsOptions(cfg)...)
+
+	return append(options, listenerOptions(cfg)...)
+}
+
+// tlsOptions serves the certificate, and verifies clients against the client CA, when TLS is configured.
+func tlsOptions(cfg config.Config) []http.ServerOption {
+	if !cfg.HTTP.TLSEnabled() {
+		return nil
+	}
+
+	options := []http.ServerOption{http.WithTLS(cfg.HTTP.TLS.CertFile, cfg.HTTP.TLS.KeyFile)}
+	if cfg.HTTP.TLS.ClientCAFile != "" {
+		options = append(options, http.WithClientCA(cfg.HTTP.TLS.ClientCAFile))
+	}
+
+	return options
+}
+
+// listenerOptions adds the unix sockets and systemd sockets to listen on. Port 0 only listens on those.
+func listenerOptions(cfg config.Config) []http.ServerOption {
+	var options []http.ServerOption
+
+	if cfg.HTTP.Port == 0 {
+		options = append(options, http.WithoutHostPort())
+	}
+
+	for _, socket := range cfg.HTTP.UnixSockets {
+		// the mode has already been validated, so the error can be ignored.
+		mode, _ := socket.FileMode()
+		options = append(options, http.WithUnixSocket(http.UnixSocket{
+			Path:  socket.Path,
+			Mode:  mode,
+			Owner: socket.Owner,
+			Group: socket.Group,
+		}))
+	}
+
+	if cfg.HTTP.Systemd {
+		options = append(options, http.WithSystemd())
+	}
+
+	return options
+}
@@ -3,14 +3,24 @@ package http
 
 import (
 	"context"
+	"errors"
 	"log"
 	"net"
 	"net/http"
+	"sync/atomic"
 	"time"
 
 	"github.com/rs/zerolog"
 )
 
+var (
+	// ErrStopping is returned by Check once the server has started to shut down.
+	ErrStopping = errors.New("server is shutting down")
+
+	// ErrNoListeners is returned by Start when there is nothing to listen on.
+	ErrNoListeners = errors.New("server has no listeners")
+)
+
 type (
 	// ServerOption defines the function signature for helper methods to update values on the wrapper.
 	ServerOption func(wrapper *ServerWrapper)
@@ -20,6 +30,13 @@ type (
 		logger          zerolog.Logger
 		server          *http.Server
 		shutdownTimeout time.Duration
+		tls             *tlsFiles
+		// tcp is set while the server listens on its host and port, which it does unless disabled.
+		tcp     bool
+		sockets []UnixSocket
+		systemd bool
+		// stopping is set to 1 once Stop has been called, and never reset.
+		stopping int32
 	}
 )
 
@@ -30,6 +47,28 @@ func WithHostPort(host, port string) ServerOption {
 	}
 }
 
+// WithoutHostPort stops the server from listening on its host and port, so it only listens on its unix sockets and the
+// sockets passed by systemd.
+func WithoutHostPort() ServerOption {
+	return func(wrapper *ServerWrapper) {
+		wrapper.tcp = false
+	}
+}
+
+// WithUnixSocket listens on the unix socket as well. It can be provided any number of times.
+func WithUnixSocket(socket UnixSocket) ServerOption {
+	return func(wrapper *ServerWrapper) {
+		wrapper.sockets = append(wrapper.sockets, socket)
+	}
+}
+
+// WithSystemd listens on every socket passed by systemd socket activation as well.
+func WithSystemd() ServerOption {
+	return func(wrapper *ServerWrapper) {
+		wrapper.systemd = true
+	}
+}
+
 // WithPort sets the port for the server to listen on, and an empty host string.
 func WithPort(port string) ServerOption {
 	return WithHostPort("", port)
@@ -42,6 +81,20 @@ func WithReadTimeout(timeout time.Duration) ServerOption {
 	}
 }
 
+// WithReadHeaderTimeout sets the ReadHeaderTimeout value on the underlying http.Server instance.
+func WithReadHeaderTimeout(timeout time.Duration) ServerOption {
+	return func(wrapper *ServerWrapper) {
+		wrapper.server.ReadHeaderTimeout = timeout
+	}
+}
+
+// WithIdleTimeout sets the IdleTimeout value on the underlying http.Server instance.
+func WithIdleTimeout(timeout time.Duration) ServerOption {
+	return func(wrapper *ServerWrapper) {
+		wrapper.server.IdleTimeout = timeout
+	}
+}
+
 // WithShutdownTimeout sets the time to wait to try and shutdown the underlying http.Server instance gracefully.
 func WithShutdownTimeout(timeout time.Duration) ServerOption {
 	return func(wrapper *ServerWrapper) {
@@ -69,8 +122,10 @@ func NewServerWrapper(logCtx zerolog.Context, rootHandler http.Handler, options
 			WriteTimeout:      120 * time.Second,
 			ReadHeaderTimeout: 10 * time.Second,
 			ErrorLog:          log.New(logger, "", log.LstdFlags),
+			ConnContext:       connContext,
 		},
 		shutdownTimeout: 60 * time.Second,
+		tcp:             true,
 	}
 
 	for _, optionFn := range options {
@@ -80,21 +135,112 @@ func NewServerWrapper(logCtx zerolog.Context, rootHandler http.Handler, options
 	return wrapper
 }
 
-// Start uses the provided options and defaults to start the http server. It will return an error IFF the error is not
-// http.ErrServerClosed.
+// Start uses the provided options and defaults to start the http server on every listener, and blocks until they have
+// all stopped. If any listener fails, the server is closed, and the error is returned. It will return an error IFF the
+// error is not http.ErrServerClosed.
 func (w *ServerWrapper) Start() error {
-	w.logger.Info().Msgf("starting http server at: %s", w.server.Addr)
-	if err := w.server.ListenAndServe(); err != nil {
-		if err != http.ErrServerClosed {
+	if w.tlsEnabled() {
+		if err := w.tls.load(); err != nil {
 			return err
 		}
+		w.server.TLSConfig = w.tls.config()
+	}
+
+	listeners, err := w.listen()
+	if err != nil {
+		return err
+	}
+
+	errs := make(chan error, len(listeners))
+	for _, listener := range listeners {
+		go func(listener net.Listener) {
+			errs <- w.serve(listener)
+		}(listener)
+	}
+
+	var firstErr error
+	for range listeners {
+		if err := <-errs; err != nil && err != http.ErrServerClosed && firstErr == nil {
+			firstErr = err
+			// the remaining listeners are closed as well, so the server is either fully up or fully down.
+			_ = w.server.Close()
+		}
+	}
+
+	return firstErr
+}
+
+func (w *ServerWrapper) serve(listener net.Listener) error {
+	if w.tlsEnabled() {
+		w.logger.Info().Msgf("starting https server at: %s", listenerName(listener))
+		return w.server.ServeTLS(listener, "", "")
+	}
+
+	w.logger.Info().Msgf("starting http server at: %s", listenerName(listener))
+	return w.server.Serve(listener)
+}
+
+// listen opens the host and port, every unix socket, and takes the sockets passed by systemd. When any of them can't
+// be opened, the ones already open are closed.
+func (w *ServerWrapper) listen() ([]net.Listener, error) {
+	listeners := make([]net.Listener, 0, len(w.sockets)+1)
+	closeAll := func() {
+		for _, listener := range listeners {
+			_ = listener.Close()
+		}
+	}
+
+	if w.tcp {
+		listener, err := net.Listen("tcp", w.server.Addr)
+		if err != nil {
+			return nil, err
+		}
+		listeners = append(listeners, listener)
+	}
+
+	for _, socket := range w.sockets {
+		listener, err := listenUnix(socket)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		listeners = append(listeners, listener)
+	}
+
+	if w.systemd {
+		activated, err := systemdListeners()
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		if len(activated) == 0 {
+			w.logger.Warn().Msg("systemd socket activation is enabled, but no sockets were passed")
+		}
+		listeners = append(listeners, activated...)
+	}
+
+	if len(listeners) == 0 {
+		return nil, ErrNoListeners
+	}
+
+	return listeners, nil
+}
+
+// Check returns ErrStopping once the server has started to shut down, so it can be reported as no longer ready while
+// the requests in flight complete.
+func (w *ServerWrapper) Check() error {
+	if atomic.LoadInt32(&w.stopping) != 0 {
+		return ErrStopping
 	}
 
 	return nil
 }
 
-// Stop attempts to gracefully stop the server, and if it passes the timeout will force close.
+// Stop attempts to gracefully stop the server, and if it passes the timeout will force close. The server reports it is
+// no longer ready from the moment Stop is called.
 func (w *ServerWrapper) Stop() {
+	atomic.StoreInt32(&w.stopping, 1)
+
 	ctx, cancel := context.WithTimeout(context.Background(), w.shutdownTimeout)
 	defer cancel()
 
@@ -0,0 +1,166 @@
+package http
+
+import (
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd socket activation.
+const listenFDsStart = 3
+
+// UnixSocket is a unix socket to listen on, along with who may connect to it. The owner and group are names or ids, and
+// are left as the user running the server when empty.
+type UnixSocket struct {
+	Path  string
+	Mode  fs.FileMode
+	Owner string
+	Group string
+}
+
+// listenUnix listens on the socket, then sets its mode and ownership. A socket left behind by a previous run is removed
+// first, but any other file at the path is left alone.
+func listenUnix(socket UnixSocket) (net.Listener, error) {
+	if info, err := os.Lstat(socket.Path); err == nil && info.Mode().Type() == fs.ModeSocket {
+		if err := os.Remove(socket.Path); err != nil {
+			return nil, fmt.Errorf("while removing the stale socket %s: %w", socket.Path, err)
+		}
+	}
+
+	listener, err := net.Listen("unix", socket.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := restrictSocket(socket); err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+
+	return listener, nil
+}
+
+func restrictSocket(socket UnixSocket) error {
+	if err := os.Chmod(socket.Path, socket.Mode); err != nil {
+		return fmt.Errorf("while setting the mode of the socket %s: %w", socket.Path, err)
+	}
+
+	if socket.Owner == "" && socket.Group == "" {
+		return nil
+	}
+
+	uid, err := lookupID(socket.Owner, func(name string) (string, error) {
+		owner, err := user.Lookup(name)
+		if err != nil {
+			return "", err
+		}
+		return owner.Uid, nil
+	})
+	if err != nil {
+		return fmt.Errorf("while looking up the owner of the socket %s: %w", socket.Path, err)
+	}
+
+	gid, err := lookupID(socket.Group, func(name string) (string, error) {
+		group, err := user.LookupGroup(name)
+		if err != nil {
+			return "", err
+		}
+		return group.Gid, nil
+	})
+	if err != nil {
+		return fmt.Errorf("while looking up the group of the socket %s: %w", socket.Path, err)
+	}
+
+	if err := os.Chown(socket.Path, uid, gid); err != nil {
+		return fmt.Errorf("while setting the owner of the socket %s: %w", socket.Path, err)
+	}
+
+	return nil
+}
+
+// lookupID returns the numeric id for the name, which may already be an id. An empty name is returned as -1, which
+// leaves the id unchanged.
+func lookupID(name string, lookup func(name string) (string, error)) (int, error) {
+	if name == "" {
+		return -1, nil
+	}
+
+	if id, err := strconv.Atoi(name); err == nil {
+		return id, nil
+	}
+
+	id, err := lookup(name)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(id)
+}
+
+// systemdListeners returns a listener for every socket passed by systemd socket activation, or none when the process
+// was not activated. The environment variables are unset once read, so they are not passed on to child processes.
+func systemdListeners() ([]net.Listener, error) {
+	return systemdListenersFrom(listenFDsStart)
+}
+
+// systemdListenersFrom returns the listeners passed by systemd, numbering the descriptors from the first.
+func systemdListenersFrom(firstFD int) ([]net.Listener, error) {
+	defer func() {
+		_ = os.Unsetenv("LISTEN_PID")
+		_ = os.Unsetenv("LISTEN_FDS")
+		_ = os.Unsetenv("LISTEN_FDNAMES")
+	}()
+
+	// the sockets are only meant for this process when the pid matches.
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count < 1 {
+		return nil, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	listeners := make([]net.Listener, 0, count)
+	for i := 0; i < count; i++ {
+		fd := firstFD + i
+		name := "systemd:" + strconv.Itoa(fd)
+		if i < len(names) && names[i] != "" {
+			name = "systemd:" + names[i]
+		}
+
+		// the listener holds a duplicate of the descriptor, so the file is closed either way.
+		file := os.NewFile(uintptr(fd), name)
+		listener, err := net.FileListener(file)
+		_ = file.Close()
+		if err != nil {
+			for _, opened := range listeners {
+				_ = opened.Close()
+			}
+			return nil, fmt.Errorf("while using the socket %s passed by systemd: %w", name, err)
+		}
+		listeners = append(listeners, namedListener{Listener: listener, name: name})
+	}
+
+	return listeners, nil
+}
+
+// namedListener names a listener passed by systemd, as its address alone does not say where it came from.
+type namedListener struct {
+	net.Listener
+	name string
+}
+
+// listenerName returns the name of the listener for logging, which is its address unless it was passed by systemd.
+func listenerName(listener net.Listener) string {
+	if named, ok := listener.(namedListener); ok {
+		return named.name + " (" + named.Addr().String() + ")"
+	}
+
+	return listener.Addr().Network() + ":" + listener.Addr().String()
+}
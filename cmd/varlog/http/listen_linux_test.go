@@ -0,0 +1,129 @@
+package http
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testFirstFD is where the test sockets are placed, well clear of any descriptor the test process opens itself.
+const testFirstFD = 500
+
+// passSockets places a listening socket at every descriptor from testFirstFD, the way systemd passes them.
+func passSockets(t *testing.T, count int) []string {
+	t.Helper()
+
+	addrs := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		file, err := listener.(*net.TCPListener).File()
+		require.NoError(t, err)
+		require.NoError(t, syscall.Dup3(int(file.Fd()), testFirstFD+i, syscall.O_CLOEXEC))
+		_ = file.Close()
+		_ = listener.Close()
+
+		addrs = append(addrs, listener.Addr().String())
+		fd := testFirstFD + i
+		t.Cleanup(func() { _ = syscall.Close(fd) })
+	}
+
+	return addrs
+}
+
+func TestSystemdListeners(t *testing.T) {
+	pid := strconv.Itoa(os.Getpid())
+
+	tests := map[string]struct {
+		pid           string
+		fds           string
+		names         string
+		expectedNames []string
+	}{
+		"Not activated": {},
+		"Sockets meant for another process are ignored": {
+			pid: strconv.Itoa(os.Getpid() + 1),
+			fds: "1",
+		},
+		"Invalid pid is ignored": {
+			pid: "systemd",
+			fds: "1",
+		},
+		"Count of 0 has no sockets": {
+			pid: pid,
+			fds: "0",
+		},
+		"Invalid count has no sockets": {
+			pid: pid,
+			fds: "many",
+		},
+		"Named sockets": {
+			pid:           pid,
+			fds:           "2",
+			names:         "api:admin",
+			expectedNames: []string{"systemd:api", "systemd:admin"},
+		},
+		"Missing names are numbered": {
+			pid:           pid,
+			fds:           "2",
+			expectedNames: []string{"systemd:" + strconv.Itoa(testFirstFD), "systemd:" + strconv.Itoa(testFirstFD+1)},
+		},
+		"Fewer names than sockets": {
+			pid:           pid,
+			fds:           "2",
+			names:         "api",
+			expectedNames: []string{"systemd:api", "systemd:" + strconv.Itoa(testFirstFD+1)},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			addrs := passSockets(tt, 2)
+			tt.Setenv("LISTEN_PID", test.pid)
+			tt.Setenv("LISTEN_FDS", test.fds)
+			tt.Setenv("LISTEN_FDNAMES", test.names)
+
+			listeners, err := systemdListenersFrom(testFirstFD)
+			require.NoError(tt, err)
+			defer func() {
+				for _, listener := range listeners {
+					_ = listener.Close()
+				}
+			}()
+
+			names := make([]string, 0, len(listeners))
+			for i, listener := range listeners {
+				names = append(names, listener.(namedListener).name)
+				assert.Equal(tt, names[i]+" ("+addrs[i]+")", listenerName(listener))
+			}
+			if test.expectedNames == nil {
+				assert.Empty(tt, names)
+			} else {
+				assert.Equal(tt, test.expectedNames, names)
+			}
+
+			// the variables are never passed on to child processes.
+			for _, variable := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+				_, set := os.LookupEnv(variable)
+				assert.False(tt, set, variable)
+			}
+		})
+	}
+}
+
+func TestSystemdListeners_NotASocket(t *testing.T) {
+	file, err := os.CreateTemp(t.TempDir(), "not-a-socket")
+	require.NoError(t, err)
+	require.NoError(t, syscall.Dup3(int(file.Fd()), testFirstFD, syscall.O_CLOEXEC))
+	_ = file.Close()
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "1")
+
+	_, err = systemdListenersFrom(testFirstFD)
+	assert.Error(t, err)
+}
@@ -0,0 +1,153 @@
+//go:build !windows
+
+package http
+
+import (
+	"errors"
+	"io/fs"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookupID(t *testing.T) {
+	tests := map[string]struct {
+		name        string
+		lookup      func(name string) (string, error)
+		expected    int
+		expectedErr bool
+	}{
+		"Empty name leaves the id unchanged": {
+			name:     "",
+			expected: -1,
+		},
+		"Numeric id is used as it is, without a lookup": {
+			name:     "1000",
+			expected: 1000,
+		},
+		"Name is looked up": {
+			name: "varlog",
+			lookup: func(name string) (string, error) {
+				return "42", nil
+			},
+			expected: 42,
+		},
+		"Unknown name is an error": {
+			name: "nobody-here",
+			lookup: func(name string) (string, error) {
+				return "", errors.New("unknown user " + name)
+			},
+			expectedErr: true,
+		},
+		"Looked up id that is not numeric is an error": {
+			name: "varlog",
+			lookup: func(string) (string, error) {
+				return "S-1-5-21", nil
+			},
+			expectedErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			lookup := test.lookup
+			if lookup == nil {
+				lookup = func(name string) (string, error) {
+					tt.Fatalf("%s was looked up", name)
+					return "", nil
+				}
+			}
+
+			id, err := lookupID(test.name, lookup)
+			if test.expectedErr {
+				assert.Error(tt, err)
+				return
+			}
+			require.NoError(tt, err)
+			assert.Equal(tt, test.expected, id)
+		})
+	}
+}
+
+func TestListenUnix(t *testing.T) {
+	current, err := user.Current()
+	require.NoError(t, err)
+	group, err := user.LookupGroupId(strconv.Itoa(os.Getgid()))
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		socket func(path string) UnixSocket
+	}{
+		"Mode only": {
+			socket: func(path string) UnixSocket {
+				return UnixSocket{Path: path, Mode: 0o600}
+			},
+		},
+		"Numeric owner and group": {
+			socket: func(path string) UnixSocket {
+				return UnixSocket{Path: path, Mode: 0o660, Owner: current.Uid, Group: group.Gid}
+			},
+		},
+		"Named owner and group": {
+			socket: func(path string) UnixSocket {
+				return UnixSocket{Path: path, Mode: 0o666, Owner: current.Username, Group: group.Name}
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			socket := test.socket(filepath.Join(tt.TempDir(), "v.sock"))
+			listener, err := listenUnix(socket)
+			require.NoError(tt, err)
+			defer func() { _ = listener.Close() }()
+
+			info, err := os.Stat(socket.Path)
+			require.NoError(tt, err)
+			assert.Equal(tt, fs.ModeSocket, info.Mode().Type())
+			assert.Equal(tt, socket.Mode, info.Mode().Perm())
+			stat := info.Sys().(*syscall.Stat_t)
+			assert.Equal(tt, uint32(os.Getuid()), stat.Uid)
+			assert.Equal(tt, uint32(os.Getgid()), stat.Gid)
+			assert.Equal(tt, "unix:"+socket.Path, listenerName(listener))
+		})
+	}
+}
+
+func TestListenUnix_ExistingFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	// a socket left behind by a previous run is replaced.
+	stalePath := filepath.Join(dir, "stale.sock")
+	stale, err := net.Listen("unix", stalePath)
+	require.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	require.NoError(t, stale.Close())
+
+	listener, err := listenUnix(UnixSocket{Path: stalePath, Mode: 0o600})
+	require.NoError(t, err)
+	require.NoError(t, listener.Close())
+
+	// any other file is left alone.
+	filePath := filepath.Join(dir, "file.sock")
+	require.NoError(t, os.WriteFile(filePath, []byte("keep"), 0o600))
+	_, err = listenUnix(UnixSocket{Path: filePath, Mode: 0o600})
+	assert.Error(t, err)
+	content, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, "keep", string(content))
+
+	// the listener is closed when the socket can't be given to its owner.
+	ownedPath := filepath.Join(dir, "owned.sock")
+	_, err = listenUnix(UnixSocket{Path: ownedPath, Mode: 0o600, Owner: "no-such-user-varlog"})
+	assert.Error(t, err)
+	_, err = net.Dial("unix", ownedPath)
+	assert.Error(t, err)
+}
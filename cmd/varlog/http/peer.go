@@ -0,0 +1,37 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+)
+
+type peerKey struct{}
+
+// connContext keeps the credentials of the process on the other end of a unix socket with the connection, as the
+// address of such a peer does not tell one from another.
+func connContext(ctx context.Context, conn net.Conn) context.Context {
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return ctx
+	}
+
+	credentials, ok := peerCredentials(unixConn)
+	if !ok {
+		return ctx
+	}
+
+	return context.WithValue(ctx, peerKey{}, credentials)
+}
+
+// PeerCredentials returns the user id of the process that made the request over a unix socket, as uid:<id>, and false
+// when the request was made over any other connection, or the credentials could not be read.
+func PeerCredentials(r *http.Request) (string, bool) {
+	credentials, ok := r.Context().Value(peerKey{}).(string)
+	return credentials, ok
+}
@@ -0,0 +1,27 @@
+package http
+
+import (
+	"net"
+	"strconv"
+	"syscall"
+)
+
+// peerCredentials reads the user id of the peer from the socket.
+func peerCredentials(conn *net.UnixConn) (string, bool) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return "", false
+	}
+
+	var (
+		credentials *syscall.Ucred
+		credErr     error
+	)
+	if err := raw.Control(func(fd uintptr) {
+		credentials, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	}); err != nil || credErr != nil {
+		return "", false
+	}
+
+	return "uid:" + strconv.FormatUint(uint64(credentials.Uid), 10), true
+}
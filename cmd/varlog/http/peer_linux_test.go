@@ -0,0 +1,53 @@
+package http
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeerCredentials(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "varlogd.sock")
+	listener, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		credentials, ok := PeerCredentials(r)
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = io.WriteString(w, credentials)
+	}))
+	require.NoError(t, server.Listener.Close())
+	server.Listener = listener
+	server.Config.ConnContext = connContext
+	server.Start()
+	t.Cleanup(server.Close)
+
+	c := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socketPath)
+		},
+	}}
+	resp, err := c.Get("http://varlogd/") //nolint:noctx // the request is never cancelled.
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "uid:"+strconv.Itoa(os.Getuid()), string(body))
+
+	// requests over any other connection have no peer credentials.
+	_, ok := PeerCredentials(httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.False(t, ok)
+}
@@ -0,0 +1,201 @@
+package http
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// tlsCheckInterval is how often the certificate files are checked for changes, at most, while serving handshakes.
+const tlsCheckInterval = time.Second
+
+// tlsFiles serves the certificate and client CAs loaded from their PEM files, and loads them again whenever one of the
+// files has been modified. If a modified file can't be loaded, the previous certificate and CAs keep being served.
+type tlsFiles struct {
+	logger        zerolog.Logger
+	certFile      string
+	keyFile       string
+	clientCAFiles []string
+
+	mu          sync.RWMutex
+	certificate *tls.Certificate
+	clientCAs   *x509.CertPool
+	modTimes    map[string]time.Time
+	lastCheck   time.Time
+}
+
+// WithTLS serves HTTPS using the PEM encoded certificate and key files. The files are loaded again when they change,
+// or when Reload is called, without restarting the server.
+func WithTLS(certFile, keyFile string) ServerOption {
+	return func(wrapper *ServerWrapper) {
+		wrapper.tlsFiles().certFile = certFile
+		wrapper.tlsFiles().keyFile = keyFile
+	}
+}
+
+// WithClientCA requires every client to present a certificate signed by one of the CAs in the provided PEM files. It
+// has no effect unless WithTLS has also been provided. The subject of the verified client certificate is available to
+// handlers through ClientSubject.
+func WithClientCA(caFiles ...string) ServerOption {
+	return func(wrapper *ServerWrapper) {
+		wrapper.tlsFiles().clientCAFiles = append(wrapper.tlsFiles().clientCAFiles, caFiles...)
+	}
+}
+
+// ClientSubject returns the subject of the certificate the client was verified with, and false when the request was
+// not made with a verified client certificate.
+func ClientSubject(r *http.Request) (pkix.Name, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return pkix.Name{}, false
+	}
+
+	return r.TLS.VerifiedChains[0][0].Subject, true
+}
+
+// tlsFiles returns the TLS files of the wrapper, creating them the first time a TLS option is applied.
+func (w *ServerWrapper) tlsFiles() *tlsFiles {
+	if w.tls == nil {
+		w.tls = &tlsFiles{logger: w.logger}
+	}
+
+	return w.tls
+}
+
+// Reload loads the certificate and client CA files again, even if they have not been modified. When any of them can't
+// be loaded, the error is returned and the previous certificate and CAs are kept.
+func (w *ServerWrapper) Reload() error {
+	if !w.tlsEnabled() {
+		return nil
+	}
+
+	return w.tls.load()
+}
+
+func (w *ServerWrapper) tlsEnabled() bool {
+	return w.tls != nil && w.tls.certFile != ""
+}
+
+// config returns the base TLS config for the server. The certificate is resolved on every handshake, and when client
+// certificates are required the whole config is, so the CAs in use are always the most recently loaded.
+func (t *tlsFiles) config() *tls.Config {
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: t.getCertificate,
+	}
+
+	if len(t.clientCAFiles) > 0 {
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+		config.GetConfigForClient = t.getConfigForClient
+	}
+
+	return config
+}
+
+func (t *tlsFiles) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	t.reloadIfModified()
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.certificate, nil
+}
+
+func (t *tlsFiles) getConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	t.reloadIfModified()
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{*t.certificate},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    t.clientCAs,
+		NextProtos:   []string{"h2", "http/1.1"},
+	}, nil
+}
+
+// reloadIfModified loads the files again when any of their modification times has changed since they were loaded.
+func (t *tlsFiles) reloadIfModified() {
+	t.mu.Lock()
+	if time.Since(t.lastCheck) < tlsCheckInterval {
+		t.mu.Unlock()
+		return
+	}
+	t.lastCheck = time.Now()
+	modified := t.modified()
+	t.mu.Unlock()
+
+	if !modified {
+		return
+	}
+
+	if err := t.load(); err != nil {
+		t.logger.Err(err).Msg("while reloading modified tls files, keeping the previous certificate")
+		return
+	}
+	t.logger.Info().Msg("reloaded modified tls files")
+}
+
+func (t *tlsFiles) modified() bool {
+	for _, filename := range t.files() {
+		info, err := os.Stat(filename)
+		if err != nil || !info.ModTime().Equal(t.modTimes[filename]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (t *tlsFiles) files() []string {
+	return append([]string{t.certFile, t.keyFile}, t.clientCAFiles...)
+}
+
+// load reads every file, and only replaces the certificate and CAs in use once all of them have been read.
+func (t *tlsFiles) load() error {
+	modTimes := make(map[string]time.Time)
+	for _, filename := range t.files() {
+		info, err := os.Stat(filename)
+		if err != nil {
+			return fmt.Errorf("while reading tls file %w", err)
+		}
+		modTimes[filename] = info.ModTime()
+	}
+
+	certificate, err := tls.LoadX509KeyPair(t.certFile, t.keyFile)
+	if err != nil {
+		return fmt.Errorf("while loading tls certificate %w", err)
+	}
+
+	var clientCAs *x509.CertPool
+	if len(t.clientCAFiles) > 0 {
+		clientCAs = x509.NewCertPool()
+		for _, filename := range t.clientCAFiles {
+			content, err := os.ReadFile(filename) //nolint:gosec // the CA path is provided by the operator.
+			if err != nil {
+				return fmt.Errorf("while reading client CA %w", err)
+			}
+			if !clientCAs.AppendCertsFromPEM(content) {
+				return fmt.Errorf("client CA file [%s] does not contain any PEM encoded certificates", filename)
+			}
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.certificate = &certificate
+	t.clientCAs = clientCAs
+	t.modTimes = modTimes
+	t.lastCheck = time.Now()
+
+	return nil
+}
@@ -0,0 +1,230 @@
+package http
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCert is a certificate and its key, both PEM encoded, along with the parsed certificate to sign others with.
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// newTestCert creates a certificate for the common name, signed by the parent, or self signed as a CA without one.
+func newTestCert(t *testing.T, commonName string, parent *testCert) *testCert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName, Organization: []string{"varlog"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func (c *testCert) keyPair(t *testing.T) tls.Certificate {
+	t.Helper()
+
+	pair, err := tls.X509KeyPair(c.certPEM, c.keyPEM)
+	require.NoError(t, err)
+	return pair
+}
+
+// writeFile writes the content, then sets the modification time, so a change can be told apart within a second.
+func writeFile(t *testing.T, path string, content []byte, modTime time.Time) {
+	t.Helper()
+
+	require.NoError(t, os.WriteFile(path, content, 0o600))
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+// startTLSServer serves the handler with the TLS config of the wrapper, the way ServerWrapper.Start does.
+func startTLSServer(t *testing.T, wrapper *ServerWrapper, handler http.Handler) *httptest.Server {
+	t.Helper()
+
+	require.NoError(t, wrapper.tls.load())
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	server := httptest.NewUnstartedServer(handler)
+	require.NoError(t, server.Listener.Close())
+	server.Listener = tls.NewListener(listener, wrapper.tls.config())
+	server.Start()
+	server.URL = "https://" + listener.Addr().String()
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// client trusts the CA, and presents the certificate when there is one. Every request is a new handshake.
+func client(t *testing.T, ca *testCert, cert *testCert) *http.Client {
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	config := &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}
+	if cert != nil {
+		config.Certificates = []tls.Certificate{cert.keyPair(t)}
+	}
+
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: config, DisableKeepAlives: true}}
+}
+
+// get returns the body of the response, and the common name of the certificate the server was verified with.
+func get(c *http.Client, url string) (string, string, error) {
+	resp, err := c.Get(url) //nolint:noctx // the request is never cancelled.
+	if err != nil {
+		return "", "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", "", err
+	}
+
+	return string(body), resp.TLS.PeerCertificates[0].Subject.CommonName, nil
+}
+
+func TestTLS_ReloadsModifiedCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "server.pem"), filepath.Join(dir, "server.key")
+	ca := newTestCert(t, "ca", nil)
+	first, second := newTestCert(t, "first", ca), newTestCert(t, "second", ca)
+
+	modTime := time.Now().Add(-time.Minute)
+	writeFile(t, certFile, first.certPEM, modTime)
+	writeFile(t, keyFile, first.keyPEM, modTime)
+
+	wrapper := NewServerWrapper(zerolog.Nop().With(), http.NotFoundHandler(), WithTLS(certFile, keyFile))
+	server := startTLSServer(t, wrapper, http.NotFoundHandler())
+	c := client(t, ca, nil)
+
+	_, served, err := get(c, server.URL)
+	require.NoError(t, err)
+	assert.Equal(t, "first", served)
+
+	// the rotated pair is only served once the modification time has changed, and the files are next checked.
+	writeFile(t, certFile, second.certPEM, modTime.Add(time.Second))
+	writeFile(t, keyFile, second.keyPEM, modTime.Add(time.Second))
+	wrapper.tls.mu.Lock()
+	wrapper.tls.lastCheck = time.Time{}
+	wrapper.tls.mu.Unlock()
+
+	_, served, err = get(c, server.URL)
+	require.NoError(t, err)
+	assert.Equal(t, "second", served)
+
+	// an unreadable pair keeps the previous certificate in place.
+	writeFile(t, keyFile, []byte("not a key"), modTime.Add(2*time.Second))
+	wrapper.tls.mu.Lock()
+	wrapper.tls.lastCheck = time.Time{}
+	wrapper.tls.mu.Unlock()
+
+	_, served, err = get(c, server.URL)
+	require.NoError(t, err)
+	assert.Equal(t, "second", served)
+	assert.Error(t, wrapper.Reload())
+}
+
+func TestTLS_ClientCA(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "server.pem"), filepath.Join(dir, "server.key"),
+		filepath.Join(dir, "clients.pem")
+	serverCA, firstCA, secondCA := newTestCert(t, "server ca", nil), newTestCert(t, "first ca", nil),
+		newTestCert(t, "second ca", nil)
+	serverCert := newTestCert(t, "server", serverCA)
+	firstClient, secondClient := newTestCert(t, "first client", firstCA), newTestCert(t, "second client", secondCA)
+
+	modTime := time.Now().Add(-time.Minute)
+	writeFile(t, certFile, serverCert.certPEM, modTime)
+	writeFile(t, keyFile, serverCert.keyPEM, modTime)
+	writeFile(t, caFile, firstCA.certPEM, modTime)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subject, ok := ClientSubject(r)
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = io.WriteString(w, subject.CommonName+"/"+subject.Organization[0])
+	})
+	wrapper := NewServerWrapper(zerolog.Nop().With(), handler, WithTLS(certFile, keyFile), WithClientCA(caFile))
+	server := startTLSServer(t, wrapper, handler)
+
+	// the subject of a verified client is available to handlers.
+	body, _, err := get(client(t, serverCA, firstClient), server.URL)
+	require.NoError(t, err)
+	assert.Equal(t, "first client/varlog", body)
+
+	// clients without a certificate, or with one from another CA, are refused during the handshake.
+	_, _, err = get(client(t, serverCA, nil), server.URL)
+	assert.Error(t, err)
+	_, _, err = get(client(t, serverCA, secondClient), server.URL)
+	assert.Error(t, err)
+
+	// Reload picks up a new CA, even when its modification time has not changed.
+	writeFile(t, caFile, secondCA.certPEM, modTime)
+	require.NoError(t, wrapper.Reload())
+
+	body, _, err = get(client(t, serverCA, secondClient), server.URL)
+	require.NoError(t, err)
+	assert.Equal(t, "second client/varlog", body)
+	_, _, err = get(client(t, serverCA, firstClient), server.URL)
+	assert.Error(t, err)
+}
+
+func TestClientSubject_WithoutTLS(t *testing.T) {
+	_, ok := ClientSubject(httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.False(t, ok)
+}
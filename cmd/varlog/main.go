@@ -1,11 +1,22 @@
 package main
 
 import (
+	"context"
 	stdos "os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/skormos/varlog-parser/internal/audit"
+	"github.com/skormos/varlog-parser/internal/auth"
+	"github.com/skormos/varlog-parser/internal/handler/admin"
+	"github.com/skormos/varlog-parser/internal/handler/health"
 	"github.com/skormos/varlog-parser/internal/handler/varlog"
+	"github.com/skormos/varlog-parser/internal/ratelimit"
 
 	"golang.org/x/sync/errgroup"
 
@@ -13,17 +24,65 @@ import (
 
 	"github.com/skormos/varlog-parser/cmd/varlog/http"
 	"github.com/skormos/varlog-parser/internal/os"
+	"github.com/skormos/varlog-parser/internal/searchindex"
 )
 
 func main() {
+	stdos.Exit(run())
+}
+
+// run starts the service and serves until it is shut down, returning the exit code of the process. Any error before
+// the service has started is a non-zero exit code, so a supervisor can tell a bad configuration from a shutdown.
+func run() (code int) {
 	mainLogger := stdoutLoggerContext("main").Logger()
-	defer recoverPanic(mainLogger)
+	defer recoverPanic(mainLogger, &code)
 
-	config := parseFlags()
+	cliFlags := parseFlags()
+	config, err := loadConfig(cliFlags)
+	if err != nil {
+		mainLogger.Err(err).Msg("loading configuration")
+		return 1
+	}
+
+	// the level has already been validated, so the error can be ignored.
+	level, _ := zerolog.ParseLevel(config.Logging.Level)
+	zerolog.SetGlobalLevel(level)
 
 	mainLogger.Info().Msg("started")
 
-	fileHandler, err := os.NewFileHandler(config.dirPath)
+	provider, err := tracerProviderFrom(config)
+	if err != nil {
+		mainLogger.Err(err).Msg("configuring tracing")
+		return 1
+	}
+	// the provider is only set when tracing is enabled, as a nil provider in the interface would not be nil.
+	var tracer trace.TracerProvider
+	if provider != nil {
+		otel.SetTracerProvider(provider)
+		tracer = provider
+		defer shutdownTracing(mainLogger, provider, config.HTTP.ShutdownTimeout)
+	}
+
+	authenticator, err := authenticatorFrom(config)
+	if err != nil {
+		mainLogger.Err(err).Msg("configuring authentication")
+		return 1
+	}
+
+	// the admin authenticator is created before anything is opened, so failing to create it leaves nothing to close.
+	var adminAuthenticator *auth.Authenticator
+	if config.Admin.Listen != "" {
+		if adminAuthenticator, err = adminAuthenticatorFrom(config); err != nil {
+			mainLogger.Err(err).Msg("configuring admin authentication")
+			return 1
+		}
+	}
+
+	// the policies and redactions have already been validated, so the error can be ignored.
+	policies, _ := config.PolicySet()
+	redactor, _ := config.Redactor()
+
+	roots, err := os.NewRoots(rootsFrom(config), os.WithMemberMemoryLimit(config.Limits.ArchiveMemory))
 	if err != nil {
 		mainLogger.Err(err).Msgf("registering file handler")
 		if pwd, err := stdos.Getwd(); err != nil {
@@ -31,23 +90,170 @@ func main() {
 		} else {
 			mainLogger.Info().Msgf("Present working directory: %s", pwd)
 		}
-		return
+		return 1
+	}
+	for _, root := range config.Roots {
+		mainLogger.Info().Msgf("file handler registered for log root %s: %s", root.Name, root.Path)
+	}
+
+	// closeOpened closes what has been opened so far, when the service fails to start.
+	var (
+		auditSink     *audit.FileSink
+		indexerSource *os.Roots
+	)
+	closeOpened := func() {
+		_ = roots.Close()
+		if auditSink != nil {
+			_ = auditSink.Close()
+		}
+		if indexerSource != nil {
+			_ = indexerSource.Close()
+		}
+	}
+
+	if auditSink, err = auditSinkFrom(config); err != nil {
+		mainLogger.Err(err).Msg("opening the audit log")
+		closeOpened()
+		return 1
+	}
+
+	lineIndex, err := lineIndexFrom(config)
+	if err != nil {
+		mainLogger.Err(err).Msg("opening the line index")
+		closeOpened()
+		return 1
+	}
+
+	searchIndex, err := searchIndexFrom(config)
+	if err != nil {
+		mainLogger.Err(err).Msg("opening the search index")
+		closeOpened()
+		return 1
+	}
+	// the indexer is only created when the search index is enabled, and reads the files through roots of its own.
+	var indexer *searchindex.Indexer
+	if searchIndex != nil {
+		if indexerSource, err = indexerSourceFrom(config); err != nil {
+			mainLogger.Err(err).Msg("opening the log roots for the search index")
+			closeOpened()
+			return 1
+		}
+		indexer = searchindex.NewIndexer(stdoutLoggerContext("indexer"), searchIndex, indexerSource,
+			indexerOptions(config)...)
 	}
-	mainLogger.Info().Msgf("file handler registered for directory: %s", config.dirPath)
 
 	httpLogContext := stdoutLoggerContext("http")
 
-	httpHandler := rootHandler(apiHandler(varlog.NewHandler(httpLogContext, fileHandler)))
-	server := http.NewServerWrapper(httpLogContext, httpHandler, http.WithPort(config.http.port))
+	limits := rateLimitsFrom(config)
+	recorder := metricsFrom(config)
+	parser := varlog.NewLogParserHandler(
+		httpLogContext,
+		roots,
+		handlerOptions(config, policies, redactor, limits, auditSink, recorder, lineIndex, searchIndex)...,
+	)
+	authn := auth.NewMiddleware(authenticator, varlog.RespondUnauthorized)
+	adminOptions := []admin.Option{
+		admin.WithRateLimiter(limits.clients),
+		admin.WithConcurrencyLimiter(limits.scans),
+		admin.WithConfig(config),
+	}
+	if indexer != nil {
+		adminOptions = append(adminOptions, admin.WithSearchIndex(indexer))
+	}
+	adminHandler := admin.NewHandler(httpLogContext, config.Admin.Groups, adminOptions...)
+	// the server can only be created once its handler has been, so the check reads the server when a probe arrives.
+	var server *http.ServerWrapper
+	healthHandler := health.NewHandler(
+		httpLogContext,
+		health.WithCheck("server", func() error { return server.Check() }),
+		health.WithCheck("roots", parser.Check),
+	)
+	httpHandler := rootHandler(
+		httpLogContext,
+		authn,
+		limits.clients,
+		ratelimit.ClientKeyWithPeer(http.PeerCredentials),
+		recorder,
+		tracer,
+		healthHandler,
+		parser.Audit,
+		apiHandler(compressorFrom(config), varlog.NewHandler(httpLogContext, parser)),
+		adminHandler.Routes(),
+	)
+	server = http.NewServerWrapper(httpLogContext, httpHandler, serverOptions(config)...)
+
+	// the admin listener is only started when it is configured, and keeps its own authentication.
+	var (
+		adminAuthn  *auth.Middleware
+		adminServer *http.ServerWrapper
+	)
+	if adminAuthenticator != nil {
+		adminLogContext := stdoutLoggerContext("admin")
+		adminAuthn = auth.NewMiddleware(adminAuthenticator, varlog.RespondUnauthorized)
+		adminServer = http.NewServerWrapper(
+			adminLogContext,
+			adminRootHandler(adminLogContext, adminAuthn, adminHandler.DebugRoutes()),
+			adminServerOptions(config)...,
+		)
+	}
+
+	reloads := newReloader(
+		mainLogger, cliFlags, parser, authn, adminAuthn, adminHandler, limits, recorder, server, adminServer, config,
+		auditSink, lineIndex, searchIndex, indexer, indexerSource,
+	)
 
+	// the roots and audit log are replaced on every reload, so the ones to close are whichever are in use on shutdown.
+	// The indexer has stopped by then, as it stops before the wait for every goroutine ends.
+	defer func() {
+		if current, ok := parser.Reload(nil).(*os.Roots); ok {
+			if err := current.Close(); err != nil {
+				mainLogger.Err(err).Msg("while closing the log roots")
+			}
+		}
+		reloads.closeAuditSink()
+		reloads.closeIndexerSource()
+	}()
+
+	done := make(chan struct{})
 	grp := new(errgroup.Group)
-	grp.Go(onShutdown(mainLogger, server.Stop))
+	grp.Go(onShutdown(mainLogger, func() {
+		close(done)
+		server.Stop()
+		if adminServer != nil {
+			adminServer.Stop()
+		}
+	}))
+	grp.Go(onReload(reloads, done))
 	grp.Go(server.Start)
+	if indexer != nil {
+		grp.Go(func() error { return indexer.Run(done) })
+	}
+	if adminServer != nil {
+		// the service is still useful without the admin listener, so failing to start it does not stop the service.
+		grp.Go(func() error {
+			if err := adminServer.Start(); err != nil {
+				mainLogger.Err(err).Msg("could not start the admin listener")
+			}
+			return nil
+		})
+	}
 
 	if err := grp.Wait(); err != nil {
 		mainLogger.Err(err).Msgf("unexpected shutdown")
-	} else {
-		mainLogger.Info().Msg("Successfully completed shutdown")
+		return 1
+	}
+
+	mainLogger.Info().Msg("Successfully completed shutdown")
+	return 0
+}
+
+// shutdownTracing exports the spans the provider still holds, giving up once the timeout has passed.
+func shutdownTracing(logger zerolog.Logger, provider *sdktrace.TracerProvider, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := provider.Shutdown(ctx); err != nil {
+		logger.Err(err).Msg("while exporting the remaining spans")
 	}
 }
 
@@ -70,12 +276,14 @@ func onShutdown(logger zerolog.Logger, shutdownFn func()) func() error {
 
 func signalShutdown() chan stdos.Signal {
 	shutdown := make(chan stdos.Signal, 1)
-	signal.Notify(shutdown, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	signal.Notify(shutdown, syscall.SIGINT, syscall.SIGTERM)
 	return shutdown
 }
 
-func recoverPanic(logger zerolog.Logger) {
+// recoverPanic logs the panic, if there is one, and sets the exit code to report it.
+func recoverPanic(logger zerolog.Logger, code *int) {
 	if r := recover(); r != nil {
 		logger.Error().Msgf("Main Recovered from Panic: %v", r)
+		*code = 1
 	}
 }
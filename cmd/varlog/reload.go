@@ -0,0 +1,258 @@
+package main
+
+import (
+	stdos "os"
+	"os/signal"
+	"reflect"
+	"syscall"
+
+	"github.com/rs/zerolog"
+
+	"github.com/skormos/varlog-parser/cmd/varlog/http"
+	"github.com/skormos/varlog-parser/internal/audit"
+	"github.com/skormos/varlog-parser/internal/auth"
+	"github.com/skormos/varlog-parser/internal/config"
+	"github.com/skormos/varlog-parser/internal/handler/admin"
+	"github.com/skormos/varlog-parser/internal/handler/varlog"
+	"github.com/skormos/varlog-parser/internal/lineindex"
+	"github.com/skormos/varlog-parser/internal/metrics"
+	"github.com/skormos/varlog-parser/internal/os"
+	"github.com/skormos/varlog-parser/internal/searchindex"
+)
+
+// reloader re-reads the configuration, and swaps the values that can change without a restart into the running
+// handlers. The TLS certificate files are read again as well. Values that can only be applied on startup, like the
+// listening port, are reported but otherwise ignored.
+type reloader struct {
+	logger zerolog.Logger
+	flags  flags
+	parser *varlog.LogParserHandler
+	authn  *auth.Middleware
+	// adminAuthn authenticates the admin listener, and is nil when there is none.
+	adminAuthn *auth.Middleware
+	admin      *admin.Handler
+	limits     rateLimits
+	metrics    *metrics.Metrics
+	server     *http.ServerWrapper
+	// adminServer serves the admin listener, and is nil when there is none.
+	adminServer *http.ServerWrapper
+	current     config.Config
+	// auditSink is the audit log in use, which is only replaced when the audit configuration changes.
+	auditSink *audit.FileSink
+	// lineIndex is the line index in use, which is only replaced when the line index configuration changes, so only a
+	// single store writes to its directory.
+	lineIndex *lineindex.Store
+	// searchIndex is the search index in use, which is only replaced on restart, and is nil when it is disabled.
+	searchIndex *searchindex.Store
+	// indexer keeps the search index up to date, and is nil when the search index is disabled. Its source is replaced
+	// on every reload, like the roots of the parser.
+	indexer       *searchindex.Indexer
+	indexerSource *os.Roots
+}
+
+func newReloader(
+	logger zerolog.Logger,
+	f flags,
+	parser *varlog.LogParserHandler,
+	authn *auth.Middleware,
+	adminAuthn *auth.Middleware,
+	adminHandler *admin.Handler,
+	limits rateLimits,
+	recorder *metrics.Metrics,
+	server *http.ServerWrapper,
+	adminServer *http.ServerWrapper,
+	current config.Config,
+	auditSink *audit.FileSink,
+	lineIndex *lineindex.Store,
+	searchIndex *searchindex.Store,
+	indexer *searchindex.Indexer,
+	indexerSource *os.Roots,
+) *reloader {
+	return &reloader{
+		logger:        logger,
+		flags:         f,
+		parser:        parser,
+		authn:         authn,
+		adminAuthn:    adminAuthn,
+		admin:         adminHandler,
+		limits:        limits,
+		metrics:       recorder,
+		server:        server,
+		adminServer:   adminServer,
+		current:       current,
+		auditSink:     auditSink,
+		lineIndex:     lineIndex,
+		searchIndex:   searchIndex,
+		indexer:       indexer,
+		indexerSource: indexerSource,
+	}
+}
+
+// reload applies the configuration as it is now. If the configuration is invalid, or any root can't be opened, the
+// previous configuration stays in place and the error is returned.
+func (r *reloader) reload() error {
+	cfg, err := loadConfig(r.flags)
+	if err != nil {
+		return err
+	}
+
+	authenticator, err := authenticatorFrom(cfg)
+	if err != nil {
+		return err
+	}
+
+	var adminAuthenticator *auth.Authenticator
+	if r.adminAuthn != nil && cfg.Admin.Listen != "" {
+		if adminAuthenticator, err = adminAuthenticatorFrom(cfg); err != nil {
+			return err
+		}
+	}
+
+	// the policies and redactions have already been validated, so the error can be ignored.
+	policies, _ := cfg.PolicySet()
+	redactor, _ := cfg.Redactor()
+
+	roots, err := os.NewRoots(rootsFrom(cfg), os.WithMemberMemoryLimit(cfg.Limits.ArchiveMemory))
+	if err != nil {
+		return err
+	}
+
+	auditSink := r.auditSink
+	if cfg.Audit != r.current.Audit {
+		if auditSink, err = auditSinkFrom(cfg); err != nil {
+			_ = roots.Close()
+			return err
+		}
+	}
+
+	lineIndex := r.lineIndex
+	if cfg.LineIndex != r.current.LineIndex {
+		if lineIndex, err = lineIndexFrom(cfg); err != nil {
+			_ = roots.Close()
+			if auditSink != nil && auditSink != r.auditSink {
+				_ = auditSink.Close()
+			}
+			return err
+		}
+	}
+
+	var indexerSource *os.Roots
+	if r.indexer != nil {
+		if indexerSource, err = indexerSourceFrom(cfg); err != nil {
+			_ = roots.Close()
+			if auditSink != nil && auditSink != r.auditSink {
+				_ = auditSink.Close()
+			}
+			return err
+		}
+	}
+
+	// the level has already been validated, so the error can be ignored.
+	level, _ := zerolog.ParseLevel(cfg.Logging.Level)
+	zerolog.SetGlobalLevel(level)
+
+	r.authn.Reload(authenticator)
+	if adminAuthenticator != nil {
+		r.adminAuthn.Reload(adminAuthenticator)
+	}
+	r.admin.SetGroups(cfg.Admin.Groups)
+	r.admin.SetConfig(cfg)
+	r.limits.apply(cfg)
+	previous := r.parser.Reload(roots, handlerOptions(
+		cfg, policies, redactor, r.limits, auditSink, r.metrics, lineIndex, r.searchIndex,
+	)...)
+	if closer, ok := previous.(*os.Roots); ok {
+		if err := closer.Close(); err != nil {
+			r.logger.Err(err).Msg("while closing the previous log roots")
+		}
+	}
+	if auditSink != r.auditSink {
+		r.closeAuditSink()
+		r.auditSink = auditSink
+	}
+	r.lineIndex = lineIndex
+	if r.indexer != nil {
+		// the previous source is returned once the pass using it has stopped, so it is safe to close.
+		r.indexer.Reload(indexerSource, indexerOptions(cfg)...)
+		r.closeIndexerSource()
+		r.indexerSource = indexerSource
+	}
+
+	if err := r.server.Reload(); err != nil {
+		r.logger.Err(err).Msg("while reloading tls files, keeping the previous certificate")
+	}
+	if r.adminServer != nil {
+		if err := r.adminServer.Reload(); err != nil {
+			r.logger.Err(err).Msg("while reloading tls files for the admin listener, keeping the previous certificate")
+		}
+	}
+
+	if !reflect.DeepEqual(cfg.HTTP, r.current.HTTP) {
+		r.logger.Warn().Msg("http configuration has changed, but is only applied on restart")
+	}
+	if cfg.Metrics != r.current.Metrics {
+		r.logger.Warn().Msg("metrics configuration has changed, but is only applied on restart")
+	}
+	if cfg.Admin.Listen != r.current.Admin.Listen {
+		r.logger.Warn().Msg("admin listener has changed, but is only applied on restart")
+	}
+	if cfg.SearchIndex.Dir != r.current.SearchIndex.Dir ||
+		cfg.SearchIndex.BlockSize != r.current.SearchIndex.BlockSize {
+		r.logger.Warn().Msg("search index directory or block size has changed, but is only applied on restart")
+	}
+	if cfg.Tracing != r.current.Tracing {
+		r.logger.Warn().Msg("tracing configuration has changed, but is only applied on restart")
+	}
+	r.current = cfg
+
+	for _, root := range cfg.Roots {
+		r.logger.Info().Msgf("file handler registered for log root %s: %s", root.Name, root.Path)
+	}
+
+	return nil
+}
+
+// closeAuditSink closes the audit log in use, if there is one.
+func (r *reloader) closeAuditSink() {
+	if r.auditSink == nil {
+		return
+	}
+
+	if err := r.auditSink.Close(); err != nil {
+		r.logger.Err(err).Msg("while closing the audit log")
+	}
+}
+
+// closeIndexerSource closes the roots of the search indexer, if there are any.
+func (r *reloader) closeIndexerSource() {
+	if r.indexerSource == nil {
+		return
+	}
+
+	if err := r.indexerSource.Close(); err != nil {
+		r.logger.Err(err).Msg("while closing the log roots of the search index")
+	}
+}
+
+// onReload reloads the configuration every time a SIGHUP is received, until the done channel is closed.
+func onReload(r *reloader, done <-chan struct{}) func() error {
+	return func() error {
+		reloadChan := make(chan stdos.Signal, 1)
+		signal.Notify(reloadChan, syscall.SIGHUP)
+		defer signal.Stop(reloadChan)
+
+		for {
+			select {
+			case <-reloadChan:
+				r.logger.Info().Msg("configuration reload requested...")
+				if err := r.reload(); err != nil {
+					r.logger.Err(err).Msg("configuration reload failed, keeping the previous configuration")
+				} else {
+					r.logger.Info().Msg("configuration reload completed successfully")
+				}
+			case <-done:
+				return nil
+			}
+		}
+	}
+}
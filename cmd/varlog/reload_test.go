@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	vlhttp "github.com/skormos/varlog-parser/cmd/varlog/http"
+	"github.com/skormos/varlog-parser/internal/auth"
+	"github.com/skormos/varlog-parser/internal/handler/admin"
+	"github.com/skormos/varlog-parser/internal/handler/varlog"
+	vlos "github.com/skormos/varlog-parser/internal/os"
+)
+
+// rootConfig returns a configuration serving the directory from a root named system, without authentication.
+func rootConfig(dir string) string {
+	return "roots:\n  - name: system\n    path: " + dir + "\nauth:\n  anonymous: true\nmetrics:\n  enabled: false\n"
+}
+
+// newTestReloader starts the handlers from the configuration file the way main does, and returns the reloader and
+// the API they serve.
+func newTestReloader(t *testing.T, path string) (*reloader, http.Handler) {
+	t.Helper()
+
+	f := flags{configPath: path, set: map[string]bool{}}
+	cfg, err := loadConfig(f)
+	require.NoError(t, err)
+	authenticator, err := authenticatorFrom(cfg)
+	require.NoError(t, err)
+	roots, err := vlos.NewRoots(rootsFrom(cfg))
+	require.NoError(t, err)
+
+	policies, _ := cfg.PolicySet()
+	redactor, _ := cfg.Redactor()
+	limits := rateLimitsFrom(cfg)
+	logCtx := zerolog.Nop().With()
+	parser := varlog.NewLogParserHandler(logCtx, roots,
+		handlerOptions(cfg, policies, redactor, limits, nil, nil, nil, nil)...)
+	authn := auth.NewMiddleware(authenticator, varlog.RespondUnauthorized)
+	api := authn.Handler(varlog.NewHandler(logCtx, parser))
+	server := vlhttp.NewServerWrapper(logCtx, api, serverOptions(cfg)...)
+
+	reloads := newReloader(zerolog.Nop(), f, parser, authn, nil, admin.NewHandler(logCtx, nil), limits, nil, server,
+		nil, cfg, nil, nil, nil, nil, nil)
+	t.Cleanup(func() {
+		if current, ok := parser.Reload(nil).(*vlos.Roots); ok {
+			_ = current.Close()
+		}
+	})
+
+	return reloads, api
+}
+
+func TestReloader_Reload(t *testing.T) {
+	first, second := t.TempDir(), t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(first, "syslog"), []byte("first root\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(second, "syslog"), []byte("second root\n"), 0o600))
+
+	path := filepath.Join(t.TempDir(), "varlogd.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(rootConfig(first)), 0o600))
+	reloads, api := newTestReloader(t, path)
+
+	get := func(tt *testing.T) string {
+		r := httptest.NewRequest(http.MethodGet, "/syslog", nil)
+		r.Header.Set("Accept", "text/plain")
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, r)
+		require.Equal(tt, http.StatusOK, w.Code)
+		return w.Body.String()
+	}
+
+	tests := map[string]struct {
+		content string
+	}{
+		"File that can't be parsed": {
+			content: "roots: [",
+		},
+		"Unknown key": {
+			content: rootConfig(second) + "http:\n  prot: 8080\n",
+		},
+		"Configuration that doesn't validate": {
+			content: rootConfig(filepath.Join(second, "missing")),
+		},
+		"Configuration without authentication": {
+			content: "roots:\n  - name: system\n    path: " + second + "\nmetrics:\n  enabled: false\n",
+		},
+	}
+
+	// an invalid file is refused, and the running configuration keeps serving requests.
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			require.NoError(tt, os.WriteFile(path, []byte(test.content), 0o600))
+
+			assert.Error(tt, reloads.reload())
+			assert.Equal(tt, first, reloads.current.Roots[0].Path)
+			assert.Equal(tt, "first root\n", get(tt))
+		})
+	}
+
+	// a valid file is applied to the requests that follow.
+	require.NoError(t, os.WriteFile(path, []byte(rootConfig(second)), 0o600))
+	require.NoError(t, reloads.reload())
+	assert.Equal(t, second, reloads.current.Roots[0].Path)
+	assert.Equal(t, "second root\n", get(t))
+}
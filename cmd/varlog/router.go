@@ -4,18 +4,77 @@ import (
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/hlog"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/skormos/varlog-parser/internal/accesslog"
+	"github.com/skormos/varlog-parser/internal/auth"
+	"github.com/skormos/varlog-parser/internal/compression"
+	"github.com/skormos/varlog-parser/internal/handler/health"
+	"github.com/skormos/varlog-parser/internal/handler/varlog"
+	"github.com/skormos/varlog-parser/internal/metrics"
+	"github.com/skormos/varlog-parser/internal/ratelimit"
+	"github.com/skormos/varlog-parser/internal/tracing"
 )
 
-func rootHandler(api http.Handler) chi.Router {
+// rootHandler assigns every request an ID and logs it once it has been served, authenticates every request, and rate
+// limits the API by the client key. Every API request is audited, including those refused by the authentication or
+// the rate limit, so the audit is mounted before either of them. The admin endpoints are left out of the rate limit,
+// so the usage of a client can still be checked while it's being refused. The health endpoints are served without
+// authentication, so they can be used by probes. When tracing is enabled, every request is traced. When metrics are
+// enabled, every request is measured, and the metrics are served without authentication so they can be scraped.
+func rootHandler(
+	logCtx zerolog.Context,
+	authn *auth.Middleware,
+	clients *ratelimit.ClientLimiter,
+	clientKey ratelimit.KeyFunc,
+	recorder *metrics.Metrics,
+	tracer trace.TracerProvider,
+	probes *health.Handler,
+	audit func(http.Handler) http.Handler,
+	api http.Handler,
+	admin http.Handler,
+) chi.Router {
 	handler := chi.NewRouter()
+	handler.Use(hlog.NewHandler(logCtx.Logger()), accesslog.RequestID)
+	if tracer != nil {
+		handler.Use(tracing.Middleware(tracer))
+	}
+	handler.Use(accesslog.Handler)
+	if recorder != nil {
+		handler.Use(recorder.Middleware)
+		handler.Handle("/metrics", recorder.Handler())
+	}
+	probes.Register(handler)
+
+	handler.With(
+		audit,
+		authn.Handler,
+		varlog.AuditPrincipal,
+		clients.Middleware(clientKey, varlog.RespondRateLimited),
+	).Mount("/api", api)
+	handler.With(authn.Handler).Mount("/admin", admin)
+
+	return handler
+}
 
-	handler.Mount("/api", api)
+// adminRootHandler serves the admin listener, which authenticates every request with its own keys, and logs every
+// request like the main listener.
+func adminRootHandler(logCtx zerolog.Context, authn *auth.Middleware, debug http.Handler) chi.Router {
+	handler := chi.NewRouter()
+	handler.Use(hlog.NewHandler(logCtx.Logger()), accesslog.RequestID, accesslog.Handler, authn.Handler)
+	handler.Mount("/", debug)
 
 	return handler
 }
 
-func apiHandler(varlog http.Handler) chi.Router {
+// apiHandler compresses every API response the client accepts compressed, unless compression is disabled.
+func apiHandler(compressor *compression.Compressor, varlog http.Handler) chi.Router {
 	handler := chi.NewRouter()
+	if compressor != nil {
+		handler.Use(compressor.Middleware)
+	}
 
 	handler.Mount("/varlog", varlog)
 
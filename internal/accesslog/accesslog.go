@@ -0,0 +1,28 @@
+package accesslog
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/hlog"
+)
+
+// Handler logs a line for every request once the response has been written, with the method, path, status, bytes
+// written and duration. The line is written with the request logger, so it includes the fields added while serving
+// the request, like the request ID and the principal.
+func Handler(next http.Handler) http.Handler {
+	return hlog.AccessHandler(func(r *http.Request, status, size int, duration time.Duration) {
+		// a handler that never writes the header responds with 200 OK.
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		hlog.FromRequest(r).Info().
+			Str("method", r.Method).
+			Str("path", r.URL.Path).
+			Int("status", status).
+			Int("bytes", size).
+			Int64("durationMs", duration.Milliseconds()).
+			Msg("request completed")
+	})(next)
+}
@@ -0,0 +1,87 @@
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/hlog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestID(t *testing.T) {
+	tests := map[string]struct {
+		header     string
+		propagated bool
+	}{
+		"Provided ID is propagated": {
+			header:     "4f6c2a1e-upstream",
+			propagated: true,
+		},
+		"Missing ID is assigned": {},
+		"ID with spaces is replaced": {
+			header: "not a valid id",
+		},
+		"Overlong ID is replaced": {
+			header: strings.Repeat("a", maxRequestIDLength+1),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			var fromContext string
+			handler := RequestID(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				fromContext, _ = RequestIDFrom(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/api/varlog/", nil)
+			if test.header != "" {
+				req.Header.Set(RequestIDHeader, test.header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			returned := rec.Header().Get(RequestIDHeader)
+			require.NotEmpty(tt, returned)
+			assert.Equal(tt, returned, fromContext)
+			if test.propagated {
+				assert.Equal(tt, test.header, returned)
+			} else {
+				assert.NotEqual(tt, test.header, returned)
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	out := &bytes.Buffer{}
+	logger := zerolog.New(out)
+
+	handler := hlog.NewHandler(logger)(RequestID(Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		zerolog.Ctx(r.Context()).UpdateContext(func(c zerolog.Context) zerolog.Context {
+			return c.Str("principal", "alice")
+		})
+		w.WriteHeader(http.StatusTeapot)
+		_, _ = w.Write([]byte("short and stout"))
+	}))))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/varlog/syslog", nil)
+	req.Header.Set(RequestIDHeader, "req-1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	var line map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &line))
+
+	assert.Equal(t, "req-1", line["requestId"])
+	assert.Equal(t, "alice", line["principal"])
+	assert.Equal(t, http.MethodGet, line["method"])
+	assert.Equal(t, "/api/varlog/syslog", line["path"])
+	assert.EqualValues(t, http.StatusTeapot, line["status"])
+	assert.EqualValues(t, len("short and stout"), line["bytes"])
+	assert.Contains(t, line, "durationMs")
+}
@@ -0,0 +1,3 @@
+// Package accesslog assigns every request an ID, and logs a single structured line for it once the response has been
+// written. The ID is added to the request logger, so every line logged while serving the request can be correlated.
+package accesslog
@@ -4,33 +4,173 @@
 package v1
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/deepmap/oapi-codegen/pkg/runtime"
 	"github.com/go-chi/chi/v5"
 )
 
+const (
+	ApiKeyScopes = "apiKey.Scopes"
+	BearerScopes = "bearer.Scopes"
+)
+
+// Defines values for ProblemCode.
+const (
+	FileNotFound     ProblemCode = "file_not_found"
+	Forbidden        ProblemCode = "forbidden"
+	InternalError    ProblemCode = "internal_error"
+	InvalidFilter    ProblemCode = "invalid_filter"
+	InvalidParam     ProblemCode = "invalid_param"
+	NotAcceptable    ProblemCode = "not_acceptable"
+	Overloaded       ProblemCode = "overloaded"
+	PermissionDenied ProblemCode = "permission_denied"
+	RateLimited      ProblemCode = "rate_limited"
+	Unauthorized     ProblemCode = "unauthorized"
+)
+
+// FileInfo defines model for fileInfo.
+type FileInfo struct {
+	// The last time the file was modified.
+	Modified time.Time `json:"modified"`
+
+	// The name to use when requesting entries from this file.
+	Name string `json:"name"`
+
+	// The name of the configured log root the file belongs to.
+	Root string `json:"root"`
+
+	// The size of the file in bytes.
+	Size int64 `json:"size"`
+}
+
 // LogEntry defines model for logEntry.
 type LogEntry = string
 
+// An error response as described in RFC 7807. The `code` is stable across versions and is the value clients should use to tell kinds of errors apart.
+type Problem struct {
+	// The stable code for a kind of problem.
+	//
+	// - `file_not_found`: the requested file does not exist in the log root.
+	// - `unauthorized`: no valid credentials were provided with the request.
+	// - `forbidden`: a policy does not allow the caller to read the requested file.
+	// - `permission_denied`: the requested file exists, but cannot be read.
+	// - `invalid_param`: a parameter is malformed or out of range.
+	// - `invalid_filter`: the filter can never match an entry.
+	// - `not_acceptable`: none of the media types in the `Accept` header can be produced.
+	// - `rate_limited`: the caller has sent too many requests, and should retry after the `Retry-After` header.
+	// - `overloaded`: the server is busy reading other files, and the request should be retried after the `Retry-After` header.
+	// - `internal_error`: an unexpected error occurred on the server.
+	Code ProblemCode `json:"code"`
+
+	// A human-readable explanation specific to this occurrence of the problem.
+	Detail *string `json:"detail,omitempty"`
+
+	// The path of the request that produced the problem.
+	Instance *string `json:"instance,omitempty"`
+
+	// The name of the parameter that caused the problem, when the code is `invalid_param` or `invalid_filter`.
+	Param *string `json:"param,omitempty"`
+
+	// The name of the policy that denied the request, when the code is `forbidden`. It is `default` when no policy allows the request.
+	Policy *string `json:"policy,omitempty"`
+
+	// The HTTP status code of the response.
+	Status int `json:"status"`
+
+	// A short, human-readable summary of the kind of problem, which does not change between occurrences.
+	Title string `json:"title"`
+
+	// A URI reference that identifies the kind of problem. This is always `urn:varlog:problem:` followed by the code.
+	Type string `json:"type"`
+}
+
+// The stable code for a kind of problem.
+//
+// - `file_not_found`: the requested file does not exist in the log root.
+// - `unauthorized`: no valid credentials were provided with the request.
+// - `forbidden`: a policy does not allow the caller to read the requested file.
+// - `permission_denied`: the requested file exists, but cannot be read.
+// - `invalid_param`: a parameter is malformed or out of range.
+// - `invalid_filter`: the filter can never match an entry.
+// - `not_acceptable`: none of the media types in the `Accept` header can be produced.
+// - `rate_limited`: the caller has sent too many requests, and should retry after the `Retry-After` header.
+// - `overloaded`: the server is busy reading other files, and the request should be retried after the `Retry-After` header.
+// - `internal_error`: an unexpected error occurred on the server.
+type ProblemCode string
+
 // GetEntriesResponse defines model for GetEntriesResponse.
 type GetEntriesResponse struct {
+	// The value of the `cursor` parameter that continues the scan, only provided when the scan was truncated.
+	Cursor  *string    `json:"cursor,omitempty"`
 	Entries []LogEntry `json:"entries"`
+
+	// The number of values replaced by the redaction rules across every returned entry.
+	Redactions int `json:"redactions"`
+
+	// How fresh the search index of the file was, only provided when it was used to skip the blocks that could not contain the `filterByText` parameter.
+	SearchIndex *struct {
+		// When the index of the file last caught up with the complete blocks of the file, only provided once it has.
+		IndexedAt *time.Time `json:"indexedAt,omitempty"`
+
+		// The number of bytes from the start of the file covered by the index.
+		IndexedBytes int64 `json:"indexedBytes"`
+
+		// The number of bytes at the end of the file that were not indexed yet, and were read in full.
+		UnindexedBytes int64 `json:"unindexedBytes"`
+	} `json:"searchIndex,omitempty"`
+
+	// Whether the scan stopped at the byte or time limit, before the start of the file or the requested number of entries was reached.
+	Truncated bool `json:"truncated"`
+}
+
+// ListFilesResponse defines model for ListFilesResponse.
+type ListFilesResponse struct {
+	Files []FileInfo `json:"files"`
 }
 
 // GetEntriesParams defines parameters for GetEntries.
 type GetEntriesParams struct {
+	// The name of the configured log root to read the file from. When not provided, the roots are searched in their configured order, and the first root containing the file is used.
+	Root *string `form:"root,omitempty" json:"root,omitempty"`
+
 	// The number of entries to return from the specified file name. When used with the `filterByText` parameter, the results will return upto this many entries that match the filter criteria.
 	NumEntries *int `form:"numEntries,omitempty" json:"numEntries,omitempty"`
 
 	// A simple string to search for specific substrings in the result set. When used with the `numEntries` parameter, the results will return up to this many entries that match the filter criteria.
 	FilterByText *string `form:"filterByText,omitempty" json:"filterByText,omitempty"`
+
+	// The order of the returned entries. `desc` returns the most recently added entry first, and `asc` returns the same entries with the oldest first. When `line` or `since` is provided, `asc` instead reads forward from that position, returning the entry there and the ones after it.
+	Order *GetEntriesParamsOrder `form:"order,omitempty" json:"order,omitempty"`
+
+	// Positions the scan at a line of the file, counting the first line as 1. With `desc` order, the entries are read back from this line, so it is the first returned. With `asc` order, they are read forward from it. A line past the end of the file is refused. Cannot be used with `since`.
+	Line *int64 `form:"line,omitempty" json:"line,omitempty"`
+
+	// Positions the scan at the first line written at or after this time, going by the timestamp that starts a syslog line, or the bracketed timestamp of a common log format line. Lines without a timestamp are passed over while searching. With `desc` order, no entry before this line is returned. With `asc` order, the entries are read forward from it. Cannot be used with `line`.
+	Since *time.Time `form:"since,omitempty" json:"since,omitempty"`
+
+	// The structure of the lines in the requested file, used to split every entry into fields when responding with `text/csv`. `syslog` expects traditional or RFC 3339 syslog lines, and `clf` expects web server access logs in the common or combined log format. Lines that do not match the format are returned whole in the last field.
+	Format *GetEntriesParamsFormat `form:"format,omitempty" json:"format,omitempty"`
+
+	// Continues a scan that stopped at the byte or time limit, from the `cursor` it returned. Entries older than the ones already returned are scanned, or newer ones for a scan read forward from `line` or `since`, with the other parameters applied as usual. The cursor names the root the file was read from, so `root` can be left out, but must match when provided.
+	Cursor *string `form:"cursor,omitempty" json:"cursor,omitempty"`
 }
 
+// GetEntriesParamsOrder defines parameters for GetEntries.
+type GetEntriesParamsOrder string
+
+// GetEntriesParamsFormat defines parameters for GetEntries.
+type GetEntriesParamsFormat string
+
 // ServerInterface represents all server handlers.
 type ServerInterface interface {
-	// Given the name of a log file expected to be in the preconfigured directory, returns the latest entries.
+	// Lists the log files that can be read from the configured log roots.
+	// (GET /)
+	ListFiles(w http.ResponseWriter, r *http.Request)
+	// Given the name of a log file expected to be in a configured log root, returns the latest entries.
 	// (GET /{filename})
 	GetEntries(w http.ResponseWriter, r *http.Request, filename string, params GetEntriesParams)
 }
@@ -44,6 +184,25 @@ type ServerInterfaceWrapper struct {
 
 type MiddlewareFunc func(http.HandlerFunc) http.HandlerFunc
 
+// ListFiles operation middleware
+func (siw *ServerInterfaceWrapper) ListFiles(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, ApiKeyScopes, []string{""})
+
+	ctx = context.WithValue(ctx, BearerScopes, []string{""})
+
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.ListFiles(w, r)
+	}
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler(w, r.WithContext(ctx))
+}
+
 // GetEntries operation middleware
 func (siw *ServerInterfaceWrapper) GetEntries(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -59,9 +218,24 @@ func (siw *ServerInterfaceWrapper) GetEntries(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	ctx = context.WithValue(ctx, ApiKeyScopes, []string{""})
+
+	ctx = context.WithValue(ctx, BearerScopes, []string{""})
+
 	// Parameter object where we will unmarshal all parameters from the context
 	var params GetEntriesParams
 
+	// ------------- Optional query parameter "root" -------------
+	if paramValue := r.URL.Query().Get("root"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "root", r.URL.Query(), &params.Root)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "root", Err: err})
+		return
+	}
+
 	// ------------- Optional query parameter "numEntries" -------------
 	if paramValue := r.URL.Query().Get("numEntries"); paramValue != "" {
 
@@ -84,6 +258,61 @@ func (siw *ServerInterfaceWrapper) GetEntries(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	// ------------- Optional query parameter "order" -------------
+	if paramValue := r.URL.Query().Get("order"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "order", r.URL.Query(), &params.Order)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "order", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "line" -------------
+	if paramValue := r.URL.Query().Get("line"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "line", r.URL.Query(), &params.Line)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "line", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "since" -------------
+	if paramValue := r.URL.Query().Get("since"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "since", r.URL.Query(), &params.Since)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "since", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "format" -------------
+	if paramValue := r.URL.Query().Get("format"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "format", r.URL.Query(), &params.Format)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "format", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "cursor" -------------
+	if paramValue := r.URL.Query().Get("cursor"); paramValue != "" {
+
+	}
+
+	err = runtime.BindQueryParameter("form", true, false, "cursor", r.URL.Query(), &params.Cursor)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "cursor", Err: err})
+		return
+	}
+
 	var handler = func(w http.ResponseWriter, r *http.Request) {
 		siw.Handler.GetEntries(w, r, filename, params)
 	}
@@ -208,6 +437,9 @@ func HandlerWithOptions(si ServerInterface, options ChiServerOptions) http.Handl
 		ErrorHandlerFunc:   options.ErrorHandlerFunc,
 	}
 
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/", wrapper.ListFiles)
+	})
 	r.Group(func(r chi.Router) {
 		r.Get(options.BaseURL+"/{filename}", wrapper.GetEntries)
 	})
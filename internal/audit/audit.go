@@ -0,0 +1,74 @@
+package audit
+
+import (
+	"io/fs"
+	"net/http"
+	"time"
+)
+
+const (
+	// OutcomeSuccess is recorded when the entries were returned in full.
+	OutcomeSuccess = "success"
+	// OutcomeCancelled is recorded when the client went away before the entries were returned in full.
+	OutcomeCancelled = "cancelled"
+	// OutcomeDenied is recorded when the caller was not allowed to read the file.
+	OutcomeDenied = "denied"
+	// OutcomeNotFound is recorded when the file or root does not exist.
+	OutcomeNotFound = "not_found"
+	// OutcomeInvalid is recorded when the request was refused because of its parameters.
+	OutcomeInvalid = "invalid"
+	// OutcomeThrottled is recorded when the request was refused because of a rate or concurrency limit.
+	OutcomeThrottled = "throttled"
+	// OutcomeError is recorded when the request failed on the server.
+	OutcomeError = "error"
+)
+
+type (
+	// Record is a single file access.
+	Record struct {
+		Time       time.Time           `json:"time"`
+		RequestID  string              `json:"requestId,omitempty"`
+		Principal  string              `json:"principal"`
+		AuthMethod string              `json:"authMethod"`
+		ClientIP   string              `json:"clientIP"`
+		Root       string              `json:"root,omitempty"`
+		File       string              `json:"file"`
+		Query      map[string][]string `json:"query,omitempty"`
+		Status     int                 `json:"status"`
+		Outcome    string              `json:"outcome"`
+		Policy     string              `json:"policy,omitempty"`
+		Redactions int                 `json:"redactions,omitempty"`
+		Truncated  bool                `json:"truncated,omitempty"`
+		Bytes      int64               `json:"bytes"`
+		DurationMS int64               `json:"durationMs"`
+	}
+
+	// Sink stores audit records.
+	Sink interface {
+		// Write stores a single record.
+		Write(record Record) error
+		// Owns reports whether the file is one the sink writes to, so it can be kept from being served.
+		Owns(info fs.FileInfo) bool
+	}
+)
+
+// Outcome returns the outcome for a request that completed with the status. A successful status is only a success if
+// the response was not cancelled part way through.
+func Outcome(status int, cancelled bool) string {
+	switch {
+	case status < http.StatusBadRequest && cancelled:
+		return OutcomeCancelled
+	case status < http.StatusBadRequest:
+		return OutcomeSuccess
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return OutcomeDenied
+	case status == http.StatusNotFound:
+		return OutcomeNotFound
+	case status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable:
+		return OutcomeThrottled
+	case status < http.StatusInternalServerError:
+		return OutcomeInvalid
+	default:
+		return OutcomeError
+	}
+}
@@ -0,0 +1,3 @@
+// Package audit records every file access as a JSON line in a dedicated, rotating file, kept separate from the
+// operational log.
+package audit
@@ -0,0 +1,183 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+const (
+	defaultMaxSize    = 100 << 20
+	defaultMaxBackups = 5
+)
+
+type (
+	// FileOption defines the function signature for helper methods to update values on the FileSink.
+	FileOption func(sink *FileSink)
+
+	// FileSink writes records as JSON lines to a file. Once the file would grow past its maximum size, it is renamed
+	// with a .1 suffix, earlier backups are shifted up by one, and a new file is started.
+	FileSink struct {
+		path       string
+		maxSize    int64
+		maxBackups int
+
+		mu   sync.Mutex
+		file *os.File
+		size int64
+	}
+)
+
+// WithMaxSize sets the size in bytes the file is rotated at. The default is 100MB.
+func WithMaxSize(size int64) FileOption {
+	return func(sink *FileSink) {
+		sink.maxSize = size
+	}
+}
+
+// WithMaxBackups sets the number of rotated files kept, after which the oldest is removed. The default is 5.
+func WithMaxBackups(backups int) FileOption {
+	return func(sink *FileSink) {
+		sink.maxBackups = backups
+	}
+}
+
+// NewFileSink opens the file at the provided path for appending, creating it readable by the owner only if it does not
+// exist yet.
+func NewFileSink(path string, options ...FileOption) (*FileSink, error) {
+	sink := &FileSink{
+		path:       filepath.Clean(path),
+		maxSize:    defaultMaxSize,
+		maxBackups: defaultMaxBackups,
+	}
+
+	for _, optionFn := range options {
+		optionFn(sink)
+	}
+
+	if err := sink.open(); err != nil {
+		return nil, err
+	}
+
+	return sink, nil
+}
+
+// Path returns the path of the file currently written to.
+func (s *FileSink) Path() string {
+	return s.path
+}
+
+// Write appends the record as a single JSON line, rotating the file first if the line would take it over the maximum
+// size.
+func (s *FileSink) Write(record Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("while marshalling audit record %w", err)
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return fmt.Errorf("audit file [%s] is closed", s.path)
+	}
+
+	if s.size > 0 && s.size+int64(len(line)) > s.maxSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("while writing audit record %w", err)
+	}
+
+	return nil
+}
+
+// Owns reports whether the file is the audit file, or one of its backups. Files are compared with os.SameFile, so a
+// link to the audit file is recognized as well.
+func (s *FileSink) Owns(info fs.FileInfo) bool {
+	for i := 0; i <= s.maxBackups; i++ {
+		owned, err := os.Stat(s.backupPath(i))
+		if err != nil {
+			continue
+		}
+		if os.SameFile(info, owned) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Close closes the file. Records written afterwards return an error.
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+
+	err := s.file.Close()
+	s.file = nil
+
+	return err
+}
+
+func (s *FileSink) open() error {
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("while opening audit file %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("while opening audit file %w", err)
+	}
+
+	s.file = file
+	s.size = info.Size()
+
+	return nil
+}
+
+func (s *FileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return fmt.Errorf("while closing audit file for rotation %w", err)
+	}
+	s.file = nil
+
+	if s.maxBackups == 0 {
+		if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("while removing audit file %w", err)
+		}
+		return s.open()
+	}
+
+	for i := s.maxBackups - 1; i >= 0; i-- {
+		if err := os.Rename(s.backupPath(i), s.backupPath(i+1)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("while rotating audit file %w", err)
+		}
+	}
+
+	return s.open()
+}
+
+// backupPath returns the path of the nth backup, where the 0th is the file currently written to.
+func (s *FileSink) backupPath(n int) string {
+	if n == 0 {
+		return s.path
+	}
+
+	return s.path + "." + strconv.Itoa(n)
+}
@@ -0,0 +1,141 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readRecords(t *testing.T, path string) []Record {
+	t.Helper()
+
+	file, err := os.Open(path) //nolint:gosec // the path is a test temp file.
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, file.Close())
+	}()
+
+	out := make([]Record, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record Record
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		out = append(out, record)
+	}
+	require.NoError(t, scanner.Err())
+
+	return out
+}
+
+func TestFileSink_Rotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	record := Record{
+		Time:      time.Date(2022, 8, 7, 21, 18, 18, 0, time.UTC),
+		Principal: "alice",
+		File:      "auth.log",
+		Query:     map[string][]string{"numEntries": {"10"}},
+		Status:    http.StatusOK,
+		Outcome:   OutcomeSuccess,
+	}
+	line, err := json.Marshal(record)
+	require.NoError(t, err)
+
+	// every file holds exactly two records before it is rotated.
+	sink, err := NewFileSink(path, WithMaxSize(int64(2*(len(line)+1))), WithMaxBackups(2))
+	require.NoError(t, err)
+
+	for i := 0; i < 7; i++ {
+		record.Bytes = int64(i)
+		require.NoError(t, sink.Write(record))
+	}
+	require.NoError(t, sink.Close())
+	assert.Error(t, sink.Write(record))
+
+	current := readRecords(t, path)
+	require.Len(t, current, 1)
+	assert.Equal(t, int64(6), current[0].Bytes)
+	assert.Equal(t, record.Query, current[0].Query)
+
+	first := readRecords(t, path+".1")
+	require.Len(t, first, 2)
+	assert.Equal(t, int64(4), first[0].Bytes)
+
+	second := readRecords(t, path+".2")
+	require.Len(t, second, 2)
+	assert.Equal(t, int64(2), second[0].Bytes)
+
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err))
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestFileSink_Owns(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.log")
+
+	sink, err := NewFileSink(path, WithMaxSize(1))
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, sink.Close())
+	}()
+	require.NoError(t, sink.Write(Record{}))
+	require.NoError(t, sink.Write(Record{}))
+
+	other := filepath.Join(dir, "syslog")
+	require.NoError(t, os.WriteFile(other, []byte("line\n"), 0600))
+	link := filepath.Join(dir, "innocent.log")
+	require.NoError(t, os.Symlink(path, link))
+
+	tests := map[string]struct {
+		path     string
+		expected bool
+	}{
+		"Current file":         {path: path, expected: true},
+		"Backup file":          {path: path + ".1", expected: true},
+		"Link to current file": {path: link, expected: true},
+		"Unrelated file":       {path: other, expected: false},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			info, err := os.Stat(test.path)
+			require.NoError(tt, err)
+			assert.Equal(tt, test.expected, sink.Owns(info))
+		})
+	}
+}
+
+func TestOutcome(t *testing.T) {
+	tests := map[string]struct {
+		status    int
+		cancelled bool
+		expected  string
+	}{
+		"Success":      {status: http.StatusOK, expected: OutcomeSuccess},
+		"Cancelled":    {status: http.StatusOK, cancelled: true, expected: OutcomeCancelled},
+		"Unauthorized": {status: http.StatusUnauthorized, expected: OutcomeDenied},
+		"Forbidden":    {status: http.StatusForbidden, expected: OutcomeDenied},
+		"Not found":    {status: http.StatusNotFound, expected: OutcomeNotFound},
+		"Bad request":  {status: http.StatusBadRequest, expected: OutcomeInvalid},
+		"Rate limited": {status: http.StatusTooManyRequests, expected: OutcomeThrottled},
+		"Overloaded":   {status: http.StatusServiceUnavailable, expected: OutcomeThrottled},
+		"Server error": {status: http.StatusInternalServerError, expected: OutcomeError},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			assert.Equal(tt, test.expected, Outcome(test.status, test.cancelled))
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	// APIKeyHeader is the request header an API key is sent in.
+	APIKeyHeader = "X-API-Key"
+
+	hashPrefixSHA256 = "sha256:"
+)
+
+type (
+	// APIKey is a named static key, stored as the hash of the key so the configuration never holds the key itself.
+	APIKey struct {
+		Name   string
+		Hash   string
+		Groups []string
+	}
+
+	// APIKeys authenticates requests with one of a fixed set of API keys.
+	APIKeys struct {
+		keys []hashedKey
+	}
+
+	hashedKey struct {
+		name   string
+		groups []string
+		sum    []byte
+	}
+)
+
+// HashAPIKey returns the hash of the key in the format expected by NewAPIKeys.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hashPrefixSHA256 + hex.EncodeToString(sum[:])
+}
+
+// NewAPIKeys validates the name and hash of every key. Hashes are the hex encoded SHA-256 of the key, prefixed with
+// "sha256:", as returned by HashAPIKey.
+func NewAPIKeys(keys []APIKey) (*APIKeys, error) {
+	out := &APIKeys{keys: make([]hashedKey, 0, len(keys))}
+
+	for _, key := range keys {
+		if key.Name == "" {
+			return nil, fmt.Errorf("every api key must have a name")
+		}
+
+		encoded := strings.TrimPrefix(key.Hash, hashPrefixSHA256)
+		sum, err := hex.DecodeString(encoded)
+		if err != nil || encoded == key.Hash || len(sum) != sha256.Size {
+			return nil, fmt.Errorf("api key [%s] must have a hash in the format sha256:<64 hex characters>", key.Name)
+		}
+
+		out.keys = append(out.keys, hashedKey{name: key.Name, groups: key.Groups, sum: sum})
+	}
+
+	return out, nil
+}
+
+// Authenticate returns the Principal named after the key in the X-API-Key header. Every key is compared in constant
+// time, so the response time does not reveal how close a guess was.
+func (a *APIKeys) Authenticate(r *http.Request) (Principal, bool, error) {
+	key := r.Header.Get(APIKeyHeader)
+	if key == "" {
+		return Principal{}, false, nil
+	}
+
+	sum := sha256.Sum256([]byte(key))
+
+	var matched *hashedKey
+	for i := range a.keys {
+		if subtle.ConstantTimeCompare(sum[:], a.keys[i].sum) == 1 {
+			matched = &a.keys[i]
+		}
+	}
+
+	if matched == nil {
+		return Principal{}, true, fmt.Errorf("%w: unknown api key", ErrInvalidCredentials)
+	}
+
+	return Principal{Subject: matched.name, Groups: matched.groups, Method: MethodAPIKey}, true, nil
+}
+
+// Challenge returns the WWW-Authenticate challenge for API keys.
+func (a *APIKeys) Challenge() string {
+	return `ApiKey realm="varlog", header="` + APIKeyHeader + `"`
+}
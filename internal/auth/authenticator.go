@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/rs/zerolog"
+)
+
+var (
+	// ErrMissingCredentials is returned when a request has no credentials, and anonymous requests are not allowed.
+	ErrMissingCredentials = errors.New("credentials are required")
+	// ErrInvalidCredentials is returned when a request has credentials, but they could not be verified.
+	ErrInvalidCredentials = errors.New("the provided credentials are not valid")
+)
+
+type (
+	// Method is a single way of authenticating a request.
+	Method interface {
+		// Authenticate returns the Principal for the credentials of the request. The flag reports whether the request
+		// carried credentials for this method at all, in which case an error means they were not valid.
+		Authenticate(r *http.Request) (Principal, bool, error)
+		// Challenge returns the WWW-Authenticate challenge for the method, or an empty string when there is none.
+		Challenge() string
+	}
+
+	// AuthenticatorOption defines the function signature for helper methods to update values on the Authenticator.
+	AuthenticatorOption func(authenticator *Authenticator)
+
+	// Authenticator tries each of its methods in order, and uses the first that finds credentials on the request.
+	Authenticator struct {
+		methods   []Method
+		anonymous bool
+	}
+
+	// ErrorHandlerFunc writes the response for a request that could not be authenticated.
+	ErrorHandlerFunc func(w http.ResponseWriter, r *http.Request, err error)
+
+	// Middleware authenticates every request before it is passed on, and replaces its Authenticator on reload.
+	Middleware struct {
+		authenticator atomic.Value
+		errorFn       ErrorHandlerFunc
+	}
+)
+
+// WithAnonymous allows requests without any credentials, which are made on behalf of the anonymous Principal. It is
+// meant for local development only. Requests with invalid credentials are still refused.
+func WithAnonymous(allowed bool) AuthenticatorOption {
+	return func(authenticator *Authenticator) {
+		authenticator.anonymous = allowed
+	}
+}
+
+// NewAuthenticator returns an Authenticator that tries the methods in the order provided.
+func NewAuthenticator(methods []Method, options ...AuthenticatorOption) *Authenticator {
+	authenticator := &Authenticator{methods: methods}
+
+	for _, optionFn := range options {
+		optionFn(authenticator)
+	}
+
+	return authenticator
+}
+
+// Authenticate returns the Principal for the request, or an error wrapping ErrMissingCredentials or
+// ErrInvalidCredentials.
+func (a *Authenticator) Authenticate(r *http.Request) (Principal, error) {
+	for _, method := range a.methods {
+		principal, found, err := method.Authenticate(r)
+		if err != nil {
+			return Principal{}, err
+		}
+		if found {
+			return principal, nil
+		}
+	}
+
+	if a.anonymous {
+		return Anonymous(), nil
+	}
+
+	return Principal{}, ErrMissingCredentials
+}
+
+// Challenge returns the WWW-Authenticate header value listing the challenge of every method.
+func (a *Authenticator) Challenge() string {
+	challenges := make([]string, 0, len(a.methods))
+	for _, method := range a.methods {
+		if challenge := method.Challenge(); challenge != "" {
+			challenges = append(challenges, challenge)
+		}
+	}
+
+	return strings.Join(challenges, ", ")
+}
+
+// NewMiddleware returns a Middleware using the Authenticator, which calls the error function for every request that
+// can't be authenticated.
+func NewMiddleware(authenticator *Authenticator, errorFn ErrorHandlerFunc) *Middleware {
+	middleware := &Middleware{errorFn: errorFn}
+	middleware.authenticator.Store(authenticator)
+
+	return middleware
+}
+
+// Reload replaces the Authenticator used for every request that starts after it returns.
+func (m *Middleware) Reload(authenticator *Authenticator) {
+	m.authenticator.Store(authenticator)
+}
+
+// Handler authenticates the request, and passes it on with the Principal in its context. The principal is added to the
+// request logger as well, when there is one.
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authenticator := m.authenticator.Load().(*Authenticator)
+
+		principal, err := authenticator.Authenticate(r)
+		if err != nil {
+			zerolog.Ctx(r.Context()).Debug().Err(err).Msg("request could not be authenticated")
+			if challenge := authenticator.Challenge(); challenge != "" {
+				w.Header().Set("WWW-Authenticate", challenge)
+			}
+			m.errorFn(w, r, err)
+			return
+		}
+
+		zerolog.Ctx(r.Context()).UpdateContext(func(c zerolog.Context) zerolog.Context {
+			return c.Str("principal", principal.Subject).Str("authMethod", principal.Method)
+		})
+
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+	})
+}
@@ -0,0 +1,338 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testKeys struct {
+	rsa     *rsa.PrivateKey
+	ec      *ecdsa.PrivateKey
+	ed25519 ed25519.PrivateKey
+}
+
+func newTestKeys(t *testing.T) testKeys {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	return testKeys{rsa: rsaKey, ec: ecKey, ed25519: edKey}
+}
+
+func writeJWKS(t *testing.T, keys testKeys) string {
+	t.Helper()
+
+	encode := func(value []byte) string {
+		return base64.RawURLEncoding.EncodeToString(value)
+	}
+
+	set := map[string]interface{}{
+		"keys": []map[string]string{
+			{
+				"kty": "RSA", "kid": "rsa", "alg": "RS256", "use": "sig",
+				"n": encode(keys.rsa.N.Bytes()), "e": encode(big.NewInt(int64(keys.rsa.E)).Bytes()),
+			},
+			{
+				"kty": "EC", "kid": "ec", "crv": "P-256",
+				"x": encode(keys.ec.X.Bytes()), "y": encode(keys.ec.Y.Bytes()),
+			},
+			{
+				"kty": "OKP", "kid": "ed", "crv": "Ed25519",
+				"x": encode(keys.ed25519.Public().(ed25519.PublicKey)),
+			},
+			{
+				"kty": "RSA", "kid": "encryption", "use": "enc", "n": "", "e": "",
+			},
+		},
+	}
+
+	content, err := json.Marshal(set)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, content, 0600))
+
+	return path
+}
+
+func signToken(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+
+	return signed
+}
+
+func TestAuthenticator_Authenticate(t *testing.T) {
+	keys := newTestKeys(t)
+	otherKeys := newTestKeys(t)
+
+	verifier, err := NewJWTVerifier(writeJWKS(t, keys), WithIssuer("https://issuer"), WithAudience("varlog"))
+	require.NoError(t, err)
+
+	apiKeys, err := NewAPIKeys([]APIKey{
+		{Name: "dashboard", Hash: HashAPIKey("s3cret"), Groups: []string{"ops"}},
+		{Name: "backup", Hash: HashAPIKey("another")},
+	})
+	require.NoError(t, err)
+
+	certificates := NewClientCertificates(func(r *http.Request) (pkix.Name, bool) {
+		if r.Header.Get("X-Test-Subject") == "" {
+			return pkix.Name{}, false
+		}
+		return pkix.Name{CommonName: r.Header.Get("X-Test-Subject"), OrganizationalUnit: []string{"infra"}}, true
+	})
+
+	validClaims := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"sub":    "alice",
+			"iss":    "https://issuer",
+			"aud":    "varlog",
+			"exp":    time.Now().Add(time.Hour).Unix(),
+			"groups": []string{"payments", "ops"},
+		}
+	}
+	withClaim := func(key string, value interface{}) jwt.MapClaims {
+		claims := validClaims()
+		if value == nil {
+			delete(claims, key)
+		} else {
+			claims[key] = value
+		}
+		return claims
+	}
+
+	tests := map[string]struct {
+		headers       map[string]string
+		anonymous     bool
+		expected      Principal
+		expectedError error
+	}{
+		"API key": {
+			headers:  map[string]string{APIKeyHeader: "s3cret"},
+			expected: Principal{Subject: "dashboard", Groups: []string{"ops"}, Method: MethodAPIKey},
+		},
+		"Unknown API key is refused": {
+			headers:       map[string]string{APIKeyHeader: "guess"},
+			expectedError: ErrInvalidCredentials,
+		},
+		"RSA signed JWT": {
+			headers: map[string]string{
+				"Authorization": "Bearer " + signToken(t, jwt.SigningMethodRS256, "rsa", keys.rsa, validClaims()),
+			},
+			expected: Principal{Subject: "alice", Groups: []string{"payments", "ops"}, Method: MethodJWT},
+		},
+		"EC signed JWT with space separated groups": {
+			headers: map[string]string{
+				"Authorization": "bearer " + signToken(t, jwt.SigningMethodES256, "ec", keys.ec,
+					withClaim("groups", "payments ops")),
+			},
+			expected: Principal{Subject: "alice", Groups: []string{"payments", "ops"}, Method: MethodJWT},
+		},
+		"Ed25519 signed JWT": {
+			headers: map[string]string{
+				"Authorization": "Bearer " + signToken(t, jwt.SigningMethodEdDSA, "ed", keys.ed25519,
+					withClaim("groups", nil)),
+			},
+			expected: Principal{Subject: "alice", Method: MethodJWT},
+		},
+		"JWT signed by an unknown key is refused": {
+			headers: map[string]string{
+				"Authorization": "Bearer " + signToken(t, jwt.SigningMethodRS256, "rsa", otherKeys.rsa, validClaims()),
+			},
+			expectedError: ErrInvalidCredentials,
+		},
+		"JWT with an algorithm the key does not allow is refused": {
+			headers: map[string]string{
+				"Authorization": "Bearer " + signToken(t, jwt.SigningMethodRS512, "rsa", keys.rsa, validClaims()),
+			},
+			expectedError: ErrInvalidCredentials,
+		},
+		"JWT without a kid is refused when there are several keys": {
+			headers: map[string]string{
+				"Authorization": "Bearer " + signToken(t, jwt.SigningMethodRS256, "", keys.rsa, validClaims()),
+			},
+			expectedError: ErrInvalidCredentials,
+		},
+		"Symmetric JWT is refused": {
+			headers: map[string]string{
+				"Authorization": "Bearer " + signToken(t, jwt.SigningMethodHS256, "rsa", []byte("secret"), validClaims()),
+			},
+			expectedError: ErrInvalidCredentials,
+		},
+		"Expired JWT is refused": {
+			headers: map[string]string{
+				"Authorization": "Bearer " + signToken(t, jwt.SigningMethodRS256, "rsa", keys.rsa,
+					withClaim("exp", time.Now().Add(-time.Minute).Unix())),
+			},
+			expectedError: ErrInvalidCredentials,
+		},
+		"JWT without an expiry is refused": {
+			headers: map[string]string{
+				"Authorization": "Bearer " + signToken(t, jwt.SigningMethodRS256, "rsa", keys.rsa, withClaim("exp", nil)),
+			},
+			expectedError: ErrInvalidCredentials,
+		},
+		"JWT with the wrong issuer is refused": {
+			headers: map[string]string{
+				"Authorization": "Bearer " + signToken(t, jwt.SigningMethodRS256, "rsa", keys.rsa,
+					withClaim("iss", "https://elsewhere")),
+			},
+			expectedError: ErrInvalidCredentials,
+		},
+		"JWT with the wrong audience is refused": {
+			headers: map[string]string{
+				"Authorization": "Bearer " + signToken(t, jwt.SigningMethodRS256, "rsa", keys.rsa,
+					withClaim("aud", "other")),
+			},
+			expectedError: ErrInvalidCredentials,
+		},
+		"JWT without a subject is refused": {
+			headers: map[string]string{
+				"Authorization": "Bearer " + signToken(t, jwt.SigningMethodRS256, "rsa", keys.rsa, withClaim("sub", nil)),
+			},
+			expectedError: ErrInvalidCredentials,
+		},
+		"Client certificate": {
+			headers:  map[string]string{"X-Test-Subject": "batch-job"},
+			expected: Principal{Subject: "batch-job", Groups: []string{"infra"}, Method: MethodClientCertificate},
+		},
+		"No credentials are refused": {
+			expectedError: ErrMissingCredentials,
+		},
+		"No credentials are anonymous when allowed": {
+			anonymous: true,
+			expected:  Anonymous(),
+		},
+		"Invalid credentials are refused even when anonymous is allowed": {
+			headers:       map[string]string{APIKeyHeader: "guess"},
+			anonymous:     true,
+			expectedError: ErrInvalidCredentials,
+		},
+		"Other authorization schemes are ignored": {
+			headers:       map[string]string{"Authorization": "Basic dXNlcjpwYXNz"},
+			expectedError: ErrMissingCredentials,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			authenticator := NewAuthenticator(
+				[]Method{apiKeys, verifier, certificates},
+				WithAnonymous(test.anonymous),
+			)
+
+			request := httptest.NewRequest(http.MethodGet, "/api/varlog/syslog", nil)
+			for key, value := range test.headers {
+				request.Header.Set(key, value)
+			}
+
+			actual, err := authenticator.Authenticate(request)
+			if test.expectedError != nil {
+				assert.True(tt, errors.Is(err, test.expectedError), "expected %v, got %v", test.expectedError, err)
+				return
+			}
+
+			require.NoError(tt, err)
+			assert.Equal(tt, test.expected, actual)
+		})
+	}
+}
+
+func TestNewAPIKeys(t *testing.T) {
+	tests := map[string]struct {
+		key         APIKey
+		expectError bool
+	}{
+		"Valid hash": {
+			key: APIKey{Name: "valid", Hash: HashAPIKey("key")},
+		},
+		"Missing name": {
+			key:         APIKey{Hash: HashAPIKey("key")},
+			expectError: true,
+		},
+		"Missing prefix": {
+			key:         APIKey{Name: "bare", Hash: HashAPIKey("key")[len(hashPrefixSHA256):]},
+			expectError: true,
+		},
+		"Plain text key": {
+			key:         APIKey{Name: "plain", Hash: "sha256:key"},
+			expectError: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			_, err := NewAPIKeys([]APIKey{test.key})
+			if test.expectError {
+				assert.Error(tt, err)
+			} else {
+				assert.NoError(tt, err)
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	apiKeys, err := NewAPIKeys([]APIKey{{Name: "dashboard", Hash: HashAPIKey("s3cret")}})
+	require.NoError(t, err)
+
+	var failure error
+	middleware := NewMiddleware(NewAuthenticator([]Method{apiKeys}), func(w http.ResponseWriter, _ *http.Request, err error) {
+		failure = err
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+
+	var principal Principal
+	handler := middleware.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ = PrincipalFrom(r.Context())
+	}))
+
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	assert.Equal(t, `ApiKey realm="varlog", header="X-API-Key"`, recorder.Header().Get("WWW-Authenticate"))
+	assert.ErrorIs(t, failure, ErrMissingCredentials)
+
+	request.Header.Set(APIKeyHeader, "s3cret")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "dashboard", principal.Subject)
+
+	middleware.Reload(NewAuthenticator(nil, WithAnonymous(true)))
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, Anonymous(), principal)
+}
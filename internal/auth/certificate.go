@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"crypto/x509/pkix"
+	"net/http"
+)
+
+type (
+	// SubjectFunc returns the subject of the verified client certificate for the request, and false when there is none.
+	SubjectFunc func(r *http.Request) (pkix.Name, bool)
+
+	// ClientCertificates authenticates requests with the TLS client certificate that was verified during the handshake.
+	ClientCertificates struct {
+		subjectFn SubjectFunc
+	}
+)
+
+// NewClientCertificates returns a method that uses the common name of the certificate subject as the Principal
+// subject, and the organizational units as its groups.
+func NewClientCertificates(subjectFn SubjectFunc) *ClientCertificates {
+	return &ClientCertificates{subjectFn: subjectFn}
+}
+
+// Authenticate returns the Principal for the verified client certificate. Requests without one are left to the other
+// methods.
+func (c *ClientCertificates) Authenticate(r *http.Request) (Principal, bool, error) {
+	subject, ok := c.subjectFn(r)
+	if !ok || subject.CommonName == "" {
+		return Principal{}, false, nil
+	}
+
+	return Principal{
+		Subject: subject.CommonName,
+		Groups:  subject.OrganizationalUnit,
+		Method:  MethodClientCertificate,
+	}, true, nil
+}
+
+// Challenge returns an empty challenge, as client certificates are requested during the TLS handshake instead.
+func (c *ClientCertificates) Challenge() string {
+	return ""
+}
@@ -0,0 +1,3 @@
+// Package auth authenticates requests with static API keys, JWTs or client certificates, and makes the resulting
+// Principal available to the handlers serving the request.
+package auth
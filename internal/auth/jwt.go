@@ -0,0 +1,271 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const defaultGroupsClaim = "groups"
+
+// validJWTMethods only allows asymmetric algorithms, as the keys come from a JWKS of public keys.
+var validJWTMethods = []string{
+	"RS256", "RS384", "RS512",
+	"PS256", "PS384", "PS512",
+	"ES256", "ES384", "ES512",
+	"EdDSA",
+}
+
+type (
+	// JWTOption defines the function signature for helper methods to update values on the JWTVerifier.
+	JWTOption func(verifier *JWTVerifier)
+
+	// JWTVerifier authenticates requests with a bearer JWT, signed by one of the keys in a local JWKS file.
+	JWTVerifier struct {
+		keys        map[string]jsonWebKey
+		issuer      string
+		audience    string
+		groupsClaim string
+		parser      *jwt.Parser
+	}
+
+	jsonWebKeySet struct {
+		Keys []jsonWebKeyJSON `json:"keys"`
+	}
+
+	jsonWebKeyJSON struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Alg string `json:"alg"`
+		Use string `json:"use"`
+		Crv string `json:"crv"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+	}
+
+	jsonWebKey struct {
+		alg string
+		key interface{}
+	}
+)
+
+// WithIssuer requires the iss claim of every token to match the issuer.
+func WithIssuer(issuer string) JWTOption {
+	return func(verifier *JWTVerifier) {
+		verifier.issuer = issuer
+	}
+}
+
+// WithAudience requires the aud claim of every token to contain the audience.
+func WithAudience(audience string) JWTOption {
+	return func(verifier *JWTVerifier) {
+		verifier.audience = audience
+	}
+}
+
+// WithGroupsClaim sets the claim the Principal groups are read from. The claim is either a list of strings, or a
+// single space separated string. The default is "groups".
+func WithGroupsClaim(claim string) JWTOption {
+	return func(verifier *JWTVerifier) {
+		verifier.groupsClaim = claim
+	}
+}
+
+// NewJWTVerifier loads the public keys from the JWKS file. RSA, EC and Ed25519 keys are supported, and keys that are
+// not meant for signatures are ignored.
+func NewJWTVerifier(jwksFile string, options ...JWTOption) (*JWTVerifier, error) {
+	content, err := os.ReadFile(jwksFile) //nolint:gosec // the JWKS path is provided by the operator.
+	if err != nil {
+		return nil, fmt.Errorf("while reading jwks file %w", err)
+	}
+
+	keys, err := parseJWKS(content)
+	if err != nil {
+		return nil, fmt.Errorf("while parsing jwks file [%s] %w", jwksFile, err)
+	}
+
+	verifier := &JWTVerifier{
+		keys:        keys,
+		groupsClaim: defaultGroupsClaim,
+		parser:      jwt.NewParser(jwt.WithValidMethods(validJWTMethods)),
+	}
+
+	for _, optionFn := range options {
+		optionFn(verifier)
+	}
+
+	return verifier, nil
+}
+
+// Authenticate returns the Principal for the sub claim of the bearer token in the Authorization header. Tokens must be
+// signed by a known key, and must have an expiry.
+func (v *JWTVerifier) Authenticate(r *http.Request) (Principal, bool, error) {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return Principal{}, false, nil
+	}
+
+	claims := jwt.MapClaims{}
+	if _, err := v.parser.ParseWithClaims(strings.TrimSpace(token), claims, v.keyFor); err != nil {
+		return Principal{}, true, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+
+	if _, ok := claims["exp"]; !ok {
+		return Principal{}, true, fmt.Errorf("%w: token has no expiry", ErrInvalidCredentials)
+	}
+	if v.issuer != "" && !claims.VerifyIssuer(v.issuer, true) {
+		return Principal{}, true, fmt.Errorf("%w: token has the wrong issuer", ErrInvalidCredentials)
+	}
+	if v.audience != "" && !claims.VerifyAudience(v.audience, true) {
+		return Principal{}, true, fmt.Errorf("%w: token has the wrong audience", ErrInvalidCredentials)
+	}
+
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return Principal{}, true, fmt.Errorf("%w: token has no subject", ErrInvalidCredentials)
+	}
+
+	return Principal{Subject: subject, Groups: groupsFrom(claims[v.groupsClaim]), Method: MethodJWT}, true, nil
+}
+
+// Challenge returns the WWW-Authenticate challenge for bearer tokens.
+func (v *JWTVerifier) Challenge() string {
+	return `Bearer realm="varlog"`
+}
+
+// keyFor finds the key the token was signed with by its kid header. Tokens without a kid can only be verified when the
+// JWKS has a single key.
+func (v *JWTVerifier) keyFor(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	key, ok := v.keys[kid]
+	if !ok && kid == "" && len(v.keys) == 1 {
+		for _, only := range v.keys {
+			key, ok = only, true
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown key id [%s]", kid)
+	}
+
+	if key.alg != "" && key.alg != token.Method.Alg() {
+		return nil, fmt.Errorf("key [%s] can't be used with %s", kid, token.Method.Alg())
+	}
+
+	return key.key, nil
+}
+
+func groupsFrom(claim interface{}) []string {
+	switch value := claim.(type) {
+	case string:
+		return strings.Fields(value)
+	case []interface{}:
+		out := make([]string, 0, len(value))
+		for _, group := range value {
+			if name, ok := group.(string); ok {
+				out = append(out, name)
+			}
+		}
+		return out
+	default:
+		return nil
+	}
+}
+
+func parseJWKS(content []byte) (map[string]jsonWebKey, error) {
+	var set jsonWebKeySet
+	if err := json.Unmarshal(content, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]jsonWebKey)
+	for i, raw := range set.Keys {
+		if raw.Use != "" && raw.Use != "sig" {
+			continue
+		}
+
+		key, err := raw.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %d [%s] %w", i, raw.Kid, err)
+		}
+
+		if _, exists := keys[raw.Kid]; exists {
+			return nil, fmt.Errorf("key id [%s] is used by more than one key", raw.Kid)
+		}
+		keys[raw.Kid] = jsonWebKey{alg: raw.Alg, key: key}
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no signing keys found")
+	}
+
+	return keys, nil
+}
+
+func (k jsonWebKeyJSON) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("has an invalid modulus %w", err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil || !e.IsInt64() {
+			return nil, fmt.Errorf("has an invalid exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		curve, ok := map[string]elliptic.Curve{
+			"P-256": elliptic.P256(),
+			"P-384": elliptic.P384(),
+			"P-521": elliptic.P521(),
+		}[k.Crv]
+		if !ok {
+			return nil, fmt.Errorf("has an unsupported curve %s", k.Crv)
+		}
+		x, errX := decodeBigInt(k.X)
+		y, errY := decodeBigInt(k.Y)
+		if errX != nil || errY != nil || !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("is not a valid point on %s", k.Crv)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("has an unsupported curve %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(k.X, "="))
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("is not a valid Ed25519 public key")
+		}
+		return ed25519.PublicKey(x), nil
+
+	default:
+		return nil, fmt.Errorf("has an unsupported key type %s", k.Kty)
+	}
+}
+
+func decodeBigInt(encoded string) (*big.Int, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(encoded, "="))
+	if err != nil {
+		return nil, err
+	}
+	if len(decoded) == 0 {
+		return nil, fmt.Errorf("value is empty")
+	}
+
+	return new(big.Int).SetBytes(decoded), nil
+}
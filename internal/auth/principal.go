@@ -0,0 +1,47 @@
+package auth
+
+import "context"
+
+const (
+	// MethodAPIKey is the method of a Principal authenticated with a static API key.
+	MethodAPIKey = "apikey"
+	// MethodJWT is the method of a Principal authenticated with a bearer JWT.
+	MethodJWT = "jwt"
+	// MethodClientCertificate is the method of a Principal authenticated with a verified TLS client certificate.
+	MethodClientCertificate = "certificate"
+	// MethodAnonymous is the method of the Principal used for requests without credentials, when they are allowed.
+	MethodAnonymous = "anonymous"
+
+	// AnonymousSubject is the subject of the anonymous Principal.
+	AnonymousSubject = "anonymous"
+)
+
+type (
+	// Principal is the authenticated identity a request is made on behalf of.
+	Principal struct {
+		// Subject identifies the caller, such as the API key name or the JWT sub claim.
+		Subject string
+		// Groups are the groups the caller belongs to, used to authorize the request.
+		Groups []string
+		// Method is how the caller was authenticated.
+		Method string
+	}
+
+	principalKey struct{}
+)
+
+// Anonymous returns the Principal used for requests without credentials.
+func Anonymous() Principal {
+	return Principal{Subject: AnonymousSubject, Method: MethodAnonymous}
+}
+
+// WithPrincipal returns a copy of the context which carries the Principal.
+func WithPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFrom returns the Principal carried by the context, and false if the request was never authenticated.
+func PrincipalFrom(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(Principal)
+	return principal, ok
+}
@@ -0,0 +1,190 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+)
+
+const (
+	// resultOverhead approximates the bytes used by a result on top of its entries, for the list element, map entry
+	// and the fields of the result and key.
+	resultOverhead = 256
+	// entryOverhead is the size of a string header, which every entry takes on top of its bytes.
+	entryOverhead = 16
+)
+
+type (
+	// Key identifies a query, normalized to the values that change which entries are read from the file. Values that
+	// only change how the entries are returned, like their order, media type or redactions, are not part of the key.
+	Key struct {
+		Root   string
+		File   string
+		Filter string
+		Lines  int
+	}
+
+	// Result is the entries a query returned, along with the state of the file they were read from.
+	Result struct {
+		// Inode and Size identify the content the entries were read from, which is every byte before Size.
+		Inode uint64
+		Size  int64
+		// Tail is the last bytes before Size, which still match when the file has only grown since, but almost never
+		// do when it was truncated and written again.
+		Tail string
+		// Entries are newest first, and are shared between every request, so they must not be modified.
+		Entries []string
+	}
+
+	// Option defines the function signature for helper methods to update the LRU when it is created.
+	Option func(cache *LRU)
+
+	// LRU holds results up to a total size in bytes, evicting the least recently used results to make room for new
+	// ones. It is safe for concurrent use.
+	LRU struct {
+		mu             sync.Mutex
+		maxBytes       int64
+		maxResultBytes int64
+		bytes          int64
+		items          map[Key]*list.Element
+		order          *list.List
+
+		hits      uint64
+		misses    uint64
+		evictions uint64
+	}
+
+	// Stats is a snapshot of the size and effectiveness of the cache.
+	Stats struct {
+		Results   int    `json:"results"`
+		Bytes     int64  `json:"bytes"`
+		MaxBytes  int64  `json:"maxBytes"`
+		Hits      uint64 `json:"hits"`
+		Misses    uint64 `json:"misses"`
+		Evictions uint64 `json:"evictions"`
+	}
+
+	item struct {
+		key    Key
+		result Result
+		bytes  int64
+	}
+)
+
+// WithMaxResultBytes sets the size of the largest single result that is kept. Larger results are not cached, so a
+// single large query can't evict every other result. The default is an eighth of the total.
+func WithMaxResultBytes(maxResultBytes int64) Option {
+	return func(cache *LRU) {
+		cache.maxResultBytes = maxResultBytes
+	}
+}
+
+// NewLRU returns an empty cache that holds results up to the total size in bytes.
+func NewLRU(maxBytes int64, options ...Option) *LRU {
+	cache := &LRU{
+		maxBytes:       maxBytes,
+		maxResultBytes: maxBytes / 8,
+		items:          make(map[Key]*list.Element),
+		order:          list.New(),
+	}
+
+	for _, optionFn := range options {
+		optionFn(cache)
+	}
+
+	if cache.maxResultBytes <= 0 || cache.maxResultBytes > maxBytes {
+		cache.maxResultBytes = maxBytes
+	}
+
+	return cache
+}
+
+// Get returns the result for the key, and marks it as the most recently used.
+func (c *LRU) Get(key Key) (Result, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.items[key]
+	if !ok {
+		c.misses++
+		return Result{}, false
+	}
+
+	c.hits++
+	c.order.MoveToFront(element)
+
+	return element.Value.(*item).result, true
+}
+
+// Put stores the result for the key, replacing any result already stored for it, and evicts the least recently used
+// results until the cache is within its size again. It returns false when the result is too large to be kept, in
+// which case any result already stored for the key is removed, as it is out of date.
+func (c *LRU) Put(key Key, result Result) bool {
+	size := sizeOf(key, result)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.items[key]; ok {
+		c.remove(element)
+	}
+
+	if size > c.maxResultBytes {
+		return false
+	}
+
+	c.items[key] = c.order.PushFront(&item{key: key, result: result, bytes: size})
+	c.bytes += size
+
+	for c.bytes > c.maxBytes {
+		c.remove(c.order.Back())
+		c.evictions++
+	}
+
+	return true
+}
+
+// Remove forgets the result for the key, when there is one.
+func (c *LRU) Remove(key Key) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.items[key]; ok {
+		c.remove(element)
+	}
+}
+
+// MaxResultBytes returns the size of the largest single result that is kept.
+func (c *LRU) MaxResultBytes() int64 {
+	return c.maxResultBytes
+}
+
+// Stats returns a snapshot of the size of the cache, and how often results were found.
+func (c *LRU) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return Stats{
+		Results:   len(c.items),
+		Bytes:     c.bytes,
+		MaxBytes:  c.maxBytes,
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+	}
+}
+
+func (c *LRU) remove(element *list.Element) {
+	removed := c.order.Remove(element).(*item)
+	delete(c.items, removed.key)
+	c.bytes -= removed.bytes
+}
+
+// sizeOf approximates the memory used to hold the result, which is dominated by the entries.
+func sizeOf(key Key, result Result) int64 {
+	size := int64(resultOverhead + len(key.Root) + len(key.File) + len(key.Filter) + len(result.Tail))
+	for _, entry := range result.Entries {
+		size += int64(entryOverhead + len(entry))
+	}
+
+	return size
+}
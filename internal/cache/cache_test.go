@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLRU(t *testing.T) {
+	key := Key{Root: "system", File: "syslog", Filter: "ERROR", Lines: 2}
+	result := Result{Inode: 7, Size: 42, Tail: "second\n", Entries: []string{"second", "first"}}
+
+	cache := NewLRU(1 << 20)
+	_, ok := cache.Get(key)
+	assert.False(t, ok)
+
+	require.True(t, cache.Put(key, result))
+	cached, ok := cache.Get(key)
+	require.True(t, ok)
+	assert.Equal(t, result, cached)
+
+	// every part of the key tells queries apart.
+	_, ok = cache.Get(Key{Root: "system", File: "syslog", Filter: "ERROR", Lines: 3})
+	assert.False(t, ok)
+
+	replaced := Result{Inode: 7, Size: 50, Tail: "third\n", Entries: []string{"third", "second"}}
+	require.True(t, cache.Put(key, replaced))
+	cached, _ = cache.Get(key)
+	assert.Equal(t, replaced, cached)
+
+	cache.Remove(key)
+	_, ok = cache.Get(key)
+	assert.False(t, ok)
+
+	stats := cache.Stats()
+	assert.Equal(t, 0, stats.Results)
+	assert.Equal(t, int64(0), stats.Bytes)
+	assert.Equal(t, uint64(2), stats.Hits)
+	assert.Equal(t, uint64(3), stats.Misses)
+}
+
+func TestLRU_Eviction(t *testing.T) {
+	resultOf := func(size int) Result {
+		return Result{Entries: []string{strings.Repeat("x", size)}}
+	}
+	keyOf := func(i int) Key {
+		return Key{File: strconv.Itoa(i)}
+	}
+
+	// room for three results of about 1000 bytes each.
+	cache := NewLRU(3*(1000+resultOverhead+entryOverhead+1), WithMaxResultBytes(2000))
+	for i := 0; i < 3; i++ {
+		require.True(t, cache.Put(keyOf(i), resultOf(1000)))
+	}
+
+	// reading the oldest makes the second the least recently used.
+	_, ok := cache.Get(keyOf(0))
+	require.True(t, ok)
+	require.True(t, cache.Put(keyOf(3), resultOf(1000)))
+
+	for i, expected := range []bool{true, false, true, true} {
+		_, ok := cache.Get(keyOf(i))
+		assert.Equal(t, expected, ok, "result %d", i)
+	}
+	assert.Equal(t, uint64(1), cache.Stats().Evictions)
+	assert.LessOrEqual(t, cache.Stats().Bytes, cache.Stats().MaxBytes)
+
+	// a result over the per result limit is refused, and removes the out of date result for its key.
+	assert.False(t, cache.Put(keyOf(0), resultOf(3000)))
+	_, ok = cache.Get(keyOf(0))
+	assert.False(t, ok)
+	assert.Equal(t, 2, cache.Stats().Results)
+}
@@ -0,0 +1,4 @@
+// Package cache keeps the entries returned for recent queries in memory, so a query repeated against a file that has
+// not changed, or has only grown, does not have to scan the whole file again. The least recently used results are
+// evicted to stay within a byte budget.
+package cache
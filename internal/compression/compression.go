@@ -0,0 +1,266 @@
+package compression
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// EncodingZstd is the Content-Encoding of zstd compressed responses.
+	EncodingZstd = "zstd"
+	// EncodingGzip is the Content-Encoding of gzip compressed responses.
+	EncodingGzip = "gzip"
+
+	encodingIdentity = "identity"
+)
+
+// defaultContentTypes are the media types compressed when none are provided. Every text type is compressed as well.
+var defaultContentTypes = []string{
+	"application/json",
+	"application/x-ndjson",
+	"application/problem+json",
+	"application/yaml",
+}
+
+type (
+	// Option defines the function signature for helper methods to update the Compressor when it is created.
+	Option func(compressor *Compressor)
+
+	// Compressor compresses responses with the most preferred encoding the client accepts. Encoders are pooled, as
+	// creating one costs more than compressing most responses.
+	Compressor struct {
+		encodings    []string
+		contentTypes map[string]bool
+		pools        map[string]*sync.Pool
+	}
+
+	// encoder is the subset of the gzip and zstd writers used to compress a response.
+	encoder interface {
+		io.WriteCloser
+		Flush() error
+		Reset(w io.Writer)
+	}
+
+	// responseWriter decides whether to compress the response when the header is written, as that is when the
+	// content type is known.
+	responseWriter struct {
+		http.ResponseWriter
+		compressor  *Compressor
+		encoding    string
+		encoder     encoder
+		wroteHeader bool
+	}
+)
+
+// WithEncodings sets the encodings the responses can be compressed with, in the order they are preferred when the
+// client accepts several equally. The default is zstd, then gzip.
+func WithEncodings(encodings ...string) Option {
+	return func(compressor *Compressor) {
+		compressor.encodings = encodings
+	}
+}
+
+// WithContentTypes replaces the media types, other than text, that are compressed.
+func WithContentTypes(contentTypes ...string) Option {
+	return func(compressor *Compressor) {
+		compressor.contentTypes = make(map[string]bool, len(contentTypes))
+		for _, contentType := range contentTypes {
+			compressor.contentTypes[contentType] = true
+		}
+	}
+}
+
+// NewCompressor returns a Compressor for the provided options, or an error when an encoding is not supported.
+func NewCompressor(options ...Option) (*Compressor, error) {
+	compressor := &Compressor{
+		encodings: []string{EncodingZstd, EncodingGzip},
+		pools:     make(map[string]*sync.Pool),
+	}
+	WithContentTypes(defaultContentTypes...)(compressor)
+
+	for _, optionFn := range options {
+		optionFn(compressor)
+	}
+
+	for _, encoding := range compressor.encodings {
+		pool, err := newPool(encoding)
+		if err != nil {
+			return nil, err
+		}
+		compressor.pools[encoding] = pool
+	}
+
+	return compressor, nil
+}
+
+// Supported reports whether responses can be compressed with the encoding.
+func Supported(encoding string) bool {
+	return encoding == EncodingZstd || encoding == EncodingGzip
+}
+
+// Middleware compresses the responses of the next handler, when the client accepts one of the encodings and the
+// response is of a compressible media type.
+func (c *Compressor) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		encoding := negotiate(r.Header.Get("Accept-Encoding"), c.encodings)
+		if encoding == "" || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		writer := &responseWriter{ResponseWriter: w, compressor: c, encoding: encoding}
+		defer writer.close()
+
+		next.ServeHTTP(writer, r)
+	})
+}
+
+func newPool(encoding string) (*sync.Pool, error) {
+	switch encoding {
+	case EncodingGzip:
+		return &sync.Pool{New: func() interface{} {
+			return gzip.NewWriter(io.Discard)
+		}}, nil
+	case EncodingZstd:
+		return &sync.Pool{New: func() interface{} {
+			// the options are valid, so the error can be ignored. A single goroutine keeps flushes in order, and
+			// avoids a goroutine per pooled encoder.
+			zstdEncoder, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+			return zstdEncoder
+		}}, nil
+	default:
+		return nil, fmt.Errorf("while creating the %s encoder: the encoding is not supported", encoding)
+	}
+}
+
+// compressible reports whether the media type of the content type is one that is compressed.
+func (c *Compressor) compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return strings.HasPrefix(mediaType, "text/") || c.contentTypes[mediaType]
+}
+
+// WriteHeader starts compressing the body, unless the response has no body, is already encoded, or is not of a
+// compressible media type.
+func (w *responseWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	header := w.Header()
+	if status >= http.StatusOK && status != http.StatusNoContent && status != http.StatusNotModified &&
+		header.Get("Content-Encoding") == "" && w.compressor.compressible(header.Get("Content-Type")) {
+		header.Set("Content-Encoding", w.encoding)
+		header.Del("Content-Length")
+		// the compressed bytes differ from the uncompressed ones, so only a weak validator still holds.
+		if etag := header.Get("ETag"); strings.HasPrefix(etag, `"`) {
+			header.Set("ETag", "W/"+etag)
+		}
+
+		w.encoder = w.compressor.pools[w.encoding].Get().(encoder)
+		w.encoder.Reset(w.ResponseWriter)
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if w.encoder == nil {
+		return w.ResponseWriter.Write(p)
+	}
+
+	return w.encoder.Write(p)
+}
+
+// Flush sends everything compressed so far on to the client, so streamed responses arrive as they are written.
+func (w *responseWriter) Flush() {
+	if w.encoder != nil {
+		if err := w.encoder.Flush(); err != nil {
+			return
+		}
+	}
+
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// close ends the compressed stream, and returns the encoder to its pool.
+func (w *responseWriter) close() {
+	if w.encoder == nil {
+		return
+	}
+
+	_ = w.encoder.Close()
+	w.encoder.Reset(io.Discard)
+	w.compressor.pools[w.encoding].Put(w.encoder)
+	w.encoder = nil
+}
+
+// negotiate returns the encoding the client accepts with the highest quality, preferring the earlier encodings when
+// the client accepts several equally, or an empty string when the response should not be compressed.
+func negotiate(acceptEncoding string, encodings []string) string {
+	if strings.TrimSpace(acceptEncoding) == "" {
+		return ""
+	}
+
+	qualities := make(map[string]float64)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		params := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(params[0]))
+		if coding == "" {
+			continue
+		}
+
+		quality := 1.0
+		for _, param := range params[1:] {
+			key, value, found := strings.Cut(strings.TrimSpace(param), "=")
+			if !found || strings.ToLower(strings.TrimSpace(key)) != "q" {
+				continue
+			}
+
+			if parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+				quality = parsed
+			}
+		}
+
+		qualities[coding] = quality
+	}
+
+	best, bestQuality := "", 0.0
+	for _, encoding := range encodings {
+		quality, ok := qualities[encoding]
+		if !ok {
+			quality = qualities["*"]
+		}
+
+		if quality > bestQuality {
+			best, bestQuality = encoding, quality
+		}
+	}
+
+	// an uncompressed response is preferred when the client says so.
+	if identity, ok := qualities[encodingIdentity]; ok && identity > bestQuality {
+		return ""
+	}
+
+	return best
+}
@@ -0,0 +1,215 @@
+package compression
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiate(t *testing.T) {
+	encodings := []string{EncodingZstd, EncodingGzip}
+
+	tests := map[string]struct {
+		acceptEncoding string
+		expected       string
+	}{
+		"Missing header is not compressed": {},
+		"Single encoding is used": {
+			acceptEncoding: "gzip",
+			expected:       EncodingGzip,
+		},
+		"Equal qualities prefer the earlier encoding": {
+			acceptEncoding: "gzip, deflate, br, zstd",
+			expected:       EncodingZstd,
+		},
+		"Higher quality wins": {
+			acceptEncoding: "zstd;q=0.5, gzip;q=0.8",
+			expected:       EncodingGzip,
+		},
+		"Wildcard accepts every encoding": {
+			acceptEncoding: "*",
+			expected:       EncodingZstd,
+		},
+		"Refused encoding is not used": {
+			acceptEncoding: "zstd;q=0, *",
+			expected:       EncodingGzip,
+		},
+		"Unsupported encodings are not compressed": {
+			acceptEncoding: "br, deflate",
+		},
+		"Preferred identity is not compressed": {
+			acceptEncoding: "identity, gzip;q=0.5",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			assert.Equal(tt, test.expected, negotiate(test.acceptEncoding, encodings))
+		})
+	}
+}
+
+func TestCompressor_Middleware(t *testing.T) {
+	body := strings.Repeat(`{"entries":["Aug  7 21:18:18 the-host-name process[4321]: message"]}`, 100)
+
+	tests := map[string]struct {
+		acceptEncoding string
+		contentType    string
+		status         int
+		etag           string
+		expected       string
+		expectedETag   string
+	}{
+		"JSON is compressed with zstd": {
+			acceptEncoding: "gzip, zstd",
+			contentType:    "application/json",
+			status:         http.StatusOK,
+			etag:           `"abc"`,
+			expected:       EncodingZstd,
+			expectedETag:   `W/"abc"`,
+		},
+		"Text is compressed with gzip": {
+			acceptEncoding: "gzip",
+			contentType:    "text/plain; charset=utf-8",
+			status:         http.StatusOK,
+			etag:           `W/"abc"`,
+			expected:       EncodingGzip,
+			expectedETag:   `W/"abc"`,
+		},
+		"Problems are compressed": {
+			acceptEncoding: "gzip",
+			contentType:    "application/problem+json",
+			status:         http.StatusNotFound,
+			expected:       EncodingGzip,
+		},
+		"Images are not compressed": {
+			acceptEncoding: "gzip",
+			contentType:    "image/png",
+			status:         http.StatusOK,
+			etag:           `"abc"`,
+			expectedETag:   `"abc"`,
+		},
+		"Not modified is not compressed": {
+			acceptEncoding: "gzip",
+			contentType:    "application/json",
+			status:         http.StatusNotModified,
+		},
+		"Unaccepted encodings are not used": {
+			acceptEncoding: "br",
+			contentType:    "application/json",
+			status:         http.StatusOK,
+		},
+	}
+
+	compressor, err := NewCompressor()
+	require.NoError(t, err)
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			handler := compressor.Middleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Content-Type", test.contentType)
+				if test.etag != "" {
+					w.Header().Set("ETag", test.etag)
+				}
+				w.WriteHeader(test.status)
+				if test.status != http.StatusNotModified {
+					_, _ = io.WriteString(w, body)
+				}
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/api/varlog/syslog", nil)
+			req.Header.Set("Accept-Encoding", test.acceptEncoding)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(tt, test.status, rec.Code)
+			assert.Equal(tt, "Accept-Encoding", rec.Header().Get("Vary"))
+			assert.Equal(tt, test.expected, rec.Header().Get("Content-Encoding"))
+			assert.Equal(tt, test.expectedETag, rec.Header().Get("ETag"))
+
+			if test.status == http.StatusNotModified {
+				assert.Empty(tt, rec.Body.Bytes())
+				return
+			}
+
+			decoded := decode(tt, test.expected, rec.Body)
+			assert.Equal(tt, body, decoded)
+			if test.expected != "" {
+				assert.Less(tt, rec.Body.Len(), len(body))
+			}
+		})
+	}
+}
+
+func TestCompressor_MiddlewareFlush(t *testing.T) {
+	for _, encoding := range []string{EncodingZstd, EncodingGzip} {
+		t.Run(encoding, func(tt *testing.T) {
+			compressor, err := NewCompressor(WithEncodings(encoding))
+			require.NoError(tt, err)
+
+			// the second entry is only written once the client has read the first, so the first must have been flushed.
+			firstRead := make(chan struct{})
+			server := httptest.NewServer(compressor.Middleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Content-Type", "application/x-ndjson")
+				_, _ = io.WriteString(w, "\"first\"\n")
+				w.(http.Flusher).Flush()
+
+				<-firstRead
+				_, _ = io.WriteString(w, "\"second\"\n")
+			})))
+			defer server.Close()
+
+			req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+			require.NoError(tt, err)
+			req.Header.Set("Accept-Encoding", encoding)
+
+			resp, err := server.Client().Do(req)
+			require.NoError(tt, err)
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+			require.Equal(tt, encoding, resp.Header.Get("Content-Encoding"))
+
+			reader := bufio.NewReader(decoder(tt, encoding, resp.Body))
+			first, err := reader.ReadString('\n')
+			require.NoError(tt, err)
+			assert.Equal(tt, "\"first\"\n", first)
+			close(firstRead)
+
+			rest, err := io.ReadAll(reader)
+			require.NoError(tt, err)
+			assert.Equal(tt, "\"second\"\n", string(rest))
+		})
+	}
+}
+
+func decode(t *testing.T, encoding string, body io.Reader) string {
+	decoded, err := io.ReadAll(decoder(t, encoding, body))
+	require.NoError(t, err)
+
+	return string(decoded)
+}
+
+func decoder(t *testing.T, encoding string, body io.Reader) io.Reader {
+	switch encoding {
+	case EncodingGzip:
+		gzipReader, err := gzip.NewReader(body)
+		require.NoError(t, err)
+		return gzipReader
+	case EncodingZstd:
+		zstdReader, err := zstd.NewReader(body)
+		require.NoError(t, err)
+		t.Cleanup(zstdReader.Close)
+		return zstdReader
+	default:
+		return body
+	}
+}
@@ -0,0 +1,3 @@
+// Package compression compresses http responses with gzip or zstd, as negotiated with the Accept-Encoding header.
+// Streamed responses stay streamed, as every flush of the response flushes the compressed stream too.
+package compression
@@ -0,0 +1,792 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"gopkg.in/yaml.v3"
+
+	"github.com/skormos/varlog-parser/internal/compression"
+	"github.com/skormos/varlog-parser/internal/policy"
+	"github.com/skormos/varlog-parser/internal/redact"
+)
+
+const (
+	// EnvPrefix is the prefix of every environment variable that overrides a configuration value.
+	EnvPrefix = "VARLOG_"
+
+	// TracingStdout exports traces to stdout, alongside the logs.
+	TracingStdout = "stdout"
+	// TracingOTLP exports traces to an OTLP collector over HTTP.
+	TracingOTLP = "otlp"
+
+	// unixPrefix starts a listen address that is a unix socket path, rather than host:port.
+	unixPrefix = "unix:"
+	// defaultSocketMode lets the user and group running the server connect to its unix sockets.
+	defaultSocketMode fs.FileMode = 0660
+	// maskedValue replaces every secret in a masked configuration.
+	maskedValue = "********"
+)
+
+type (
+	// Config is the full set of tunable values for the service.
+	Config struct {
+		Roots       []Root      `yaml:"roots"`
+		Limits      Limits      `yaml:"limits"`
+		RateLimit   RateLimit   `yaml:"rateLimit"`
+		Cache       Cache       `yaml:"cache"`
+		LineIndex   LineIndex   `yaml:"lineIndex"`
+		SearchIndex SearchIndex `yaml:"searchIndex"`
+		HTTP        HTTP        `yaml:"http"`
+		Auth        Auth        `yaml:"auth"`
+		Policies    []Policy    `yaml:"policies"`
+		Redactions  []Redaction `yaml:"redactions"`
+		Audit       Audit       `yaml:"audit"`
+		Admin       Admin       `yaml:"admin"`
+		Metrics     Metrics     `yaml:"metrics"`
+		Tracing     Tracing     `yaml:"tracing"`
+		Logging     Logging     `yaml:"logging"`
+	}
+
+	// Root is a named log root, which is either a directory or an archive.
+	Root struct {
+		Name string `yaml:"name"`
+		Path string `yaml:"path"`
+	}
+
+	// Limits bound the work done for, and the size of, a single request.
+	Limits struct {
+		DefaultLines  int           `yaml:"defaultLines"`
+		MaxLines      int           `yaml:"maxLines"`
+		ChunkSize     int           `yaml:"chunkSize"`
+		MaxLineLength int           `yaml:"maxLineLength"`
+		MaxScanBytes  int64         `yaml:"maxScanBytes"`
+		MaxScanTime   time.Duration `yaml:"maxScanTime"`
+		ArchiveMemory int64         `yaml:"archiveMemory"`
+	}
+
+	// Cache bounds the memory used to keep the entries returned for recent queries. A maxBytes of 0 disables the cache.
+	// Results larger than maxResultBytes are not kept, so a single large query can't evict every other result.
+	Cache struct {
+		MaxBytes       int64 `yaml:"maxBytes"`
+		MaxResultBytes int64 `yaml:"maxResultBytes"`
+	}
+
+	// LineIndex keeps a sparse index of the lines of every file positioned by the line or since parameters, in sidecar
+	// files in dir, which must not be inside a root. Every interval lines are indexed. An empty dir disables the index,
+	// and the files are searched from the start instead.
+	LineIndex struct {
+		Dir      string `yaml:"dir"`
+		Interval int    `yaml:"interval"`
+	}
+
+	// SearchIndex keeps an index of the text of the files matching the root and file glob patterns in dir, which must
+	// not be inside a root. The files are indexed in the background every interval, a block of at least blockSize
+	// bytes at a time, and filterByText only reads the blocks that could match. An empty dir disables the index.
+	SearchIndex struct {
+		Dir       string        `yaml:"dir"`
+		Roots     []string      `yaml:"roots"`
+		Files     []string      `yaml:"files"`
+		Interval  time.Duration `yaml:"interval"`
+		BlockSize int64         `yaml:"blockSize"`
+	}
+
+	// RateLimit protects the service from clients sending too many requests, and from scanning too many files at once.
+	// A requestsPerSecond or maxConcurrentScans of 0 disables that limit.
+	RateLimit struct {
+		RequestsPerSecond  float64       `yaml:"requestsPerSecond"`
+		Burst              int           `yaml:"burst"`
+		MaxConcurrentScans int           `yaml:"maxConcurrentScans"`
+		MaxQueuedScans     int           `yaml:"maxQueuedScans"`
+		QueueTimeout       time.Duration `yaml:"queueTimeout"`
+	}
+
+	// HTTP configures the http server. The server listens on the host and port, on every unix socket, and on every
+	// socket passed by systemd socket activation when systemd is set, all at once. A port of 0 disables listening on
+	// the host and port, as long as there is another listener.
+	HTTP struct {
+		Host              string        `yaml:"host"`
+		Port              int           `yaml:"port"`
+		UnixSockets       []UnixSocket  `yaml:"unixSockets"`
+		Systemd           bool          `yaml:"systemd"`
+		ReadTimeout       time.Duration `yaml:"readTimeout"`
+		ReadHeaderTimeout time.Duration `yaml:"readHeaderTimeout"`
+		WriteTimeout      time.Duration `yaml:"writeTimeout"`
+		IdleTimeout       time.Duration `yaml:"idleTimeout"`
+		ShutdownTimeout   time.Duration `yaml:"shutdownTimeout"`
+		TLS               TLS           `yaml:"tls"`
+		Compression       Compression   `yaml:"compression"`
+	}
+
+	// Compression configures how API responses are compressed. The encodings are offered in order of preference, and
+	// are used when the client accepts them in its Accept-Encoding header.
+	Compression struct {
+		Enabled   bool     `yaml:"enabled"`
+		Encodings []string `yaml:"encodings"`
+	}
+
+	// UnixSocket is a unix socket the http server listens on. The mode is in octal, and defaults to 0660. The owner and
+	// group are user and group names or ids, and are left as the user running the server when empty.
+	UnixSocket struct {
+		Path  string `yaml:"path"`
+		Mode  string `yaml:"mode"`
+		Owner string `yaml:"owner"`
+		Group string `yaml:"group"`
+	}
+
+	// TLS configures the certificate the http server is served with. TLS is disabled when no certificate is provided.
+	// When a client CA is provided, every client must present a certificate signed by it.
+	TLS struct {
+		CertFile     string `yaml:"certFile"`
+		KeyFile      string `yaml:"keyFile"`
+		ClientCAFile string `yaml:"clientCAFile"`
+	}
+
+	// Auth configures how requests are authenticated. At least one method must be enabled, unless anonymous requests
+	// are allowed.
+	Auth struct {
+		// Anonymous allows requests without credentials, and is meant for local development only.
+		Anonymous          bool     `yaml:"anonymous"`
+		APIKeys            []APIKey `yaml:"apiKeys"`
+		JWT                JWT      `yaml:"jwt"`
+		ClientCertificates bool     `yaml:"clientCertificates"`
+	}
+
+	// APIKey is a named static API key, stored as the hex encoded SHA-256 of the key prefixed with "sha256:".
+	APIKey struct {
+		Name   string   `yaml:"name"`
+		Hash   string   `yaml:"hash"`
+		Groups []string `yaml:"groups"`
+	}
+
+	// JWT configures bearer tokens, which are verified with the keys in a local JWKS file. JWTs are disabled when no
+	// JWKS file is provided.
+	JWT struct {
+		JWKSFile    string `yaml:"jwksFile"`
+		Issuer      string `yaml:"issuer"`
+		Audience    string `yaml:"audience"`
+		GroupsClaim string `yaml:"groupsClaim"`
+	}
+
+	// Policy allows or denies principals, matched by subject or group, access to the files matching the root and file
+	// glob patterns. When no policies are configured, every authenticated principal can read every file.
+	Policy struct {
+		Name       string   `yaml:"name"`
+		Effect     string   `yaml:"effect"`
+		Principals []string `yaml:"principals"`
+		Groups     []string `yaml:"groups"`
+		Roots      []string `yaml:"roots"`
+		Files      []string `yaml:"files"`
+	}
+
+	// Redaction replaces the values matching either a built-in preset or a regular expression in every returned entry.
+	// Principals in any of the exempt groups see the values as they are.
+	Redaction struct {
+		Preset       string   `yaml:"preset"`
+		Name         string   `yaml:"name"`
+		Pattern      string   `yaml:"pattern"`
+		Replacement  string   `yaml:"replacement"`
+		ExemptGroups []string `yaml:"exemptGroups"`
+	}
+
+	// Audit configures the audit log of every file access. The audit log is disabled when no file is provided.
+	Audit struct {
+		File       string `yaml:"file"`
+		MaxSize    int64  `yaml:"maxSize"`
+		MaxBackups int    `yaml:"maxBackups"`
+	}
+
+	// Admin configures the admin endpoints. On the main listener, they are only available to principals in one of
+	// the groups. When listen is set, the admin endpoints and the debug endpoints are also served from a listener of
+	// their own, at host:port or unix:<path>, which only accepts its own API keys.
+	Admin struct {
+		Groups  []string `yaml:"groups"`
+		Listen  string   `yaml:"listen"`
+		APIKeys []APIKey `yaml:"apiKeys"`
+	}
+
+	// Metrics configures the Prometheus metrics served from /metrics. File names are only used as labels when
+	// fileLabels is set, as every file read creates new series.
+	Metrics struct {
+		Enabled    bool `yaml:"enabled"`
+		FileLabels bool `yaml:"fileLabels"`
+	}
+
+	// Tracing configures the OpenTelemetry traces, which are exported to stdout, or to an OTLP collector over HTTP at
+	// the endpoint. Tracing is disabled unless an exporter is provided. Requests without a sampled parent are sampled at
+	// the sampleRatio, between 0 and 1.
+	Tracing struct {
+		Exporter    string  `yaml:"exporter"`
+		Endpoint    string  `yaml:"endpoint"`
+		Insecure    bool    `yaml:"insecure"`
+		SampleRatio float64 `yaml:"sampleRatio"`
+	}
+
+	// Logging configures the operational logger.
+	Logging struct {
+		Level string `yaml:"level"`
+	}
+
+	// ValidationError lists every problem found in a configuration, so they can all be fixed at once.
+	ValidationError struct {
+		Source   string
+		Problems []string
+	}
+)
+
+var (
+	rootNamePattern  = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+	apiKeyHashFormat = regexp.MustCompile(`^sha256:[0-9A-Fa-f]{64}$`)
+)
+
+// Default returns the configuration used for any value that is not provided.
+func Default() Config {
+	return Config{
+		Roots: []Root{
+			{Name: "default", Path: "/var/log"},
+		},
+		Limits: Limits{
+			DefaultLines:  25,
+			MaxLines:      100000,
+			ChunkSize:     64 * 1024,
+			MaxLineLength: 64 * 1024,
+			MaxScanBytes:  1 << 30,
+			MaxScanTime:   30 * time.Second,
+			ArchiveMemory: 32 << 20,
+		},
+		RateLimit: RateLimit{
+			RequestsPerSecond:  10,
+			Burst:              20,
+			MaxConcurrentScans: 8,
+			MaxQueuedScans:     32,
+			QueueTimeout:       10 * time.Second,
+		},
+		Cache: Cache{
+			MaxBytes:       64 << 20,
+			MaxResultBytes: 8 << 20,
+		},
+		LineIndex: LineIndex{
+			Interval: 1000,
+		},
+		SearchIndex: SearchIndex{
+			Interval:  time.Minute,
+			BlockSize: 1 << 20,
+		},
+		HTTP: HTTP{
+			Port:              8080,
+			ReadTimeout:       120 * time.Second,
+			ReadHeaderTimeout: 10 * time.Second,
+			WriteTimeout:      120 * time.Second,
+			ShutdownTimeout:   60 * time.Second,
+			Compression: Compression{
+				Enabled:   true,
+				Encodings: []string{compression.EncodingZstd, compression.EncodingGzip},
+			},
+		},
+		Auth: Auth{
+			JWT: JWT{
+				GroupsClaim: "groups",
+			},
+		},
+		Audit: Audit{
+			MaxSize:    100 << 20,
+			MaxBackups: 5,
+		},
+		Metrics: Metrics{
+			Enabled: true,
+		},
+		Tracing: Tracing{
+			Endpoint:    "localhost:4318",
+			SampleRatio: 1,
+		},
+		Logging: Logging{
+			Level: zerolog.LevelInfoValue,
+		},
+	}
+}
+
+// Load reads the configuration file at the provided path over the defaults, then applies any environment variable
+// overrides. An empty path skips the file, which leaves the defaults and environment. The result is not validated, so
+// callers can apply further overrides before calling Validate.
+func Load(path string, environ []string) (Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		content, err := os.ReadFile(path) //nolint:gosec // the config path is provided by the operator.
+		if err != nil {
+			return Config{}, fmt.Errorf("could not read config file %s: %w", path, err)
+		}
+
+		if err := decode(content, &cfg); err != nil {
+			return Config{}, fmt.Errorf("could not parse config file %s: %w", path, err)
+		}
+	}
+
+	if err := applyEnv(&cfg, environ); err != nil {
+		return Config{}, err
+	}
+
+	return cfg, nil
+}
+
+func decode(content []byte, cfg *Config) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	return nil
+}
+
+// Validate checks every value in the configuration, returning a ValidationError with all the problems found.
+func (c Config) Validate(source string) error {
+	problems := make([]string, 0)
+	addProblem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if len(c.Roots) == 0 {
+		addProblem("roots must contain at least one root")
+	}
+	names := make(map[string]bool, len(c.Roots))
+	for i, root := range c.Roots {
+		if !rootNamePattern.MatchString(root.Name) {
+			addProblem("roots[%d].name %q must start with a letter or digit, and only contain letters, digits, '_', '.' or '-'", i, root.Name)
+		} else if names[root.Name] {
+			addProblem("roots[%d].name %q is used by more than one root", i, root.Name)
+		}
+		names[root.Name] = true
+
+		if root.Path == "" {
+			addProblem("roots[%d].path must not be empty", i)
+		} else if _, err := os.Stat(root.Path); err != nil {
+			addProblem("roots[%d].path %q cannot be used: %v", i, root.Path, err)
+		}
+	}
+
+	if c.Limits.MaxLines < 1 {
+		addProblem("limits.maxLines must be at least 1, got %d", c.Limits.MaxLines)
+	}
+	if c.Limits.DefaultLines < 1 || c.Limits.DefaultLines > c.Limits.MaxLines {
+		addProblem("limits.defaultLines must be between 1 and limits.maxLines (%d), got %d", c.Limits.MaxLines, c.Limits.DefaultLines)
+	}
+	if c.Limits.ChunkSize < 1 {
+		addProblem("limits.chunkSize must be at least 1 byte, got %d", c.Limits.ChunkSize)
+	}
+	if c.Limits.MaxLineLength < 1 {
+		addProblem("limits.maxLineLength must be at least 1 byte, got %d", c.Limits.MaxLineLength)
+	}
+	if c.Limits.MaxScanBytes < 0 {
+		addProblem("limits.maxScanBytes must not be negative, got %d", c.Limits.MaxScanBytes)
+	}
+	if c.Limits.MaxScanTime < 0 {
+		addProblem("limits.maxScanTime must not be negative, got %s", c.Limits.MaxScanTime)
+	}
+	if c.Limits.ArchiveMemory < 0 {
+		addProblem("limits.archiveMemory must not be negative, got %d", c.Limits.ArchiveMemory)
+	}
+
+	c.RateLimit.validate(addProblem)
+
+	c.Cache.validate(addProblem)
+
+	c.LineIndex.validate(c.Roots, addProblem)
+	c.SearchIndex.validate(c.Roots, addProblem)
+
+	c.HTTP.validateListeners(addProblem)
+	timeouts := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"readTimeout", c.HTTP.ReadTimeout},
+		{"readHeaderTimeout", c.HTTP.ReadHeaderTimeout},
+		{"writeTimeout", c.HTTP.WriteTimeout},
+		{"idleTimeout", c.HTTP.IdleTimeout},
+		{"shutdownTimeout", c.HTTP.ShutdownTimeout},
+	}
+	for _, timeout := range timeouts {
+		if timeout.value < 0 {
+			addProblem("http.%s must not be negative, got %s", timeout.name, timeout.value)
+		}
+	}
+
+	c.HTTP.Compression.validate(addProblem)
+
+	tls := c.HTTP.TLS
+	if (tls.CertFile == "") != (tls.KeyFile == "") {
+		addProblem("http.tls.certFile and http.tls.keyFile must be provided together")
+	}
+	if tls.CertFile != "" {
+		if _, err := os.Stat(tls.CertFile); err != nil {
+			addProblem("http.tls.certFile %q cannot be used: %v", tls.CertFile, err)
+		}
+	}
+	if tls.KeyFile != "" {
+		if _, err := os.Stat(tls.KeyFile); err != nil {
+			addProblem("http.tls.keyFile %q cannot be used: %v", tls.KeyFile, err)
+		}
+	}
+	if tls.ClientCAFile != "" {
+		if tls.CertFile == "" {
+			addProblem("http.tls.clientCAFile requires http.tls.certFile and http.tls.keyFile")
+		}
+		if _, err := os.Stat(tls.ClientCAFile); err != nil {
+			addProblem("http.tls.clientCAFile %q cannot be used: %v", tls.ClientCAFile, err)
+		}
+	}
+
+	c.Auth.validate(addProblem)
+	if c.Auth.ClientCertificates && tls.ClientCAFile == "" {
+		addProblem("auth.clientCertificates requires http.tls.clientCAFile")
+	}
+
+	if _, err := c.PolicySet(); err != nil {
+		addProblem("policies are not valid: %v", err)
+	}
+
+	if _, err := c.Redactor(); err != nil {
+		addProblem("redactions are not valid: %v", err)
+	}
+
+	if c.Audit.File != "" {
+		if info, err := os.Stat(filepath.Dir(c.Audit.File)); err != nil || !info.IsDir() {
+			addProblem("audit.file %q must be in an existing directory", c.Audit.File)
+		}
+	}
+	if c.Audit.MaxSize < 1 {
+		addProblem("audit.maxSize must be at least 1 byte, got %d", c.Audit.MaxSize)
+	}
+	if c.Audit.MaxBackups < 0 {
+		addProblem("audit.maxBackups must not be negative, got %d", c.Audit.MaxBackups)
+	}
+
+	c.Admin.validate(addProblem)
+	c.Tracing.validate(addProblem)
+
+	if _, err := zerolog.ParseLevel(c.Logging.Level); err != nil || c.Logging.Level == "" {
+		addProblem("logging.level %q must be one of trace, debug, info, warn, error, fatal, panic or disabled", c.Logging.Level)
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Source: source, Problems: problems}
+	}
+
+	return nil
+}
+
+func (r RateLimit) validate(addProblem func(format string, args ...interface{})) {
+	if r.RequestsPerSecond < 0 {
+		addProblem("rateLimit.requestsPerSecond must not be negative, got %g", r.RequestsPerSecond)
+	}
+	if r.RequestsPerSecond > 0 && r.Burst < 1 {
+		addProblem("rateLimit.burst must be at least 1, got %d", r.Burst)
+	}
+	if r.MaxConcurrentScans < 0 {
+		addProblem("rateLimit.maxConcurrentScans must not be negative, got %d", r.MaxConcurrentScans)
+	}
+	if r.MaxQueuedScans < 0 {
+		addProblem("rateLimit.maxQueuedScans must not be negative, got %d", r.MaxQueuedScans)
+	}
+	if r.MaxConcurrentScans > 0 && r.QueueTimeout <= 0 {
+		addProblem("rateLimit.queueTimeout must be positive, got %s", r.QueueTimeout)
+	}
+}
+
+func (a Auth) validate(addProblem func(format string, args ...interface{})) {
+	if !a.Anonymous && len(a.APIKeys) == 0 && a.JWT.JWKSFile == "" && !a.ClientCertificates {
+		addProblem("auth must enable apiKeys, jwt.jwksFile or clientCertificates, or allow anonymous requests")
+	}
+
+	validateAPIKeys("auth.apiKeys", a.APIKeys, addProblem)
+
+	if a.JWT.JWKSFile != "" {
+		if _, err := os.Stat(a.JWT.JWKSFile); err != nil {
+			addProblem("auth.jwt.jwksFile %q cannot be used: %v", a.JWT.JWKSFile, err)
+		}
+		if a.JWT.GroupsClaim == "" {
+			addProblem("auth.jwt.groupsClaim must not be empty")
+		}
+	}
+}
+
+func (h HTTP) validateListeners(addProblem func(format string, args ...interface{})) {
+	switch {
+	case h.Port == 0 && len(h.UnixSockets) == 0 && !h.Systemd:
+		addProblem("http.port can only be 0 when http.unixSockets or http.systemd are used")
+	case h.Port < 0 || h.Port > 65535:
+		addProblem("http.port must be between 1 and 65535, or 0 to disable it, got %d", h.Port)
+	}
+
+	paths := make(map[string]bool, len(h.UnixSockets))
+	for i, socket := range h.UnixSockets {
+		if info, err := os.Stat(filepath.Dir(socket.Path)); socket.Path == "" || err != nil || !info.IsDir() {
+			addProblem("http.unixSockets[%d].path %q must name a socket in an existing directory", i, socket.Path)
+		} else if paths[socket.Path] {
+			addProblem("http.unixSockets[%d].path %q is used by more than one socket", i, socket.Path)
+		}
+		paths[socket.Path] = true
+
+		if _, err := socket.FileMode(); err != nil {
+			addProblem("http.unixSockets[%d].mode %q must be an octal permission, like 0660", i, socket.Mode)
+		}
+	}
+}
+
+// FileMode returns the permissions of the socket, which are 0660 when no mode is provided.
+func (u UnixSocket) FileMode() (fs.FileMode, error) {
+	if u.Mode == "" {
+		return defaultSocketMode, nil
+	}
+
+	mode, err := strconv.ParseUint(u.Mode, 8, 32)
+	if err != nil {
+		return 0, err
+	}
+	if mode > uint64(fs.ModePerm) {
+		return 0, fmt.Errorf("mode %s has more than permission bits", u.Mode)
+	}
+
+	return fs.FileMode(mode), nil
+}
+
+func (a Admin) validate(addProblem func(format string, args ...interface{})) {
+	if a.Listen == "" {
+		return
+	}
+
+	if path, ok := UnixSocketPath(a.Listen); ok {
+		if info, err := os.Stat(filepath.Dir(path)); path == "" || err != nil || !info.IsDir() {
+			addProblem("admin.listen %q must name a socket in an existing directory", a.Listen)
+		}
+	} else if _, port, err := net.SplitHostPort(a.Listen); err != nil {
+		addProblem("admin.listen %q must be host:port or unix:<path>: %v", a.Listen, err)
+	} else if number, err := strconv.Atoi(port); err != nil || number < 1 || number > 65535 {
+		addProblem("admin.listen %q must have a port between 1 and 65535", a.Listen)
+	}
+
+	if len(a.APIKeys) == 0 {
+		addProblem("admin.apiKeys must contain at least one key when admin.listen is set")
+	}
+	validateAPIKeys("admin.apiKeys", a.APIKeys, addProblem)
+}
+
+// validateAPIKeys checks every key has a unique name and a hash in the expected format. The path is used to name the
+// keys in the problems found.
+func validateAPIKeys(path string, keys []APIKey, addProblem func(format string, args ...interface{})) {
+	names := make(map[string]bool)
+	for i, key := range keys {
+		if key.Name == "" {
+			addProblem("%s[%d].name must not be empty", path, i)
+		} else if names[key.Name] {
+			addProblem("%s[%d].name %q is used by more than one key", path, i, key.Name)
+		}
+		names[key.Name] = true
+
+		if !apiKeyHashFormat.MatchString(key.Hash) {
+			addProblem("%s[%d].hash must be in the format sha256:<64 hex characters>", path, i)
+		}
+	}
+}
+
+// UnixSocketPath returns the path of the socket when the address is in the form unix:<path>.
+func UnixSocketPath(address string) (string, bool) {
+	if !strings.HasPrefix(address, unixPrefix) {
+		return "", false
+	}
+
+	return strings.TrimPrefix(address, unixPrefix), true
+}
+
+// Masked returns a copy of the configuration that is safe to show, with every API key hash replaced.
+func (c Config) Masked() Config {
+	c.Auth.APIKeys = maskAPIKeys(c.Auth.APIKeys)
+	c.Admin.APIKeys = maskAPIKeys(c.Admin.APIKeys)
+
+	return c
+}
+
+func maskAPIKeys(keys []APIKey) []APIKey {
+	if keys == nil {
+		return nil
+	}
+
+	out := make([]APIKey, 0, len(keys))
+	for _, key := range keys {
+		key.Hash = maskedValue
+		out = append(out, key)
+	}
+
+	return out
+}
+
+// PolicySet returns the configured policies as a policy.Set.
+func (c Config) PolicySet() (*policy.Set, error) {
+	policies := make([]policy.Policy, 0, len(c.Policies))
+	for _, p := range c.Policies {
+		policies = append(policies, policy.Policy{
+			Name:       p.Name,
+			Effect:     p.Effect,
+			Principals: p.Principals,
+			Groups:     p.Groups,
+			Roots:      p.Roots,
+			Files:      p.Files,
+		})
+	}
+
+	return policy.NewSet(policies)
+}
+
+// Redactor returns the configured redaction rules as a redact.Redactor.
+func (c Config) Redactor() (*redact.Redactor, error) {
+	rules := make([]redact.Rule, 0, len(c.Redactions))
+	for _, r := range c.Redactions {
+		rules = append(rules, redact.Rule{
+			Preset:       r.Preset,
+			Name:         r.Name,
+			Pattern:      r.Pattern,
+			Replacement:  r.Replacement,
+			ExemptGroups: r.ExemptGroups,
+		})
+	}
+
+	return redact.New(rules)
+}
+
+// TLSEnabled reports whether a certificate has been configured for the http server.
+func (h HTTP) TLSEnabled() bool {
+	return h.TLS.CertFile != ""
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid configuration from %s:\n  - %s", e.Source, strings.Join(e.Problems, "\n  - "))
+}
+
+func (c Compression) validate(addProblem func(format string, args ...interface{})) {
+	if !c.Enabled {
+		return
+	}
+
+	if len(c.Encodings) == 0 {
+		addProblem("http.compression.encodings must not be empty while compression is enabled")
+	}
+
+	seen := make(map[string]bool, len(c.Encodings))
+	for i, encoding := range c.Encodings {
+		if !compression.Supported(encoding) {
+			addProblem("http.compression.encodings[%d] %q must be one of %s or %s", i, encoding,
+				compression.EncodingZstd, compression.EncodingGzip)
+		}
+		if seen[encoding] {
+			addProblem("http.compression.encodings[%d] %q is listed more than once", i, encoding)
+		}
+		seen[encoding] = true
+	}
+}
+
+// validate only bounds maxResultBytes by maxBytes while the cache is enabled, so the default maxResultBytes doesn't
+// refuse a config that disables it.
+func (c Cache) validate(addProblem func(format string, args ...interface{})) {
+	if c.MaxBytes < 0 {
+		addProblem("cache.maxBytes must not be negative, got %d", c.MaxBytes)
+	}
+	if c.MaxResultBytes < 0 || (c.MaxBytes > 0 && c.MaxResultBytes > c.MaxBytes) {
+		addProblem("cache.maxResultBytes must be between 0 and cache.maxBytes, got %d", c.MaxResultBytes)
+	}
+}
+
+// validate checks the interval, and that the sidecars are kept outside every directory root, where they could be
+// listed and read like any other file.
+func (l LineIndex) validate(roots []Root, addProblem func(format string, args ...interface{})) {
+	if l.Interval < 1 {
+		addProblem("lineIndex.interval must be at least 1 line, got %d", l.Interval)
+	}
+
+	if l.Dir != "" {
+		validateIndexDir("lineIndex.dir", l.Dir, roots, addProblem)
+	}
+}
+
+func (s SearchIndex) validate(roots []Root, addProblem func(format string, args ...interface{})) {
+	if s.Interval <= 0 {
+		addProblem("searchIndex.interval must be greater than 0, got %s", s.Interval)
+	}
+	if s.BlockSize < 4096 {
+		addProblem("searchIndex.blockSize must be at least 4096 bytes, got %d", s.BlockSize)
+	}
+
+	for _, pattern := range s.Roots {
+		if _, err := path.Match(pattern, ""); err != nil {
+			addProblem("searchIndex.roots pattern %q is invalid: %v", pattern, err)
+		}
+	}
+	for _, pattern := range s.Files {
+		if _, err := path.Match(pattern, ""); err != nil {
+			addProblem("searchIndex.files pattern %q is invalid: %v", pattern, err)
+		}
+	}
+
+	if s.Dir == "" {
+		return
+	}
+
+	if len(s.Files) == 0 {
+		addProblem("searchIndex.files must have at least one pattern when searchIndex.dir is set")
+	}
+	validateIndexDir("searchIndex.dir", s.Dir, roots, addProblem)
+}
+
+// validateIndexDir checks the directory an index is kept in exists, and is not inside a root, where its files could be
+// read like any log.
+func validateIndexDir(param, dir string, roots []Root, addProblem func(format string, args ...interface{})) {
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		addProblem("%s %q must be an existing directory", param, dir)
+		return
+	}
+
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		addProblem("%s %q cannot be used: %v", param, dir, err)
+		return
+	}
+	for _, root := range roots {
+		rootPath, err := filepath.Abs(root.Path)
+		if err != nil {
+			continue
+		}
+
+		rel, err := filepath.Rel(rootPath, absDir)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			addProblem("%s %q must not be inside root %q, where its files could be read", param, dir, root.Name)
+		}
+	}
+}
+
+func (t Tracing) validate(addProblem func(format string, args ...interface{})) {
+	switch t.Exporter {
+	case "", TracingStdout:
+	case TracingOTLP:
+		if t.Endpoint == "" {
+			addProblem("tracing.endpoint must be provided for the %s exporter", TracingOTLP)
+		}
+	default:
+		addProblem("tracing.exporter %q must be one of %s or %s, or empty to disable tracing", t.Exporter, TracingStdout, TracingOTLP)
+	}
+
+	if t.SampleRatio < 0 || t.SampleRatio > 1 {
+		addProblem("tracing.sampleRatio must be between 0 and 1, got %g", t.SampleRatio)
+	}
+}
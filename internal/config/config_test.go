@@ -0,0 +1,477 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "varlogd.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	logDir := t.TempDir()
+
+	path := writeConfig(t, `
+roots:
+  - name: system
+    path: `+logDir+`
+limits:
+  maxLines: 500
+rateLimit:
+  requestsPerSecond: 2.5
+http:
+  port: 9090
+  readTimeout: 30s
+auth:
+  apiKeys:
+    - name: dashboard
+      hash: sha256:4f2bb2a7e8e5e6b4cbf0fe1ebcd9ec0c1ee4bf6ea5e0d0e2a21e9c5bc0a1bc5b
+      groups: [ops]
+policies:
+  - name: ops-everything
+    effect: allow
+    groups: [ops]
+redactions:
+  - preset: email
+    exemptGroups: [ops]
+  - name: session
+    pattern: 'session=\w+'
+tracing:
+  exporter: otlp
+  sampleRatio: 0.25
+logging:
+  level: debug
+`)
+
+	cfg, err := Load(path, []string{
+		"VARLOG_HTTP_PORT=9191",
+		"VARLOG_HTTP_WRITE_TIMEOUT=5s",
+		"VARLOG_LIMITS_DEFAULT_LINES=10",
+		"VARLOG_LIMITS_MAX_SCAN_TIME=5s",
+		"UNRELATED=value",
+	})
+	require.NoError(t, err)
+	require.NoError(t, cfg.Validate(path))
+
+	assert.Equal(t, []Root{{Name: "system", Path: logDir}}, cfg.Roots)
+	assert.Equal(t, 500, cfg.Limits.MaxLines)
+	assert.Equal(t, 10, cfg.Limits.DefaultLines)
+	assert.Equal(t, Default().Limits.ChunkSize, cfg.Limits.ChunkSize)
+	assert.Equal(t, 5*time.Second, cfg.Limits.MaxScanTime)
+	assert.Equal(t, 2.5, cfg.RateLimit.RequestsPerSecond)
+	assert.Equal(t, Default().RateLimit.Burst, cfg.RateLimit.Burst)
+	assert.Equal(t, 9191, cfg.HTTP.Port)
+	assert.Equal(t, 30*time.Second, cfg.HTTP.ReadTimeout)
+	assert.Equal(t, 5*time.Second, cfg.HTTP.WriteTimeout)
+	assert.Equal(t, "debug", cfg.Logging.Level)
+	assert.Equal(t, TracingOTLP, cfg.Tracing.Exporter)
+	assert.Equal(t, "localhost:4318", cfg.Tracing.Endpoint)
+	assert.Equal(t, 0.25, cfg.Tracing.SampleRatio)
+	assert.Equal(t, []string{"ops"}, cfg.Auth.APIKeys[0].Groups)
+	assert.Equal(t, "groups", cfg.Auth.JWT.GroupsClaim)
+
+	policies, err := cfg.PolicySet()
+	require.NoError(t, err)
+	assert.Equal(t, 1, policies.Len())
+
+	redactor, err := cfg.Redactor()
+	require.NoError(t, err)
+	redacted, count := redactor.Redact("login bob@example.com session=abc123")
+	assert.Equal(t, "login [REDACTED:email] [REDACTED]", redacted)
+	assert.Equal(t, 2, count)
+	assert.False(t, cfg.HTTP.TLSEnabled())
+}
+
+func TestLoad_Errors(t *testing.T) {
+	tests := map[string]struct {
+		content string
+		environ []string
+	}{
+		"Unknown keys are refused": {
+			content: "http:\n  prot: 8080\n",
+		},
+		"Wrong types are refused": {
+			content: "http:\n  port: eighty\n",
+		},
+		"Malformed environment durations are refused": {
+			environ: []string{"VARLOG_HTTP_READ_TIMEOUT=soon"},
+		},
+		"Malformed environment roots are refused": {
+			environ: []string{"VARLOG_ROOTS=/var/log"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			path := ""
+			if test.content != "" {
+				path = writeConfig(tt, test.content)
+			}
+
+			_, err := Load(path, test.environ)
+			assert.Error(tt, err)
+		})
+	}
+
+	_, err := Load(filepath.Join(t.TempDir(), "missing.yaml"), nil)
+	assert.Error(t, err)
+}
+
+func TestConfig_Validate(t *testing.T) {
+	logDir := t.TempDir()
+
+	cfg := Default()
+	cfg.Roots = []Root{{Name: "system", Path: logDir}, {Name: "system", Path: logDir}, {Name: "../up", Path: ""}}
+	cfg.Limits.DefaultLines = 0
+	cfg.Limits.MaxScanTime = -time.Second
+	cfg.RateLimit.Burst = 0
+	cfg.Cache.MaxResultBytes = cfg.Cache.MaxBytes + 1
+	cfg.LineIndex.Interval = 0
+	cfg.SearchIndex.BlockSize = 0
+	cfg.HTTP.Port = 70000
+	cfg.HTTP.ShutdownTimeout = -time.Second
+	cfg.HTTP.TLS.CertFile = filepath.Join(logDir, "missing.pem")
+	cfg.HTTP.TLS.ClientCAFile = filepath.Join(logDir, "ca.pem")
+	cfg.HTTP.Compression.Encodings = []string{"br"}
+	cfg.Auth.APIKeys = []APIKey{{Name: "dashboard", Hash: "s3cret"}, {Name: "dashboard", Hash: "sha256:00"}}
+	cfg.Auth.ClientCertificates = true
+	cfg.Policies = []Policy{{Name: "maybe", Effect: "permit", Groups: []string{"ops"}}}
+	cfg.Redactions = []Redaction{{Preset: "ssn"}}
+	cfg.Audit.File = filepath.Join(logDir, "missing", "audit.log")
+	cfg.Admin.Listen = "localhost"
+	cfg.Tracing.Exporter = "jaeger"
+	cfg.Tracing.SampleRatio = 1.5
+	cfg.Logging.Level = "loud"
+
+	err := cfg.Validate("test")
+	require.Error(t, err)
+
+	var validationErr *ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	assert.Equal(t, "test", validationErr.Source)
+	assert.Len(t, validationErr.Problems, 26)
+	assert.Contains(t, err.Error(), `roots[1].name "system" is used by more than one root`)
+	assert.Contains(t, err.Error(), "http.tls.certFile and http.tls.keyFile must be provided together")
+	assert.Contains(t, err.Error(), `auth.apiKeys[1].name "dashboard" is used by more than one key`)
+	assert.Contains(t, err.Error(), "admin.apiKeys must contain at least one key when admin.listen is set")
+
+	assert.Contains(t, Default().Validate("defaults").Error(), "auth must enable apiKeys")
+
+	roots, err := Load("", []string{"VARLOG_ROOTS=system=" + logDir + ", apps = " + logDir, "VARLOG_AUTH_ANONYMOUS=true"})
+	require.NoError(t, err)
+	assert.NoError(t, roots.Validate("environment"))
+	assert.Equal(t, []Root{{Name: "system", Path: logDir}, {Name: "apps", Path: logDir}}, roots.Roots)
+}
+
+func TestEnvNames(t *testing.T) {
+	names := EnvNames()
+
+	assert.Equal(t, "VARLOG_ROOTS", names["roots"])
+	assert.Equal(t, "VARLOG_HTTP_READ_HEADER_TIMEOUT", names["http.readHeaderTimeout"])
+	assert.Equal(t, "VARLOG_HTTP_TLS_CERT_FILE", names["http.tls.certFile"])
+	assert.Equal(t, "VARLOG_HTTP_TLS_CLIENT_CA_FILE", names["http.tls.clientCAFile"])
+	assert.Equal(t, "VARLOG_RATE_LIMIT_MAX_CONCURRENT_SCANS", names["rateLimit.maxConcurrentScans"])
+	assert.Equal(t, "VARLOG_ADMIN_GROUPS", names["admin.groups"])
+	assert.Equal(t, "VARLOG_LOGGING_LEVEL", names["logging.level"])
+}
+
+func TestConfig_Masked(t *testing.T) {
+	hash := "sha256:4f2bb2a7e8e5e6b4cbf0fe1ebcd9ec0c1ee4bf6ea5e0d0e2a21e9c5bc0a1bc5b"
+
+	cfg := Default()
+	cfg.Auth.APIKeys = []APIKey{{Name: "dashboard", Hash: hash, Groups: []string{"ops"}}}
+	cfg.Admin.APIKeys = []APIKey{{Name: "oncall", Hash: hash}}
+
+	masked := cfg.Masked()
+	assert.Equal(t, []APIKey{{Name: "dashboard", Hash: maskedValue, Groups: []string{"ops"}}}, masked.Auth.APIKeys)
+	assert.Equal(t, []APIKey{{Name: "oncall", Hash: maskedValue}}, masked.Admin.APIKeys)
+	assert.Equal(t, hash, cfg.Auth.APIKeys[0].Hash, "the original configuration is left as it was")
+	assert.Equal(t, cfg.Limits, masked.Limits)
+}
+
+func TestAdmin_Listen(t *testing.T) {
+	socketDir := t.TempDir()
+	keys := []APIKey{{Name: "oncall", Hash: "sha256:4f2bb2a7e8e5e6b4cbf0fe1ebcd9ec0c1ee4bf6ea5e0d0e2a21e9c5bc0a1bc5b"}}
+
+	tests := map[string]struct {
+		listen        string
+		expectedValid bool
+	}{
+		"Host and port is valid": {
+			listen:        "127.0.0.1:9091",
+			expectedValid: true,
+		},
+		"Socket in an existing directory is valid": {
+			listen:        "unix:" + filepath.Join(socketDir, "admin.sock"),
+			expectedValid: true,
+		},
+		"Socket in a missing directory is invalid": {
+			listen: "unix:" + filepath.Join(socketDir, "missing", "admin.sock"),
+		},
+		"Missing port is invalid": {
+			listen: "localhost",
+		},
+		"Out of range port is invalid": {
+			listen: ":70000",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			problems := make([]string, 0)
+			Admin{Listen: test.listen, APIKeys: keys}.validate(func(format string, args ...interface{}) {
+				problems = append(problems, format)
+			})
+
+			if test.expectedValid {
+				assert.Empty(tt, problems)
+			} else {
+				assert.Len(tt, problems, 1)
+			}
+		})
+	}
+}
+
+func TestHTTP_Listeners(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "varlogd.sock")
+
+	tests := map[string]struct {
+		http             HTTP
+		expectedProblems int
+	}{
+		"Port alone is valid": {
+			http: HTTP{Port: 8080},
+		},
+		"Port 0 with a unix socket is valid": {
+			http: HTTP{UnixSockets: []UnixSocket{{Path: socketPath, Mode: "0600", Owner: "varlogd"}}},
+		},
+		"Port 0 with systemd is valid": {
+			http: HTTP{Systemd: true},
+		},
+		"Port 0 without another listener is invalid": {
+			expectedProblems: 1,
+		},
+		"Socket with a malformed mode is invalid": {
+			http:             HTTP{Port: 8080, UnixSockets: []UnixSocket{{Path: socketPath, Mode: "rw-rw----"}}},
+			expectedProblems: 1,
+		},
+		"Socket with more than permission bits is invalid": {
+			http:             HTTP{Port: 8080, UnixSockets: []UnixSocket{{Path: socketPath, Mode: "4755"}}},
+			expectedProblems: 1,
+		},
+		"Socket used twice is invalid": {
+			http:             HTTP{Port: 8080, UnixSockets: []UnixSocket{{Path: socketPath}, {Path: socketPath}}},
+			expectedProblems: 1,
+		},
+		"Socket in a missing directory is invalid": {
+			http:             HTTP{Port: 8080, UnixSockets: []UnixSocket{{Path: "/missing/varlogd.sock"}}},
+			expectedProblems: 1,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			problems := make([]string, 0)
+			test.http.validateListeners(func(format string, args ...interface{}) {
+				problems = append(problems, format)
+			})
+
+			assert.Len(tt, problems, test.expectedProblems)
+		})
+	}
+
+	mode, err := UnixSocket{}.FileMode()
+	require.NoError(t, err)
+	assert.Equal(t, defaultSocketMode, mode)
+}
+
+func TestCache_Validate(t *testing.T) {
+	tests := map[string]struct {
+		cache            Cache
+		expectedProblems int
+	}{
+		"Default is valid": {
+			cache: Default().Cache,
+		},
+		"Disabled cache is valid with the default result limit": {
+			cache: Cache{MaxBytes: 0, MaxResultBytes: Default().Cache.MaxResultBytes},
+		},
+		"Result limit over the cache size is invalid": {
+			cache:            Cache{MaxBytes: 1 << 20, MaxResultBytes: 2 << 20},
+			expectedProblems: 1,
+		},
+		"Negative sizes are invalid": {
+			cache:            Cache{MaxBytes: -1, MaxResultBytes: -1},
+			expectedProblems: 2,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			problems := make([]string, 0)
+			test.cache.validate(func(format string, args ...interface{}) {
+				problems = append(problems, format)
+			})
+
+			assert.Len(tt, problems, test.expectedProblems)
+		})
+	}
+
+	// disabling the cache from the environment leaves the rest of the config valid.
+	cfg, err := Load("", []string{"VARLOG_ROOTS=system=" + t.TempDir(), "VARLOG_AUTH_ANONYMOUS=true",
+		"VARLOG_CACHE_MAX_BYTES=0"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), cfg.Cache.MaxBytes)
+	assert.NoError(t, cfg.Validate("environment"))
+}
+
+func TestLineIndex_Validate(t *testing.T) {
+	logDir := t.TempDir()
+	indexDir := t.TempDir()
+	nested := filepath.Join(logDir, "index")
+	require.NoError(t, os.Mkdir(nested, 0o700))
+	roots := []Root{{Name: "system", Path: logDir}}
+
+	tests := map[string]struct {
+		lineIndex        LineIndex
+		expectedProblems int
+	}{
+		"Default is valid": {
+			lineIndex: Default().LineIndex,
+		},
+		"Directory outside every root is valid": {
+			lineIndex: LineIndex{Dir: indexDir, Interval: 100},
+		},
+		"Interval below 1 is invalid": {
+			lineIndex:        LineIndex{Interval: 0},
+			expectedProblems: 1,
+		},
+		"Missing directory is invalid": {
+			lineIndex:        LineIndex{Dir: filepath.Join(indexDir, "missing"), Interval: 100},
+			expectedProblems: 1,
+		},
+		"Directory inside a root is invalid": {
+			lineIndex:        LineIndex{Dir: nested, Interval: 100},
+			expectedProblems: 1,
+		},
+		"Root directory itself is invalid": {
+			lineIndex:        LineIndex{Dir: logDir, Interval: 100},
+			expectedProblems: 1,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			problems := make([]string, 0)
+			test.lineIndex.validate(roots, func(format string, args ...interface{}) {
+				problems = append(problems, format)
+			})
+
+			assert.Len(tt, problems, test.expectedProblems)
+		})
+	}
+}
+
+func TestSearchIndex_Validate(t *testing.T) {
+	logDir := t.TempDir()
+	indexDir := t.TempDir()
+	roots := []Root{{Name: "system", Path: logDir}}
+	valid := func(update func(searchIndex *SearchIndex)) SearchIndex {
+		searchIndex := Default().SearchIndex
+		searchIndex.Dir = indexDir
+		searchIndex.Files = []string{"syslog*"}
+		update(&searchIndex)
+		return searchIndex
+	}
+
+	tests := map[string]struct {
+		searchIndex      SearchIndex
+		expectedProblems int
+	}{
+		"Default is valid": {
+			searchIndex: Default().SearchIndex,
+		},
+		"Directory with file patterns is valid": {
+			searchIndex: valid(func(*SearchIndex) {}),
+		},
+		"Directory without file patterns is invalid": {
+			searchIndex:      valid(func(s *SearchIndex) { s.Files = nil }),
+			expectedProblems: 1,
+		},
+		"Directory inside a root is invalid": {
+			searchIndex:      valid(func(s *SearchIndex) { s.Dir = logDir }),
+			expectedProblems: 1,
+		},
+		"Invalid patterns are invalid": {
+			searchIndex:      valid(func(s *SearchIndex) { s.Roots, s.Files = []string{"["}, []string{"syslog", "["} }),
+			expectedProblems: 2,
+		},
+		"Interval of 0 is invalid": {
+			searchIndex:      valid(func(s *SearchIndex) { s.Interval = 0 }),
+			expectedProblems: 1,
+		},
+		"Block size below 4096 is invalid": {
+			searchIndex:      valid(func(s *SearchIndex) { s.BlockSize = 1024 }),
+			expectedProblems: 1,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			problems := make([]string, 0)
+			test.searchIndex.validate(roots, func(format string, args ...interface{}) {
+				problems = append(problems, format)
+			})
+
+			assert.Len(tt, problems, test.expectedProblems)
+		})
+	}
+}
+
+func TestCompression_Validate(t *testing.T) {
+	tests := map[string]struct {
+		compression      Compression
+		expectedProblems int
+	}{
+		"Default encodings are valid": {
+			compression: Default().HTTP.Compression,
+		},
+		"Disabled compression needs no encodings": {
+			compression: Compression{},
+		},
+		"Enabled without encodings is invalid": {
+			compression:      Compression{Enabled: true},
+			expectedProblems: 1,
+		},
+		"Unsupported encoding is invalid": {
+			compression:      Compression{Enabled: true, Encodings: []string{"gzip", "br"}},
+			expectedProblems: 1,
+		},
+		"Encoding listed twice is invalid": {
+			compression:      Compression{Enabled: true, Encodings: []string{"gzip", "gzip"}},
+			expectedProblems: 1,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			problems := make([]string, 0)
+			test.compression.validate(func(format string, args ...interface{}) {
+				problems = append(problems, format)
+			})
+
+			assert.Len(tt, problems, test.expectedProblems)
+		})
+	}
+}
@@ -0,0 +1,3 @@
+// Package config loads and validates the service configuration from a YAML file, with overrides from environment
+// variables.
+package config
@@ -0,0 +1,176 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// rootsEnv is the one override that does not follow the naming of the yaml keys, as roots is a list of pairs. The value
+// is a comma separated list of name=path pairs, which replaces every root from the file.
+const rootsEnv = EnvPrefix + "ROOTS"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// EnvNames returns the name of the environment variable that overrides every scalar value in the configuration, keyed
+// by the dotted yaml path of the value.
+func EnvNames() map[string]string {
+	out := map[string]string{"roots": rootsEnv}
+	walkEnv(reflect.ValueOf(&Config{}).Elem(), "", "", func(path, env string, _ reflect.Value) {
+		out[path] = env
+	})
+
+	return out
+}
+
+// applyEnv overrides the configuration with every VARLOG_ environment variable. Names are built from the yaml path of
+// the value, with each key changed from camel case to upper snake case, so http.readTimeout is VARLOG_HTTP_READ_TIMEOUT.
+func applyEnv(cfg *Config, environ []string) error {
+	env := make(map[string]string)
+	for _, pair := range environ {
+		if key, value, found := strings.Cut(pair, "="); found && strings.HasPrefix(key, EnvPrefix) {
+			env[key] = value
+		}
+	}
+
+	if value, ok := env[rootsEnv]; ok {
+		roots, err := parseRoots(value)
+		if err != nil {
+			return fmt.Errorf("could not use %s: %w", rootsEnv, err)
+		}
+		cfg.Roots = roots
+	}
+
+	var firstErr error
+	walkEnv(reflect.ValueOf(cfg).Elem(), "", "", func(_, name string, field reflect.Value) {
+		value, ok := env[name]
+		if !ok || firstErr != nil {
+			return
+		}
+
+		if err := setValue(field, value); err != nil {
+			firstErr = fmt.Errorf("could not use %s=%q: %w", name, value, err)
+		}
+	})
+
+	return firstErr
+}
+
+// walkEnv calls the provided function with every scalar field reachable from the struct, skipping slices of structs.
+func walkEnv(value reflect.Value, path, env string, fn func(path, env string, field reflect.Value)) {
+	for i := 0; i < value.NumField(); i++ {
+		fieldType := value.Type().Field(i)
+		key := strings.Split(fieldType.Tag.Get("yaml"), ",")[0]
+		if key == "" || key == "-" {
+			continue
+		}
+
+		fieldPath := key
+		if path != "" {
+			fieldPath = path + "." + key
+		}
+		fieldEnv := env + "_" + upperSnake(key)
+		if env == "" {
+			fieldEnv = EnvPrefix + upperSnake(key)
+		}
+
+		field := value.Field(i)
+		switch {
+		case field.Kind() == reflect.Struct:
+			walkEnv(field, fieldPath, fieldEnv, fn)
+		case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.Struct:
+			continue
+		default:
+			fn(fieldPath, fieldEnv, field)
+		}
+	}
+}
+
+func setValue(field reflect.Value, value string) error {
+	if field.Type() == durationType {
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(duration))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(parsed)
+	case reflect.Int, reflect.Int64:
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(parsed)
+	case reflect.Float64:
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(parsed)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported list type %s", field.Type())
+		}
+		parts := make([]string, 0)
+		for _, part := range strings.Split(value, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				parts = append(parts, part)
+			}
+		}
+		field.Set(reflect.ValueOf(parts))
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+
+	return nil
+}
+
+func parseRoots(value string) ([]Root, error) {
+	out := make([]Root, 0)
+	for _, pair := range strings.Split(value, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+
+		name, path, found := strings.Cut(pair, "=")
+		if !found {
+			return nil, fmt.Errorf("root %q must be in the form name=path", pair)
+		}
+		out = append(out, Root{Name: strings.TrimSpace(name), Path: strings.TrimSpace(path)})
+	}
+
+	return out, nil
+}
+
+// upperSnake changes a camel case yaml key to upper snake case, eg. readHeaderTimeout becomes READ_HEADER_TIMEOUT.
+// Acronyms are kept together, so clientCAFile becomes CLIENT_CA_FILE.
+func upperSnake(key string) string {
+	runes := []rune(key)
+
+	var builder strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			afterLower := !unicode.IsUpper(runes[i-1])
+			endsAcronym := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if afterLower || endsAcronym {
+				builder.WriteByte('_')
+			}
+		}
+		builder.WriteRune(unicode.ToUpper(r))
+	}
+
+	return builder.String()
+}
@@ -0,0 +1,4 @@
+// Package admin contains the http handlers for operating the service. On the main listener, they are only served to
+// principals in one of the admin groups. The admin listener serves them alongside the debug endpoints, for changing the
+// log level, showing the configuration and profiling the process.
+package admin
@@ -0,0 +1,286 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/pprof"
+	"sync/atomic"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+	"gopkg.in/yaml.v3"
+
+	v1 "github.com/skormos/varlog-parser/internal/api/rest/v1"
+	"github.com/skormos/varlog-parser/internal/auth"
+	"github.com/skormos/varlog-parser/internal/config"
+	"github.com/skormos/varlog-parser/internal/problem"
+	"github.com/skormos/varlog-parser/internal/ratelimit"
+	"github.com/skormos/varlog-parser/internal/searchindex"
+)
+
+const (
+	mediaTypeJSON = "application/json"
+	mediaTypeYAML = "application/yaml"
+
+	// maxLogLevelBody bounds the body of a log level change, which only ever holds a single short value.
+	maxLogLevelBody = 1024
+)
+
+type (
+	// Handler serves the admin endpoints.
+	Handler struct {
+		logger zerolog.Logger
+		// groups holds the []string of groups allowed to use the endpoints, which is replaced as a whole on reload.
+		groups atomic.Value
+		// config holds the masked config.Config in use, which is replaced as a whole on reload.
+		config  atomic.Value
+		clients *ratelimit.ClientLimiter
+		scans   *ratelimit.ConcurrencyLimiter
+		index   SearchIndex
+	}
+
+	// SearchIndex reports the files in the search index, and rebuilds it from scratch.
+	SearchIndex interface {
+		Status() []searchindex.FileStatus
+		Rebuild()
+	}
+
+	// SearchIndexResponse reports every file in the search index, and how much of it has been indexed.
+	SearchIndexResponse struct {
+		Files []searchindex.FileStatus `json:"files"`
+	}
+
+	// Option defines the function signature for helper methods to update the Handler when it is created.
+	Option func(h *Handler)
+
+	// LimitsResponse reports the rate and concurrency limits, and how much of them is in use.
+	LimitsResponse struct {
+		RateLimit   *ratelimit.ClientStats      `json:"rateLimit,omitempty"`
+		Concurrency *ratelimit.ConcurrencyStats `json:"concurrency,omitempty"`
+	}
+
+	// LogLevel is the level of the operational logger, both as reported and as requested.
+	LogLevel struct {
+		Level string `json:"level"`
+	}
+)
+
+// NewHandler returns a Handler that only serves principals in one of the groups. Without any groups, every endpoint is
+// forbidden.
+func NewHandler(logCtx zerolog.Context, groups []string, options ...Option) *Handler {
+	// the context is copied before adding to it, as it is shared by every handler and would otherwise be overwritten.
+	handler := &Handler{
+		logger: logCtx.Logger().With().Str("handler", "admin").Logger(),
+	}
+	handler.groups.Store(groups)
+
+	for _, optionFn := range options {
+		optionFn(handler)
+	}
+
+	return handler
+}
+
+// WithRateLimiter reports the per client rate limits from the limits endpoint.
+func WithRateLimiter(clients *ratelimit.ClientLimiter) Option {
+	return func(h *Handler) {
+		h.clients = clients
+	}
+}
+
+// WithConfig reports the configuration from the config endpoint, until it is replaced by SetConfig.
+func WithConfig(cfg config.Config) Option {
+	return func(h *Handler) {
+		h.SetConfig(cfg)
+	}
+}
+
+// WithConcurrencyLimiter reports the concurrent scan limits from the limits endpoint.
+func WithConcurrencyLimiter(scans *ratelimit.ConcurrencyLimiter) Option {
+	return func(h *Handler) {
+		h.scans = scans
+	}
+}
+
+// WithSearchIndex reports the files in the search index from the searchindex endpoint, and rebuilds it from the
+// searchindex/rebuild endpoint. Without it, neither endpoint is served.
+func WithSearchIndex(index SearchIndex) Option {
+	return func(h *Handler) {
+		h.index = index
+	}
+}
+
+// SetGroups replaces the groups allowed to use the endpoints.
+func (h *Handler) SetGroups(groups []string) {
+	h.groups.Store(groups)
+}
+
+// SetConfig replaces the configuration reported by the config endpoint. Secrets are masked before it is stored.
+func (h *Handler) SetConfig(cfg config.Config) {
+	h.config.Store(cfg.Masked())
+}
+
+// Routes returns the router for every admin endpoint.
+func (h *Handler) Routes() http.Handler {
+	router := chi.NewRouter()
+	router.Use(h.authorize)
+
+	router.Get("/limits", h.getLimits)
+	if h.index != nil {
+		router.Get("/searchindex", h.getSearchIndex)
+		router.Post("/searchindex/rebuild", h.rebuildSearchIndex)
+	}
+
+	return router
+}
+
+// DebugRoutes returns the router for the admin listener, with every admin endpoint under /admin, and the runtime
+// profiles under /debug/pprof. The groups are not checked, as the listener authenticates with keys of its own.
+func (h *Handler) DebugRoutes() http.Handler {
+	router := chi.NewRouter()
+
+	router.Route("/admin", func(admin chi.Router) {
+		admin.Get("/limits", h.getLimits)
+		admin.Get("/loglevel", h.getLogLevel)
+		admin.Put("/loglevel", h.putLogLevel)
+		admin.Get("/config", h.getConfig)
+		if h.index != nil {
+			admin.Get("/searchindex", h.getSearchIndex)
+			admin.Post("/searchindex/rebuild", h.rebuildSearchIndex)
+		}
+	})
+
+	router.Route("/debug/pprof", func(debug chi.Router) {
+		debug.Get("/", pprof.Index)
+		debug.Get("/cmdline", pprof.Cmdline)
+		debug.Get("/profile", pprof.Profile)
+		debug.Get("/symbol", pprof.Symbol)
+		debug.Post("/symbol", pprof.Symbol)
+		debug.Get("/trace", pprof.Trace)
+		debug.Get("/{profile}", pprof.Index)
+	})
+
+	return router
+}
+
+// getLogLevel responds with the level of the operational logger.
+func (h *Handler) getLogLevel(w http.ResponseWriter, _ *http.Request) {
+	h.respond(w, LogLevel{Level: zerolog.GlobalLevel().String()})
+}
+
+// putLogLevel changes the level of the operational logger until it is changed again, or the configuration is reloaded.
+func (h *Handler) putLogLevel(w http.ResponseWriter, r *http.Request) {
+	var req LogLevel
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxLogLevelBody)).Decode(&req); err != nil {
+		problem.Respond(w, r, http.StatusBadRequest, v1.InvalidParam, fmt.Sprintf("body must be a log level: %v", err))
+		return
+	}
+
+	level, err := zerolog.ParseLevel(req.Level)
+	if err != nil || req.Level == "" {
+		problem.Respond(w, r, http.StatusBadRequest, v1.InvalidParam,
+			fmt.Sprintf("level %q must be one of trace, debug, info, warn, error, fatal, panic or disabled", req.Level))
+		return
+	}
+
+	previous := zerolog.GlobalLevel()
+	zerolog.SetGlobalLevel(level)
+	// logged at warn, so the change is recorded even when the level is raised past info.
+	h.logger.Warn().Msgf("log level changed from %s to %s", previous, level)
+
+	h.respond(w, LogLevel{Level: level.String()})
+}
+
+// getConfig responds with the configuration in use, as YAML in the same layout as the configuration file.
+func (h *Handler) getConfig(w http.ResponseWriter, r *http.Request) {
+	cfg, ok := h.config.Load().(config.Config)
+	if !ok {
+		problem.Respond(w, r, http.StatusInternalServerError, v1.InternalError, "no configuration has been provided")
+		return
+	}
+
+	bytes, err := yaml.Marshal(cfg)
+	if err != nil {
+		h.logger.Err(err).Msg("while marshalling the configuration for http response")
+		problem.Respond(w, r, http.StatusInternalServerError, v1.InternalError, "")
+		return
+	}
+
+	w.Header().Set("Content-Type", mediaTypeYAML)
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(bytes); err != nil {
+		h.logger.Err(err).Msg("while writing the configuration to Response")
+	}
+}
+
+// getLimits responds with the current limits and usage.
+func (h *Handler) getLimits(w http.ResponseWriter, _ *http.Request) {
+	resp := LimitsResponse{}
+	if h.clients != nil {
+		stats := h.clients.Stats()
+		resp.RateLimit = &stats
+	}
+	if h.scans != nil {
+		stats := h.scans.Stats()
+		resp.Concurrency = &stats
+	}
+
+	h.respond(w, resp)
+}
+
+// getSearchIndex responds with every file in the search index.
+func (h *Handler) getSearchIndex(w http.ResponseWriter, _ *http.Request) {
+	h.respond(w, SearchIndexResponse{Files: h.index.Status()})
+}
+
+// rebuildSearchIndex removes the search index, which is then built again in the background. It responds straight away,
+// and searches read the whole of every file until it has been.
+func (h *Handler) rebuildSearchIndex(w http.ResponseWriter, _ *http.Request) {
+	h.index.Rebuild()
+	h.logger.Warn().Msg("search index rebuild requested")
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// authorize refuses requests from principals outside of the admin groups.
+func (h *Handler) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ := auth.PrincipalFrom(r.Context())
+		if !memberOf(principal.Groups, h.groups.Load().([]string)) {
+			problem.Respond(w, r, http.StatusForbidden, v1.Forbidden,
+				"the admin endpoints are only available to the admin groups")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (h *Handler) respond(w http.ResponseWriter, input interface{}) {
+	bytes, err := json.Marshal(input)
+	if err != nil {
+		h.logger.Err(err).Msgf("while marshalling %v for http response", input)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", mediaTypeJSON)
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(bytes); err != nil {
+		h.logger.Err(err).Msgf("while writing %v as bytes to Response", input)
+	}
+}
+
+func memberOf(groups, allowed []string) bool {
+	for _, group := range groups {
+		for _, candidate := range allowed {
+			if group == candidate {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,175 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	v1 "github.com/skormos/varlog-parser/internal/api/rest/v1"
+	"github.com/skormos/varlog-parser/internal/auth"
+	"github.com/skormos/varlog-parser/internal/config"
+	"github.com/skormos/varlog-parser/internal/problem"
+)
+
+// serve sends the request to the handler, and returns the response.
+func serve(handler http.Handler, method, target, body string, principal *auth.Principal) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if principal != nil {
+		r = r.WithContext(auth.WithPrincipal(r.Context(), *principal))
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+// decodeProblem decodes the problem document of the response.
+func decodeProblem(t *testing.T, w *httptest.ResponseRecorder) v1.Problem {
+	t.Helper()
+
+	require.Equal(t, problem.MediaType, w.Header().Get("Content-Type"))
+	var out v1.Problem
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &out))
+	return out
+}
+
+func TestHandler_PutLogLevel(t *testing.T) {
+	tests := map[string]struct {
+		body           string
+		expectedStatus int
+		expectedLevel  zerolog.Level
+	}{
+		"Valid level is applied": {
+			body:           `{"level":"debug"}`,
+			expectedStatus: http.StatusOK,
+			expectedLevel:  zerolog.DebugLevel,
+		},
+		"Unknown level is refused": {
+			body:           `{"level":"loud"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedLevel:  zerolog.WarnLevel,
+		},
+		"Missing level is refused": {
+			body:           `{}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedLevel:  zerolog.WarnLevel,
+		},
+		"Body that is not JSON is refused": {
+			body:           `debug`,
+			expectedStatus: http.StatusBadRequest,
+			expectedLevel:  zerolog.WarnLevel,
+		},
+		"Body over the limit is refused": {
+			body:           `{"level":"debug","padding":"` + strings.Repeat("x", maxLogLevelBody) + `"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedLevel:  zerolog.WarnLevel,
+		},
+	}
+
+	previous := zerolog.GlobalLevel()
+	defer zerolog.SetGlobalLevel(previous)
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			zerolog.SetGlobalLevel(zerolog.WarnLevel)
+			handler := NewHandler(zerolog.Nop().With(), nil).DebugRoutes()
+
+			w := serve(handler, http.MethodPut, "/admin/loglevel", test.body, nil)
+			require.Equal(tt, test.expectedStatus, w.Code)
+			assert.Equal(tt, test.expectedLevel, zerolog.GlobalLevel())
+
+			if test.expectedStatus != http.StatusOK {
+				assert.Equal(tt, v1.InvalidParam, decodeProblem(tt, w).Code)
+				return
+			}
+			var level LogLevel
+			require.NoError(tt, json.Unmarshal(w.Body.Bytes(), &level))
+			assert.Equal(tt, test.expectedLevel.String(), level.Level)
+		})
+	}
+}
+
+func TestHandler_GetConfig(t *testing.T) {
+	cfg := config.Config{
+		Auth: config.Auth{APIKeys: []config.APIKey{
+			{Name: "dashboard", Hash: auth.HashAPIKey("main secret"), Groups: []string{"readers"}},
+		}},
+		Admin: config.Admin{
+			Listen:  "localhost:9091",
+			APIKeys: []config.APIKey{{Name: "operator", Hash: auth.HashAPIKey("admin secret")}},
+		},
+	}
+
+	w := serve(NewHandler(zerolog.Nop().With(), nil, WithConfig(cfg)).DebugRoutes(), http.MethodGet,
+		"/admin/config", "", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, mediaTypeYAML, w.Header().Get("Content-Type"))
+
+	// every hash is masked, while the rest of the configuration is returned as it is.
+	assert.NotContains(t, w.Body.String(), "sha256:")
+	var served config.Config
+	require.NoError(t, yaml.Unmarshal(w.Body.Bytes(), &served))
+	masked := cfg.Masked()
+	assert.Equal(t, masked.Auth.APIKeys, served.Auth.APIKeys)
+	assert.Equal(t, masked.Admin.APIKeys[0].Hash, served.Admin.APIKeys[0].Hash)
+	assert.Equal(t, "localhost:9091", served.Admin.Listen)
+
+	// without a configuration, there is nothing to report.
+	w = serve(NewHandler(zerolog.Nop().With(), nil).DebugRoutes(), http.MethodGet, "/admin/config", "", nil)
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, v1.InternalError, decodeProblem(t, w).Code)
+}
+
+func TestHandler_Authorize(t *testing.T) {
+	tests := map[string]struct {
+		groups         []string
+		principal      *auth.Principal
+		expectedStatus int
+	}{
+		"Principal in an admin group is allowed": {
+			groups:         []string{"operators"},
+			principal:      &auth.Principal{Subject: "alice", Groups: []string{"readers", "operators"}},
+			expectedStatus: http.StatusOK,
+		},
+		"Principal outside of the admin groups is forbidden": {
+			groups:         []string{"operators"},
+			principal:      &auth.Principal{Subject: "bob", Groups: []string{"readers"}},
+			expectedStatus: http.StatusForbidden,
+		},
+		"Request without a principal is forbidden": {
+			groups:         []string{"operators"},
+			expectedStatus: http.StatusForbidden,
+		},
+		"Every principal is forbidden without admin groups": {
+			principal:      &auth.Principal{Subject: "alice", Groups: []string{"operators"}},
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			handler := NewHandler(zerolog.Nop().With(), test.groups).Routes()
+
+			w := serve(handler, http.MethodGet, "/limits", "", test.principal)
+			require.Equal(tt, test.expectedStatus, w.Code)
+			if test.expectedStatus == http.StatusForbidden {
+				forbidden := decodeProblem(tt, w)
+				assert.Equal(tt, v1.Forbidden, forbidden.Code)
+				assert.Equal(tt, "/limits", *forbidden.Instance)
+			}
+		})
+	}
+
+	// the groups are replaced as a whole, so a principal is only allowed by the groups in use.
+	handler := NewHandler(zerolog.Nop().With(), []string{"operators"})
+	handler.SetGroups([]string{"oncall"})
+	alice := &auth.Principal{Subject: "alice", Groups: []string{"operators"}}
+	assert.Equal(t, http.StatusForbidden, serve(handler.Routes(), http.MethodGet, "/limits", "", alice).Code)
+}
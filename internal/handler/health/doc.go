@@ -0,0 +1,3 @@
+// Package health contains the http handlers that report whether the service is alive and ready to serve requests, and
+// which build of it is running. They are served without authentication, so they can be used by probes.
+package health
@@ -0,0 +1,156 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+)
+
+const (
+	mediaTypeJSON = "application/json"
+
+	statusOK       = "ok"
+	statusNotReady = "not_ready"
+)
+
+type (
+	// Check returns an error when the part of the service it checks can't serve requests.
+	Check func() error
+
+	// Handler serves the health endpoints.
+	Handler struct {
+		logger  zerolog.Logger
+		names   []string
+		checks  map[string]Check
+		version VersionResponse
+	}
+
+	// Option defines the function signature for helper methods to update the Handler when it is created.
+	Option func(h *Handler)
+
+	// StatusResponse reports whether the service is alive or ready. Checks is only set for readiness, with the result
+	// of every check by name. The reason a check failed is logged rather than returned, as the endpoints are served
+	// without authentication.
+	StatusResponse struct {
+		Status string            `json:"status"`
+		Checks map[string]string `json:"checks,omitempty"`
+	}
+
+	// VersionResponse reports which build of the service is running. Values the build did not record are left out.
+	VersionResponse struct {
+		Version   string `json:"version,omitempty"`
+		Revision  string `json:"revision,omitempty"`
+		Time      string `json:"time,omitempty"`
+		Modified  bool   `json:"modified,omitempty"`
+		GoVersion string `json:"goVersion"`
+	}
+)
+
+// NewHandler returns a Handler that is ready while every provided check passes.
+func NewHandler(logCtx zerolog.Context, options ...Option) *Handler {
+	handler := &Handler{
+		logger:  logCtx.Logger().With().Str("handler", "health").Logger(),
+		checks:  make(map[string]Check),
+		version: BuildVersion(),
+	}
+
+	for _, optionFn := range options {
+		optionFn(handler)
+	}
+
+	return handler
+}
+
+// WithCheck adds a check that must pass for the service to be ready. Checks are run in the order they were added.
+func WithCheck(name string, check Check) Option {
+	return func(h *Handler) {
+		if _, exists := h.checks[name]; !exists {
+			h.names = append(h.names, name)
+		}
+		h.checks[name] = check
+	}
+}
+
+// Register adds every health endpoint to the router. The endpoints are registered individually, rather than mounted,
+// so they can sit alongside other routes at the root.
+func (h *Handler) Register(router chi.Router) {
+	router.Get("/healthz", h.getHealth)
+	router.Get("/readyz", h.getReady)
+	router.Get("/version", h.getVersion)
+}
+
+// getHealth responds as long as the process can serve requests at all.
+func (h *Handler) getHealth(w http.ResponseWriter, _ *http.Request) {
+	h.respond(w, StatusResponse{Status: statusOK}, http.StatusOK)
+}
+
+// getReady runs every check, and responds with 503 Service Unavailable when any of them fail.
+func (h *Handler) getReady(w http.ResponseWriter, _ *http.Request) {
+	resp := StatusResponse{Status: statusOK, Checks: make(map[string]string, len(h.names))}
+	status := http.StatusOK
+
+	for _, name := range h.names {
+		if err := h.checks[name](); err != nil {
+			h.logger.Warn().Err(err).Str("check", name).Msg("readiness check failed")
+			resp.Status = statusNotReady
+			resp.Checks[name] = statusNotReady
+			status = http.StatusServiceUnavailable
+			continue
+		}
+		resp.Checks[name] = statusOK
+	}
+
+	h.respond(w, resp, status)
+}
+
+// getVersion responds with the build information read on startup.
+func (h *Handler) getVersion(w http.ResponseWriter, _ *http.Request) {
+	h.respond(w, h.version, http.StatusOK)
+}
+
+func (h *Handler) respond(w http.ResponseWriter, input interface{}, status int) {
+	bytes, err := json.Marshal(input)
+	if err != nil {
+		h.logger.Err(err).Msgf("while marshalling %v for http response", input)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", mediaTypeJSON)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if _, err := w.Write(bytes); err != nil {
+		h.logger.Err(err).Msgf("while writing %v as bytes to Response", input)
+	}
+}
+
+// BuildVersion reads the module version and the version control settings recorded in the binary. Binaries built
+// without module support only report the Go version.
+func BuildVersion() VersionResponse {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return VersionResponse{GoVersion: runtime.Version()}
+	}
+
+	out := VersionResponse{
+		Version:   info.Main.Version,
+		GoVersion: info.GoVersion,
+	}
+
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			out.Revision = setting.Value
+		case "vcs.time":
+			out.Time = setting.Value
+		case "vcs.modified":
+			out.Modified = setting.Value == "true"
+		}
+	}
+
+	return out
+}
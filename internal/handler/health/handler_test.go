@@ -0,0 +1,136 @@
+package health
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	vlhttp "github.com/skormos/varlog-parser/cmd/varlog/http"
+	vlos "github.com/skormos/varlog-parser/internal/os"
+)
+
+// serve sends a GET request for the path to the endpoints of the handler, and returns the response and its status.
+func serve(t *testing.T, handler *Handler, path string) (*httptest.ResponseRecorder, StatusResponse) {
+	t.Helper()
+
+	router := chi.NewRouter()
+	handler.Register(router)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+	assert.Equal(t, mediaTypeJSON, w.Header().Get("Content-Type"))
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	var status StatusResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	return w, status
+}
+
+// writeArchive writes a tar archive holding a single log file, and returns its path.
+func writeArchive(t *testing.T) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "logs.tar")
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	content := []byte("first\n")
+	writer := tar.NewWriter(file)
+	require.NoError(t, writer.WriteHeader(&tar.Header{Name: "syslog", Mode: 0o600, Size: int64(len(content))}))
+	_, err = writer.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	return path
+}
+
+func TestHandler_ReadyUntilStopped(t *testing.T) {
+	server := vlhttp.NewServerWrapper(zerolog.Nop().With(), http.NotFoundHandler())
+	handler := NewHandler(zerolog.Nop().With(), WithCheck("server", server.Check))
+
+	w, ready := serve(t, handler, "/readyz")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, StatusResponse{Status: statusOK, Checks: map[string]string{"server": statusOK}}, ready)
+
+	server.Stop()
+
+	w, ready = serve(t, handler, "/readyz")
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, StatusResponse{Status: statusNotReady, Checks: map[string]string{"server": statusNotReady}}, ready)
+
+	// the service is still alive while it stops, so it isn't restarted part way through.
+	w, alive := serve(t, handler, "/healthz")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, StatusResponse{Status: statusOK}, alive)
+}
+
+func TestHandler_ReadyWhileRootsAreAvailable(t *testing.T) {
+	archivePath := writeArchive(t)
+	roots, err := vlos.NewRoots([]vlos.Root{{Name: "apps", Path: t.TempDir()}, {Name: "archived", Path: archivePath}})
+	require.NoError(t, err)
+	defer roots.Close()
+
+	handler := NewHandler(zerolog.Nop().With(),
+		WithCheck("server", func() error { return nil }),
+		WithCheck("roots", roots.Check),
+	)
+
+	tests := []struct {
+		name           string
+		change         func(tt *testing.T)
+		expectedStatus int
+		expectedChecks map[string]string
+	}{
+		{
+			name:           "Every root is available",
+			change:         func(*testing.T) {},
+			expectedStatus: http.StatusOK,
+			expectedChecks: map[string]string{"server": statusOK, "roots": statusOK},
+		},
+		{
+			name: "Archive root has been removed",
+			change: func(tt *testing.T) {
+				require.NoError(tt, os.Remove(archivePath))
+			},
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedChecks: map[string]string{"server": statusOK, "roots": statusNotReady},
+		},
+	}
+
+	// the cases run in order, as each one changes the roots the next one checks.
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			test.change(tt)
+
+			w, ready := serve(tt, handler, "/readyz")
+			require.Equal(tt, test.expectedStatus, w.Code)
+			assert.Equal(tt, test.expectedChecks, ready.Checks)
+
+			w, alive := serve(tt, handler, "/healthz")
+			require.Equal(tt, http.StatusOK, w.Code)
+			assert.Equal(tt, statusOK, alive.Status)
+		})
+	}
+}
+
+func TestHandler_Version(t *testing.T) {
+	router := chi.NewRouter()
+	NewHandler(zerolog.Nop().With()).Register(router)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/version", nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var version VersionResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &version))
+	assert.Equal(t, BuildVersion(), version)
+	assert.NotEmpty(t, version.GoVersion)
+}
@@ -0,0 +1,137 @@
+package varlog
+
+import (
+	"context"
+	"io/fs"
+	"net"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog"
+
+	"github.com/skormos/varlog-parser/internal/accesslog"
+	"github.com/skormos/varlog-parser/internal/audit"
+	"github.com/skormos/varlog-parser/internal/os"
+)
+
+type (
+	auditKey struct{}
+
+	// auditedRequest is the config the audit record will be written with, and the record itself, which the handlers
+	// further down the chain complete with what they know about the request.
+	auditedRequest struct {
+		cfg    *handlerConfig
+		record *audit.Record
+	}
+)
+
+// Audit writes an audit record for every request it serves, once it has been served. It is mounted before the
+// authentication and the rate limit, so the requests they refuse are recorded as well. The config is held until the
+// record has been written, so the sink is never closed by a reload while in use.
+func (l *LogParserHandler) Audit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := l.acquire()
+		defer l.release(cfg)
+
+		requestID, _ := accesslog.RequestIDFrom(r.Context())
+		record := &audit.Record{
+			Time:      time.Now().UTC(),
+			RequestID: requestID,
+			ClientIP:  clientIP(r),
+			File:      path.Base(r.URL.Path),
+			Query:     r.URL.Query(),
+		}
+		recorder := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		defer cfg.writeAccessRecord(l.requestLogger(r), r, record, recorder)
+
+		ctx := context.WithValue(r.Context(), auditKey{}, &auditedRequest{cfg: cfg, record: record})
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+	})
+}
+
+// AuditPrincipal adds the authenticated principal to the audit record. It is mounted straight after the
+// authentication, so the principal is recorded for the requests refused by the rate limit as well.
+func AuditPrincipal(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if audited, ok := r.Context().Value(auditKey{}).(*auditedRequest); ok {
+			principal := principalFrom(r)
+			audited.record.Principal = principal.Subject
+			audited.record.AuthMethod = principal.Method
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// auditedFrom returns the config the request is audited with, and its record. When the request is not audited, the
+// current config is acquired instead, along with a record that is never written. The returned func releases the config
+// when it was acquired here.
+func (l *LogParserHandler) auditedFrom(r *http.Request) (*handlerConfig, *audit.Record, func()) {
+	if audited, ok := r.Context().Value(auditKey{}).(*auditedRequest); ok {
+		return audited.cfg, audited.record, func() {}
+	}
+
+	cfg := l.acquire()
+	return cfg, &audit.Record{}, func() { l.release(cfg) }
+}
+
+// writeAccessRecord completes the record with the response, and writes it to the audit sink when there is one.
+func (c *handlerConfig) writeAccessRecord(
+	logger *zerolog.Logger,
+	r *http.Request,
+	record *audit.Record,
+	recorder middleware.WrapResponseWriter,
+) {
+	if c.auditSink == nil {
+		return
+	}
+
+	record.Status = recorder.Status()
+	if record.Status == 0 {
+		record.Status = http.StatusOK
+	}
+	record.Bytes = int64(recorder.BytesWritten())
+	record.Outcome = audit.Outcome(record.Status, r.Context().Err() != nil)
+	record.DurationMS = time.Since(record.Time).Milliseconds()
+
+	if err := c.auditSink.Write(*record); err != nil {
+		logger.Err(err).Msgf("while writing the audit record for file %s", record.File)
+	}
+}
+
+// openVisible opens the file, unless it is one of the audit files, which are reported as not existing.
+func (c *handlerConfig) openVisible(ctx context.Context, root, filename string) (os.File, error) {
+	file, err := c.opener.Open(ctx, root, filename)
+	if err != nil || c.auditSink == nil {
+		return file, err
+	}
+
+	// the opened file is checked, rather than its name, so links to an audit file are hidden as well.
+	info, err := file.Stat()
+	if err == nil && !c.hides(info) {
+		return file, nil
+	}
+
+	_ = file.Close()
+	if err != nil {
+		return nil, err
+	}
+	return nil, os.ErrNotExists
+}
+
+// hides reports whether the file is one the audit sink writes to.
+func (c *handlerConfig) hides(info fs.FileInfo) bool {
+	return c.auditSink != nil && c.auditSink.Owns(info)
+}
+
+// clientIP returns the address of the peer that made the request, without the port.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
@@ -0,0 +1,203 @@
+package varlog
+
+import (
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	v1 "github.com/skormos/varlog-parser/internal/api/rest/v1"
+	"github.com/skormos/varlog-parser/internal/audit"
+	"github.com/skormos/varlog-parser/internal/auth"
+	"github.com/skormos/varlog-parser/internal/os"
+	"github.com/skormos/varlog-parser/internal/ratelimit"
+)
+
+// recordingSink keeps every record written to it.
+type recordingSink struct {
+	mu      sync.Mutex
+	records []audit.Record
+}
+
+func (s *recordingSink) Write(record audit.Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, record)
+	return nil
+}
+
+func (s *recordingSink) Owns(fs.FileInfo) bool {
+	return false
+}
+
+func (s *recordingSink) Records() []audit.Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]audit.Record(nil), s.records...)
+}
+
+// newAuditedRouter serves the API the way the root handler does, with the audit mounted before the authentication and
+// a rate limit of one request per client.
+func newAuditedRouter(t *testing.T, sink audit.Sink) http.Handler {
+	t.Helper()
+
+	dir := t.TempDir()
+	writeLog(t, filepath.Join(dir, "syslog"), "first\nsecond\n")
+	roots, err := os.NewRoots([]os.Root{{Name: "system", Path: dir}})
+	require.NoError(t, err)
+
+	keys, err := auth.NewAPIKeys([]auth.APIKey{{Name: "reader", Hash: auth.HashAPIKey("secret")}})
+	require.NoError(t, err)
+	authn := auth.NewMiddleware(auth.NewAuthenticator([]auth.Method{keys}), RespondUnauthorized)
+	clients := ratelimit.NewClientLimiter(0.001, 1)
+
+	parser := NewLogParserHandler(zerolog.Nop().With(), roots, WithAudit(sink))
+	api := http.StripPrefix("/api/varlog", NewHandler(zerolog.Nop().With(), parser))
+
+	return parser.Audit(authn.Handler(AuditPrincipal(
+		clients.Middleware(ratelimit.ClientKey, RespondRateLimited)(api),
+	)))
+}
+
+func TestLogParserHandler_Audit(t *testing.T) {
+	tests := map[string]struct {
+		apiKey            string
+		target            string
+		requests          int
+		expectedStatus    int
+		expectedOutcome   string
+		expectedPrincipal string
+		expectedRoot      string
+	}{
+		"Served request": {
+			apiKey:            "secret",
+			target:            "/api/varlog/syslog",
+			requests:          1,
+			expectedStatus:    http.StatusOK,
+			expectedOutcome:   audit.OutcomeSuccess,
+			expectedPrincipal: "reader",
+			expectedRoot:      "system",
+		},
+		"Request without credentials is recorded as denied": {
+			target:          "/api/varlog/syslog",
+			requests:        1,
+			expectedStatus:  http.StatusUnauthorized,
+			expectedOutcome: audit.OutcomeDenied,
+		},
+		"Request with an unknown key is recorded as denied": {
+			apiKey:          "guess",
+			target:          "/api/varlog/syslog",
+			requests:        1,
+			expectedStatus:  http.StatusUnauthorized,
+			expectedOutcome: audit.OutcomeDenied,
+		},
+		"Rate limited request is recorded as throttled, with its principal": {
+			apiKey:            "secret",
+			target:            "/api/varlog/syslog",
+			requests:          2,
+			expectedStatus:    http.StatusTooManyRequests,
+			expectedOutcome:   audit.OutcomeThrottled,
+			expectedPrincipal: "reader",
+		},
+		"Parameter that can't be bound is recorded as invalid": {
+			apiKey:            "secret",
+			target:            "/api/varlog/syslog?numEntries=many",
+			requests:          1,
+			expectedStatus:    http.StatusBadRequest,
+			expectedOutcome:   audit.OutcomeInvalid,
+			expectedPrincipal: "reader",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			sink := &recordingSink{}
+			router := newAuditedRouter(tt, sink)
+
+			var recorder *httptest.ResponseRecorder
+			for i := 0; i < test.requests; i++ {
+				req := httptest.NewRequest(http.MethodGet, test.target, nil)
+				if test.apiKey != "" {
+					req.Header.Set(auth.APIKeyHeader, test.apiKey)
+				}
+				recorder = httptest.NewRecorder()
+				router.ServeHTTP(recorder, req)
+			}
+			require.Equal(tt, test.expectedStatus, recorder.Code)
+
+			// every request is recorded once, including those refused before reaching the handler.
+			records := sink.Records()
+			require.Len(tt, records, test.requests)
+			record := records[len(records)-1]
+			assert.Equal(tt, test.expectedStatus, record.Status)
+			assert.Equal(tt, test.expectedOutcome, record.Outcome)
+			assert.Equal(tt, test.expectedPrincipal, record.Principal)
+			assert.Equal(tt, test.expectedRoot, record.Root)
+			assert.Equal(tt, "syslog", record.File)
+			assert.Equal(tt, int64(recorder.Body.Len()), record.Bytes)
+			assert.NotEmpty(tt, record.ClientIP)
+		})
+	}
+}
+
+func TestLogParserHandler_ReloadDuringListing(t *testing.T) {
+	previousDir, nextDir := t.TempDir(), t.TempDir()
+	writeLog(t, filepath.Join(previousDir, "previous.log"), "first\n")
+	writeLog(t, filepath.Join(nextDir, "next.log"), "first\n")
+	previous, err := os.NewRoots([]os.Root{{Name: "system", Path: previousDir}})
+	require.NoError(t, err)
+	next, err := os.NewRoots([]os.Root{{Name: "system", Path: nextDir}})
+	require.NoError(t, err)
+
+	sink := &recordingSink{}
+	parser := NewLogParserHandler(zerolog.Nop().With(), previous, WithAudit(sink))
+
+	// the request is held between the audit and the handler, so the reload starts while the request holds the config.
+	entered, proceed := make(chan struct{}), make(chan struct{})
+	hold := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(entered)
+			<-proceed
+			next.ServeHTTP(w, r)
+		})
+	}
+	router := parser.Audit(hold(http.StripPrefix("/api/varlog", NewHandler(zerolog.Nop().With(), parser))))
+
+	served := make(chan *httptest.ResponseRecorder)
+	go func() {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/varlog/", nil))
+		served <- w
+	}()
+	<-entered
+
+	reloaded := make(chan FileOpener)
+	go func() {
+		reloaded <- parser.Reload(next, WithAudit(sink))
+	}()
+
+	// the reload waits for the listing, which completes with the config the request is audited with.
+	select {
+	case <-reloaded:
+		t.Fatal("reload returned while a listing was in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(proceed)
+
+	w := <-served
+	require.Equal(t, http.StatusOK, w.Code)
+	var listing v1.ListFilesResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &listing))
+	require.Len(t, listing.Files, 1)
+	assert.Equal(t, "previous.log", listing.Files[0].Name)
+	assert.Same(t, previous, <-reloaded)
+	assert.Len(t, sink.Records(), 1)
+}
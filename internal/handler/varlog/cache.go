@@ -0,0 +1,183 @@
+package varlog
+
+import (
+	"io/fs"
+	"strings"
+
+	"github.com/skormos/varlog-parser/internal/cache"
+	"github.com/skormos/varlog-parser/internal/logparser"
+	"github.com/skormos/varlog-parser/internal/os"
+)
+
+const (
+	// cacheHit is the outcome of a lookup that found the entries for the file as it is now.
+	cacheHit = "hit"
+	// cacheGrown is the outcome of a lookup that found the entries for the file before it grew, so only what was
+	// appended since has to be scanned.
+	cacheGrown = "grown"
+	// cacheMiss is the outcome of a lookup that found nothing usable, so the file is scanned as usual.
+	cacheMiss = "miss"
+)
+
+type (
+	// cachePlan is how the cache is used for a single request: the state of the file the scan is bounded by, and the
+	// cached entries it continues with, if any.
+	cachePlan struct {
+		key   cache.Key
+		inode uint64
+		size  int64
+		tail  string
+		// start is the offset the scan stops at, which is the size of the file when its entries were cached.
+		start   int64
+		cached  []string
+		outcome string
+		// storable is set when the file ends with a complete line, as the entries from a line still being written
+		// must not outlive the request.
+		storable bool
+	}
+
+	// mergingScanner continues with the cached entries once the wrapped scanner, which only reads the lines appended
+	// since they were cached, has been exhausted. A scan that stopped early has a gap before the cached entries, so
+	// it is not continued.
+	mergingScanner struct {
+		entryScanner
+		summary *scanSummary
+		cached  []string
+		merging bool
+		pos     int
+	}
+
+	// recordingScanner keeps every entry from the wrapped scanner, so they can be cached once the scan completes. It
+	// stops keeping them once they have grown past the limit, as they could not be cached anyway.
+	recordingScanner struct {
+		entryScanner
+		limit    int64
+		size     int64
+		entries  []string
+		overflow bool
+	}
+)
+
+// planCache looks up the cached result for the query. The file size is read once, and every scan is bounded by it,
+// so the stored result describes exactly the content that was read. Without a cache, when continuing from a cursor,
+// or when the scan is positioned by the line or since parameters, the plan is nil, and the file is scanned as usual.
+func (c *handlerConfig) planCache(
+	file os.File,
+	info fs.FileInfo,
+	key cache.Key,
+	cursor *scanCursor,
+	positioned bool,
+) (*cachePlan, error) {
+	if c.results == nil || cursor != nil || positioned {
+		return nil, nil
+	}
+
+	tail, err := os.ReadTail(file, info.Size())
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &cachePlan{
+		key:      key,
+		inode:    os.Inode(info),
+		size:     info.Size(),
+		tail:     tail,
+		outcome:  cacheMiss,
+		storable: tail == "" || strings.HasSuffix(tail, "\n"),
+	}
+
+	cached, ok := c.results.Get(key)
+	if !ok {
+		return plan, nil
+	}
+	grown, err := os.HasOnlyGrown(file, info, cached.Inode, cached.Size, cached.Tail)
+	if err != nil {
+		return nil, err
+	}
+	if !grown {
+		return plan, nil
+	}
+
+	plan.start = cached.Size
+	plan.cached = cached.Entries
+	plan.outcome = cacheGrown
+	if cached.Size == plan.size {
+		plan.outcome = cacheHit
+	}
+
+	return plan, nil
+}
+
+// scanOptions bounds the scan to the content between the cached result, or the start of the file, and the size the
+// file had when planned.
+func (p *cachePlan) scanOptions() []logparser.Option {
+	return []logparser.Option{logparser.WithStartOffset(p.start), logparser.WithEndOffset(p.size)}
+}
+
+// store caches the recorded entries, when the scan read every entry the query asks for.
+func (c *handlerConfig) store(plan *cachePlan, recorder *recordingScanner, summary *scanSummary) {
+	if !plan.storable || summary.truncated || recorder.overflow {
+		return
+	}
+
+	c.results.Put(plan.key, cache.Result{
+		Inode:   plan.inode,
+		Size:    plan.size,
+		Tail:    plan.tail,
+		Entries: recorder.entries,
+	})
+}
+
+func newMergingScanner(scanner entryScanner, cached []string, summary *scanSummary) *mergingScanner {
+	return &mergingScanner{entryScanner: scanner, cached: cached, summary: summary}
+}
+
+func (s *mergingScanner) Next() bool {
+	if !s.merging {
+		if s.entryScanner.Next() {
+			return true
+		}
+		if s.entryScanner.Err() != nil || s.summary.truncated {
+			return false
+		}
+		s.merging = true
+	}
+
+	if s.pos >= len(s.cached) {
+		return false
+	}
+	s.pos++
+
+	return true
+}
+
+func (s *mergingScanner) Entry() string {
+	if s.merging {
+		return s.cached[s.pos-1]
+	}
+
+	return s.entryScanner.Entry()
+}
+
+func newRecordingScanner(scanner entryScanner, limit int64) *recordingScanner {
+	return &recordingScanner{entryScanner: scanner, limit: limit}
+}
+
+func (s *recordingScanner) Next() bool {
+	if !s.entryScanner.Next() {
+		return false
+	}
+
+	if !s.overflow {
+		entry := s.entryScanner.Entry()
+		s.size += int64(len(entry))
+		if s.size > s.limit {
+			s.overflow = true
+			s.entries = nil
+		} else {
+			s.entries = append(s.entries, entry)
+		}
+	}
+
+	return true
+}
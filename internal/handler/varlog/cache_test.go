@@ -0,0 +1,139 @@
+package varlog
+
+import (
+	"net/http"
+	goos "os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skormos/varlog-parser/internal/cache"
+	"github.com/skormos/varlog-parser/internal/logparser"
+)
+
+// statsRecorder keeps the cache lookups and scans of every request.
+type statsRecorder struct {
+	nopRecorder
+	mu      sync.Mutex
+	lookups []string
+	scans   []logparser.ScanStats
+}
+
+func (s *statsRecorder) Scanned(_, _ string, stats logparser.ScanStats, _ bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scans = append(s.scans, stats)
+}
+
+func (s *statsRecorder) CacheLookup(outcome string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lookups = append(s.lookups, outcome)
+}
+
+// last returns the outcome of the last cache lookup, and the bytes read by the last scan.
+func (s *statsRecorder) last() (string, int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	outcome := ""
+	if len(s.lookups) > 0 {
+		outcome = s.lookups[len(s.lookups)-1]
+	}
+	var bytes int64 = -1
+	if len(s.scans) > 0 {
+		bytes = s.scans[len(s.scans)-1].Bytes
+	}
+	return outcome, bytes
+}
+
+// numberedLines returns the lines from first up to, but not including, last.
+func numberedLines(prefix string, first, last int) string {
+	var out strings.Builder
+	for i := first; i < last; i++ {
+		out.WriteString(prefix + " line " + strconv.Itoa(i) + "\n")
+	}
+	return out.String()
+}
+
+func TestLogParserHandler_Cache(t *testing.T) {
+	initial := numberedLines("sshd", 0, 50)
+
+	tests := map[string]struct {
+		// change is applied to the file between the first and second request.
+		change          func(t *testing.T, path string)
+		expectedOutcome string
+		// expectedBytes is how much of the file the second request reads, or -1 for all of it.
+		expectedBytes int64
+	}{
+		"Unchanged file is a hit": {
+			change:          func(*testing.T, string) {},
+			expectedOutcome: cacheHit,
+			expectedBytes:   0,
+		},
+		"Grown file only reads what was appended": {
+			change: func(t *testing.T, path string) {
+				appendLog(t, path, numberedLines("cron", 50, 53))
+			},
+			expectedOutcome: cacheGrown,
+			expectedBytes:   int64(len(numberedLines("cron", 50, 53))),
+		},
+		"Truncated and rewritten file is a miss": {
+			change: func(t *testing.T, path string) {
+				writeLog(t, path, numberedLines("kernel", 0, 60))
+			},
+			expectedOutcome: cacheMiss,
+			expectedBytes:   -1,
+		},
+		"File truncated to a shorter one is a miss": {
+			change: func(t *testing.T, path string) {
+				writeLog(t, path, numberedLines("kernel", 0, 5))
+			},
+			expectedOutcome: cacheMiss,
+			expectedBytes:   -1,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			dir, path := logPath(tt, "syslog")
+			writeLog(tt, path, initial)
+			recorder := &statsRecorder{}
+			handler := newTestHandler(tt, dir, WithCache(cache.NewLRU(1<<20)), WithRecorder(recorder))
+
+			for _, target := range []string{"/syslog?numEntries=10", "/syslog?numEntries=10&filterByText=line+4"} {
+				first := getText(handler, target, nil)
+				require.Equal(tt, http.StatusOK, first.Code)
+				outcome, _ := recorder.last()
+				require.Equal(tt, cacheMiss, outcome, target)
+			}
+
+			test.change(tt, path)
+			info, err := goos.Stat(path)
+			require.NoError(tt, err)
+			cold := newTestHandler(tt, dir)
+
+			// the cached response is the same as a scan of the file as it is now, with or without a filter.
+			for _, target := range []string{"/syslog?numEntries=10", "/syslog?numEntries=10&filterByText=line+4"} {
+				cached := getText(handler, target, nil)
+				require.Equal(tt, http.StatusOK, cached.Code)
+				outcome, bytes := recorder.last()
+				assert.Equal(tt, test.expectedOutcome, outcome, target)
+				if test.expectedBytes >= 0 {
+					assert.Equal(tt, test.expectedBytes, bytes, target)
+				} else {
+					assert.Greater(tt, bytes, int64(0), target)
+					assert.LessOrEqual(tt, bytes, info.Size(), target)
+				}
+
+				scanned := getText(cold, target, nil)
+				require.Equal(tt, http.StatusOK, scanned.Code)
+				assert.Equal(tt, scanned.Body.String(), cached.Body.String(), target)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package varlog
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"io/fs"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/skormos/varlog-parser/internal/os"
+)
+
+// validators identify a GetEntries response, so a client polling a file that has not changed can be answered without
+// scanning it again.
+type validators struct {
+	etag         string
+	lastModified time.Time
+}
+
+// validatorsFor returns the validators of the response to the request. The ETag changes whenever the size,
+// modification time or inode of the file changes, or anything that changes which entries are returned does: the
+// query, media type, the groups the principal is redacted for, and the config, which is replaced on every reload.
+// The ETag is weak, as a scan stopped by the time limit can return fewer entries for the same file.
+func (c *handlerConfig) validatorsFor(r *http.Request, root string, info fs.FileInfo, mediaType string) validators {
+	groups := append([]string(nil), principalFrom(r).Groups...)
+	sort.Strings(groups)
+
+	parts := []string{
+		c.validatorSeed,
+		root,
+		info.Name(),
+		strconv.FormatInt(info.Size(), 10),
+		strconv.FormatInt(info.ModTime().UnixNano(), 10),
+		strconv.FormatUint(os.Inode(info), 10),
+		r.URL.Query().Encode(),
+		mediaType,
+		strings.Join(groups, ","),
+	}
+
+	// every part is separated by a byte that none of them can contain, so no two sets of parts hash the same.
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+
+	return validators{
+		etag:         `W/"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`,
+		lastModified: info.ModTime(),
+	}
+}
+
+// set adds the validators to the response header, along with what else the response varies on. Responses are private
+// to the principal, and must be revalidated before a cached copy is used.
+func (v validators) set(header http.Header) {
+	header.Set("ETag", v.etag)
+	header.Set("Last-Modified", v.lastModified.UTC().Format(http.TimeFormat))
+	header.Set("Cache-Control", "private, no-cache")
+	header.Add("Vary", "Accept")
+}
+
+// clear removes the validators from the response header, for when the response turns out to be an error.
+func (v validators) clear(header http.Header) {
+	header.Del("ETag")
+	header.Del("Last-Modified")
+	header.Del("Cache-Control")
+}
+
+// notModified reports whether the client already has the response, as described in RFC 7232 section 6. If-None-Match
+// is compared weakly, and If-Modified-Since is only used without it.
+func (v validators) notModified(r *http.Request) bool {
+	if ifNoneMatch := r.Header.Values("If-None-Match"); len(ifNoneMatch) > 0 {
+		for _, value := range ifNoneMatch {
+			for _, etag := range strings.Split(value, ",") {
+				etag = strings.TrimSpace(etag)
+				if etag == "*" || strings.TrimPrefix(etag, "W/") == strings.TrimPrefix(v.etag, "W/") {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+
+	// the header only has whole seconds, so the modification time is compared at the same precision.
+	return !v.lastModified.Truncate(time.Second).After(since)
+}
@@ -0,0 +1,49 @@
+package varlog
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogParserHandler_ConditionalRequests(t *testing.T) {
+	dir, path := logPath(t, "syslog")
+	writeLog(t, path, "first\nsecond\n")
+	handler := newTestHandler(t, dir)
+
+	first := getText(handler, "/syslog?numEntries=10", nil)
+	require.Equal(t, http.StatusOK, first.Code)
+	assert.Equal(t, "second\nfirst\n", first.Body.String())
+	etag := first.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+	assert.Equal(t, "private, no-cache", first.Header().Get("Cache-Control"))
+
+	// the same ETag is answered without a body while the file is unchanged, whichever way it is quoted.
+	for _, ifNoneMatch := range []string{etag, etag[2:], `"other", ` + etag, "*"} {
+		notModified := getText(handler, "/syslog?numEntries=10", http.Header{"If-None-Match": {ifNoneMatch}})
+		assert.Equal(t, http.StatusNotModified, notModified.Code, ifNoneMatch)
+		assert.Empty(t, notModified.Body.String())
+		assert.Equal(t, etag, notModified.Header().Get("ETag"))
+	}
+
+	// another query of the same file is a different response.
+	other := getText(handler, "/syslog?numEntries=1", http.Header{"If-None-Match": {etag}})
+	assert.Equal(t, http.StatusOK, other.Code)
+	assert.NotEqual(t, etag, other.Header().Get("ETag"))
+
+	// once the file has grown, the same ETag gets the new entries.
+	appendLog(t, path, "third\n")
+	changed := getText(handler, "/syslog?numEntries=10", http.Header{"If-None-Match": {etag}})
+	require.Equal(t, http.StatusOK, changed.Code)
+	assert.Equal(t, "third\nsecond\nfirst\n", changed.Body.String())
+	assert.NotEqual(t, etag, changed.Header().Get("ETag"))
+
+	// If-Modified-Since is only used without If-None-Match.
+	since := http.Header{"If-Modified-Since": {time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)}}
+	assert.Equal(t, http.StatusNotModified, getText(handler, "/syslog?numEntries=10", since).Code)
+	since.Set("If-None-Match", etag)
+	assert.Equal(t, http.StatusOK, getText(handler, "/syslog?numEntries=10", since).Code)
+}
@@ -0,0 +1,72 @@
+package varlog
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+
+	"github.com/skormos/varlog-parser/internal/logparser"
+)
+
+type (
+	// scanCursor is where a truncated scan stopped, as the root the file was read from and the offset the next scan
+	// continues from, reading back from it, or forward from it for a scan positioned in ascending order. It is opaque
+	// to clients, who only pass it back unchanged.
+	scanCursor struct {
+		root   string
+		offset int64
+	}
+
+	// fileScanner is the subset of the logparser.ReverseScanner and logparser.ForwardScanner used to read a file.
+	fileScanner interface {
+		entryScanner
+		LimitReached() bool
+		Offset() int64
+		Stats() logparser.ScanStats
+	}
+
+	// cursorScanner records in the summary whether the wrapped scan stopped at the byte or time limit, and the cursor
+	// to continue it from, once the scan ends.
+	cursorScanner struct {
+		fileScanner
+		root    string
+		summary *scanSummary
+	}
+)
+
+func (c scanCursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(c.offset, 10) + ":" + c.root))
+}
+
+// parseCursor reverses scanCursor.String, refusing any value it could not have produced.
+func parseCursor(value string) (scanCursor, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return scanCursor{}, invalidParam("cursor", "cursor value must be one returned by a truncated response")
+	}
+
+	offsetValue, root, found := strings.Cut(string(decoded), ":")
+	offset, err := strconv.ParseInt(offsetValue, 10, 64)
+	if !found || err != nil || offset < 0 || root == "" {
+		return scanCursor{}, invalidParam("cursor", "cursor value must be one returned by a truncated response")
+	}
+
+	return scanCursor{root: root, offset: offset}, nil
+}
+
+func newCursorScanner(scanner fileScanner, root string, summary *scanSummary) *cursorScanner {
+	return &cursorScanner{fileScanner: scanner, root: root, summary: summary}
+}
+
+func (s *cursorScanner) Next() bool {
+	if s.fileScanner.Next() {
+		return true
+	}
+
+	if s.LimitReached() {
+		s.summary.truncated = true
+		s.summary.cursor = scanCursor{root: s.root, offset: s.Offset()}.String()
+	}
+
+	return false
+}
@@ -2,6 +2,7 @@ package varlog
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 
@@ -11,20 +12,55 @@ import (
 	v1 "github.com/skormos/varlog-parser/internal/api/rest/v1"
 )
 
-// NewHandler creates a new http.Handler which conforms to the varlog API Spec.
-func NewHandler(logCtx zerolog.Context, opener FileOpener) http.Handler {
+// NewHandler creates a new http.Handler which conforms to the varlog API Spec, serving requests with the provided
+// LogParserHandler.
+func NewHandler(logCtx zerolog.Context, parser *LogParserHandler) http.Handler {
 	logger := logCtx.Logger()
 
-	return v1.HandlerWithOptions(NewLogParserHandler(logCtx, opener), v1.ChiServerOptions{
+	return v1.HandlerWithOptions(parser, v1.ChiServerOptions{
 		BaseRouter: chi.NewRouter(),
 		ErrorHandlerFunc: func(w http.ResponseWriter, r *http.Request, err error) {
-			logger.Err(err).Msgf("while calling %s", r.RequestURI)
+			if param, ok := bindingParam(err); ok {
+				respondParamProblem(w, r, invalidParam(param, err.Error()))
+				return
+			}
 
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			logger.Err(err).Msgf("while calling %s", r.RequestURI)
+			respondProblem(w, r, http.StatusInternalServerError, v1.InternalError, "")
 		},
 	})
 }
 
+// bindingParam returns the name of the parameter when the error was caused by binding a request parameter, which is
+// always the fault of the client.
+func bindingParam(err error) (string, bool) {
+	var (
+		formatErr    *v1.InvalidParamFormatError
+		requiredErr  *v1.RequiredParamError
+		headerErr    *v1.RequiredHeaderError
+		tooManyErr   *v1.TooManyValuesForParamError
+		unmarshalErr *v1.UnmarshalingParamError
+		cookieErr    *v1.UnescapedCookieParamError
+	)
+
+	switch {
+	case errors.As(err, &formatErr):
+		return formatErr.ParamName, true
+	case errors.As(err, &requiredErr):
+		return requiredErr.ParamName, true
+	case errors.As(err, &headerErr):
+		return headerErr.ParamName, true
+	case errors.As(err, &tooManyErr):
+		return tooManyErr.ParamName, true
+	case errors.As(err, &unmarshalErr):
+		return unmarshalErr.ParamName, true
+	case errors.As(err, &cookieErr):
+		return cookieErr.ParamName, true
+	default:
+		return "", false
+	}
+}
+
 func respond(writer http.ResponseWriter, input interface{}, status int) error {
 	bytes, err := json.Marshal(input)
 	if err != nil {
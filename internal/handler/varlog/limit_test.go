@@ -0,0 +1,134 @@
+package varlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	v1 "github.com/skormos/varlog-parser/internal/api/rest/v1"
+)
+
+// getPage requests the entries at the query as JSON, continuing from the cursor when one is provided.
+func getPage(t *testing.T, handler http.Handler, query url.Values, cursor string) v1.GetEntriesResponse {
+	t.Helper()
+
+	query = cloneValues(query)
+	if cursor != "" {
+		query.Set("cursor", cursor)
+	}
+	w := get(handler, "/syslog?"+query.Encode(), http.Header{"Accept": {mediaTypeJSON}})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var page v1.GetEntriesResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	return page
+}
+
+func cloneValues(values url.Values) url.Values {
+	out := make(url.Values, len(values))
+	for key, value := range values {
+		out[key] = append([]string(nil), value...)
+	}
+	return out
+}
+
+func TestLogParserHandler_GetEntriesWithinLimits(t *testing.T) {
+	const lines = 40
+
+	dir, path := logPath(t, "syslog")
+	var content strings.Builder
+	for i := 1; i <= lines; i++ {
+		fmt.Fprintf(&content, "line %02d\n", i)
+	}
+	writeLog(t, path, content.String())
+	descending := make([]string, 0, lines)
+	for i := lines; i >= 1; i-- {
+		descending = append(descending, fmt.Sprintf("line %02d", i))
+	}
+
+	tests := map[string]struct {
+		limits          func(limits *Limits)
+		query           url.Values
+		expectedEntries []string
+	}{
+		"Byte limit": {
+			limits: func(limits *Limits) {
+				limits.MaxScanBytes = 32
+			},
+			query:           url.Values{"numEntries": {"100"}},
+			expectedEntries: descending,
+		},
+		"Byte limit with a filter": {
+			limits: func(limits *Limits) {
+				limits.MaxScanBytes = 32
+			},
+			query:           url.Values{"numEntries": {"100"}, "filterByText": {"5"}},
+			expectedEntries: []string{"line 35", "line 25", "line 15", "line 05"},
+		},
+		"Time limit": {
+			limits: func(limits *Limits) {
+				limits.MaxScanTime = time.Nanosecond
+			},
+			query:           url.Values{"numEntries": {"100"}, "filterByText": {"5"}},
+			expectedEntries: []string{"line 35", "line 25", "line 15", "line 05"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			limits := DefaultLimits()
+			limits.ChunkSize = 16
+			test.limits(&limits)
+			handler := newTestHandler(tt, dir, WithLimits(limits))
+
+			// the first scan stops at the limit, returning what it found with a cursor to continue from.
+			page := getPage(tt, handler, test.query, "")
+			require.True(tt, page.Truncated)
+			require.NotNil(tt, page.Cursor)
+
+			// following the cursors returns every entry once, in order, as a single unlimited scan would.
+			entries := append([]string(nil), page.Entries...)
+			for requests := 1; page.Truncated; requests++ {
+				require.Less(tt, requests, 10*lines, "the scan never completed")
+				require.NotNil(tt, page.Cursor)
+
+				page = getPage(tt, handler, test.query, *page.Cursor)
+				entries = append(entries, page.Entries...)
+			}
+			assert.Nil(tt, page.Cursor)
+			assert.Equal(tt, test.expectedEntries, entries)
+		})
+	}
+}
+
+func TestLogParserHandler_TruncatedTrailers(t *testing.T) {
+	dir, path := logPath(t, "syslog")
+	writeLog(t, path, "line 01\nline 02\nline 03\nline 04\nline 05\nline 06\nline 07\nline 08\n")
+
+	limits := DefaultLimits()
+	limits.ChunkSize = 16
+	limits.MaxScanBytes = 16
+	handler := newTestHandler(t, dir, WithLimits(limits))
+
+	// the formats without room for the summary in the body send it as trailers. The first line of a chunk is only known
+	// to be complete once the chunk before it is read, so the first scan returns a single line.
+	w := getText(handler, "/syslog", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "line 08\n", w.Body.String())
+
+	trailer := w.Result().Trailer
+	assert.Equal(t, "true", trailer.Get(truncatedTrailer))
+	require.NotEmpty(t, trailer.Get(cursorTrailer))
+
+	w = getText(handler, "/syslog?cursor="+url.QueryEscape(trailer.Get(cursorTrailer)), nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "line 07\n", w.Body.String())
+	assert.Equal(t, "true", w.Result().Trailer.Get(truncatedTrailer))
+}
@@ -1,128 +1,623 @@
 package varlog
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
-	stdos "os"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/rs/zerolog"
 
 	v1 "github.com/skormos/varlog-parser/internal/api/rest/v1"
+	"github.com/skormos/varlog-parser/internal/auth"
+	"github.com/skormos/varlog-parser/internal/cache"
 	"github.com/skormos/varlog-parser/internal/logparser"
 	"github.com/skormos/varlog-parser/internal/os"
+	"github.com/skormos/varlog-parser/internal/ratelimit"
+	"github.com/skormos/varlog-parser/internal/searchindex"
 )
 
 const (
-	defaultLines = 25
-	maxLines     = 100000
+	orderDescending = "desc"
+	orderAscending  = "asc"
+
+	// the trailers carry the scan summary for every media type, as it is only known once every entry has been written.
+	redactionTrailer = "X-Redaction-Count"
+	truncatedTrailer = "X-Truncated"
+	cursorTrailer    = "X-Cursor"
 )
 
+// errNoOpener is returned by Check once the opener has been removed, which only happens on shutdown.
+var errNoOpener = errors.New("no log roots are open")
+
+// entryWriters maps every media type GetEntries can respond with to the function that writes it.
+var entryWriters = map[string]entryWriter{
+	mediaTypeJSON:   writeJSONEntries,
+	mediaTypeNDJSON: writeNDJSONEntries,
+	mediaTypeText:   writeTextEntries,
+	mediaTypeCSV:    writeCSVEntries,
+}
+
 type (
-	// FileOpener defines the interface which is used to open file resources based on a single file name.
+	// FileOpener defines the interface which is used to open file resources based on a root and file name, and to list
+	// the files that can be opened. An empty root name opens the file from the first root that contains it.
 	FileOpener interface {
-		Open(filename string) (*stdos.File, error)
+		Names() []string
+		Open(ctx context.Context, root, filename string) (os.File, error)
+		List() ([]os.FileEntry, error)
+	}
+
+	// forbiddenError is returned when every root the file could be opened from is denied by a policy.
+	forbiddenError struct {
+		policy string
 	}
 
 	// LogParserHandler implements the v1 ServerInterface to open files and read lines from the end of it.
 	LogParserHandler struct {
-		opener FileOpener
 		logger zerolog.Logger
+		// config holds the current *handlerConfig, which is replaced as a whole on reload.
+		config atomic.Value
 	}
 
-	rawLines []string
-
 	getEntriesParams v1.GetEntriesParams
 )
 
 // GetEntries uses the provided FileOpener implementation to retrieve the most recent log entries as part of the query
 // parameters.
 func (l *LogParserHandler) GetEntries(w http.ResponseWriter, r *http.Request, filename string, params v1.GetEntriesParams) {
-	reader, err := l.opener.Open(filename)
+	// the config the request is audited with is used throughout, so it is never acquired twice by the same request.
+	cfg, record, done := l.auditedFrom(r)
+	defer done()
+	record.File = filename
+
+	logger := l.requestLogger(r)
+	parsedParams := getEntriesParams(params)
+
+	cursor, err := parsedParams.cursor()
+	if err != nil {
+		respondParamProblem(w, r, err)
+		return
+	}
+
+	requestedRoot := parsedParams.root()
+	if cursor != nil {
+		requestedRoot = cursor.root
+	}
+
+	reader, root, err := cfg.open(r.Context(), principalFrom(r), requestedRoot, filename)
+	record.Root = root
+	if reader != nil {
+		cfg.recorder.FileOpened()
+	}
 	defer func() {
 		if reader != nil {
+			cfg.recorder.FileClosed()
 			if closeErr := reader.Close(); closeErr != nil {
-				l.logger.Err(closeErr).Msgf("could not close file %s", filename)
+				logger.Err(closeErr).Msgf("could not close file %s", filename)
 			}
 		}
 	}()
 	if err != nil {
+		var forbidden *forbiddenError
+		if errors.As(err, &forbidden) {
+			record.Policy = forbidden.policy
+			logger.Debug().Msgf("request for file %s was denied by policy %s", filename, forbidden.policy)
+			respondForbidden(w, r, forbidden.policy)
+			return
+		}
+
 		if err == os.ErrNotExists {
-			http.Error(w, "requested file with name could not be located", http.StatusNotFound)
+			respondProblem(w, r, http.StatusNotFound, v1.FileNotFound, "requested file with name could not be located")
+			return
+		}
+
+		if err == os.ErrUnknownRoot {
+			respondProblem(w, r, http.StatusNotFound, v1.FileNotFound, "requested root with name could not be located")
 			return
 		}
 
 		if err == os.ErrNoReadPerm {
-			http.Error(w, "requested file does not have sufficient permissions to be read", http.StatusForbidden)
+			respondProblem(w, r, http.StatusForbidden, v1.PermissionDenied,
+				"requested file does not have sufficient permissions to be read")
 			return
 		}
 
-		l.logger.Err(err).Msgf("while requesting filename: %s", filename)
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		logger.Err(err).Msgf("while requesting filename: %s", filename)
+		respondProblem(w, r, http.StatusInternalServerError, v1.InternalError, "")
 		return
 	}
 
-	parsedParams := getEntriesParams(params)
-	numLines, err := parsedParams.numLines()
+	numLines, err := parsedParams.numLines(cfg.limits)
+	if err != nil {
+		respondParamProblem(w, r, err)
+		return
+	}
+
+	ascending, err := parsedParams.ascending()
+	if err != nil {
+		respondParamProblem(w, r, err)
+		return
+	}
+
+	line, err := parsedParams.line()
+	if err != nil {
+		respondParamProblem(w, r, err)
+		return
+	}
+
+	format, err := parsedParams.format()
+	if err != nil {
+		respondParamProblem(w, r, err)
+		return
+	}
+
+	filter, err := parsedParams.filterer(cfg.limits)
+	if err != nil {
+		respondParamProblem(w, r, err)
+		return
+	}
+
+	mediaType := negotiate(r.Header.Get("Accept"), mediaTypeJSON, mediaTypeNDJSON, mediaTypeText, mediaTypeCSV)
+	if mediaType == "" {
+		respondProblem(w, r, http.StatusNotAcceptable, v1.NotAcceptable,
+			"none of the accepted media types can be produced")
+		return
+	}
+
+	info, err := reader.Stat()
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		logger.Err(err).Msgf("while reading the file info for %s", filename)
+		respondProblem(w, r, http.StatusInternalServerError, v1.InternalError, "")
 		return
 	}
 
-	lines, err := logparser.ParseLastNLinesSeek(r.Context(), reader, numLines, parsedParams.filterer())
+	// a client that already has the response is answered before queueing, as no scan is needed.
+	validators := cfg.validatorsFor(r, root, info, mediaType)
+	if validators.notModified(r) {
+		validators.set(w.Header())
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	key := cache.Key{Root: root, File: filename, Filter: parsedParams.filterText(), Lines: numLines}
+	plan, err := cfg.planCache(reader, info, key, cursor, line != nil || parsedParams.Since != nil)
+	if err != nil {
+		logger.Err(err).Msgf("while looking up the cached entries for %s", filename)
+		respondProblem(w, r, http.StatusInternalServerError, v1.InternalError, "")
+		return
+	}
+	if plan != nil {
+		cfg.recorder.CacheLookup(plan.outcome)
+	}
+
+	// the read lock on the config is held while queued, so a reload waits at most the queue timeout for this request.
+	release, err := cfg.acquireScan(r.Context(), plan)
+	if err != nil {
+		if r.Context().Err() != nil {
+			logger.Debug().Msgf("request for file %s was cancelled while queued", filename)
+			return
+		}
+
+		logger.Warn().Err(err).Msgf("refused request for file %s", filename)
+		ratelimit.SetRetryAfter(w, cfg.scans.RetryAfter())
+		respondProblem(w, r, http.StatusServiceUnavailable, v1.Overloaded, err.Error())
+		return
+	}
+	defer release()
+
+	position, err := cfg.locate(r.Context(), logger, root, filename, reader, info, line, parsedParams.Since, ascending,
+		cursor)
 	if err != nil {
-		l.logger.Err(err).Msgf("while parsing %d lines for file %s", numLines, filename)
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		respondLocateProblem(w, r, logger, filename, err)
 		return
 	}
+	forward := position != nil && position.forward
+
+	scanOptions := cfg.limits.scanOptions()
+	if cursor != nil && !forward {
+		scanOptions = append(scanOptions, logparser.WithEndOffset(cursor.offset))
+	}
+	if position != nil {
+		scanOptions = append(scanOptions, position.scanOptions()...)
+	}
+	if plan != nil {
+		scanOptions = append(scanOptions, plan.scanOptions()...)
+	}
 
-	resp := v1.GetEntriesResponse{
-		Entries: rawLines(lines).toEntries(),
+	// the search index is only used for a whole scan from the end, as the other scans already skip most of the file.
+	var ranges []searchindex.Range
+	summary := &scanSummary{}
+	if position == nil && (plan == nil || plan.outcome == cacheMiss) {
+		end := info.Size()
+		if cursor != nil {
+			end = cursor.offset
+		}
+		ranges, summary.index = cfg.searchRanges(logger, root, filename, reader, info, parsedParams.filterText(), end)
+	}
+	if summary.index != nil {
+		summary.index.setHeaders(w.Header())
+	}
+
+	scanStarted := time.Now()
+	scanCtx, span := startScanSpan(r.Context(), root, filename, mediaType, numLines)
+	var fileScanner fileScanner
+	if forward {
+		fileScanner = logparser.NewForwardScanner(scanCtx, reader, filter, scanOptions...)
+	} else if summary.index != nil {
+		fileScanner = newIndexedScanner(scanCtx, reader, filter, cfg.limits, ranges, scanOptions...)
+		setSearchIndexed(span, summary.index)
+	} else {
+		fileScanner = logparser.NewReverseScanner(scanCtx, reader, filter, scanOptions...)
+	}
+	var scanner entryScanner = newCursorScanner(fileScanner, root, summary)
+	if plan != nil && plan.outcome != cacheMiss {
+		scanner = newMergingScanner(scanner, plan.cached, summary)
+	}
+	scanner = newLimitScanner(scanner, numLines)
+	// entries are cached before they are redacted, as the redactions depend on the principal.
+	var recording *recordingScanner
+	if plan != nil {
+		recording = newRecordingScanner(scanner, cfg.results.MaxResultBytes())
+		scanner = recording
+		setCacheOutcome(span, plan.outcome)
+	}
+	if redactor := cfg.redactor.For(principalFrom(r).Groups); redactor != nil {
+		scanner = newRedactingScanner(scanner, redactor, summary)
+	}
+	if ascending && !forward {
+		scanner = newAscendingScanner(scanner)
+	}
+
+	contentType := mediaType
+	if mediaType == mediaTypeText || mediaType == mediaTypeCSV {
+		contentType += "; charset=utf-8"
+	}
+	validators.set(w.Header())
+	w.Header().Set("Trailer", strings.Join([]string{redactionTrailer, truncatedTrailer, cursorTrailer}, ", "))
+	stream := newResponseStream(w, contentType, http.StatusOK)
+	stream.StartFlushing()
+	defer stream.StopFlushing()
+
+	err = entryWriters[mediaType](stream, scanner, format, summary)
+	stream.StopFlushing()
+	scanErr := fileScanner.Err()
+	stats := fileScanner.Stats()
+	cfg.recorder.Scanned(root, filename, stats, scanErr != nil && !errors.Is(scanErr, context.Canceled))
+	endScanSpan(scanCtx, span, scanStarted, stats, summary, err)
+	record.Redactions = summary.redactions
+	record.Truncated = summary.truncated
+	if err == nil && plan != nil {
+		cfg.store(plan, recording, summary)
+	}
+	if err == nil {
+		err = stream.Flush()
+	}
+	if err == nil {
+		summary.writeTrailers(w.Header())
+	}
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			logger.Debug().Msgf("request for file %s was cancelled while parsing", filename)
+			return
+		}
+
+		if !stream.Started() {
+			validators.clear(w.Header())
+		}
+
+		if errors.Is(err, logparser.ErrInvalidOffset) && !stream.Started() {
+			respondParamProblem(w, r,
+				invalidParam("cursor", "cursor is past the end of the file, which has been replaced or truncated"))
+			return
+		}
+
+		logger.Err(err).Msgf("while parsing %d lines for file %s", numLines, filename)
+		if !stream.Started() {
+			respondProblem(w, r, http.StatusInternalServerError, v1.InternalError, "")
+		}
+	}
+}
+
+// ListFiles uses the provided FileOpener implementation to list every file that can be requested from GetEntries.
+func (l *LogParserHandler) ListFiles(w http.ResponseWriter, r *http.Request) {
+	// as in GetEntries, the files are listed with the config the request is audited with.
+	cfg, _, done := l.auditedFrom(r)
+	defer done()
+
+	logger := l.requestLogger(r)
+	entries, err := cfg.opener.List()
+	if err != nil {
+		logger.Err(err).Msg("while listing files")
+		respondProblem(w, r, http.StatusInternalServerError, v1.InternalError, "")
+		return
+	}
+
+	principal := principalFrom(r)
+	resp := v1.ListFilesResponse{
+		Files: make([]v1.FileInfo, 0, len(entries)),
+	}
+	for _, entry := range entries {
+		if cfg.hides(entry.Info) || !cfg.policies.Authorize(principal, entry.Root, entry.Info.Name()).Allowed {
+			continue
+		}
+
+		resp.Files = append(resp.Files, v1.FileInfo{
+			Root:     entry.Root,
+			Name:     entry.Info.Name(),
+			Size:     entry.Info.Size(),
+			Modified: entry.Info.ModTime().UTC(),
+		})
 	}
 
 	if err := respond(w, resp, http.StatusOK); err != nil {
-		l.logger.Err(err).Msgf("attempting to send a response for file %s", filename)
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		logger.Err(err).Msg("attempting to send a response for the file listing")
+		respondProblem(w, r, http.StatusInternalServerError, v1.InternalError, "")
 	}
 }
 
 // NewLogParserHandler returns a new instance of the LogParserHandler.
-func NewLogParserHandler(logCtx zerolog.Context, opener FileOpener) *LogParserHandler {
-	return &LogParserHandler{
-		logger: logCtx.Str("handler", "logparser").Logger(),
-		opener: opener,
+func NewLogParserHandler(logCtx zerolog.Context, opener FileOpener, options ...HandlerOption) *LogParserHandler {
+	handler := &LogParserHandler{
+		logger: logCtx.Logger().With().Str("handler", "logparser").Logger(),
+	}
+	handler.config.Store(newHandlerConfig(opener, options...))
+
+	return handler
+}
+
+// Reload atomically replaces the opener and options used by every request that starts after it returns. Any option not
+// provided is reset to its default. Requests already in flight complete with the values they started with, and Reload
+// blocks until they have, so the previous opener it returns is safe to close.
+func (l *LogParserHandler) Reload(opener FileOpener, options ...HandlerOption) FileOpener {
+	previous := l.config.Load().(*handlerConfig)
+	l.config.Store(newHandlerConfig(opener, options...))
+
+	previous.inUse.Lock()
+	previous.retired = true
+	previous.inUse.Unlock()
+
+	return previous.opener
+}
+
+// Check validates every file can still be served from the current opener, when the opener supports it. An opener
+// that has been removed on shutdown is never ready.
+func (l *LogParserHandler) Check() error {
+	cfg := l.acquire()
+	defer l.release(cfg)
+
+	if cfg.opener == nil {
+		return errNoOpener
+	}
+
+	if checker, ok := cfg.opener.(interface{ Check() error }); ok {
+		return checker.Check()
 	}
+
+	return nil
 }
 
-func (l rawLines) toEntries() []v1.LogEntry {
-	out := make([]v1.LogEntry, 0, len(l))
+// acquire returns the current handlerConfig, which stays in use until it is released. If a reload retires the config
+// between loading and locking it, the newer config is used instead.
+func (l *LogParserHandler) acquire() *handlerConfig {
+	for {
+		cfg := l.config.Load().(*handlerConfig)
+
+		cfg.inUse.RLock()
+		if !cfg.retired {
+			return cfg
+		}
+		cfg.inUse.RUnlock()
+	}
+}
 
-	for _, line := range l {
-		out = append(out, v1.LogEntry(line))
+func (l *LogParserHandler) release(cfg *handlerConfig) {
+	cfg.inUse.RUnlock()
+}
+
+// open opens the file from the requested root after checking the policies allow it, and returns the name of the root
+// it was opened from. When no root is requested, the roots the principal may not read the file from are skipped while
+// searching, so a denied principal can't tell whether the file exists in them.
+func (c *handlerConfig) open(
+	ctx context.Context,
+	principal auth.Principal,
+	root, filename string,
+) (os.File, string, error) {
+	roots := []string{root}
+	if root == "" {
+		roots = c.opener.Names()
+	} else if !contains(c.opener.Names(), root) {
+		return nil, "", os.ErrUnknownRoot
+	}
+
+	deniedBy := ""
+	searched := false
+	for _, name := range roots {
+		decision := c.policies.Authorize(principal, name, filename)
+		if !decision.Allowed {
+			if deniedBy == "" {
+				deniedBy = decision.Policy
+			}
+			continue
+		}
+
+		searched = true
+		file, err := c.openVisible(ctx, name, filename)
+		if err == os.ErrNotExists && root == "" {
+			continue
+		}
+		return file, name, err
+	}
+
+	// once any root has been searched, the file is reported as missing, even if another root was denied.
+	if !searched && deniedBy != "" {
+		return nil, "", &forbiddenError{policy: deniedBy}
+	}
+
+	return nil, "", os.ErrNotExists
+}
+
+// acquireScan waits for a turn to scan a file, and returns the function that ends it. Without a concurrency limit,
+// or when every entry is cached for the file as it is now, the request scans straight away.
+func (c *handlerConfig) acquireScan(ctx context.Context, plan *cachePlan) (func(), error) {
+	if c.scans == nil || (plan != nil && plan.outcome == cacheHit) {
+		return func() {}, nil
+	}
+
+	return c.scans.Acquire(ctx)
+}
+
+// principalFrom returns the principal the request was authenticated as, or the anonymous principal when the request
+// was not authenticated.
+func principalFrom(r *http.Request) auth.Principal {
+	if principal, ok := auth.PrincipalFrom(r.Context()); ok {
+		return principal
+	}
+
+	return auth.Anonymous()
+}
+
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
 	}
 
-	return out
+	return false
 }
 
-func (p getEntriesParams) numLines() (int, error) {
+// requestLogger returns the logger attached to the request, which carries request scoped fields like the principal,
+// or the handler logger when the request has none.
+func (l *LogParserHandler) requestLogger(r *http.Request) *zerolog.Logger {
+	logger := zerolog.Ctx(r.Context())
+	if logger.GetLevel() == zerolog.Disabled {
+		return &l.logger
+	}
+
+	handlerLogger := logger.With().Str("handler", "logparser").Logger()
+	return &handlerLogger
+}
+
+func (p getEntriesParams) root() string {
+	if p.Root == nil {
+		return ""
+	}
+
+	return *p.Root
+}
+
+// cursor returns the cursor to continue a scan from, or nil when the scan starts at the end of the file. A cursor is
+// only valid for the root it was returned for.
+func (p getEntriesParams) cursor() (*scanCursor, error) {
+	if p.Cursor == nil || *p.Cursor == "" {
+		return nil, nil
+	}
+
+	cursor, err := parseCursor(*p.Cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.Root != nil && *p.Root != cursor.root {
+		return nil, invalidParam("cursor", "cursor value was returned for a different root")
+	}
+
+	return &cursor, nil
+}
+
+// filterText returns the filterByText parameter, or an empty string when no filter was requested.
+func (p getEntriesParams) filterText() string {
+	if p.FilterByText == nil {
+		return ""
+	}
+
+	return *p.FilterByText
+}
+
+func (p getEntriesParams) numLines(limits Limits) (int, error) {
 	if p.NumEntries == nil {
-		return defaultLines, nil
+		return limits.DefaultLines, nil
 	}
 
-	if *p.NumEntries > maxLines {
-		return -1, fmt.Errorf("numEntries value cannot be larger than %d", maxLines)
+	if *p.NumEntries > limits.MaxLines {
+		return -1, invalidParam("numEntries", fmt.Sprintf("numEntries value cannot be larger than %d", limits.MaxLines))
 	}
 
 	if *p.NumEntries <= 0 {
-		return -1, fmt.Errorf("numEntries value cannot be less than 1")
+		return -1, invalidParam("numEntries", "numEntries value cannot be less than 1")
 	}
 
 	return *p.NumEntries, nil
 }
 
-func (p getEntriesParams) filterer() logparser.Filterer {
+// filterer returns the Filterer for the filterByText parameter. Filters that could never match an entry are refused,
+// rather than reading the whole file to return nothing.
+func (p getEntriesParams) filterer(limits Limits) (logparser.Filterer, error) {
 	if p.FilterByText == nil || *p.FilterByText == "" {
-		return logparser.FilterNone()
+		return logparser.FilterNone(), nil
+	}
+
+	if strings.ContainsRune(*p.FilterByText, '\n') {
+		return nil, invalidFilter("filterByText", "filterByText value cannot contain a newline, as entries never do")
 	}
 
-	return logparser.FilterOnSubstring(*p.FilterByText)
+	if len(*p.FilterByText) > limits.MaxLineLength {
+		return nil, invalidFilter("filterByText",
+			fmt.Sprintf("filterByText value cannot be longer than the longest entry of %d bytes", limits.MaxLineLength))
+	}
+
+	return logparser.FilterOnSubstring(*p.FilterByText), nil
+}
+
+func (p getEntriesParams) ascending() (bool, error) {
+	if p.Order == nil {
+		return false, nil
+	}
+
+	switch *p.Order {
+	case orderDescending:
+		return false, nil
+	case orderAscending:
+		return true, nil
+	default:
+		return false, invalidParam("order", fmt.Sprintf("order value must be one of %s or %s", orderDescending, orderAscending))
+	}
+}
+
+// line returns the line parameter counted from 0, or nil when the scan is not positioned at a line.
+func (p getEntriesParams) line() (*int64, error) {
+	if p.Line == nil {
+		return nil, nil
+	}
+
+	if *p.Line < 1 {
+		return nil, invalidParam("line", "line value cannot be less than 1")
+	}
+
+	if p.Since != nil {
+		return nil, invalidParam("line", "line and since cannot be used together")
+	}
+
+	line := *p.Line - 1
+	return &line, nil
+}
+
+func (p getEntriesParams) format() (logparser.Format, error) {
+	if p.Format == nil || *p.Format == "" {
+		return nil, nil
+	}
+
+	format, ok := logparser.LookupFormat(string(*p.Format))
+	if !ok {
+		return nil, invalidParam("format", "format value must be one of "+strings.Join(logparser.FormatNames(), ", "))
+	}
+
+	return format, nil
+}
+
+func (e *forbiddenError) Error() string {
+	return fmt.Sprintf("denied by policy %s", e.policy)
 }
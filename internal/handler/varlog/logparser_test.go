@@ -0,0 +1,141 @@
+package varlog
+
+import (
+	"net/http"
+	"net/http/httptest"
+	goos "os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skormos/varlog-parser/internal/os"
+)
+
+// newTestHandler serves the files in the directory from a root named system.
+func newTestHandler(t *testing.T, dir string, options ...HandlerOption) http.Handler {
+	t.Helper()
+
+	roots, err := os.NewRoots([]os.Root{{Name: "system", Path: dir}})
+	require.NoError(t, err)
+
+	return NewHandler(zerolog.Nop().With(), NewLogParserHandler(zerolog.Nop().With(), roots, options...))
+}
+
+// getText requests the entries at the target as plain text, with the headers.
+func getText(handler http.Handler, target string, header http.Header) *httptest.ResponseRecorder {
+	header = header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	header.Set("Accept", mediaTypeText)
+
+	return get(handler, target, header)
+}
+
+// get requests the target with the headers.
+func get(handler http.Handler, target string, header http.Header) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	for name, values := range header {
+		r.Header[name] = values
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+// writeLog writes the content to a new log file, readable by everyone, or replaces the content of an existing one.
+func writeLog(t *testing.T, path, content string) {
+	t.Helper()
+
+	require.NoError(t, goos.WriteFile(path, []byte(content), 0o644))
+}
+
+// appendLog appends the content to the log file.
+func appendLog(t *testing.T, path, content string) {
+	t.Helper()
+
+	file, err := goos.OpenFile(path, goos.O_APPEND|goos.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = file.WriteString(content)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+}
+
+// logPath returns the path of the file in a new directory.
+func logPath(t *testing.T, name string) (string, string) {
+	dir := t.TempDir()
+	return dir, filepath.Join(dir, name)
+}
+
+func TestLogParserHandler_GetEntries(t *testing.T) {
+	dir, path := logPath(t, "syslog")
+	writeLog(t, path, "first, one\nsecond \"two\"\nthird\n")
+	handler := newTestHandler(t, dir)
+
+	tests := map[string]struct {
+		target       string
+		accept       string
+		expectedType string
+		expectedBody string
+	}{
+		"JSON by default": {
+			target:       "/syslog",
+			expectedType: mediaTypeJSON,
+			expectedBody: `{"entries":["third","second \"two\"","first, one"],"redactions":0,"truncated":false}`,
+		},
+		"Newline delimited JSON": {
+			target:       "/syslog",
+			accept:       mediaTypeNDJSON,
+			expectedType: mediaTypeNDJSON,
+			expectedBody: "\"third\"\n\"second \\\"two\\\"\"\n\"first, one\"\n",
+		},
+		"Plain text": {
+			target:       "/syslog",
+			accept:       mediaTypeText,
+			expectedType: mediaTypeText + "; charset=utf-8",
+			expectedBody: "third\nsecond \"two\"\nfirst, one\n",
+		},
+		"CSV": {
+			target:       "/syslog",
+			accept:       mediaTypeCSV,
+			expectedType: mediaTypeCSV + "; charset=utf-8",
+			expectedBody: "entry\nthird\n\"second \"\"two\"\"\"\n\"first, one\"\n",
+		},
+		"Ascending order returns the last entries, oldest first": {
+			target:       "/syslog?order=asc&numEntries=2",
+			accept:       mediaTypeText,
+			expectedType: mediaTypeText + "; charset=utf-8",
+			expectedBody: "second \"two\"\nthird\n",
+		},
+		"Ascending order as JSON": {
+			target:       "/syslog?order=asc&numEntries=2",
+			accept:       mediaTypeJSON,
+			expectedType: mediaTypeJSON,
+			expectedBody: `{"entries":["second \"two\"","third"],"redactions":0,"truncated":false}`,
+		},
+		"Descending order with a limit returns the most recent entries first": {
+			target:       "/syslog?order=desc&numEntries=2",
+			accept:       mediaTypeCSV,
+			expectedType: mediaTypeCSV + "; charset=utf-8",
+			expectedBody: "entry\nthird\n\"second \"\"two\"\"\"\n",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			header := make(http.Header)
+			if test.accept != "" {
+				header.Set("Accept", test.accept)
+			}
+
+			w := get(handler, test.target, header)
+			require.Equal(tt, http.StatusOK, w.Code)
+			assert.Equal(tt, test.expectedType, w.Header().Get("Content-Type"))
+			assert.Equal(tt, test.expectedBody, w.Body.String())
+		})
+	}
+}
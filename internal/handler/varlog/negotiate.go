@@ -0,0 +1,91 @@
+package varlog
+
+import (
+	"strconv"
+	"strings"
+)
+
+const (
+	mediaTypeJSON   = "application/json"
+	mediaTypeNDJSON = "application/x-ndjson"
+	mediaTypeText   = "text/plain"
+	mediaTypeCSV    = "text/csv"
+)
+
+// acceptRange is a single media range from an Accept header, with its quality value.
+type acceptRange struct {
+	mediaType string
+	quality   float64
+}
+
+// negotiate returns the offered media type that best matches the Accept header, as described in RFC 7231 section 5.3.2.
+// When the client has no preference between offers, the earliest offer wins, and a missing Accept header accepts the
+// first offer. An empty string is returned when none of the offers are acceptable.
+func negotiate(accept string, offers ...string) string {
+	if strings.TrimSpace(accept) == "" {
+		return offers[0]
+	}
+
+	ranges := parseAccept(accept)
+
+	best, bestQuality := "", 0.0
+	for _, offer := range offers {
+		if quality := qualityOf(ranges, offer); quality > bestQuality {
+			best, bestQuality = offer, quality
+		}
+	}
+
+	return best
+}
+
+func parseAccept(accept string) []acceptRange {
+	out := make([]acceptRange, 0)
+
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+		if mediaType == "" {
+			continue
+		}
+
+		quality := 1.0
+		for _, param := range params[1:] {
+			key, value, found := strings.Cut(strings.TrimSpace(param), "=")
+			if !found || strings.ToLower(strings.TrimSpace(key)) != "q" {
+				continue
+			}
+
+			if parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+				quality = parsed
+			}
+		}
+
+		out = append(out, acceptRange{mediaType: mediaType, quality: quality})
+	}
+
+	return out
+}
+
+// qualityOf returns the quality of the most specific range that matches the media type, or 0 when none match.
+func qualityOf(ranges []acceptRange, mediaType string) float64 {
+	mainType, _, _ := strings.Cut(mediaType, "/")
+
+	quality, specificity := 0.0, -1
+	for _, r := range ranges {
+		matched := -1
+		switch r.mediaType {
+		case mediaType:
+			matched = 2
+		case mainType + "/*":
+			matched = 1
+		case "*/*":
+			matched = 0
+		}
+
+		if matched > specificity {
+			quality, specificity = r.quality, matched
+		}
+	}
+
+	return quality
+}
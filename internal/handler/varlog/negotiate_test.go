@@ -0,0 +1,71 @@
+package varlog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiate(t *testing.T) {
+	offers := []string{mediaTypeJSON, mediaTypeNDJSON, mediaTypeText, mediaTypeCSV}
+
+	tests := map[string]struct {
+		accept   string
+		expected string
+	}{
+		"Missing header accepts the first offer": {
+			accept:   "",
+			expected: mediaTypeJSON,
+		},
+		"Exact media type": {
+			accept:   "application/x-ndjson",
+			expected: mediaTypeNDJSON,
+		},
+		"Media type is case insensitive": {
+			accept:   "Text/CSV",
+			expected: mediaTypeCSV,
+		},
+		"Wildcard accepts the first offer": {
+			accept:   "*/*",
+			expected: mediaTypeJSON,
+		},
+		"Subtype wildcard accepts the first offer of that type": {
+			accept:   "text/*",
+			expected: mediaTypeText,
+		},
+		"Highest quality wins": {
+			accept:   "application/json;q=0.5, text/plain;q=0.9",
+			expected: mediaTypeText,
+		},
+		"Equal quality keeps the order of the offers": {
+			accept:   "text/csv, application/x-ndjson",
+			expected: mediaTypeNDJSON,
+		},
+		"Specific range overrides a wildcard": {
+			accept:   "*/*;q=0.8, application/json;q=0.1",
+			expected: mediaTypeNDJSON,
+		},
+		"Zero quality refuses an offer": {
+			accept:   "application/json;q=0, */*;q=0.1",
+			expected: mediaTypeNDJSON,
+		},
+		"Parameters other than quality are ignored": {
+			accept:   "text/plain; charset=utf-8",
+			expected: mediaTypeText,
+		},
+		"Invalid quality counts as the default": {
+			accept:   "text/plain;q=high",
+			expected: mediaTypeText,
+		},
+		"Nothing acceptable": {
+			accept:   "image/png",
+			expected: "",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			assert.Equal(tt, test.expected, negotiate(test.accept, offers...))
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package varlog
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rs/xid"
+
+	"github.com/skormos/varlog-parser/internal/audit"
+	"github.com/skormos/varlog-parser/internal/cache"
+	"github.com/skormos/varlog-parser/internal/lineindex"
+	"github.com/skormos/varlog-parser/internal/logparser"
+	"github.com/skormos/varlog-parser/internal/policy"
+	"github.com/skormos/varlog-parser/internal/ratelimit"
+	"github.com/skormos/varlog-parser/internal/redact"
+	"github.com/skormos/varlog-parser/internal/searchindex"
+)
+
+type (
+	// HandlerOption defines the function signature for helper methods to update the values used by the
+	// LogParserHandler, either when it is created or reloaded.
+	HandlerOption func(cfg *handlerConfig)
+
+	// Limits bound the work done for, and the size of, a single GetEntries request.
+	Limits struct {
+		// DefaultLines is the number of entries returned when numEntries is not provided.
+		DefaultLines int
+		// MaxLines is the largest numEntries value that will be accepted.
+		MaxLines int
+		// ChunkSize is the number of bytes read from a file at a time.
+		ChunkSize int
+		// MaxLineLength is the number of bytes kept for a single entry, before it is truncated.
+		MaxLineLength int
+		// MaxScanBytes is the number of bytes read from a file before the scan stops, returning the entries found so
+		// far. 0 disables the limit.
+		MaxScanBytes int64
+		// MaxScanTime is how long a scan runs before it stops, returning the entries found so far. 0 disables the
+		// limit.
+		MaxScanTime time.Duration
+	}
+
+	// ScanRecorder is told about every file opened and scanned by GetEntries, so it can be measured.
+	ScanRecorder interface {
+		FileOpened()
+		FileClosed()
+		Scanned(root, file string, stats logparser.ScanStats, failed bool)
+		CacheLookup(outcome string)
+	}
+
+	nopRecorder struct{}
+
+	// handlerConfig holds every value that can be replaced by a reload. A request uses a single handlerConfig from
+	// start to finish, and holds a read lock on it for that time, so a reload can tell when the previous values are no
+	// longer in use.
+	handlerConfig struct {
+		opener      FileOpener
+		limits      Limits
+		policies    *policy.Set
+		redactor    *redact.Redactor
+		auditSink   audit.Sink
+		scans       *ratelimit.ConcurrencyLimiter
+		recorder    ScanRecorder
+		results     *cache.LRU
+		lineIndex   *lineindex.Store
+		searchIndex *searchindex.Store
+		// validatorSeed is unique to this config, so the validators of every response change on reload.
+		validatorSeed string
+
+		inUse   sync.RWMutex
+		retired bool
+	}
+)
+
+// DefaultLimits returns the Limits used when none are provided.
+func DefaultLimits() Limits {
+	return Limits{
+		DefaultLines:  25,
+		MaxLines:      100000,
+		ChunkSize:     64 * 1024,
+		MaxLineLength: logparser.DefaultMaxLineLength,
+		MaxScanBytes:  1 << 30,
+		MaxScanTime:   30 * time.Second,
+	}
+}
+
+// WithLimits replaces the default Limits.
+func WithLimits(limits Limits) HandlerOption {
+	return func(cfg *handlerConfig) {
+		cfg.limits = limits
+	}
+}
+
+// WithPolicies restricts the files every principal can read and list. Without any policies, every file can be read.
+func WithPolicies(policies *policy.Set) HandlerOption {
+	return func(cfg *handlerConfig) {
+		cfg.policies = policies
+	}
+}
+
+// WithRedactor replaces sensitive values in every returned entry, apart from the rules the principal's groups are
+// exempt from.
+func WithRedactor(redactor *redact.Redactor) HandlerOption {
+	return func(cfg *handlerConfig) {
+		cfg.redactor = redactor
+	}
+}
+
+// WithAudit records every GetEntries request to the sink. The files the sink writes to can't be read or listed.
+func WithAudit(sink audit.Sink) HandlerOption {
+	return func(cfg *handlerConfig) {
+		cfg.auditSink = sink
+	}
+}
+
+// WithConcurrencyLimit caps the number of files scanned at once. Requests over the cap are queued, and are refused with
+// a 503 when the queue is full or they have waited too long.
+func WithConcurrencyLimit(scans *ratelimit.ConcurrencyLimiter) HandlerOption {
+	return func(cfg *handlerConfig) {
+		cfg.scans = scans
+	}
+}
+
+// WithCache keeps the entries returned for recent queries, so a query repeated against a file that has not changed is
+// answered without reading it, and one against a file that has only grown only reads what was appended.
+func WithCache(results *cache.LRU) HandlerOption {
+	return func(cfg *handlerConfig) {
+		cfg.results = results
+	}
+}
+
+// WithLineIndex finds the position of the line and since parameters from the index of the file, rather than reading
+// it from the start.
+func WithLineIndex(lineIndex *lineindex.Store) HandlerOption {
+	return func(cfg *handlerConfig) {
+		cfg.lineIndex = lineIndex
+	}
+}
+
+// WithSearchIndex reads only the blocks of a file that could contain the filterByText parameter, and the content not
+// indexed yet, rather than the whole file.
+func WithSearchIndex(searchIndex *searchindex.Store) HandlerOption {
+	return func(cfg *handlerConfig) {
+		cfg.searchIndex = searchIndex
+	}
+}
+
+// WithRecorder reports every file opened and scanned to the recorder.
+func WithRecorder(recorder ScanRecorder) HandlerOption {
+	return func(cfg *handlerConfig) {
+		cfg.recorder = recorder
+	}
+}
+
+func newHandlerConfig(opener FileOpener, options ...HandlerOption) *handlerConfig {
+	cfg := &handlerConfig{
+		opener:        opener,
+		limits:        DefaultLimits(),
+		recorder:      nopRecorder{},
+		validatorSeed: xid.New().String(),
+	}
+
+	for _, optionFn := range options {
+		optionFn(cfg)
+	}
+
+	return cfg
+}
+
+// scanOptions returns the logparser options that apply the limits to a single scan, which starts now.
+func (l Limits) scanOptions() []logparser.Option {
+	options := []logparser.Option{
+		logparser.WithChunkSize(l.ChunkSize),
+		logparser.WithMaxLineLength(l.MaxLineLength),
+		logparser.WithMaxBytes(l.MaxScanBytes),
+	}
+
+	if l.MaxScanTime > 0 {
+		options = append(options, logparser.WithDeadline(time.Now().Add(l.MaxScanTime)))
+	}
+
+	return options
+}
+
+func (nopRecorder) FileOpened() {}
+
+func (nopRecorder) FileClosed() {}
+
+func (nopRecorder) Scanned(string, string, logparser.ScanStats, bool) {}
+
+func (nopRecorder) CacheLookup(string) {}
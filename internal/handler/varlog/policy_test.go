@@ -0,0 +1,185 @@
+package varlog
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	v1 "github.com/skormos/varlog-parser/internal/api/rest/v1"
+	"github.com/skormos/varlog-parser/internal/audit"
+	"github.com/skormos/varlog-parser/internal/auth"
+	"github.com/skormos/varlog-parser/internal/os"
+	"github.com/skormos/varlog-parser/internal/policy"
+)
+
+// newPolicyRouter serves two roots, apps and then system, to the principal, with policies that deny it some of the
+// files in them. Every GetEntries request is recorded to the sink.
+func newPolicyRouter(t *testing.T, principal auth.Principal, sink audit.Sink) http.Handler {
+	t.Helper()
+
+	apps, system := t.TempDir(), t.TempDir()
+	writeLog(t, filepath.Join(apps, "app.log"), "app\n")
+	writeLog(t, filepath.Join(apps, "secret.log"), "apps secret\n")
+	writeLog(t, filepath.Join(apps, "hidden.log"), "hidden\n")
+	writeLog(t, filepath.Join(system, "secret.log"), "system secret\n")
+	writeLog(t, filepath.Join(system, "audit.log"), "audit\n")
+	roots, err := os.NewRoots([]os.Root{{Name: "apps", Path: apps}, {Name: "system", Path: system}})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = roots.Close()
+	})
+
+	policies, err := policy.NewSet([]policy.Policy{
+		{Name: "operators", Effect: policy.EffectAllow, Groups: []string{"ops"}},
+		{
+			Name:       "no-app-secrets",
+			Effect:     policy.EffectDeny,
+			Principals: []string{"reader"},
+			Roots:      []string{"apps"},
+			Files:      []string{"secret.log", "hidden.log"},
+		},
+		{Name: "no-audit", Effect: policy.EffectDeny, Groups: []string{"ops"}, Files: []string{"audit.log"}},
+	})
+	require.NoError(t, err)
+
+	parser := NewLogParserHandler(zerolog.Nop().With(), roots, WithPolicies(policies), WithAudit(sink))
+	api := NewHandler(zerolog.Nop().With(), parser)
+
+	return parser.Audit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		AuditPrincipal(api).ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+	}))
+}
+
+func TestLogParserHandler_GetEntriesWithPolicies(t *testing.T) {
+	reader := auth.Principal{Subject: "reader", Groups: []string{"ops"}, Method: auth.MethodAPIKey}
+
+	tests := map[string]struct {
+		principal       auth.Principal
+		target          string
+		expectedStatus  int
+		expectedBody    string
+		expectedPolicy  string
+		expectedOutcome string
+		expectedRoot    string
+	}{
+		"Allowed file": {
+			principal:       reader,
+			target:          "/app.log",
+			expectedStatus:  http.StatusOK,
+			expectedBody:    "app\n",
+			expectedOutcome: audit.OutcomeSuccess,
+			expectedRoot:    "apps",
+		},
+		"File in a denied root": {
+			principal:       reader,
+			target:          "/secret.log?root=apps",
+			expectedStatus:  http.StatusForbidden,
+			expectedPolicy:  "no-app-secrets",
+			expectedOutcome: audit.OutcomeDenied,
+		},
+		"Denied root is skipped for the next root with the file": {
+			principal:       reader,
+			target:          "/secret.log",
+			expectedStatus:  http.StatusOK,
+			expectedBody:    "system secret\n",
+			expectedOutcome: audit.OutcomeSuccess,
+			expectedRoot:    "system",
+		},
+		"File only in a denied root is missing once another root was searched": {
+			principal:       reader,
+			target:          "/hidden.log",
+			expectedStatus:  http.StatusNotFound,
+			expectedOutcome: audit.OutcomeNotFound,
+		},
+		"File missing from every root is missing": {
+			principal:       reader,
+			target:          "/missing.log",
+			expectedStatus:  http.StatusNotFound,
+			expectedOutcome: audit.OutcomeNotFound,
+		},
+		"File denied in every root": {
+			principal:       reader,
+			target:          "/audit.log",
+			expectedStatus:  http.StatusForbidden,
+			expectedPolicy:  "no-audit",
+			expectedOutcome: audit.OutcomeDenied,
+		},
+		"Principal no policy allows": {
+			principal:       auth.Principal{Subject: "guest", Method: auth.MethodAPIKey},
+			target:          "/app.log",
+			expectedStatus:  http.StatusForbidden,
+			expectedPolicy:  policy.DefaultPolicy,
+			expectedOutcome: audit.OutcomeDenied,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			sink := &recordingSink{}
+			w := getText(newPolicyRouter(tt, test.principal, sink), test.target, nil)
+			require.Equal(tt, test.expectedStatus, w.Code)
+
+			switch test.expectedStatus {
+			case http.StatusOK:
+				assert.Equal(tt, test.expectedBody, w.Body.String())
+			case http.StatusForbidden:
+				body := decodeProblem(tt, w)
+				assert.Equal(tt, v1.Forbidden, body.Code)
+				require.NotNil(tt, body.Policy)
+				assert.Equal(tt, test.expectedPolicy, *body.Policy)
+			default:
+				// a missing file reads the same whether or not a denied root holds it.
+				body := decodeProblem(tt, w)
+				assert.Equal(tt, v1.FileNotFound, body.Code)
+				assert.Nil(tt, body.Policy)
+			}
+
+			records := sink.Records()
+			require.Len(tt, records, 1)
+			assert.Equal(tt, test.principal.Subject, records[0].Principal)
+			assert.Equal(tt, test.expectedOutcome, records[0].Outcome)
+			assert.Equal(tt, test.expectedPolicy, records[0].Policy)
+			assert.Equal(tt, test.expectedRoot, records[0].Root)
+		})
+	}
+}
+
+func TestLogParserHandler_ListFilesWithPolicies(t *testing.T) {
+	tests := map[string]struct {
+		principal     auth.Principal
+		expectedFiles []string
+	}{
+		"Files denied to the principal are hidden": {
+			principal:     auth.Principal{Subject: "reader", Groups: []string{"ops"}},
+			expectedFiles: []string{"apps/app.log", "system/secret.log"},
+		},
+		"Policies that name another principal don't hide its files": {
+			principal:     auth.Principal{Subject: "writer", Groups: []string{"ops"}},
+			expectedFiles: []string{"apps/app.log", "apps/hidden.log", "apps/secret.log", "system/secret.log"},
+		},
+		"Every file is hidden from a principal no policy allows": {
+			principal:     auth.Principal{Subject: "guest"},
+			expectedFiles: []string{},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			w := get(newPolicyRouter(tt, test.principal, &recordingSink{}), "/", nil)
+			require.Equal(tt, http.StatusOK, w.Code)
+
+			var resp v1.ListFilesResponse
+			require.NoError(tt, json.Unmarshal(w.Body.Bytes(), &resp))
+			files := make([]string, 0, len(resp.Files))
+			for _, file := range resp.Files {
+				files = append(files, file.Root+"/"+file.Name)
+			}
+			assert.ElementsMatch(tt, test.expectedFiles, files)
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package varlog
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	v1 "github.com/skormos/varlog-parser/internal/api/rest/v1"
+	"github.com/skormos/varlog-parser/internal/lineindex"
+	"github.com/skormos/varlog-parser/internal/logparser"
+	"github.com/skormos/varlog-parser/internal/os"
+)
+
+// scanPosition is where the line or since parameter positions a scan, and which way it reads from there.
+type scanPosition struct {
+	// forward is set when the entries are read forward from start, rather than back from end.
+	forward bool
+	start   int64
+	// end is the offset the scan reads back from, or -1 for the end of the file.
+	end int64
+}
+
+// locate finds the position of the line, counted from 0, or the first line written at or after since, from the line
+// index when there is one, or by reading the file from the start. A cursor continues a positioned scan from where it
+// stopped, so only the position since sets for a scan read back towards it is still found. It returns nil when the
+// scan is not positioned.
+func (c *handlerConfig) locate(
+	ctx context.Context,
+	logger *zerolog.Logger,
+	root, filename string,
+	file os.File,
+	info fs.FileInfo,
+	line *int64,
+	since *time.Time,
+	ascending bool,
+	cursor *scanCursor,
+) (*scanPosition, error) {
+	if line == nil && since == nil {
+		return nil, nil
+	}
+
+	position := &scanPosition{forward: ascending, end: -1}
+	if cursor != nil && (ascending || line != nil) {
+		if ascending {
+			position.start = cursor.offset
+		}
+		return position, nil
+	}
+
+	if c.limits.MaxScanTime > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.limits.MaxScanTime)
+		defer cancel()
+	}
+
+	if line != nil {
+		from, err := c.checkpoint(ctx, logger, filename, func(lineIndex *lineindex.Store) (logparser.Checkpoint, error) {
+			return lineIndex.LineCheckpoint(ctx, root, filename, file, info, *line)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		start, end, err := logparser.LocateLine(ctx, file, from, *line)
+		if err != nil {
+			return nil, err
+		}
+
+		if ascending {
+			position.start = start
+		} else {
+			position.end = end
+		}
+		return position, nil
+	}
+
+	from, err := c.checkpoint(ctx, logger, filename, func(lineIndex *lineindex.Store) (logparser.Checkpoint, error) {
+		return lineIndex.TimeCheckpoint(ctx, root, filename, file, info, *since)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if position.start, err = logparser.LocateTime(ctx, file, from.Offset, *since, info.ModTime()); err != nil {
+		return nil, err
+	}
+
+	return position, nil
+}
+
+// checkpoint returns the closest position to search from that the line index knows of, or the start of the file
+// without an index. An index that can't be read or written is logged, and the file is searched from the start.
+func (c *handlerConfig) checkpoint(
+	ctx context.Context,
+	logger *zerolog.Logger,
+	filename string,
+	lookup func(lineIndex *lineindex.Store) (logparser.Checkpoint, error),
+) (logparser.Checkpoint, error) {
+	if c.lineIndex == nil {
+		return logparser.Checkpoint{}, nil
+	}
+
+	checkpoint, err := lookup(c.lineIndex)
+	if err != nil {
+		if ctx.Err() != nil {
+			return logparser.Checkpoint{}, err
+		}
+
+		logger.Warn().Err(err).Msgf("while indexing the lines of %s, searching it from the start", filename)
+		return logparser.Checkpoint{}, nil
+	}
+
+	return checkpoint, nil
+}
+
+// scanOptions bounds the scan to the content after the start, and before the end when it is set.
+func (p *scanPosition) scanOptions() []logparser.Option {
+	options := []logparser.Option{logparser.WithStartOffset(p.start)}
+	if p.end >= 0 {
+		options = append(options, logparser.WithEndOffset(p.end))
+	}
+
+	return options
+}
+
+// respondLocateProblem responds to a position that could not be found. Finding it is bounded by the scan time limit,
+// as without an index, the whole file may be read.
+func respondLocateProblem(w http.ResponseWriter, r *http.Request, logger *zerolog.Logger, filename string, err error) {
+	switch {
+	case errors.Is(err, logparser.ErrLineOutOfRange):
+		respondParamProblem(w, r, invalidParam("line", "line value is past the end of the file"))
+	case r.Context().Err() != nil:
+		logger.Debug().Msgf("request for file %s was cancelled while locating the position", filename)
+	case errors.Is(err, context.DeadlineExceeded):
+		logger.Warn().Msgf("could not locate the position in file %s within the scan time limit", filename)
+		respondProblem(w, r, http.StatusServiceUnavailable, v1.Overloaded,
+			"the line or time could not be located within the scan time limit")
+	default:
+		logger.Err(err).Msgf("while locating the position in file %s", filename)
+		respondProblem(w, r, http.StatusInternalServerError, v1.InternalError, "")
+	}
+}
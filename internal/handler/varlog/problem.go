@@ -0,0 +1,71 @@
+package varlog
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	v1 "github.com/skormos/varlog-parser/internal/api/rest/v1"
+	"github.com/skormos/varlog-parser/internal/problem"
+)
+
+// paramError is returned when validating a single request parameter fails.
+type paramError struct {
+	code  v1.ProblemCode
+	param string
+	msg   string
+}
+
+func (e *paramError) Error() string {
+	return e.msg
+}
+
+func invalidParam(param, msg string) error {
+	return &paramError{code: v1.InvalidParam, param: param, msg: msg}
+}
+
+func invalidFilter(param, msg string) error {
+	return &paramError{code: v1.InvalidFilter, param: param, msg: msg}
+}
+
+// respondProblem writes an RFC 7807 problem document. The detail is optional, and is left out when empty.
+func respondProblem(writer http.ResponseWriter, r *http.Request, status int, code v1.ProblemCode, detail string) {
+	problem.Respond(writer, r, status, code, detail)
+}
+
+// RespondUnauthorized writes a 401 problem document for a request that could not be authenticated, with the reason as
+// the detail.
+func RespondUnauthorized(writer http.ResponseWriter, r *http.Request, err error) {
+	respondProblem(writer, r, http.StatusUnauthorized, v1.Unauthorized, err.Error())
+}
+
+// RespondRateLimited writes a 429 problem document for a client that has sent too many requests. The Retry-After
+// header must already be set.
+func RespondRateLimited(writer http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	respondProblem(writer, r, http.StatusTooManyRequests, v1.RateLimited,
+		fmt.Sprintf("too many requests, retry after %s", retryAfter.Round(time.Millisecond)))
+}
+
+// respondForbidden writes a 403 problem document naming the policy that denied the request.
+func respondForbidden(writer http.ResponseWriter, r *http.Request, policyName string) {
+	forbidden := problem.New(r, http.StatusForbidden, v1.Forbidden,
+		"a policy does not allow the requested file to be read")
+	forbidden.Policy = &policyName
+
+	problem.Write(writer, forbidden)
+}
+
+// respondParamProblem writes a 400 problem document for a parameter validation error.
+func respondParamProblem(writer http.ResponseWriter, r *http.Request, err error) {
+	var paramErr *paramError
+	if !errors.As(err, &paramErr) {
+		respondProblem(writer, r, http.StatusBadRequest, v1.InvalidParam, err.Error())
+		return
+	}
+
+	invalid := problem.New(r, http.StatusBadRequest, paramErr.code, paramErr.msg)
+	invalid.Param = &paramErr.param
+
+	problem.Write(writer, invalid)
+}
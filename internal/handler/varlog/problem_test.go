@@ -0,0 +1,94 @@
+package varlog
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	v1 "github.com/skormos/varlog-parser/internal/api/rest/v1"
+	"github.com/skormos/varlog-parser/internal/problem"
+)
+
+// decodeProblem decodes the problem document of the response.
+func decodeProblem(t *testing.T, w *httptest.ResponseRecorder) v1.Problem {
+	t.Helper()
+
+	require.Equal(t, problem.MediaType, w.Header().Get("Content-Type"))
+	var out v1.Problem
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &out))
+	return out
+}
+
+func TestLogParserHandler_Problems(t *testing.T) {
+	dir, path := logPath(t, "syslog")
+	writeLog(t, path, "first\nsecond\n")
+	handler := newTestHandler(t, dir)
+
+	tests := map[string]struct {
+		target         string
+		expectedStatus int
+		expectedCode   v1.ProblemCode
+		expectedParam  string
+	}{
+		"Parameter that can't be bound": {
+			target:         "/syslog?numEntries=many",
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   v1.InvalidParam,
+			expectedParam:  "numEntries",
+		},
+		"Parameter out of range": {
+			target:         "/syslog?numEntries=0",
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   v1.InvalidParam,
+			expectedParam:  "numEntries",
+		},
+		"Filter that can never match": {
+			target:         "/syslog?filterByText=%0A",
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   v1.InvalidFilter,
+			expectedParam:  "filterByText",
+		},
+		"Cursor that was never returned": {
+			target:         "/syslog?cursor=guess",
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   v1.InvalidParam,
+			expectedParam:  "cursor",
+		},
+		"Unknown file": {
+			target:         "/missing",
+			expectedStatus: http.StatusNotFound,
+			expectedCode:   v1.FileNotFound,
+		},
+		"Unknown root": {
+			target:         "/syslog?root=apps",
+			expectedStatus: http.StatusNotFound,
+			expectedCode:   v1.FileNotFound,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			w := get(handler, test.target, nil)
+			require.Equal(tt, test.expectedStatus, w.Code)
+
+			body := decodeProblem(tt, w)
+			assert.Equal(tt, "urn:varlog:problem:"+string(test.expectedCode), body.Type)
+			assert.Equal(tt, test.expectedCode, body.Code)
+			assert.Equal(tt, test.expectedStatus, body.Status)
+			assert.NotEmpty(tt, body.Title)
+			require.NotNil(tt, body.Instance)
+			assert.Equal(tt, httptest.NewRequest(http.MethodGet, test.target, nil).URL.Path, *body.Instance)
+			if test.expectedParam == "" {
+				assert.Nil(tt, body.Param)
+				return
+			}
+			require.NotNil(tt, body.Param)
+			assert.Equal(tt, test.expectedParam, *body.Param)
+			assert.NotNil(tt, body.Detail)
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package varlog
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skormos/varlog-parser/internal/auth"
+	"github.com/skormos/varlog-parser/internal/redact"
+)
+
+// asPrincipal serves every request to the handler on behalf of the principal, as the authentication would.
+func asPrincipal(handler http.Handler, principal auth.Principal) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+	})
+}
+
+func TestLogParserHandler_GetEntriesWithRedactions(t *testing.T) {
+	dir, path := logPath(t, "syslog")
+	writeLog(t, path, "login by alice@example.com, password=hunter2\nhealthy\n")
+
+	redactor, err := redact.New([]redact.Rule{
+		{Preset: "email", ExemptGroups: []string{"security"}},
+		{Preset: "password", ExemptGroups: []string{"admins"}},
+	})
+	require.NoError(t, err)
+	handler := newTestHandler(t, dir, WithRedactor(redactor))
+
+	const (
+		redacted = "login by [REDACTED:email], password=[REDACTED]"
+		raw      = "login by alice@example.com, password=hunter2"
+	)
+
+	tests := map[string]struct {
+		groups             []string
+		accept             string
+		expectedBody       string
+		expectedRedactions string
+	}{
+		"JSON": {
+			accept:             mediaTypeJSON,
+			expectedBody:       `{"entries":["healthy","` + redacted + `"],"redactions":2,"truncated":false}`,
+			expectedRedactions: "2",
+		},
+		"Newline delimited JSON": {
+			accept:             mediaTypeNDJSON,
+			expectedBody:       "\"healthy\"\n\"" + redacted + "\"\n",
+			expectedRedactions: "2",
+		},
+		"Plain text": {
+			accept:             mediaTypeText,
+			expectedBody:       "healthy\n" + redacted + "\n",
+			expectedRedactions: "2",
+		},
+		"CSV": {
+			accept:             mediaTypeCSV,
+			expectedBody:       "entry\nhealthy\n\"" + redacted + "\"\n",
+			expectedRedactions: "2",
+		},
+		"Group exempt from one rule sees the values it matches": {
+			groups: []string{"security"},
+			accept: mediaTypeJSON,
+			expectedBody: `{"entries":["healthy","login by alice@example.com, password=[REDACTED]"],` +
+				`"redactions":1,"truncated":false}`,
+			expectedRedactions: "1",
+		},
+		"Groups exempt from every rule see the raw entries": {
+			groups:             []string{"security", "admins"},
+			accept:             mediaTypeText,
+			expectedBody:       "healthy\n" + raw + "\n",
+			expectedRedactions: "0",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			principal := auth.Principal{Subject: "reader", Groups: test.groups, Method: auth.MethodAPIKey}
+			w := get(asPrincipal(handler, principal), "/syslog", http.Header{"Accept": {test.accept}})
+			require.Equal(tt, http.StatusOK, w.Code)
+
+			assert.Equal(tt, test.expectedBody, w.Body.String())
+			// the count is also sent as a trailer, as only the JSON body has room for it.
+			assert.Equal(tt, test.expectedRedactions, w.Result().Trailer.Get(redactionTrailer))
+		})
+	}
+}
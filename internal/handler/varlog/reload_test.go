@@ -0,0 +1,153 @@
+package varlog
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skormos/varlog-parser/internal/os"
+)
+
+// generationOpener serves a single file, syslog, which holds the generation of the opener. It counts the files opened
+// once it has been retired, which a reload must never allow. While held is set, every open waits on proceed, after
+// signalling entered, so a request can be kept in flight.
+type generationOpener struct {
+	*os.Roots
+	retired     int32
+	openedAfter int32
+
+	held    int32
+	entered chan struct{}
+	proceed chan struct{}
+}
+
+func newGenerationOpener(t *testing.T, generation int) *generationOpener {
+	t.Helper()
+
+	dir := t.TempDir()
+	writeLog(t, filepath.Join(dir, "syslog"), fmt.Sprintf("generation %d\n", generation))
+	roots, err := os.NewRoots([]os.Root{{Name: "system", Path: dir}})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = roots.Close()
+	})
+
+	return &generationOpener{Roots: roots, entered: make(chan struct{}), proceed: make(chan struct{})}
+}
+
+func (o *generationOpener) Open(ctx context.Context, root, filename string) (os.File, error) {
+	if atomic.LoadInt32(&o.retired) == 1 {
+		atomic.AddInt32(&o.openedAfter, 1)
+	}
+	if atomic.LoadInt32(&o.held) == 1 {
+		o.entered <- struct{}{}
+		<-o.proceed
+	}
+
+	return o.Roots.Open(ctx, root, filename)
+}
+
+// retire marks the opener as no longer in use, once a reload has returned it.
+func (o *generationOpener) retire() {
+	atomic.StoreInt32(&o.retired, 1)
+}
+
+func TestLogParserHandler_Reload(t *testing.T) {
+	const inFlight = 3
+
+	previous := newGenerationOpener(t, 1)
+	atomic.StoreInt32(&previous.held, 1)
+	next := newGenerationOpener(t, 2)
+
+	parser := NewLogParserHandler(zerolog.Nop().With(), previous)
+	handler := NewHandler(zerolog.Nop().With(), parser)
+
+	bodies := make(chan string, inFlight)
+	for i := 0; i < inFlight; i++ {
+		go func() {
+			bodies <- getText(handler, "/syslog", nil).Body.String()
+		}()
+		<-previous.entered
+	}
+	// the requests made while the reload is starting are not held, as nothing waits for them to enter.
+	atomic.StoreInt32(&previous.held, 0)
+
+	reloaded := make(chan FileOpener)
+	go func() {
+		reloaded <- parser.Reload(next)
+	}()
+
+	// requests that start once the new config is stored are served by it straight away, while the reload still waits.
+	require.Eventually(t, func() bool {
+		return getText(handler, "/syslog", nil).Body.String() == "generation 2\n"
+	}, time.Second, time.Millisecond)
+	select {
+	case <-reloaded:
+		t.Fatal("reload returned while requests were in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// the requests in flight complete with the config they started with, and only then does the reload return.
+	close(previous.proceed)
+	for i := 0; i < inFlight; i++ {
+		assert.Equal(t, "generation 1\n", <-bodies)
+	}
+	assert.Same(t, previous, <-reloaded)
+}
+
+func TestLogParserHandler_ReloadConcurrently(t *testing.T) {
+	const (
+		reloads  = 20
+		requests = 8
+	)
+
+	openers := []*generationOpener{newGenerationOpener(t, 0)}
+	parser := NewLogParserHandler(zerolog.Nop().With(), openers[0])
+	handler := NewHandler(zerolog.Nop().With(), parser)
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				w := getText(handler, "/syslog", nil)
+				assert.Equal(t, http.StatusOK, w.Code)
+				assert.Regexp(t, `^generation \d+\n$`, w.Body.String())
+			}
+		}()
+	}
+
+	// every reload returns the opener it replaced, which is never handed to a request again.
+	for generation := 1; generation <= reloads; generation++ {
+		opener := newGenerationOpener(t, generation)
+		openers = append(openers, opener)
+
+		previous := parser.Reload(opener)
+		assert.Same(t, openers[generation-1], previous)
+		openers[generation-1].retire()
+	}
+	close(done)
+	wg.Wait()
+
+	for generation, opener := range openers {
+		assert.Zero(t, atomic.LoadInt32(&opener.openedAfter), "generation %d was opened once retired", generation)
+	}
+	assert.Equal(t, fmt.Sprintf("generation %d\n", reloads), getText(handler, "/syslog", nil).Body.String())
+}
@@ -0,0 +1,234 @@
+package varlog
+
+import (
+	"context"
+	"io/fs"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/skormos/varlog-parser/internal/logparser"
+	"github.com/skormos/varlog-parser/internal/os"
+	"github.com/skormos/varlog-parser/internal/searchindex"
+)
+
+const (
+	// the freshness of the search index is known before the scan starts, so it is sent as headers.
+	indexedAtHeader      = "X-Search-Index-Indexed-At"
+	unindexedBytesHeader = "X-Search-Index-Unindexed-Bytes"
+)
+
+type (
+	// indexSummary is how fresh the search index of the file was when it was used to skip the blocks that could not
+	// contain the filter text.
+	indexSummary struct {
+		indexedAt      time.Time
+		indexedBytes   int64
+		unindexedBytes int64
+	}
+
+	// indexSummaryJSON is the index summary, as the searchIndex property of a GetEntriesResponse.
+	indexSummaryJSON struct {
+		IndexedAt      *time.Time `json:"indexedAt,omitempty"`
+		IndexedBytes   int64      `json:"indexedBytes"`
+		UnindexedBytes int64      `json:"unindexedBytes"`
+	}
+
+	// indexedScanner reads the ranges of a file newest first, each with a logparser.ReverseScanner of its own. The
+	// byte and time limits apply to the scan as a whole, so a range is only started while neither has been reached.
+	indexedScanner struct {
+		ctx     context.Context
+		file    os.File
+		filter  logparser.Filterer
+		options []logparser.Option
+		limits  Limits
+		started time.Time
+
+		ranges  []searchindex.Range
+		current *logparser.ReverseScanner
+		stats   logparser.ScanStats
+		limited bool
+		offset  int64
+		err     error
+	}
+)
+
+// searchRanges returns the parts of the file to read for the filter, newest first, up to the end offset, which is the
+// cursor when there is one. These are the content the search index has not covered yet, followed by the blocks that
+// could contain the filter text. It returns nil when there is no index for the file as it is now, or the filter can't
+// be searched for, and the whole file is read instead.
+func (c *handlerConfig) searchRanges(
+	logger *zerolog.Logger,
+	root, filename string,
+	file os.File,
+	info fs.FileInfo,
+	filter string,
+	end int64,
+) ([]searchindex.Range, *indexSummary) {
+	if c.searchIndex == nil || filter == "" {
+		return nil, nil
+	}
+
+	candidates, err := c.searchIndex.Candidates(root, filename, file, info, filter)
+	if err != nil {
+		logger.Warn().Err(err).Msgf("while searching the index of %s, reading all of it", filename)
+		return nil, nil
+	}
+	if candidates == nil {
+		return nil, nil
+	}
+
+	ranges := make([]searchindex.Range, 0, len(candidates.Ranges)+1)
+	if end > candidates.IndexedSize {
+		ranges = append(ranges, searchindex.Range{Start: candidates.IndexedSize, End: end})
+	}
+	for i := len(candidates.Ranges) - 1; i >= 0; i-- {
+		candidate := candidates.Ranges[i]
+		if candidate.Start >= end {
+			continue
+		}
+		if candidate.End > end {
+			candidate.End = end
+		}
+		ranges = append(ranges, candidate)
+	}
+
+	return ranges, &indexSummary{
+		indexedAt:      candidates.IndexedAt,
+		indexedBytes:   candidates.IndexedSize,
+		unindexedBytes: info.Size() - candidates.IndexedSize,
+	}
+}
+
+// setHeaders sets the freshness of the index on the response.
+func (s *indexSummary) setHeaders(header http.Header) {
+	if !s.indexedAt.IsZero() {
+		header.Set(indexedAtHeader, s.indexedAt.UTC().Format(time.RFC3339))
+	}
+	header.Set(unindexedBytesHeader, strconv.FormatInt(s.unindexedBytes, 10))
+}
+
+func (s *indexSummary) json() *indexSummaryJSON {
+	if s == nil {
+		return nil
+	}
+
+	out := &indexSummaryJSON{IndexedBytes: s.indexedBytes, UnindexedBytes: s.unindexedBytes}
+	if !s.indexedAt.IsZero() {
+		indexedAt := s.indexedAt.UTC()
+		out.IndexedAt = &indexedAt
+	}
+
+	return out
+}
+
+func newIndexedScanner(
+	ctx context.Context,
+	file os.File,
+	filter logparser.Filterer,
+	limits Limits,
+	ranges []searchindex.Range,
+	options ...logparser.Option,
+) *indexedScanner {
+	return &indexedScanner{
+		ctx:     ctx,
+		file:    file,
+		filter:  filter,
+		options: options,
+		limits:  limits,
+		started: time.Now(),
+		ranges:  ranges,
+	}
+}
+
+func (s *indexedScanner) Next() bool {
+	for {
+		if s.current != nil {
+			if s.current.Next() {
+				return true
+			}
+
+			s.add(s.current.Stats())
+			if s.err = s.current.Err(); s.err != nil || s.current.LimitReached() {
+				s.limited = s.err == nil
+				s.offset = s.current.Offset()
+				s.current = nil
+				return false
+			}
+			s.current = nil
+		}
+
+		if len(s.ranges) == 0 {
+			return false
+		}
+
+		next := s.ranges[0]
+		if s.overLimit() {
+			s.limited = true
+			s.offset = next.End
+			return false
+		}
+		s.ranges = s.ranges[1:]
+
+		options := append(append(make([]logparser.Option, 0, len(s.options)+3), s.options...),
+			logparser.WithStartOffset(next.Start),
+			logparser.WithEndOffset(next.End),
+		)
+		if s.limits.MaxScanBytes > 0 {
+			options = append(options, logparser.WithMaxBytes(s.limits.MaxScanBytes-s.stats.Bytes))
+		}
+		s.current = logparser.NewReverseScanner(s.ctx, s.file, s.filter, options...)
+	}
+}
+
+func (s *indexedScanner) Entry() string {
+	return s.current.Entry()
+}
+
+func (s *indexedScanner) Err() error {
+	return s.err
+}
+
+// LimitReached reports whether the scan stopped at the byte or time limit, before every range had been read.
+func (s *indexedScanner) LimitReached() bool {
+	return s.limited
+}
+
+// Offset returns the offset a scan stopped at the limit continues from.
+func (s *indexedScanner) Offset() int64 {
+	return s.offset
+}
+
+// Stats returns the totals of every range read so far.
+func (s *indexedScanner) Stats() logparser.ScanStats {
+	stats := s.stats
+	if s.current != nil {
+		current := s.current.Stats()
+		stats.Bytes += current.Bytes
+		stats.Lines += current.Lines
+		stats.Matched += current.Matched
+		stats.ReadTime += current.ReadTime
+		stats.FilterTime += current.FilterTime
+	}
+
+	return stats
+}
+
+func (s *indexedScanner) add(stats logparser.ScanStats) {
+	s.stats.Bytes += stats.Bytes
+	s.stats.Lines += stats.Lines
+	s.stats.Matched += stats.Matched
+	s.stats.ReadTime += stats.ReadTime
+	s.stats.FilterTime += stats.FilterTime
+}
+
+// overLimit reports whether the ranges read so far have used up the byte or time limit of the scan.
+func (s *indexedScanner) overLimit() bool {
+	if s.limits.MaxScanBytes > 0 && s.stats.Bytes >= s.limits.MaxScanBytes {
+		return true
+	}
+
+	return s.limits.MaxScanTime > 0 && time.Since(s.started) >= s.limits.MaxScanTime
+}
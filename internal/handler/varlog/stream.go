@@ -0,0 +1,428 @@
+package varlog
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/skormos/varlog-parser/internal/logparser"
+	"github.com/skormos/varlog-parser/internal/redact"
+)
+
+const (
+	streamBufferSize = 32 * 1024
+
+	// streamFlushInterval is the longest a streamed entry is buffered before being flushed to the client, whether or not
+	// more entries are found in the meantime.
+	streamFlushInterval = 100 * time.Millisecond
+)
+
+type (
+	// entryWriter writes every entry from the scanner to the stream in a single media type. The format is only provided
+	// when the client requested one, and is ignored by media types without fields. The summary is complete once the
+	// scanner is exhausted, and is only written by media types with room for it.
+	entryWriter func(stream *responseStream, scanner entryScanner, format logparser.Format, summary *scanSummary) error
+
+	// scanSummary collects the totals for a whole scan, which are reported once every entry has been written.
+	scanSummary struct {
+		redactions int
+		truncated  bool
+		cursor     string
+		// index is only set when the search index was used to skip part of the file.
+		index *indexSummary
+	}
+
+	// summaryJSON is the scan summary, as the properties that follow the entries in a GetEntriesResponse.
+	summaryJSON struct {
+		Redactions  int               `json:"redactions"`
+		Truncated   bool              `json:"truncated"`
+		Cursor      string            `json:"cursor,omitempty"`
+		SearchIndex *indexSummaryJSON `json:"searchIndex,omitempty"`
+	}
+
+	// entryScanner is the subset of the logparser scanners used when writing entries to a response.
+	entryScanner interface {
+		Next() bool
+		Entry() string
+		Err() error
+	}
+
+	// limitScanner stops the wrapped scanner after a number of entries have been found.
+	limitScanner struct {
+		entryScanner
+		remaining int
+	}
+
+	// redactingScanner applies the redaction rules to every entry from the wrapped scanner, and counts the values it
+	// replaces in the summary.
+	redactingScanner struct {
+		entryScanner
+		redactor *redact.Redactor
+		summary  *scanSummary
+		entry    string
+	}
+
+	// ascendingScanner collects every entry from the wrapped scanner on the first call to Next, then returns them in
+	// the opposite order. The wrapped scanner must be limited, as every entry is held in memory.
+	ascendingScanner struct {
+		entryScanner
+		collected bool
+		entries   []string
+		pos       int
+	}
+
+	// responseStream defers writing the status header until the first bytes of the body are written, so an error found
+	// before then can still be returned with an error status. Writes are buffered to avoid a syscall per entry, and
+	// flushed from a timer while the scan reads lines that don't match.
+	responseStream struct {
+		// mu guards the buffer and the response writer, which the timer flushes while entries are written.
+		mu        sync.Mutex
+		writer    http.ResponseWriter
+		status    int
+		started   bool
+		buf       *bufio.Writer
+		lastFlush time.Time
+		// stop ends the timer, which closes stopped once it has.
+		stop    chan struct{}
+		stopped chan struct{}
+	}
+)
+
+func newResponseStream(writer http.ResponseWriter, contentType string, status int) *responseStream {
+	stream := &responseStream{
+		writer: writer,
+		status: status,
+	}
+	stream.buf = bufio.NewWriterSize(headerWriter{stream: stream}, streamBufferSize)
+	writer.Header().Set("Content-Type", contentType)
+
+	return stream
+}
+
+// Write buffers the provided bytes, sending the status header first if this is the start of the body.
+func (s *responseStream) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.buf.Write(p)
+}
+
+// Started reports whether the status header, and some part of the body, have been sent to the client.
+func (s *responseStream) Started() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.started
+}
+
+// StartFlushing flushes the buffered bytes every flush interval until StopFlushing is called, so an entry that was
+// found is sent on while the scan keeps reading lines that don't match. A failed flush is returned by the next Write.
+func (s *responseStream) StartFlushing() {
+	s.stop = make(chan struct{})
+	s.stopped = make(chan struct{})
+
+	go func() {
+		defer close(s.stopped)
+
+		ticker := time.NewTicker(streamFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				s.mu.Lock()
+				if s.buf.Buffered() > 0 && time.Since(s.lastFlush) >= streamFlushInterval {
+					_ = s.flush()
+				}
+				s.mu.Unlock()
+			}
+		}
+	}()
+}
+
+// StopFlushing stops the timer started by StartFlushing, and waits for a flush in progress, so the headers and
+// trailers can be changed again.
+func (s *responseStream) StopFlushing() {
+	if s.stop == nil {
+		return
+	}
+
+	close(s.stop)
+	<-s.stopped
+	s.stop = nil
+}
+
+// Flush sends everything that has been buffered on to the client.
+func (s *responseStream) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.flush()
+}
+
+func (s *responseStream) flush() error {
+	if err := s.buf.Flush(); err != nil {
+		return err
+	}
+
+	if flusher, ok := s.writer.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	s.lastFlush = time.Now()
+
+	return nil
+}
+
+// FlushIfStale flushes the buffered bytes when nothing has been flushed for longer than the flush interval, or when
+// nothing has been sent to the client yet.
+func (s *responseStream) FlushIfStale() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started && time.Since(s.lastFlush) < streamFlushInterval {
+		return nil
+	}
+
+	return s.flush()
+}
+
+type headerWriter struct {
+	stream *responseStream
+}
+
+func (h headerWriter) Write(p []byte) (int, error) {
+	if !h.stream.started {
+		h.stream.started = true
+		h.stream.writer.WriteHeader(h.stream.status)
+	}
+
+	return h.stream.writer.Write(p)
+}
+
+// writeTrailers sets the summary trailers, which must have been declared before the header was written.
+func (s *scanSummary) writeTrailers(header http.Header) {
+	header.Set(redactionTrailer, strconv.Itoa(s.redactions))
+	header.Set(truncatedTrailer, strconv.FormatBool(s.truncated))
+	if s.cursor != "" {
+		header.Set(cursorTrailer, s.cursor)
+	}
+}
+
+func newLimitScanner(scanner entryScanner, limit int) *limitScanner {
+	return &limitScanner{entryScanner: scanner, remaining: limit}
+}
+
+func (s *limitScanner) Next() bool {
+	if s.remaining <= 0 {
+		return false
+	}
+	s.remaining--
+
+	return s.entryScanner.Next()
+}
+
+func newRedactingScanner(scanner entryScanner, redactor *redact.Redactor, summary *scanSummary) *redactingScanner {
+	return &redactingScanner{entryScanner: scanner, redactor: redactor, summary: summary}
+}
+
+func (s *redactingScanner) Next() bool {
+	if !s.entryScanner.Next() {
+		return false
+	}
+
+	var count int
+	s.entry, count = s.redactor.Redact(s.entryScanner.Entry())
+	s.summary.redactions += count
+
+	return true
+}
+
+func (s *redactingScanner) Entry() string {
+	return s.entry
+}
+
+func newAscendingScanner(scanner entryScanner) *ascendingScanner {
+	return &ascendingScanner{entryScanner: scanner}
+}
+
+func (s *ascendingScanner) Next() bool {
+	if !s.collected {
+		s.collected = true
+		for s.entryScanner.Next() {
+			s.entries = append(s.entries, s.entryScanner.Entry())
+		}
+		s.pos = len(s.entries)
+	}
+
+	if s.pos == 0 {
+		return false
+	}
+	s.pos--
+
+	return true
+}
+
+func (s *ascendingScanner) Entry() string {
+	return s.entries[s.pos]
+}
+
+// writeJSONEntries writes the entries from the scanner as a GetEntriesResponse. Every entry is written as soon as it is
+// found, rather than collecting all entries before marshalling.
+func writeJSONEntries(writer *responseStream, scanner entryScanner, _ logparser.Format, summary *scanSummary) error {
+	written := 0
+	for scanner.Next() {
+		separator := ","
+		if written == 0 {
+			separator = `{"entries":[`
+		}
+
+		if err := writeJSONValue(writer, separator, scanner.Entry()); err != nil {
+			return err
+		}
+		written++
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	tail, err := json.Marshal(summaryJSON{
+		Redactions:  summary.redactions,
+		Truncated:   summary.truncated,
+		Cursor:      summary.cursor,
+		SearchIndex: summary.index.json(),
+	})
+	if err != nil {
+		return fmt.Errorf("while marshalling the scan summary for http response: %w", err)
+	}
+
+	// the summary object is opened by the entries, so only its properties are written.
+	closing := "]," + string(tail[1:])
+	if written == 0 {
+		closing = `{"entries":[` + closing
+	}
+
+	if _, err := io.WriteString(writer, closing); err != nil {
+		return fmt.Errorf("while writing the end of the entries to Response: %w", err)
+	}
+
+	return nil
+}
+
+// writeNDJSONEntries writes the entries from the scanner as newline delimited JSON strings. The first entry is flushed
+// as soon as it is found, and following entries are flushed periodically, so clients can start processing entries
+// while the file is still being read.
+func writeNDJSONEntries(writer *responseStream, scanner entryScanner, _ logparser.Format, _ *scanSummary) error {
+	for scanner.Next() {
+		if err := writeJSONValue(writer, "", scanner.Entry()); err != nil {
+			return err
+		}
+
+		if err := writeLineEnd(writer); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// writeTextEntries writes the entries from the scanner as they appear in the file, one per line.
+func writeTextEntries(writer *responseStream, scanner entryScanner, _ logparser.Format, _ *scanSummary) error {
+	for scanner.Next() {
+		if _, err := io.WriteString(writer, scanner.Entry()); err != nil {
+			return fmt.Errorf("while writing entry to Response: %w", err)
+		}
+
+		if err := writeLineEnd(writer); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// writeCSVEntries writes the entries from the scanner as CSV rows, starting with a header row. When a format is
+// provided, every entry is split into the fields of that format, otherwise every row has a single entry column.
+func writeCSVEntries(writer *responseStream, scanner entryScanner, format logparser.Format, _ *scanSummary) error {
+	csvWriter := csv.NewWriter(writer)
+
+	header := []string{"entry"}
+	if format != nil {
+		header = format.Fields()
+	}
+
+	// the header is only written with the first row, so a failed scan can still be answered with an error status.
+	wroteHeader := false
+	for scanner.Next() {
+		if !wroteHeader {
+			wroteHeader = true
+			if err := csvWriter.Write(header); err != nil {
+				return fmt.Errorf("while writing CSV header to Response: %w", err)
+			}
+		}
+
+		row := []string{scanner.Entry()}
+		if format != nil {
+			row = format.Parse(scanner.Entry())
+		}
+
+		if err := csvWriter.Write(row); err != nil {
+			return fmt.Errorf("while writing CSV row to Response: %w", err)
+		}
+
+		csvWriter.Flush()
+		if err := writer.FlushIfStale(); err != nil {
+			return fmt.Errorf("while flushing entries to Response: %w", err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if !wroteHeader {
+		if err := csvWriter.Write(header); err != nil {
+			return fmt.Errorf("while writing CSV header to Response: %w", err)
+		}
+	}
+
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+// writeLineEnd ends the current entry with a newline, then flushes when the client has been waiting long enough.
+func writeLineEnd(writer *responseStream) error {
+	if _, err := io.WriteString(writer, "\n"); err != nil {
+		return fmt.Errorf("while writing entry delimiter to Response: %w", err)
+	}
+
+	if err := writer.FlushIfStale(); err != nil {
+		return fmt.Errorf("while flushing entries to Response: %w", err)
+	}
+
+	return nil
+}
+
+func writeJSONValue(writer io.Writer, prefix string, value interface{}) error {
+	bytes, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("while marshalling %v for http response: %w", value, err)
+	}
+
+	if _, err := io.WriteString(writer, prefix); err != nil {
+		return fmt.Errorf("while writing %v as bytes to Response: %w", value, err)
+	}
+
+	if _, err := writer.Write(bytes); err != nil {
+		return fmt.Errorf("while writing %v as bytes to Response: %w", value, err)
+	}
+
+	return nil
+}
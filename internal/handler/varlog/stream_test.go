@@ -0,0 +1,272 @@
+package varlog
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skormos/varlog-parser/internal/logparser"
+)
+
+type (
+	// sliceScanner returns the entries in order, then waits for release to be closed, if there is one, before ending.
+	sliceScanner struct {
+		entries []string
+		pos     int
+		release chan struct{}
+	}
+
+	// flushRecorder records what has been flushed to the client, and can be read while the response is written.
+	flushRecorder struct {
+		mu      sync.Mutex
+		header  http.Header
+		status  int
+		body    strings.Builder
+		flushed string
+	}
+)
+
+func (s *sliceScanner) Next() bool {
+	if s.pos < len(s.entries) {
+		s.pos++
+		return true
+	}
+
+	if s.release != nil {
+		<-s.release
+	}
+	return false
+}
+
+func (s *sliceScanner) Entry() string {
+	return s.entries[s.pos-1]
+}
+
+func (s *sliceScanner) Err() error {
+	return nil
+}
+
+func newFlushRecorder() *flushRecorder {
+	return &flushRecorder{header: make(http.Header)}
+}
+
+func (f *flushRecorder) Header() http.Header {
+	return f.header
+}
+
+func (f *flushRecorder) WriteHeader(status int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.status = status
+}
+
+func (f *flushRecorder) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.body.Write(p)
+}
+
+func (f *flushRecorder) Flush() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.flushed = f.body.String()
+}
+
+func (f *flushRecorder) Flushed() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.flushed
+}
+
+func TestWriteNDJSONEntries(t *testing.T) {
+	tests := map[string]struct {
+		entries []string
+	}{
+		"No entries has an empty body": {
+			entries: []string{},
+		},
+		"Single entry": {
+			entries: []string{"Aug  7 21:18:18 host sshd[4321]: accepted"},
+		},
+		"Entries are escaped to a single line each": {
+			entries: []string{`quoted "value"`, "tab\tand\nnewline", `back\slash`, "unicode ✓", ""},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			recorder := newFlushRecorder()
+			stream := newResponseStream(recorder, mediaTypeNDJSON, http.StatusOK)
+			require.NoError(tt, writeNDJSONEntries(stream, &sliceScanner{entries: test.entries}, nil, &scanSummary{}))
+			require.NoError(tt, stream.Flush())
+
+			assert.Equal(tt, mediaTypeNDJSON, recorder.Header().Get("Content-Type"))
+			body := recorder.Flushed()
+			if len(test.entries) == 0 {
+				assert.Empty(tt, body)
+				return
+			}
+
+			// every line is a single JSON string, and every entry ends with a newline.
+			assert.True(tt, strings.HasSuffix(body, "\n"))
+			decoded := make([]string, 0)
+			lines := bufio.NewScanner(strings.NewReader(body))
+			for lines.Scan() {
+				var entry string
+				require.NoError(tt, json.Unmarshal(lines.Bytes(), &entry), lines.Text())
+				decoded = append(decoded, entry)
+			}
+			assert.Equal(tt, test.entries, decoded)
+		})
+	}
+}
+
+func TestWriteTextEntries(t *testing.T) {
+	tests := map[string]struct {
+		entries  []string
+		expected string
+	}{
+		"No entries has an empty body": {
+			entries:  []string{},
+			expected: "",
+		},
+		"Every entry ends with a newline": {
+			entries:  []string{"first", "second"},
+			expected: "first\nsecond\n",
+		},
+		"Entries are written as they are": {
+			entries:  []string{`quoted "value", with a comma`, "tab\tseparated", ""},
+			expected: "quoted \"value\", with a comma\ntab\tseparated\n\n",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			recorder := newFlushRecorder()
+			stream := newResponseStream(recorder, mediaTypeText, http.StatusOK)
+			require.NoError(tt, writeTextEntries(stream, &sliceScanner{entries: test.entries}, nil, &scanSummary{}))
+			require.NoError(tt, stream.Flush())
+
+			assert.Equal(tt, mediaTypeText, recorder.Header().Get("Content-Type"))
+			assert.Equal(tt, test.expected, recorder.Flushed())
+		})
+	}
+}
+
+func TestWriteCSVEntries(t *testing.T) {
+	syslog, ok := logparser.LookupFormat("syslog")
+	require.True(t, ok)
+
+	tests := map[string]struct {
+		entries  []string
+		format   logparser.Format
+		expected string
+	}{
+		"No entries has only the header": {
+			entries:  []string{},
+			expected: "entry\n",
+		},
+		"Plain entries are not quoted": {
+			entries:  []string{"first", "second"},
+			expected: "entry\nfirst\nsecond\n",
+		},
+		"Entry with a comma is quoted": {
+			entries:  []string{"one, two"},
+			expected: "entry\n\"one, two\"\n",
+		},
+		"Quotes in an entry are doubled": {
+			entries:  []string{`say "hi"`},
+			expected: "entry\n\"say \"\"hi\"\"\"\n",
+		},
+		"Entry with a newline is quoted": {
+			entries:  []string{"first\nsecond"},
+			expected: "entry\n\"first\nsecond\"\n",
+		},
+		"Entries are split into the fields of the format": {
+			entries: []string{"Aug  7 21:18:18 host sshd[4321]: accepted, from \"10.0.0.1\"", "not syslog"},
+			format:  syslog,
+			expected: "timestamp,host,process,pid,message\n" +
+				"Aug  7 21:18:18,host,sshd,4321,\"accepted, from \"\"10.0.0.1\"\"\"\n" +
+				",,,,not syslog\n",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			recorder := newFlushRecorder()
+			stream := newResponseStream(recorder, mediaTypeCSV, http.StatusOK)
+			scanner := &sliceScanner{entries: test.entries}
+			require.NoError(tt, writeCSVEntries(stream, scanner, test.format, &scanSummary{}))
+			require.NoError(tt, stream.Flush())
+
+			assert.Equal(tt, mediaTypeCSV, recorder.Header().Get("Content-Type"))
+			assert.Equal(tt, test.expected, recorder.Flushed())
+		})
+	}
+}
+
+func TestAscendingScanner(t *testing.T) {
+	// the scanner reads the most recent entry first, as the file is read from the end.
+	newest := []string{"fifth", "fourth", "third", "second", "first"}
+
+	tests := map[string]struct {
+		limit    int
+		expected []string
+	}{
+		"Every entry, oldest first": {
+			limit:    10,
+			expected: []string{"first", "second", "third", "fourth", "fifth"},
+		},
+		"Last entries, oldest first": {
+			limit:    2,
+			expected: []string{"fourth", "fifth"},
+		},
+		"No entries": {
+			limit:    0,
+			expected: []string{},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			scanner := newAscendingScanner(newLimitScanner(&sliceScanner{entries: newest}, test.limit))
+
+			entries := make([]string, 0)
+			for scanner.Next() {
+				entries = append(entries, scanner.Entry())
+			}
+			require.NoError(tt, scanner.Err())
+			assert.Equal(tt, test.expected, entries)
+		})
+	}
+}
+
+func TestResponseStream_FlushesWhileScanning(t *testing.T) {
+	recorder := newFlushRecorder()
+	stream := newResponseStream(recorder, mediaTypeNDJSON, http.StatusOK)
+	stream.StartFlushing()
+
+	// the second entry is found straight after the first was flushed, then no more entries are found for a while.
+	scanner := &sliceScanner{entries: []string{"first", "second"}, release: make(chan struct{})}
+	written := make(chan error)
+	go func() {
+		written <- writeNDJSONEntries(stream, scanner, nil, &scanSummary{})
+	}()
+
+	require.Eventually(t, func() bool {
+		return recorder.Flushed() == "\"first\"\n\"second\"\n"
+	}, time.Second, 5*time.Millisecond, "the buffered entry was not flushed while the scan continued")
+
+	close(scanner.release)
+	require.NoError(t, <-written)
+	stream.StopFlushing()
+	assert.True(t, stream.Started())
+	assert.Equal(t, http.StatusOK, recorder.status)
+}
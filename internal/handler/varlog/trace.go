@@ -0,0 +1,66 @@
+package varlog
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/skormos/varlog-parser/internal/logparser"
+)
+
+// tracer records a span for every scan. It uses the global provider, so nothing is recorded until one is set.
+var tracer = otel.Tracer("github.com/skormos/varlog-parser/internal/handler/varlog")
+
+// startScanSpan starts the span covering a scan, from the first read until the last entry has been written.
+func startScanSpan(ctx context.Context, root, filename, mediaType string, numLines int) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "LogParserHandler.Scan", trace.WithAttributes(
+		attribute.String("varlog.root", root),
+		attribute.String("varlog.file", filename),
+		attribute.String("varlog.media_type", mediaType),
+		attribute.Int("varlog.num_lines", numLines),
+	))
+}
+
+// setCacheOutcome records whether the entries were cached, for the file as it is now or before it grew.
+func setCacheOutcome(span trace.Span, outcome string) {
+	span.SetAttributes(attribute.String("varlog.cache", outcome))
+}
+
+// setSearchIndexed records that the search index was used to skip part of the file, and how much was not indexed yet.
+func setSearchIndexed(span trace.Span, index *indexSummary) {
+	span.SetAttributes(
+		attribute.Int64("varlog.search_index.indexed_bytes", index.indexedBytes),
+		attribute.Int64("varlog.search_index.unindexed_bytes", index.unindexedBytes),
+	)
+}
+
+// endScanSpan records the work done by the scan, with a span for each of its read and filter phases, then ends the
+// span. A cancelled scan is not marked as failed, as the client chose to stop it.
+func endScanSpan(
+	ctx context.Context,
+	span trace.Span,
+	started time.Time,
+	stats logparser.ScanStats,
+	summary *scanSummary,
+	err error,
+) {
+	logparser.RecordPhases(ctx, started, stats)
+	span.SetAttributes(
+		attribute.Int64("varlog.scan.bytes", stats.Bytes),
+		attribute.Int64("varlog.scan.lines", stats.Lines),
+		attribute.Int64("varlog.scan.matched", stats.Matched),
+		attribute.Int("varlog.scan.redactions", summary.redactions),
+		attribute.Bool("varlog.scan.truncated", summary.truncated),
+	)
+
+	if err != nil && !errors.Is(err, context.Canceled) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,5 @@
+// Package lineindex keeps a sparse index of the lines in log files, so a line, or the first line written at or after a
+// time, can be found in a large file without reading it from the start. The index records where every Nth line
+// starts, and the earliest and latest timestamp of the lines in every block of N lines. It is stored in a sidecar file
+// in a directory of its own, extended as the file grows, and rebuilt once the file has been rotated or truncated.
+package lineindex
@@ -0,0 +1,258 @@
+package lineindex
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+	"time"
+
+	"github.com/skormos/varlog-parser/internal/logparser"
+	vlos "github.com/skormos/varlog-parser/internal/os"
+)
+
+const (
+	// checkInterval is the number of lines indexed between checks of the context.
+	checkInterval = 4096
+	readSize      = 64 * 1024
+
+	// the sidecar is a fixed size header, followed by the blocks in order.
+	sidecarMagic   = "VLIX"
+	sidecarVersion = 1
+	headerSize     = 128
+	blockSize      = 24
+)
+
+type (
+	// block is every line from the one starting at offset until the next block. minTime and maxTime are the range of
+	// the timestamps of those lines as Unix nanoseconds, and are both 0 when none of them had a timestamp.
+	block struct {
+		offset  int64
+		minTime int64
+		maxTime int64
+	}
+
+	// index is the index of a single file, which covers every line before size. A line still being written at the end
+	// of the file is only indexed once it is complete, so size is always the start of a line.
+	index struct {
+		interval int64
+		inode    uint64
+		size     int64
+		lines    int64
+		tail     string
+		blocks   []block
+		// latest is the latest timestamp in any block up to and including each block, which only ever increases, so
+		// it can be searched even when some lines were written out of order.
+		latest []int64
+	}
+)
+
+func newIndex(interval int64, inode uint64) *index {
+	return &index{interval: interval, inode: inode}
+}
+
+// validFor reports whether the index still describes the start of the file, which is only true while the file has
+// not been replaced, truncated or written again since the index was last extended.
+func (ix *index) validFor(file io.ReadSeeker, info fs.FileInfo) (bool, error) {
+	return vlos.HasOnlyGrown(file, info, ix.inode, ix.size, ix.tail)
+}
+
+// extend indexes the complete lines between the end of the index and size. When the context is done part way, the
+// lines indexed so far are kept, and the context error is returned.
+func (ix *index) extend(ctx context.Context, file io.ReadSeeker, size int64, reference time.Time) error {
+	if ix.size == size {
+		return nil
+	}
+
+	if _, err := file.Seek(ix.size, io.SeekStart); err != nil {
+		return fmt.Errorf("while seeking to the end of the index: %w", err)
+	}
+
+	reader := bufio.NewReaderSize(io.LimitReader(file, size-ix.size), readSize)
+	prefix := make([]byte, 0, logparser.TimestampSearchLength)
+	var err error
+	for n := 0; ; n++ {
+		if n%checkInterval == 0 {
+			if err = ctx.Err(); err != nil {
+				break
+			}
+		}
+
+		var (
+			length     int
+			terminated bool
+		)
+		prefix, length, terminated, err = readLine(reader, prefix)
+		if err != nil || !terminated {
+			break
+		}
+		ix.add(prefix, length, reference)
+	}
+
+	// the tail is read after the lines indexed so far, whether or not indexing stopped early.
+	tail, tailErr := vlos.ReadTail(file, ix.size)
+	if tailErr != nil {
+		return tailErr
+	}
+	ix.tail = tail
+
+	return err
+}
+
+// readLine reads the next line, keeping only the start of it, where the timestamp is. It reports the length of the
+// whole line, including the newline, and whether it was ended by one, which only the last line of a file might not be.
+func readLine(reader *bufio.Reader, prefix []byte) ([]byte, int, bool, error) {
+	prefix = prefix[:0]
+	length := 0
+	for {
+		fragment, err := reader.ReadSlice('\n')
+		length += len(fragment)
+		if keep := cap(prefix) - len(prefix); keep > 0 {
+			if len(fragment) > keep {
+				fragment = fragment[:keep]
+			}
+			prefix = append(prefix, fragment...)
+		}
+
+		if err == nil {
+			return prefix, length, true, nil
+		}
+		if errors.Is(err, io.EOF) {
+			return prefix, length, false, nil
+		}
+		if !errors.Is(err, bufio.ErrBufferFull) {
+			return prefix, length, false, fmt.Errorf("while reading a line to index: %w", err)
+		}
+	}
+}
+
+// add indexes the line that starts at the end of the index, starting a new block every interval lines.
+func (ix *index) add(prefix []byte, length int, reference time.Time) {
+	if ix.lines%ix.interval == 0 {
+		latest := int64(0)
+		if n := len(ix.latest); n > 0 {
+			latest = ix.latest[n-1]
+		}
+
+		ix.blocks = append(ix.blocks, block{offset: ix.size})
+		ix.latest = append(ix.latest, latest)
+	}
+
+	if timestamp, ok := logparser.ParseTimestamp(string(prefix), reference); ok {
+		last := len(ix.blocks) - 1
+		current := &ix.blocks[last]
+		nanos := timestamp.UnixNano()
+		if current.minTime == 0 || nanos < current.minTime {
+			current.minTime = nanos
+		}
+		if nanos > current.maxTime {
+			current.maxTime = nanos
+		}
+		if nanos > ix.latest[last] {
+			ix.latest[last] = nanos
+		}
+	}
+
+	ix.lines++
+	ix.size += int64(length)
+}
+
+// lineCheckpoint returns the closest indexed line at or before the line, counting from 0.
+func (ix *index) lineCheckpoint(line int64) logparser.Checkpoint {
+	if line >= ix.lines {
+		return logparser.Checkpoint{Offset: ix.size, Line: ix.lines}
+	}
+
+	n := line / ix.interval
+	return logparser.Checkpoint{Offset: ix.blocks[n].offset, Line: n * ix.interval}
+}
+
+// timeCheckpoint returns the start of the first block with a line written at or after since. When there is none, the
+// end of the index is returned, as a line appended since it was extended may still be.
+func (ix *index) timeCheckpoint(since time.Time) logparser.Checkpoint {
+	nanos := since.UnixNano()
+	n := sort.Search(len(ix.latest), func(i int) bool {
+		return ix.latest[i] >= nanos
+	})
+	if n == len(ix.blocks) {
+		return logparser.Checkpoint{Offset: ix.size, Line: ix.lines}
+	}
+
+	return logparser.Checkpoint{Offset: ix.blocks[n].offset, Line: int64(n) * ix.interval}
+}
+
+// encodeHeader returns the header of the sidecar, which describes the file the index is for and counts the blocks.
+func (ix *index) encodeHeader() []byte {
+	out := make([]byte, headerSize)
+	copy(out, sidecarMagic)
+	binary.LittleEndian.PutUint32(out[4:], sidecarVersion)
+	binary.LittleEndian.PutUint64(out[8:], uint64(ix.interval))
+	binary.LittleEndian.PutUint64(out[16:], ix.inode)
+	binary.LittleEndian.PutUint64(out[24:], uint64(ix.size))
+	binary.LittleEndian.PutUint64(out[32:], uint64(ix.lines))
+	binary.LittleEndian.PutUint64(out[40:], uint64(len(ix.blocks)))
+	binary.LittleEndian.PutUint32(out[48:], uint32(len(ix.tail)))
+	copy(out[52:52+vlos.TailLength], ix.tail)
+
+	return out
+}
+
+// encodeBlocks returns the blocks from the nth onwards, as they are laid out after the header.
+func (ix *index) encodeBlocks(n int) []byte {
+	out := make([]byte, (len(ix.blocks)-n)*blockSize)
+	for i, b := range ix.blocks[n:] {
+		record := out[i*blockSize:]
+		binary.LittleEndian.PutUint64(record, uint64(b.offset))
+		binary.LittleEndian.PutUint64(record[8:], uint64(b.minTime))
+		binary.LittleEndian.PutUint64(record[16:], uint64(b.maxTime))
+	}
+
+	return out
+}
+
+// decodeIndex reverses encodeHeader and encodeBlocks, and returns false for a sidecar that was not written with the
+// same interval, or that is not whole.
+func decodeIndex(data []byte, interval int64) (*index, bool) {
+	if len(data) < headerSize || string(data[:4]) != sidecarMagic ||
+		binary.LittleEndian.Uint32(data[4:]) != sidecarVersion ||
+		int64(binary.LittleEndian.Uint64(data[8:])) != interval {
+		return nil, false
+	}
+
+	ix := &index{
+		interval: interval,
+		inode:    binary.LittleEndian.Uint64(data[16:]),
+		size:     int64(binary.LittleEndian.Uint64(data[24:])),
+		lines:    int64(binary.LittleEndian.Uint64(data[32:])),
+	}
+
+	count := binary.LittleEndian.Uint64(data[40:])
+	tailLen := binary.LittleEndian.Uint32(data[48:])
+	if tailLen > vlos.TailLength || count != uint64((ix.lines+interval-1)/interval) ||
+		uint64(len(data)-headerSize)/blockSize < count {
+		return nil, false
+	}
+	ix.tail = string(data[52 : 52+tailLen])
+
+	ix.blocks = make([]block, count)
+	ix.latest = make([]int64, count)
+	latest := int64(0)
+	for i := range ix.blocks {
+		record := data[headerSize+i*blockSize:]
+		ix.blocks[i] = block{
+			offset:  int64(binary.LittleEndian.Uint64(record)),
+			minTime: int64(binary.LittleEndian.Uint64(record[8:])),
+			maxTime: int64(binary.LittleEndian.Uint64(record[16:])),
+		}
+		if ix.blocks[i].maxTime > latest {
+			latest = ix.blocks[i].maxTime
+		}
+		ix.latest[i] = latest
+	}
+
+	return ix, true
+}
@@ -0,0 +1,243 @@
+package lineindex
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/skormos/varlog-parser/internal/logparser"
+	vlos "github.com/skormos/varlog-parser/internal/os"
+)
+
+// DefaultInterval is the number of lines between the lines indexed when no other interval has been provided.
+const DefaultInterval = 1000
+
+// errNotDirectory is returned when the directory the sidecars are kept in is not a directory.
+var errNotDirectory = errors.New("is not a directory")
+
+type (
+	// Option defines the function signature for helper methods to update the Store when it is created.
+	Option func(store *Store)
+
+	// Store keeps the index of every file it is asked about in a sidecar file in its directory, and in memory once it
+	// has been read. Every lookup first extends the index to the end of the file, or rebuilds it when the file has
+	// been rotated or truncated since. It is safe for concurrent use, but only a single Store should use a directory.
+	Store struct {
+		dir      string
+		interval int64
+
+		mu      sync.Mutex
+		entries map[string]*entry
+	}
+
+	// entry is the index of a single file, which is locked while it is extended and searched.
+	entry struct {
+		mu     sync.Mutex
+		loaded bool
+		index  *index
+	}
+)
+
+// WithInterval sets the number of lines between the lines indexed. A smaller interval reads less of the file to find
+// a line, at the cost of a larger index. Changing the interval rebuilds every index on its next lookup.
+func WithInterval(lines int) Option {
+	return func(store *Store) {
+		store.interval = int64(lines)
+	}
+}
+
+// NewStore returns a Store that keeps the sidecars in the directory, which must already exist.
+func NewStore(dir string, options ...Option) (*Store, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("while opening the line index directory: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("line index directory %s %w", dir, errNotDirectory)
+	}
+
+	store := &Store{
+		dir:      dir,
+		interval: DefaultInterval,
+		entries:  make(map[string]*entry),
+	}
+
+	for _, optionFn := range options {
+		optionFn(store)
+	}
+
+	if store.interval <= 0 {
+		store.interval = DefaultInterval
+	}
+
+	return store, nil
+}
+
+// LineCheckpoint returns the closest indexed line at or before the line, counting from 0, in the named file of the
+// root. The file is the one opened for the name, and info its current state.
+func (s *Store) LineCheckpoint(
+	ctx context.Context,
+	root, name string,
+	file io.ReadSeeker,
+	info fs.FileInfo,
+	line int64,
+) (logparser.Checkpoint, error) {
+	var out logparser.Checkpoint
+	err := s.lookup(ctx, root, name, file, info, func(ix *index) {
+		out = ix.lineCheckpoint(line)
+	})
+
+	return out, err
+}
+
+// TimeCheckpoint returns the start of the first block of lines with a line written at or after since, in the named
+// file of the root. The file is the one opened for the name, and info its current state.
+func (s *Store) TimeCheckpoint(
+	ctx context.Context,
+	root, name string,
+	file io.ReadSeeker,
+	info fs.FileInfo,
+	since time.Time,
+) (logparser.Checkpoint, error) {
+	var out logparser.Checkpoint
+	err := s.lookup(ctx, root, name, file, info, func(ix *index) {
+		out = ix.timeCheckpoint(since)
+	})
+
+	return out, err
+}
+
+// lookup brings the index of the file up to date, then searches it while it is still locked.
+func (s *Store) lookup(
+	ctx context.Context,
+	root, name string,
+	file io.ReadSeeker,
+	info fs.FileInfo,
+	search func(ix *index),
+) error {
+	path := s.sidecarPath(root, name)
+
+	s.mu.Lock()
+	current, ok := s.entries[path]
+	if !ok {
+		current = &entry{}
+		s.entries[path] = current
+	}
+	s.mu.Unlock()
+
+	current.mu.Lock()
+	defer current.mu.Unlock()
+
+	ix, err := s.update(ctx, current, path, file, info)
+	if err != nil {
+		return err
+	}
+	search(ix)
+
+	return nil
+}
+
+// update extends the index of the file to its current size, rebuilding it when the file is no longer the one it was
+// built from, and writes what changed to the sidecar.
+func (s *Store) update(
+	ctx context.Context,
+	current *entry,
+	path string,
+	file io.ReadSeeker,
+	info fs.FileInfo,
+) (*index, error) {
+	if !current.loaded {
+		current.index = s.load(path)
+		current.loaded = true
+	}
+
+	inode := vlos.Inode(info)
+	ix := current.index
+	rebuild := ix == nil
+	if !rebuild {
+		valid, err := ix.validFor(file, info)
+		if err != nil {
+			return nil, err
+		}
+		rebuild = !valid
+	}
+	if rebuild {
+		ix = newIndex(s.interval, inode)
+		current.index = ix
+	}
+
+	size, lines, blocks := ix.size, ix.lines, len(ix.blocks)
+	extendErr := ix.extend(ctx, file, info.Size(), info.ModTime())
+	if rebuild || ix.size != size || ix.lines != lines {
+		// the last block may have gained lines, so it is written again along with any new ones.
+		from := blocks - 1
+		if from < 0 || rebuild {
+			from = 0
+		}
+		if err := s.save(path, ix, from, rebuild); err != nil {
+			return nil, err
+		}
+	}
+	if extendErr != nil {
+		return nil, extendErr
+	}
+
+	return ix, nil
+}
+
+// load reads the index from the sidecar, or returns nil when there is none, or it can't be used.
+func (s *Store) load(path string) *index {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	ix, ok := decodeIndex(data, s.interval)
+	if !ok {
+		return nil
+	}
+
+	return ix
+}
+
+// save writes the blocks from the nth onwards, then the header that counts them, so a sidecar that was only partly
+// written still describes every block up to the count in its header.
+func (s *Store) save(path string, ix *index, n int, rebuild bool) error {
+	flags := os.O_RDWR | os.O_CREATE
+	if rebuild {
+		flags |= os.O_TRUNC
+	}
+
+	file, err := os.OpenFile(path, flags, 0o600)
+	if err != nil {
+		return fmt.Errorf("while opening the line index %s: %w", path, err)
+	}
+
+	_, err = file.WriteAt(ix.encodeBlocks(n), int64(headerSize+n*blockSize))
+	if err == nil {
+		_, err = file.WriteAt(ix.encodeHeader(), 0)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("while writing the line index %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// sidecarPath returns the path of the sidecar for the named file of the root. The names are hashed, so every file
+// has a sidecar directly in the directory, whatever characters its name has.
+func (s *Store) sidecarPath(root, name string) string {
+	sum := sha256.Sum256([]byte(root + "\x00" + name))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:16])+".idx")
+}
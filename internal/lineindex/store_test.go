@@ -0,0 +1,223 @@
+package lineindex
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skormos/varlog-parser/internal/logparser"
+	vlos "github.com/skormos/varlog-parser/internal/os"
+	"github.com/skormos/varlog-parser/internal/os/ostest"
+)
+
+func TestNewStore(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	require.NoError(t, os.WriteFile(file, nil, 0o600))
+
+	tests := map[string]struct {
+		dir         string
+		expectedErr bool
+	}{
+		"Existing directory": {dir: dir},
+		"Missing directory":  {dir: filepath.Join(dir, "missing"), expectedErr: true},
+		"File":               {dir: file, expectedErr: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			store, err := NewStore(test.dir)
+			if test.expectedErr {
+				assert.Error(tt, err)
+				return
+			}
+
+			require.NoError(tt, err)
+			assert.Equal(tt, int64(DefaultInterval), store.interval)
+		})
+	}
+}
+
+func TestStore_LineCheckpoint(t *testing.T) {
+	logs := t.TempDir()
+	path := filepath.Join(logs, "messages")
+	writeLines(t, path, 0, 10)
+
+	store, err := NewStore(t.TempDir(), WithInterval(4))
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		line     int64
+		expected logparser.Checkpoint
+	}{
+		"First line":                {line: 0, expected: logparser.Checkpoint{}},
+		"Line in the first block":   {line: 3, expected: logparser.Checkpoint{}},
+		"First line of a block":     {line: 4, expected: checkpointAt(4)},
+		"Line in the last block":    {line: 9, expected: checkpointAt(8)},
+		"Past the last line":        {line: 12, expected: checkpointAt(10)},
+		"Past the last line, again": {line: 10, expected: checkpointAt(10)},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			file := ostest.Open(tt, path)
+			checkpoint, err := store.LineCheckpoint(context.TODO(), "root", "messages", file, ostest.Stat(tt, file), test.line)
+			require.NoError(tt, err)
+			assert.Equal(tt, test.expected, checkpoint)
+		})
+	}
+}
+
+func TestStore_Maintained(t *testing.T) {
+	logs := t.TempDir()
+	dir := t.TempDir()
+	path := filepath.Join(logs, "messages")
+	writeLines(t, path, 0, 10)
+
+	lookup := func(tt *testing.T, store *Store, line int64) (logparser.Checkpoint, int64) {
+		file := ostest.Open(tt, path)
+		checkpoint, err := store.LineCheckpoint(context.TODO(), "root", "messages", file, ostest.Stat(tt, file), line)
+		require.NoError(tt, err)
+		return checkpoint, file.BytesRead
+	}
+
+	store, err := NewStore(dir, WithInterval(4))
+	require.NoError(t, err)
+	checkpoint, read := lookup(t, store, 9)
+	assert.Equal(t, checkpointAt(8), checkpoint)
+	assert.Greater(t, read, int64(lineOffset(10)), "the whole file is read to build the index")
+
+	// a line still being written is not indexed until it is complete.
+	ostest.Append(t, path, "line 10 still being")
+	checkpoint, _ = lookup(t, store, 10)
+	assert.Equal(t, checkpointAt(10), checkpoint)
+	ostest.Append(t, path, " written\n")
+	writeLines(t, path, 11, 13)
+	checkpoint, read = lookup(t, store, 12)
+	grown := lineOffset(12) + int64(len(" still being written"))
+	assert.Equal(t, logparser.Checkpoint{Offset: grown, Line: 12}, checkpoint)
+	assert.Less(t, read, int64(200), "only the appended lines and the tail are read")
+
+	// a new store reads the index from the sidecar, rather than the file.
+	reopened, err := NewStore(dir, WithInterval(4))
+	require.NoError(t, err)
+	checkpoint, read = lookup(t, reopened, 9)
+	assert.Equal(t, checkpointAt(8), checkpoint)
+	assert.Equal(t, int64(vlos.TailLength), read)
+
+	// a different interval rebuilds the index.
+	rebuilt, err := NewStore(dir, WithInterval(3))
+	require.NoError(t, err)
+	checkpoint, _ = lookup(t, rebuilt, 7)
+	assert.Equal(t, checkpointAt(6), checkpoint)
+
+	// a file truncated and written again is indexed from the start.
+	require.NoError(t, os.Truncate(path, 0))
+	writeLines(t, path, 100, 110)
+	checkpoint, _ = lookup(t, rebuilt, 7)
+	assert.Equal(t, logparser.Checkpoint{Offset: 6 * int64(len("line 100\n")), Line: 6}, checkpoint)
+
+	// as is a file replaced by rotation, even when it starts with the same content.
+	require.NoError(t, os.Rename(path, path+".1"))
+	writeLines(t, path, 100, 112)
+	checkpoint, read = lookup(t, rebuilt, 11)
+	assert.Equal(t, logparser.Checkpoint{Offset: 9 * int64(len("line 100\n")), Line: 9}, checkpoint)
+	assert.Greater(t, read, 12*int64(len("line 100\n")), "the whole file is read to build the index")
+}
+
+func TestStore_TimeCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "messages")
+	start := time.Date(2022, time.August, 7, 21, 0, 0, 0, time.UTC)
+	content := make([]string, 0)
+	for i := 0; i < 10; i++ {
+		written := start.Add(time.Duration(i) * time.Minute)
+		content = append(content, fmt.Sprintf("%s host line %d\n", written.Format(time.RFC3339), i))
+	}
+	// an out of order line in the first block makes it the first with a line at or after every time up to it.
+	content[1] = start.Add(5*time.Minute+30*time.Second).Format(time.RFC3339) + " host late line\n"
+	require.NoError(t, os.WriteFile(path, []byte(strings.Join(content, "")), 0o600))
+
+	offsetOf := func(line int) int64 {
+		return int64(len(strings.Join(content[:line], "")))
+	}
+
+	store, err := NewStore(t.TempDir(), WithInterval(3))
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		since    time.Time
+		expected logparser.Checkpoint
+	}{
+		"Before every line": {
+			since:    start.Add(-time.Hour),
+			expected: logparser.Checkpoint{},
+		},
+		"In a later block": {
+			since:    start.Add(7 * time.Minute),
+			expected: logparser.Checkpoint{Offset: offsetOf(6), Line: 6},
+		},
+		"Out of order line": {
+			since:    start.Add(5*time.Minute + 15*time.Second),
+			expected: logparser.Checkpoint{},
+		},
+		"After every line": {
+			since:    start.Add(time.Hour),
+			expected: logparser.Checkpoint{Offset: offsetOf(10), Line: 10},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			file := ostest.Open(tt, path)
+			checkpoint, err := store.TimeCheckpoint(context.TODO(), "root", "messages", file, ostest.Stat(tt, file), test.since)
+			require.NoError(tt, err)
+			assert.Equal(tt, test.expected, checkpoint)
+		})
+	}
+}
+
+func TestStore_Cancelled(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "messages")
+	writeLines(t, path, 0, 10)
+
+	store, err := NewStore(t.TempDir(), WithInterval(4))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	file := ostest.Open(t, path)
+	_, err = store.LineCheckpoint(ctx, "root", "messages", file, ostest.Stat(t, file), 9)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	checkpoint, err := store.LineCheckpoint(context.TODO(), "root", "messages", file, ostest.Stat(t, file), 9)
+	require.NoError(t, err)
+	assert.Equal(t, checkpointAt(8), checkpoint)
+}
+
+// writeLines appends the lines numbered from first up to, but not including, last.
+func writeLines(t *testing.T, path string, first, last int) {
+	t.Helper()
+
+	ostest.AppendLines(t, path, "line %d", first, last)
+}
+
+// lineOffset returns the offset of a line written by writeLines, for lines numbered below 100.
+func lineOffset(line int) int64 {
+	if line <= 10 {
+		return int64(line * len("line 0\n"))
+	}
+
+	return int64(10*len("line 0\n") + (line-10)*len("line 10\n"))
+}
+
+func checkpointAt(line int) logparser.Checkpoint {
+	return logparser.Checkpoint{Offset: lineOffset(line), Line: int64(line)}
+}
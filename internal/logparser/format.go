@@ -0,0 +1,75 @@
+package logparser
+
+import (
+	"regexp"
+	"sort"
+)
+
+type (
+	// Format splits a single line into named fields, for log files with a well known structure.
+	Format interface {
+		// Fields returns the names of the fields produced by Parse, in the same order.
+		Fields() []string
+		// Parse returns the value of every field for the line. When the line does not match the format, the whole line
+		// is returned as the last field and the other fields are left empty.
+		Parse(line string) []string
+	}
+
+	regexpFormat struct {
+		fields  []string
+		pattern *regexp.Regexp
+	}
+)
+
+var formats = map[string]Format{
+	// syslog accepts both the traditional BSD timestamp and the RFC 3339 timestamp written by rsyslog, and treats the
+	// pid and the colon after the process name as optional.
+	"syslog": regexpFormat{
+		fields: []string{"timestamp", "host", "process", "pid", "message"},
+		pattern: regexp.MustCompile(
+			`^([A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2}|\d{4}-\d{2}-\d{2}T\S+) (\S+) ([^\s\[:]+)(?:\[(\d+)\])?:? (.*)$`,
+		),
+	},
+	// clf is the NCSA common log format used by most web servers for access logs, including the referer and user agent
+	// of the combined format when they are present.
+	"clf": regexpFormat{
+		fields: []string{"host", "ident", "user", "timestamp", "request", "status", "bytes", "referer", "userAgent", "message"},
+		pattern: regexp.MustCompile(
+			`^(\S+) (\S+) (\S+) \[([^\]]+)\] "((?:[^"\\]|\\.)*)" (\d{3}) (\S+)(?: "((?:[^"\\]|\\.)*)" "((?:[^"\\]|\\.)*)")?(.*)$`,
+		),
+	},
+}
+
+// LookupFormat returns the Format registered with the provided name.
+func LookupFormat(name string) (Format, bool) {
+	format, ok := formats[name]
+	return format, ok
+}
+
+// FormatNames returns the names of every registered Format, sorted alphabetically.
+func FormatNames() []string {
+	out := make([]string, 0, len(formats))
+	for name := range formats {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+
+	return out
+}
+
+func (f regexpFormat) Fields() []string {
+	return f.fields
+}
+
+func (f regexpFormat) Parse(line string) []string {
+	out := make([]string, len(f.fields))
+
+	matches := f.pattern.FindStringSubmatch(line)
+	if matches == nil {
+		out[len(out)-1] = line
+		return out
+	}
+
+	copy(out, matches[1:])
+	return out
+}
@@ -0,0 +1,59 @@
+package logparser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormats(t *testing.T) {
+	tests := map[string]struct {
+		format   string
+		line     string
+		expected []string
+	}{
+		"BSD syslog line is split into fields": {
+			format:   "syslog",
+			line:     "Aug  7 21:18:18 the-host-name thisprocess[4321]: Single process wrote this message.",
+			expected: []string{"Aug  7 21:18:18", "the-host-name", "thisprocess", "4321", "Single process wrote this message."},
+		},
+		"RFC 3339 syslog line without a pid is split into fields": {
+			format:   "syslog",
+			line:     "2022-08-07T21:18:18.123456+00:00 the-host-name kernel: [ 0.000000] Linux version",
+			expected: []string{"2022-08-07T21:18:18.123456+00:00", "the-host-name", "kernel", "", "[ 0.000000] Linux version"},
+		},
+		"Line that is not syslog is kept whole as the message": {
+			format:   "syslog",
+			line:     "\tThe next line is here.",
+			expected: []string{"", "", "", "", "\tThe next line is here."},
+		},
+		"Common log format line is split into fields": {
+			format:   "clf",
+			line:     `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326`,
+			expected: []string{"127.0.0.1", "-", "frank", "10/Oct/2000:13:55:36 -0700", "GET /apache_pb.gif HTTP/1.0", "200", "2326", "", "", ""},
+		},
+		"Combined log format line includes the referer and user agent": {
+			format: "clf",
+			line:   `10.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET / HTTP/1.1" 304 - "http://example.com/" "curl/7.79.1"`,
+			expected: []string{
+				"10.0.0.1", "-", "-", "10/Oct/2000:13:55:36 -0700", "GET / HTTP/1.1", "304", "-", "http://example.com/", "curl/7.79.1", "",
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			format, ok := LookupFormat(test.format)
+			require.True(tt, ok)
+
+			actual := format.Parse(test.line)
+			assert.Len(tt, actual, len(format.Fields()))
+			assert.Equal(tt, test.expected, actual)
+		})
+	}
+
+	_, ok := LookupFormat("unknown")
+	assert.False(t, ok)
+	assert.Equal(t, []string{"clf", "syslog"}, FormatNames())
+}
@@ -0,0 +1,225 @@
+package logparser
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+type (
+	// forwardReader reads whole lines from the start offset towards the end of a file. Only the first maxLineLength
+	// bytes of a line are kept, and the rest of it is read past without being held in memory.
+	forwardReader struct {
+		readOptions
+		ctx    context.Context
+		file   io.ReadSeeker
+		source io.Reader
+		reader *bufio.Reader
+
+		// bytesRead is the number of bytes read from the file so far, and readTime the time spent reading them.
+		bytesRead int64
+		readTime  time.Duration
+		// limited is set when reading stopped early because the byte or time limit was reached.
+		limited bool
+		// returned is set once a line has been returned, as the limits only stop reading after the first line.
+		returned bool
+
+		// pos is the offset in the file where the bytes that have not been turned into lines yet start.
+		pos int64
+		// lineStart is the offset where the last line returned starts.
+		lineStart int64
+		// line is the buffer reused for every line returned.
+		line []byte
+		done bool
+	}
+
+	// ForwardScanner provides a convenient interface for reading the lines of a file one at a time, starting at the
+	// start offset, or the first line, and working towards the end of the file. It is the counterpart of the
+	// ReverseScanner, and takes the same options, with the limits checked between lines rather than chunks.
+	ForwardScanner struct {
+		lineFilter
+		reader *forwardReader
+	}
+)
+
+// NewForwardScanner returns a new ForwardScanner to read from the start offset of the provided file. Lines appended
+// after the first call to Next are not read. The scanner does not take ownership of the file, so it is up to the
+// caller to close it once scanning has completed.
+func NewForwardScanner(ctx context.Context, file io.ReadSeeker, filter Filterer, options ...Option) *ForwardScanner {
+	return &ForwardScanner{
+		lineFilter: newLineFilter(ctx, filter),
+		reader:     newForwardReader(ctx, file, options...),
+	}
+}
+
+// Next advances the scanner to the following line that passes the filter, which will then be available through the
+// Entry method. It returns false when the scan stops, either by reaching the end of the file or an error. After Next
+// returns false, the Err method will return any error that occurred during scanning, including the context error if
+// it was cancelled.
+func (s *ForwardScanner) Next() bool {
+	return s.next(s.reader.next)
+}
+
+// Entry returns the most recent line found by a call to Next.
+func (s *ForwardScanner) Entry() string {
+	return s.entry
+}
+
+// LimitReached reports whether the scan stopped before the end of the file, because the byte limit or deadline was
+// reached.
+func (s *ForwardScanner) LimitReached() bool {
+	return s.reader.limited
+}
+
+// Offset returns the offset where the line after the last one read starts, whether or not it passed the filter.
+// Scanning again with WithStartOffset set to the offset continues from that line.
+func (s *ForwardScanner) Offset() int64 {
+	return s.reader.pos
+}
+
+// Stats returns the work done by the scanner so far.
+func (s *ForwardScanner) Stats() ScanStats {
+	return ScanStats{
+		Bytes:      s.reader.bytesRead,
+		Lines:      s.lines,
+		Matched:    s.matched,
+		ReadTime:   s.reader.readTime,
+		FilterTime: s.filterTime,
+	}
+}
+
+// Err returns the first error that was encountered by the ForwardScanner.
+func (s *ForwardScanner) Err() error {
+	return s.err
+}
+
+func newForwardReader(ctx context.Context, file io.ReadSeeker, options ...Option) *forwardReader {
+	return &forwardReader{
+		readOptions: newReadOptions(options...),
+		ctx:         ctx,
+		file:        file,
+	}
+}
+
+// next returns the line after the one previously returned, and false once the end of the file has been reached. The
+// returned line content is only valid until the following call. The returned flag reports whether the line was cut
+// down to the maximum line length.
+func (r *forwardReader) next() ([]byte, bool, bool, error) {
+	if r.reader == nil {
+		if err := r.seekStart(); err != nil {
+			return nil, false, false, err
+		}
+	}
+
+	if r.done {
+		return nil, false, false, nil
+	}
+
+	if err := r.ctx.Err(); err != nil {
+		return nil, false, false, err
+	}
+	if r.returned && r.overLimit(r.bytesRead) {
+		r.limited = true
+		r.done = true
+		return nil, false, false, nil
+	}
+
+	// a line is kept up to the maximum length, with room for the newline that ends it.
+	r.line = r.line[:0]
+	length := 0
+	terminated := false
+	for {
+		fragment, err := r.reader.ReadSlice('\n')
+		length += len(fragment)
+		if keep := r.maxLineLength + 1 - len(r.line); keep > 0 {
+			if len(fragment) > keep {
+				fragment = fragment[:keep]
+			}
+			r.line = append(r.line, fragment...)
+		}
+
+		if err == nil {
+			terminated = true
+			break
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if !errors.Is(err, bufio.ErrBufferFull) {
+			return nil, false, false, fmt.Errorf("while reading %w", err)
+		}
+	}
+
+	if length == 0 {
+		r.done = true
+		return nil, false, false, nil
+	}
+
+	r.lineStart = r.pos
+	r.pos += int64(length)
+	r.returned = true
+
+	contentLength := length
+	if terminated {
+		contentLength--
+	}
+	if contentLength > r.maxLineLength {
+		logTruncated(r.ctx, r.lineStart, r.maxLineLength)
+		return r.line[:r.maxLineLength], true, true, nil
+	}
+
+	return bytes.TrimSuffix(r.line[:contentLength], []byte{'\r'}), false, true, nil
+}
+
+func (r *forwardReader) seekStart() error {
+	_, span := tracer.Start(r.ctx, "ForwardScanner.Seek")
+	size, err := r.file.Seek(0, io.SeekEnd)
+	if err == nil && r.end > size {
+		err = ErrInvalidOffset
+	}
+	span.SetAttributes(attribute.Int64("varlog.file.size", size), attribute.Int64("varlog.scan.start_offset", r.start))
+	endSpan(span, err)
+
+	if err == ErrInvalidOffset {
+		logInvalidOffset(r.ctx, size, r.start, r.end)
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("while getting file size %w", err)
+	}
+	if r.end >= 0 {
+		size = r.end
+	}
+	if r.start > size {
+		logInvalidOffset(r.ctx, size, r.start, r.end)
+		return ErrInvalidOffset
+	}
+
+	if _, err := r.file.Seek(r.start, io.SeekStart); err != nil {
+		return fmt.Errorf("while seeking %w", err)
+	}
+
+	r.pos = r.start
+	r.lineStart = r.start
+	r.source = io.LimitReader(r.file, size-r.start)
+	r.reader = bufio.NewReaderSize(r, r.chunkSize)
+	r.line = make([]byte, 0, r.maxLineLength+1)
+
+	return nil
+}
+
+// Read fills the buffered reader from the file, up to the end offset, and times the reads.
+func (r *forwardReader) Read(p []byte) (int, error) {
+	start := time.Now()
+	n, err := r.source.Read(p)
+	r.readTime += time.Since(start)
+	r.bytesRead += int64(n)
+
+	return n, err
+}
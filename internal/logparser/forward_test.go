@@ -0,0 +1,148 @@
+package logparser
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/quick"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForwardScanner_MatchesForwardRead(t *testing.T) {
+	property := func(test reverseCase) bool {
+		scanner := NewForwardScanner(
+			context.TODO(),
+			strings.NewReader(test.Content),
+			FilterOnSubstring(test.Filter),
+			WithChunkSize(test.ChunkSize),
+			WithMaxLineLength(test.MaxLineLength),
+		)
+
+		actual := make([]string, 0)
+		for scanner.Next() {
+			actual = append(actual, scanner.Entry())
+		}
+		if err := scanner.Err(); err != nil {
+			t.Log(err)
+			return false
+		}
+
+		test.NLines = len(test.Content) + 1
+		expected := naiveLastNLines(test)
+		for i, j := 0, len(expected)-1; i < j; i, j = i+1, j-1 {
+			expected[i], expected[j] = expected[j], expected[i]
+		}
+
+		return reflect.DeepEqual(expected, actual) && scanner.Offset() == int64(len(test.Content))
+	}
+
+	require.NoError(t, quick.Check(property, &quick.Config{MaxCount: 2000}))
+}
+
+func TestForwardScanner_Offsets(t *testing.T) {
+	content := "first\nsecond\nthird\nfourth\nfifth\n"
+	start := int64(strings.Index(content, "third"))
+	end := int64(strings.Index(content, "fifth"))
+
+	tests := map[string]struct {
+		options       []Option
+		expected      []string
+		expectedBytes int64
+	}{
+		"Start offset skips the lines before it": {
+			options:       []Option{WithStartOffset(start)},
+			expected:      []string{"third", "fourth", "fifth"},
+			expectedBytes: int64(len(content)) - start,
+		},
+		"End offset stops at it": {
+			options:       []Option{WithEndOffset(end)},
+			expected:      []string{"first", "second", "third", "fourth"},
+			expectedBytes: end,
+		},
+		"Both offsets read between them": {
+			options:       []Option{WithStartOffset(start), WithEndOffset(end)},
+			expected:      []string{"third", "fourth"},
+			expectedBytes: end - start,
+		},
+		"Equal offsets read nothing": {
+			options:  []Option{WithStartOffset(end), WithEndOffset(end)},
+			expected: []string{},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			scanner := NewForwardScanner(context.TODO(), strings.NewReader(content), FilterNone(), test.options...)
+
+			entries := make([]string, 0)
+			for scanner.Next() {
+				entries = append(entries, scanner.Entry())
+			}
+			require.NoError(tt, scanner.Err())
+
+			assert.Equal(tt, test.expected, entries)
+			assert.Equal(tt, test.expectedBytes, scanner.Stats().Bytes)
+		})
+	}
+
+	scanner := NewForwardScanner(context.TODO(), strings.NewReader(content), FilterNone(),
+		WithEndOffset(int64(len(content))+1))
+	assert.False(t, scanner.Next())
+	assert.ErrorIs(t, scanner.Err(), ErrInvalidOffset)
+}
+
+func TestForwardScanner_Limits(t *testing.T) {
+	content := "first\nsecond\nthird\nfourth\nfifth\n"
+
+	tests := map[string]struct {
+		options  []Option
+		expected []string
+		limited  bool
+	}{
+		"Byte limit stops between lines": {
+			options:  []Option{WithChunkSize(16), WithMaxBytes(20)},
+			expected: []string{"first", "second", "third"},
+			limited:  true,
+		},
+		"Deadline stops after the first line": {
+			options:  []Option{WithDeadline(time.Now().Add(-time.Second))},
+			expected: []string{"first"},
+			limited:  true,
+		},
+		"Limits larger than the file read it all": {
+			options:  []Option{WithMaxBytes(1024), WithDeadline(time.Now().Add(time.Minute))},
+			expected: []string{"first", "second", "third", "fourth", "fifth"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			scanner := NewForwardScanner(context.TODO(), strings.NewReader(content), FilterNone(), test.options...)
+
+			entries := make([]string, 0)
+			for scanner.Next() {
+				entries = append(entries, scanner.Entry())
+			}
+			require.NoError(tt, scanner.Err())
+
+			assert.Equal(tt, test.expected, entries)
+			assert.Equal(tt, test.limited, scanner.LimitReached())
+			if !test.limited {
+				return
+			}
+
+			// continuing from the offset reads the rest of the file.
+			rest := NewForwardScanner(context.TODO(), strings.NewReader(content), FilterNone(),
+				WithStartOffset(scanner.Offset()))
+			for rest.Next() {
+				entries = append(entries, rest.Entry())
+			}
+			require.NoError(tt, rest.Err())
+			assert.Equal(tt, []string{"first", "second", "third", "fourth", "fifth"}, entries)
+		})
+	}
+}
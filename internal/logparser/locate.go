@@ -0,0 +1,140 @@
+package logparser
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrLineOutOfRange is returned when locating a line past the last line of the file.
+var ErrLineOutOfRange = errors.New("line is past the end of the file")
+
+// Checkpoint is a known position in a file, as the offset where a line starts and the number of lines before it. The
+// start of the file is the zero Checkpoint.
+type Checkpoint struct {
+	Offset int64
+	Line   int64
+}
+
+// LocateLine returns the offsets where a line starts and ends, counting the lines from 0. Lines are counted from the
+// checkpoint, which must not be past the line, so the closer the checkpoint, the less of the file is read. The end
+// includes the newline, so it is where the following line starts. A line past the last line of the file is refused
+// with ErrLineOutOfRange.
+func LocateLine(ctx context.Context, file io.ReadSeeker, from Checkpoint, line int64) (int64, int64, error) {
+	ctx, span := tracer.Start(ctx, "LocateLine", trace.WithAttributes(
+		attribute.Int64("varlog.locate.line", line),
+		attribute.Int64("varlog.locate.from_offset", from.Offset),
+	))
+
+	start, end, read, err := locateLine(ctx, file, from, line)
+	span.SetAttributes(attribute.Int64("varlog.locate.bytes", read))
+	endSpan(span, err)
+
+	return start, end, err
+}
+
+func locateLine(ctx context.Context, file io.ReadSeeker, from Checkpoint, line int64) (int64, int64, int64, error) {
+	if from.Line > line {
+		return 0, 0, 0, ErrInvalidOffset
+	}
+
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("while getting file size %w", err)
+	}
+	if from.Offset > size {
+		logInvalidOffset(ctx, size, from.Offset, -1)
+		return 0, 0, 0, ErrInvalidOffset
+	}
+	if _, err := file.Seek(from.Offset, io.SeekStart); err != nil {
+		return 0, 0, 0, fmt.Errorf("while seeking %w", err)
+	}
+
+	reader := io.LimitReader(file, size-from.Offset)
+	buf := make([]byte, defaultChunkSize)
+	pos, current, start := from.Offset, from.Line, int64(-1)
+	if current == line {
+		start = pos
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return 0, 0, pos - from.Offset, err
+		}
+
+		n, err := io.ReadFull(reader, buf)
+		chunk := buf[:n]
+		for {
+			idx := bytes.IndexByte(chunk, '\n')
+			if idx < 0 {
+				break
+			}
+
+			end := pos + int64(idx) + 1
+			if start >= 0 {
+				return start, end, end - from.Offset, nil
+			}
+
+			current++
+			chunk = chunk[idx+1:]
+			pos = end
+			if current == line {
+				start = end
+			}
+		}
+		pos += int64(len(chunk))
+
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return 0, 0, pos - from.Offset, fmt.Errorf("while reading %w", err)
+		}
+	}
+
+	// the last line of a file does not have to end with a newline.
+	if start >= 0 && start < size {
+		return start, size, size - from.Offset, nil
+	}
+
+	return 0, 0, size - from.Offset, ErrLineOutOfRange
+}
+
+// LocateTime returns the offset where the first line with a timestamp at or after since starts, searching from the
+// offset, which must be the start of a line. Lines without a timestamp are passed over, and when no line is that
+// recent, the end of the file is returned. The reference time is passed to ParseTimestamp.
+func LocateTime(ctx context.Context, file io.ReadSeeker, from int64, since, reference time.Time) (int64, error) {
+	ctx, span := tracer.Start(ctx, "LocateTime", trace.WithAttributes(
+		attribute.String("varlog.locate.since", since.Format(time.RFC3339Nano)),
+		attribute.Int64("varlog.locate.from_offset", from),
+	))
+
+	reader := newForwardReader(ctx, file, WithStartOffset(from), WithMaxLineLength(TimestampSearchLength))
+	offset, err := locateTime(reader, since, reference)
+	span.SetAttributes(attribute.Int64("varlog.locate.bytes", reader.bytesRead))
+	endSpan(span, err)
+
+	return offset, err
+}
+
+func locateTime(reader *forwardReader, since, reference time.Time) (int64, error) {
+	for {
+		line, _, ok, err := reader.next()
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			return reader.pos, nil
+		}
+
+		if timestamp, found := ParseTimestamp(string(line), reference); found && !timestamp.Before(since) {
+			return reader.lineStart, nil
+		}
+	}
+}
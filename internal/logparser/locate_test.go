@@ -0,0 +1,130 @@
+package logparser
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocateLine(t *testing.T) {
+	content := "first\nsecond\nthird\nfourth\nfifth"
+	third := int64(strings.Index(content, "third"))
+	fourth := int64(strings.Index(content, "fourth"))
+	fifth := int64(strings.Index(content, "fifth"))
+
+	tests := map[string]struct {
+		from          Checkpoint
+		line          int64
+		expectedStart int64
+		expectedEnd   int64
+		expectedErr   error
+	}{
+		"First line": {
+			line:        0,
+			expectedEnd: int64(len("first\n")),
+		},
+		"Counted from the start of the file": {
+			line:          2,
+			expectedStart: third,
+			expectedEnd:   fourth,
+		},
+		"Counted from a checkpoint": {
+			from:          Checkpoint{Offset: third, Line: 2},
+			line:          3,
+			expectedStart: fourth,
+			expectedEnd:   fifth,
+		},
+		"Checkpoint at the line": {
+			from:          Checkpoint{Offset: fourth, Line: 3},
+			line:          3,
+			expectedStart: fourth,
+			expectedEnd:   fifth,
+		},
+		"Last line without a newline": {
+			line:          4,
+			expectedStart: fifth,
+			expectedEnd:   int64(len(content)),
+		},
+		"Past the last line": {
+			line:        5,
+			expectedErr: ErrLineOutOfRange,
+		},
+		"Checkpoint past the line": {
+			from:        Checkpoint{Offset: fourth, Line: 3},
+			line:        2,
+			expectedErr: ErrInvalidOffset,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			start, end, err := LocateLine(context.TODO(), strings.NewReader(content), test.from, test.line)
+			if test.expectedErr != nil {
+				assert.ErrorIs(tt, err, test.expectedErr)
+				return
+			}
+
+			require.NoError(tt, err)
+			assert.Equal(tt, test.expectedStart, start)
+			assert.Equal(tt, test.expectedEnd, end)
+		})
+	}
+
+	_, _, err := LocateLine(context.TODO(), strings.NewReader("first\nsecond\n"), Checkpoint{}, 2)
+	assert.ErrorIs(t, err, ErrLineOutOfRange, "a newline at the end of the file does not start another line")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err = LocateLine(ctx, strings.NewReader(content), Checkpoint{}, 4)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestLocateTime(t *testing.T) {
+	content := "2022-08-07T21:18:18Z host first\n" +
+		"  continued without a timestamp\n" +
+		"2022-08-07T21:18:20Z host second\n" +
+		"2022-08-07T21:18:22Z host third\n"
+	second := int64(strings.Index(content, "2022-08-07T21:18:20Z"))
+	third := int64(strings.Index(content, "2022-08-07T21:18:22Z"))
+	reference := time.Date(2022, time.August, 8, 0, 0, 0, 0, time.UTC)
+
+	tests := map[string]struct {
+		from     int64
+		since    time.Time
+		expected int64
+	}{
+		"Before every line": {
+			since:    time.Date(2022, time.August, 7, 0, 0, 0, 0, time.UTC),
+			expected: 0,
+		},
+		"Between lines": {
+			since:    time.Date(2022, time.August, 7, 21, 18, 19, 0, time.UTC),
+			expected: second,
+		},
+		"Equal to a line": {
+			since:    time.Date(2022, time.August, 7, 21, 18, 22, 0, time.UTC),
+			expected: third,
+		},
+		"After every line": {
+			since:    time.Date(2022, time.August, 7, 21, 18, 23, 0, time.UTC),
+			expected: int64(len(content)),
+		},
+		"Searched from an offset": {
+			from:     third,
+			since:    time.Date(2022, time.August, 7, 0, 0, 0, 0, time.UTC),
+			expected: third,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			offset, err := LocateTime(context.TODO(), strings.NewReader(content), test.from, test.since, reference)
+			require.NoError(tt, err)
+			assert.Equal(tt, test.expected, offset)
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package logparser
+
+import (
+	"context"
+
+	"github.com/rs/zerolog"
+)
+
+// The events logged here don't stop a scan, or are reported to the caller as an error it can recover from, so they are
+// logged at debug level with the request-scoped logger carried by the context, and nothing is logged without one.
+
+// logTruncated logs a line that was cut down to the maximum line length.
+func logTruncated(ctx context.Context, offset int64, maxLineLength int) {
+	zerolog.Ctx(ctx).Debug().
+		Int64("offset", offset).
+		Int("maxLineLength", maxLineLength).
+		Msg("truncated a line longer than the maximum line length")
+}
+
+// logInvalidOffset logs a start or end offset past the end of the file, which happens when the file has been replaced
+// or truncated since the offset was taken.
+func logInvalidOffset(ctx context.Context, size, start, end int64) {
+	event := zerolog.Ctx(ctx).Debug().Int64("size", size).Int64("startOffset", start)
+	if end >= 0 {
+		event = event.Int64("endOffset", end)
+	}
+	event.Msg("refused an offset past the end of the file")
+}
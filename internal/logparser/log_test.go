@@ -0,0 +1,92 @@
+package logparser
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanners_LogRecoverableEvents(t *testing.T) {
+	content := "first\n" + strings.Repeat("x", 32) + "\nlast\n"
+
+	tests := map[string]struct {
+		scan        func(ctx context.Context, file *strings.Reader) error
+		expectedErr error
+		expected    []map[string]interface{}
+	}{
+		"Reverse scan logs a truncated line": {
+			scan: func(ctx context.Context, file *strings.Reader) error {
+				scanner := NewReverseScanner(ctx, file, FilterOnSubstring(""), WithMaxLineLength(16))
+				drain(scanner.Next)
+				return scanner.Err()
+			},
+			expected: []map[string]interface{}{
+				{"level": "debug", "offset": 6.0, "maxLineLength": 16.0},
+			},
+		},
+		"Forward scan logs a truncated line": {
+			scan: func(ctx context.Context, file *strings.Reader) error {
+				scanner := NewForwardScanner(ctx, file, FilterOnSubstring(""), WithMaxLineLength(16))
+				drain(scanner.Next)
+				return scanner.Err()
+			},
+			expected: []map[string]interface{}{
+				{"level": "debug", "offset": 6.0, "maxLineLength": 16.0},
+			},
+		},
+		"Reverse scan logs an end offset past the end of the file": {
+			scan: func(ctx context.Context, file *strings.Reader) error {
+				scanner := NewReverseScanner(ctx, file, FilterOnSubstring(""), WithEndOffset(100))
+				scanner.Next()
+				return scanner.Err()
+			},
+			expectedErr: ErrInvalidOffset,
+			expected: []map[string]interface{}{
+				{"level": "debug", "size": 44.0, "startOffset": 0.0, "endOffset": 100.0},
+			},
+		},
+		"Forward scan logs a start offset past the end of the file": {
+			scan: func(ctx context.Context, file *strings.Reader) error {
+				scanner := NewForwardScanner(ctx, file, FilterOnSubstring(""), WithStartOffset(100))
+				scanner.Next()
+				return scanner.Err()
+			},
+			expectedErr: ErrInvalidOffset,
+			expected: []map[string]interface{}{
+				{"level": "debug", "size": 44.0, "startOffset": 100.0},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			var out bytes.Buffer
+			logger := zerolog.New(&out)
+			ctx := logger.WithContext(context.Background())
+
+			assert.Equal(tt, test.expectedErr, test.scan(ctx, strings.NewReader(content)))
+
+			lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+			require.Len(tt, lines, len(test.expected))
+			for i, line := range lines {
+				var logged map[string]interface{}
+				require.NoError(tt, json.Unmarshal([]byte(line), &logged))
+				delete(logged, "message")
+				assert.Equal(tt, test.expected[i], logged)
+			}
+		})
+	}
+}
+
+// drain calls next until it returns false.
+func drain(next func() bool) {
+	for next() {
+		continue
+	}
+}
@@ -0,0 +1,352 @@
+package logparser
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// TruncatedMarker is appended to any line that was longer than the maximum line length, after the line has been cut
+	// down to that length.
+	TruncatedMarker = "...[truncated]"
+
+	// DefaultMaxLineLength is the number of bytes kept for a single line when no other maximum has been provided.
+	DefaultMaxLineLength = 64 * 1024
+
+	minChunkSize = 4 * 1024
+	maxChunkSize = 1024 * 1024
+)
+
+// ErrInvalidOffset is returned when the end offset is past the end of the file, which happens when a file has been
+// replaced or truncated since the offset was taken.
+var ErrInvalidOffset = errors.New("offset is past the end of the file")
+
+type (
+	// Option defines the function signature for helper methods to update values on the reader used while parsing.
+	Option func(options *readOptions)
+
+	// readOptions are the values shared by the readers in either direction.
+	readOptions struct {
+		chunkSize     int
+		maxLineLength int
+		// end is the offset the content being read ends at, or -1 for the end of the file.
+		end int64
+		// start is the offset the content being read starts at, as if it were the start of the file.
+		start    int64
+		maxBytes int64
+		deadline time.Time
+	}
+
+	// reverseReader reads whole lines starting at the end of a file, and works its way back to the start. Lines that
+	// span more than a single chunk are carried across reads, so a line is never split regardless of the chunk size.
+	reverseReader struct {
+		readOptions
+		ctx  context.Context
+		file io.ReadSeeker
+
+		// bytesRead is the number of bytes read from the file so far, and readTime the time spent reading them.
+		bytesRead int64
+		readTime  time.Duration
+		// limited is set when reading stopped early because the byte or time limit was reached.
+		limited bool
+		// lineStart is the offset where the last line returned starts, so every line from there on has been read.
+		lineStart int64
+		// returned is set once a line has been returned, as the limits only stop reading after the first line.
+		returned bool
+
+		// pos is the offset in the file where the bytes that have not been read yet end.
+		pos int64
+		// buf is the buffer reused for every chunk read from the file.
+		buf []byte
+		// chunk is the part of the last chunk read that has not been turned into lines yet.
+		chunk []byte
+		// partial holds the end of the line currently being assembled, which began in an earlier chunk than the
+		// current one. It never grows beyond maxLineLength.
+		partial   []byte
+		truncated bool
+		started   bool
+		done      bool
+	}
+)
+
+// WithChunkSize sets the number of bytes read from the file on every read.
+func WithChunkSize(size int) Option {
+	return func(options *readOptions) {
+		options.chunkSize = size
+	}
+}
+
+// WithMaxLineLength sets the number of bytes kept for a single line. Longer lines are cut down to this many bytes from
+// the start of the line, and have the TruncatedMarker appended.
+func WithMaxLineLength(length int) Option {
+	return func(options *readOptions) {
+		options.maxLineLength = length
+	}
+}
+
+// WithEndOffset ends the content read at the offset, rather than the end of the file, so a ReverseScanner starts
+// reading back from it, and a ForwardScanner stops at it. An offset past the end of the file is refused with
+// ErrInvalidOffset.
+func WithEndOffset(offset int64) Option {
+	return func(options *readOptions) {
+		options.end = offset
+	}
+}
+
+// WithStartOffset starts the content read at the offset, as if it were the start of the file, so a ReverseScanner stops
+// at it, and a ForwardScanner starts from it. The offset must be the start of a line. An offset past the end offset is
+// refused with ErrInvalidOffset.
+func WithStartOffset(offset int64) Option {
+	return func(options *readOptions) {
+		options.start = offset
+	}
+}
+
+// WithMaxBytes stops reading once this many bytes have been read from the file. The limit is checked between chunks,
+// and only once the first line has been read, so a scan always makes progress, and can read more than the limit.
+func WithMaxBytes(maxBytes int64) Option {
+	return func(options *readOptions) {
+		options.maxBytes = maxBytes
+	}
+}
+
+// WithDeadline stops reading once the deadline has passed. Like the byte limit, it is checked between chunks.
+func WithDeadline(deadline time.Time) Option {
+	return func(options *readOptions) {
+		options.deadline = deadline
+	}
+}
+
+func newReverseReader(ctx context.Context, file io.ReadSeeker, options ...Option) *reverseReader {
+	return &reverseReader{
+		readOptions: newReadOptions(options...),
+		ctx:         ctx,
+		file:        file,
+		pos:         -1,
+	}
+}
+
+func newReadOptions(options ...Option) readOptions {
+	out := readOptions{
+		chunkSize:     defaultChunkSize,
+		maxLineLength: DefaultMaxLineLength,
+		end:           -1,
+	}
+
+	for _, optionFn := range options {
+		optionFn(&out)
+	}
+
+	if out.chunkSize <= 0 {
+		out.chunkSize = defaultChunkSize
+	}
+	if out.maxLineLength <= 0 {
+		out.maxLineLength = DefaultMaxLineLength
+	}
+
+	return out
+}
+
+// overLimit reports whether the byte or time limit has been reached, once bytesRead bytes have been read.
+func (o readOptions) overLimit(bytesRead int64) bool {
+	if o.maxBytes > 0 && bytesRead >= o.maxBytes {
+		return true
+	}
+
+	return !o.deadline.IsZero() && !time.Now().Before(o.deadline)
+}
+
+// chunkSizeFor estimates the chunk size needed to read the requested lines in a single read, within sensible bounds.
+func chunkSizeFor(nLines int) int {
+	size := nLines * defaultLineSize
+	if size < minChunkSize {
+		return minChunkSize
+	}
+	if size > maxChunkSize {
+		return maxChunkSize
+	}
+	return size
+}
+
+// next returns the line before the one previously returned, and false once the start of the file has been reached. The
+// returned line content is only valid until the following call. The returned flag reports whether the line was cut
+// down to the maximum line length.
+func (r *reverseReader) next() ([]byte, bool, bool, error) {
+	if r.pos < 0 {
+		if err := r.seekEnd(); err != nil {
+			return nil, false, false, err
+		}
+	}
+
+	for !r.done {
+		if idx := bytes.LastIndexByte(r.chunk, '\n'); idx >= 0 {
+			line, truncated := r.assemble(r.chunk[idx+1:])
+			r.chunk = r.chunk[:idx]
+			r.lineStart = r.pos + int64(idx) + 1
+			r.returned = true
+			if truncated {
+				logTruncated(r.ctx, r.lineStart, r.maxLineLength)
+			}
+			return line, truncated, true, nil
+		}
+
+		// without a newline, what remains of the chunk is the start of a line that continues in the partial buffer.
+		r.carry(r.chunk)
+		r.chunk = nil
+
+		if r.pos == r.start {
+			r.done = true
+			if !r.started {
+				return nil, false, false, nil
+			}
+
+			line, truncated := r.assemble(nil)
+			r.lineStart = r.start
+			if truncated {
+				logTruncated(r.ctx, r.lineStart, r.maxLineLength)
+			}
+			return line, truncated, true, nil
+		}
+
+		// the context and limits are checked between chunks, as a single line can span any number of them.
+		if err := r.ctx.Err(); err != nil {
+			return nil, false, false, err
+		}
+		if r.overLimit() {
+			r.limited = true
+			r.done = true
+			return nil, false, false, nil
+		}
+
+		if err := r.readChunk(); err != nil {
+			return nil, false, false, err
+		}
+	}
+
+	return nil, false, false, nil
+}
+
+func (r *reverseReader) seekEnd() error {
+	_, span := tracer.Start(r.ctx, "ReverseScanner.Seek")
+	size, err := r.file.Seek(0, io.SeekEnd)
+	if err == nil && r.end > size {
+		err = ErrInvalidOffset
+	}
+	span.SetAttributes(attribute.Int64("varlog.file.size", size))
+	if r.end >= 0 {
+		span.SetAttributes(attribute.Int64("varlog.scan.end_offset", r.end))
+	}
+	endSpan(span, err)
+
+	if err == ErrInvalidOffset {
+		logInvalidOffset(r.ctx, size, r.start, r.end)
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("while getting file size %w", err)
+	}
+	if r.end >= 0 {
+		size = r.end
+	}
+	if r.start > size {
+		logInvalidOffset(r.ctx, size, r.start, r.end)
+		return ErrInvalidOffset
+	}
+
+	r.pos = size
+	r.lineStart = size
+	r.started = size > r.start
+	r.buf = make([]byte, r.chunkSize)
+	r.partial = make([]byte, 0, r.maxLineLength)
+
+	if !r.started {
+		return nil
+	}
+
+	if err := r.readChunk(); err != nil {
+		return err
+	}
+
+	// a newline at the very end of the file terminates the last line, rather than starting an empty one.
+	if n := len(r.chunk); r.chunk[n-1] == '\n' {
+		r.chunk = r.chunk[:n-1]
+	}
+
+	return nil
+}
+
+func (r *reverseReader) readChunk() error {
+	readSize := int64(r.chunkSize)
+	if r.pos-r.start < readSize {
+		readSize = r.pos - r.start
+	}
+	r.pos -= readSize
+
+	start := time.Now()
+	defer func() {
+		r.readTime += time.Since(start)
+	}()
+
+	if _, err := r.file.Seek(r.pos, io.SeekStart); err != nil {
+		return fmt.Errorf("while seeking %w", err)
+	}
+
+	r.chunk = r.buf[:readSize]
+	if _, err := io.ReadFull(r.file, r.chunk); err != nil {
+		return fmt.Errorf("while reading %w", err)
+	}
+	r.bytesRead += readSize
+
+	return nil
+}
+
+// overLimit reports whether the byte or time limit has been reached, after the first line has been returned.
+func (r *reverseReader) overLimit() bool {
+	return r.returned && r.readOptions.overLimit(r.bytesRead)
+}
+
+// carry prepends the start of a line to the partial buffer, keeping only the first maxLineLength bytes of the line.
+func (r *reverseReader) carry(start []byte) {
+	if len(start) == 0 {
+		return
+	}
+
+	keep := len(r.partial)
+	if len(start)+keep > r.maxLineLength {
+		r.truncated = true
+		keep = r.maxLineLength - len(start)
+		if keep < 0 {
+			keep = 0
+		}
+	}
+
+	if len(start) > r.maxLineLength {
+		start = start[:r.maxLineLength]
+	}
+
+	r.partial = r.partial[:len(start)+keep]
+	copy(r.partial[len(start):], r.partial[:keep])
+	copy(r.partial, start)
+}
+
+// assemble completes the line being built by prepending its start, and resets the partial buffer for the next line.
+func (r *reverseReader) assemble(start []byte) ([]byte, bool) {
+	r.carry(start)
+
+	line := r.partial
+	truncated := r.truncated
+	if !truncated {
+		line = bytes.TrimSuffix(line, []byte{'\r'})
+	}
+
+	r.partial = r.partial[:0]
+	r.truncated = false
+
+	return line, truncated
+}
@@ -0,0 +1,111 @@
+package logparser
+
+import (
+	"context"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/quick"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// reverseCase is a randomly generated input for comparing the reverse reader against a naive forward read.
+type reverseCase struct {
+	Content       string
+	ChunkSize     int
+	MaxLineLength int
+	NLines        int
+	Filter        string
+}
+
+// Generate favours short alphabets and small sizes, so line breaks, carriage returns and chunk boundaries collide often.
+func (reverseCase) Generate(rnd *rand.Rand, size int) reflect.Value {
+	alphabet := []byte("ab\n\r{}\"x")
+	content := make([]byte, rnd.Intn(size*8+1))
+	for i := range content {
+		content[i] = alphabet[rnd.Intn(len(alphabet))]
+	}
+
+	filters := []string{"", "a", "b", "ab", "x\r"}
+
+	return reflect.ValueOf(reverseCase{
+		Content:       string(content),
+		ChunkSize:     rnd.Intn(32) + 1,
+		MaxLineLength: rnd.Intn(48) + 1,
+		NLines:        rnd.Intn(size+1) + 1,
+		Filter:        filters[rnd.Intn(len(filters))],
+	})
+}
+
+// naiveLastNLines reads the whole content forward, with the same line semantics as bufio.ScanLines, then works back
+// from the last line.
+func naiveLastNLines(test reverseCase) []string {
+	out := make([]string, 0)
+	if test.Content == "" {
+		return out
+	}
+
+	lines := strings.Split(strings.TrimSuffix(test.Content, "\n"), "\n")
+	for i := len(lines) - 1; i >= 0 && len(out) < test.NLines; i-- {
+		line := lines[i]
+		truncated := len(line) > test.MaxLineLength
+		if truncated {
+			line = line[:test.MaxLineLength]
+		} else {
+			line = strings.TrimSuffix(line, "\r")
+		}
+
+		if !strings.Contains(line, test.Filter) {
+			continue
+		}
+
+		if truncated {
+			line += TruncatedMarker
+		}
+		out = append(out, line)
+	}
+
+	return out
+}
+
+func TestParseLastNLinesSeek_MatchesForwardRead(t *testing.T) {
+	property := func(test reverseCase) bool {
+		actual, err := ParseLastNLinesSeek(
+			context.TODO(),
+			strings.NewReader(test.Content),
+			test.NLines,
+			FilterOnSubstring(test.Filter),
+			WithChunkSize(test.ChunkSize),
+			WithMaxLineLength(test.MaxLineLength),
+		)
+		if err != nil {
+			t.Log(err)
+			return false
+		}
+
+		return reflect.DeepEqual(naiveLastNLines(test), actual)
+	}
+
+	require.NoError(t, quick.Check(property, &quick.Config{MaxCount: 2000}))
+}
+
+func TestParseLastNLinesSeek_LongLines(t *testing.T) {
+	longLine := `{"msg":"` + strings.Repeat("x", 10*1024) + `"}`
+	content := "first\n" + longLine + "\n" + longLine + "\r\n"
+
+	out, err := ParseLastNLinesSeek(context.TODO(), strings.NewReader(content), 1, FilterNone())
+	require.NoError(t, err)
+	require.Len(t, out, 1)
+	assert.Equal(t, longLine, out[0])
+
+	out, err = ParseLastNLinesSeek(context.TODO(), strings.NewReader(content), 3, FilterNone(), WithChunkSize(100))
+	require.NoError(t, err)
+	assert.Equal(t, []string{longLine, longLine, "first"}, out)
+
+	out, err = ParseLastNLinesSeek(context.TODO(), strings.NewReader(content), 2, FilterNone(), WithMaxLineLength(8))
+	require.NoError(t, err)
+	assert.Equal(t, []string{`{"msg":"` + TruncatedMarker, `{"msg":"` + TruncatedMarker}, out)
+}
@@ -0,0 +1,149 @@
+package logparser
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+const defaultChunkSize = 64 * 1024
+
+// ReverseScanner provides a convenient interface for reading the lines of a file one at a time, starting at the last
+// line and working back to the first. Only the lines that pass the filter are returned. Successive calls to Next step
+// through the lines, until the start of the file is reached, a limit is reached, an error occurs, or the context is
+// done.
+//
+// Only a single chunk, and at most one line, is held in memory at a time, so results can be streamed to the caller
+// without knowing ahead of time how many lines will be requested.
+type ReverseScanner struct {
+	lineFilter
+	reader *reverseReader
+}
+
+// lineFilter applies the filter to the lines read in either direction, and counts the lines it has seen.
+type lineFilter struct {
+	ctx        context.Context
+	filter     Filterer
+	entry      string
+	err        error
+	lines      int64
+	matched    int64
+	filterTime time.Duration
+}
+
+// ScanStats counts the work done by a ReverseScanner or ForwardScanner.
+type ScanStats struct {
+	// Bytes is the number of bytes read from the file.
+	Bytes int64
+	// Lines is the number of lines read, whether or not they passed the filter.
+	Lines int64
+	// Matched is the number of lines that passed the filter.
+	Matched int64
+	// ReadTime is the time spent seeking and reading the file.
+	ReadTime time.Duration
+	// FilterTime is the time spent filtering lines.
+	FilterTime time.Duration
+}
+
+// NewReverseScanner returns a new ReverseScanner to read from the end of the provided file. The scanner does not take
+// ownership of the file, so it is up to the caller to close it once scanning has completed.
+func NewReverseScanner(ctx context.Context, file io.ReadSeeker, filter Filterer, options ...Option) *ReverseScanner {
+	return &ReverseScanner{
+		lineFilter: newLineFilter(ctx, filter),
+		reader:     newReverseReader(ctx, file, append([]Option{WithChunkSize(defaultChunkSize)}, options...)...),
+	}
+}
+
+func newLineFilter(ctx context.Context, filter Filterer) lineFilter {
+	return lineFilter{
+		ctx:    ctx,
+		filter: filter,
+	}
+}
+
+// Next advances the scanner to the previous line that passes the filter, which will then be available through the
+// Entry method. It returns false when the scan stops, either by reaching the start of the file or an error. After Next
+// returns false, the Err method will return any error that occurred during scanning, including the context error if
+// it was cancelled.
+func (s *ReverseScanner) Next() bool {
+	return s.next(s.reader.next)
+}
+
+// next reads lines until one passes the filter, and keeps it as the entry.
+func (s *lineFilter) next(read func() ([]byte, bool, bool, error)) bool {
+	if s.err != nil {
+		return false
+	}
+
+	for {
+		if err := s.ctx.Err(); err != nil {
+			s.err = err
+			return false
+		}
+
+		line, truncated, ok, err := read()
+		if err != nil {
+			s.err = err
+			return false
+		}
+		if !ok {
+			return false
+		}
+
+		s.lines++
+		entry := string(line)
+		if !s.filterEntry(entry) {
+			continue
+		}
+		s.matched++
+
+		if truncated {
+			entry += TruncatedMarker
+		}
+		s.entry = entry
+
+		return true
+	}
+}
+
+// filterEntry applies the filter to the entry, and times it, the same way every read is timed.
+func (s *lineFilter) filterEntry(entry string) bool {
+	start := time.Now()
+	passed := s.filter.Filter(entry)
+	s.filterTime += time.Since(start)
+
+	return passed
+}
+
+// Entry returns the most recent line found by a call to Next.
+func (s *ReverseScanner) Entry() string {
+	return s.entry
+}
+
+// LimitReached reports whether the scan stopped before the start of the file, because the byte limit or deadline was
+// reached.
+func (s *ReverseScanner) LimitReached() bool {
+	return s.reader.limited
+}
+
+// Offset returns the offset where the last line read starts, whether or not it passed the filter. Scanning again with
+// WithEndOffset set to the offset continues from the line before it.
+func (s *ReverseScanner) Offset() int64 {
+	return s.reader.lineStart
+}
+
+// Stats returns the work done by the scanner so far.
+func (s *ReverseScanner) Stats() ScanStats {
+	return ScanStats{
+		Bytes:      s.reader.bytesRead,
+		Lines:      s.lines,
+		Matched:    s.matched,
+		ReadTime:   s.reader.readTime,
+		FilterTime: s.filterTime,
+	}
+}
+
+// Err returns the first error that was encountered by the ReverseScanner.
+func (s *ReverseScanner) Err() error {
+	return s.err
+}
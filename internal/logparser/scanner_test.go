@@ -0,0 +1,221 @@
+package logparser
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestReverseScanner(t *testing.T) {
+	file, err := os.Open("./testdata/benchmark-small.log")
+	defer func() {
+		if file != nil {
+			_ = file.Close()
+		}
+	}()
+	require.NoError(t, err)
+
+	scanner := NewReverseScanner(context.TODO(), file, FilterOnSubstring("thisprocess"))
+
+	prefixes := make([]string, 0)
+	for scanner.Next() {
+		prefixes = append(prefixes, scanner.Entry()[:2])
+	}
+	require.NoError(t, scanner.Err())
+	assert.Equal(t, []string{"07", "06", "05", "02", "01"}, prefixes)
+
+	stats := scanner.Stats()
+	assert.Equal(t, int64(5), stats.Matched)
+	assert.Greater(t, stats.Lines, stats.Matched)
+	info, err := file.Stat()
+	require.NoError(t, err)
+	assert.Equal(t, info.Size(), stats.Bytes)
+
+	// once finished, the scanner does not start over
+	assert.False(t, scanner.Next())
+}
+
+func TestReverseScanner_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	scanner := NewReverseScanner(ctx, strings.NewReader("first\nsecond\nthird"), FilterNone())
+	require.True(t, scanner.Next())
+	assert.Equal(t, "third", scanner.Entry())
+
+	cancel()
+
+	assert.False(t, scanner.Next())
+	assert.ErrorIs(t, scanner.Err(), context.Canceled)
+
+	out, err := ParseLastNLinesSeek(ctx, strings.NewReader("first\nsecond"), 2, FilterNone())
+	assert.Nil(t, out)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestReverseScanner_Limits(t *testing.T) {
+	content := "first\nsecond\nthird\nfourth\nfifth\n"
+
+	tests := map[string]struct {
+		options  []Option
+		expected []string
+		limited  bool
+	}{
+		"Byte limit stops between chunks": {
+			options:  []Option{WithChunkSize(8), WithMaxBytes(8)},
+			expected: []string{"fifth"},
+			limited:  true,
+		},
+		"Deadline stops between chunks": {
+			options:  []Option{WithChunkSize(8), WithDeadline(time.Now().Add(-time.Second))},
+			expected: []string{"fifth"},
+			limited:  true,
+		},
+		"Limits larger than the file read it all": {
+			options:  []Option{WithChunkSize(8), WithMaxBytes(1024), WithDeadline(time.Now().Add(time.Minute))},
+			expected: []string{"fifth", "fourth", "third", "second", "first"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			scanner := NewReverseScanner(context.TODO(), strings.NewReader(content), FilterNone(), test.options...)
+
+			entries := make([]string, 0)
+			for scanner.Next() {
+				entries = append(entries, scanner.Entry())
+			}
+			require.NoError(tt, scanner.Err())
+			assert.Equal(tt, test.expected, entries)
+			assert.Equal(tt, test.limited, scanner.LimitReached())
+		})
+	}
+}
+
+func TestReverseScanner_Continue(t *testing.T) {
+	content := "first\nsecond\nthird\nfourth\nfifth\n"
+	reader := strings.NewReader(content)
+
+	entries := make([]string, 0)
+	offset := int64(len(content))
+	for scans := 0; scans < 10; scans++ {
+		scanner := NewReverseScanner(context.TODO(), reader, FilterOnSubstring("i"),
+			WithChunkSize(6), WithMaxBytes(6), WithEndOffset(offset))
+		for scanner.Next() {
+			entries = append(entries, scanner.Entry())
+		}
+		require.NoError(t, scanner.Err())
+
+		if !scanner.LimitReached() {
+			break
+		}
+		offset = scanner.Offset()
+	}
+
+	assert.Equal(t, []string{"fifth", "third", "first"}, entries)
+
+	scanner := NewReverseScanner(context.TODO(), reader, FilterNone(), WithEndOffset(int64(len(content)+1)))
+	assert.False(t, scanner.Next())
+	assert.ErrorIs(t, scanner.Err(), ErrInvalidOffset)
+}
+
+func TestReverseScanner_StartOffset(t *testing.T) {
+	content := "first\nsecond\nthird\nfourth\nfifth\n"
+	start := int64(strings.Index(content, "third"))
+	end := int64(strings.Index(content, "fifth"))
+
+	tests := map[string]struct {
+		options       []Option
+		expected      []string
+		expectedBytes int64
+	}{
+		"Lines before the start are not read": {
+			options:       []Option{WithStartOffset(start)},
+			expected:      []string{"fifth", "fourth", "third"},
+			expectedBytes: int64(len(content)) - start,
+		},
+		"Small chunks stop at the start": {
+			options:       []Option{WithStartOffset(start), WithChunkSize(4)},
+			expected:      []string{"fifth", "fourth", "third"},
+			expectedBytes: int64(len(content)) - start,
+		},
+		"Start at the end reads nothing": {
+			options:  []Option{WithStartOffset(int64(len(content)))},
+			expected: []string{},
+		},
+		"Start and end bound the lines read": {
+			options:       []Option{WithStartOffset(start), WithEndOffset(end)},
+			expected:      []string{"fourth", "third"},
+			expectedBytes: end - start,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			scanner := NewReverseScanner(context.TODO(), strings.NewReader(content), FilterNone(), test.options...)
+
+			entries := make([]string, 0)
+			for scanner.Next() {
+				entries = append(entries, scanner.Entry())
+			}
+			require.NoError(tt, scanner.Err())
+			assert.Equal(tt, test.expected, entries)
+			assert.Equal(tt, test.expectedBytes, scanner.Stats().Bytes)
+		})
+	}
+
+	scanner := NewReverseScanner(context.TODO(), strings.NewReader(content), FilterNone(),
+		WithStartOffset(int64(len(content))), WithEndOffset(start))
+	assert.False(t, scanner.Next())
+	assert.ErrorIs(t, scanner.Err(), ErrInvalidOffset)
+}
+
+func TestReverseScanner_Traced(t *testing.T) {
+	spans := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "scan")
+	started := time.Now()
+	scanner := NewReverseScanner(ctx, strings.NewReader("first\nsecond\nthird\n"), FilterOnSubstring("i"))
+	for scanner.Next() {
+	}
+	require.NoError(t, scanner.Err())
+	stats := scanner.Stats()
+	RecordPhases(ctx, started, stats)
+	parent.End()
+
+	// the seek is recorded as the scan starts, and each phase once the scan is over, covering all of it.
+	ended := spans.Ended()
+	require.Len(t, ended, 4)
+	names := make([]string, 0, 3)
+	for _, span := range ended[:3] {
+		names = append(names, span.Name())
+		assert.Equal(t, parent.SpanContext().SpanID(), span.Parent().SpanID())
+	}
+	assert.Equal(t, []string{"ReverseScanner.Seek", "Scan.Read", "Scan.Filter"}, names)
+	read, filter := ended[1], ended[2]
+	assert.Equal(t, started, read.StartTime())
+	assert.Equal(t, read.StartTime(), filter.StartTime())
+	assert.Equal(t, read.EndTime(), filter.EndTime())
+	assert.Contains(t, read.Attributes(), attribute.Int64("varlog.scan.bytes", stats.Bytes))
+	assert.Contains(t, filter.Attributes(), attribute.Int64("varlog.scan.matched", 2))
+
+	// reads and filtering are both timed, whether or not the scan is traced.
+	assert.Greater(t, stats.ReadTime, time.Duration(0))
+	assert.Greater(t, stats.FilterTime, time.Duration(0))
+	untraced := NewReverseScanner(context.Background(), strings.NewReader("first\nsecond\n"), FilterNone())
+	for untraced.Next() {
+	}
+	assert.Greater(t, untraced.Stats().FilterTime, time.Duration(0))
+}
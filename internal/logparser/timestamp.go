@@ -0,0 +1,67 @@
+package logparser
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	// TimestampSearchLength is the number of bytes at the start of a line searched for its timestamp.
+	TimestampSearchLength = 256
+
+	bsdTimestampLayout = "Jan _2 15:04:05"
+	clfTimestampLayout = "02/Jan/2006:15:04:05 -0700"
+)
+
+// ParseTimestamp returns the time a line was written, from the RFC 3339 or traditional BSD timestamp that starts a
+// syslog line, or the bracketed timestamp of a common log format line. It returns false when the line has none.
+//
+// BSD timestamps have no year, so they are given the year of the reference time, or the year before when that would
+// put them more than a day after it. The reference is usually the modification time of the file, which no line in it
+// can be newer than.
+func ParseTimestamp(line string, reference time.Time) (time.Time, bool) {
+	if len(line) > TimestampSearchLength {
+		line = line[:TimestampSearchLength]
+	}
+
+	if len(line) >= 20 && line[4] == '-' && line[10] == 'T' {
+		field := line
+		if idx := strings.IndexByte(line, ' '); idx >= 0 {
+			field = line[:idx]
+		}
+		if parsed, err := time.Parse(time.RFC3339, field); err == nil {
+			return parsed, true
+		}
+	}
+
+	if len(line) >= len(bsdTimestampLayout) && line[3] == ' ' {
+		if parsed, err := time.ParseInLocation(bsdTimestampLayout, line[:len(bsdTimestampLayout)],
+			reference.Location()); err == nil {
+			return withYear(parsed, reference), true
+		}
+	}
+
+	if start := strings.IndexByte(line, '['); start >= 0 {
+		if end := strings.IndexByte(line[start:], ']'); end == len(clfTimestampLayout)+1 {
+			if parsed, err := time.Parse(clfTimestampLayout, line[start+1:start+end]); err == nil {
+				return parsed, true
+			}
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// withYear gives a timestamp parsed without a year the year of the reference, or the year before when it would
+// otherwise be more than a day after the reference.
+func withYear(parsed, reference time.Time) time.Time {
+	year := reference.Year()
+	out := time.Date(year, parsed.Month(), parsed.Day(), parsed.Hour(), parsed.Minute(), parsed.Second(), 0,
+		parsed.Location())
+	if out.After(reference.Add(24 * time.Hour)) {
+		out = time.Date(year-1, parsed.Month(), parsed.Day(), parsed.Hour(), parsed.Minute(), parsed.Second(), 0,
+			parsed.Location())
+	}
+
+	return out
+}
@@ -0,0 +1,57 @@
+package logparser
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	reference := time.Date(2023, time.January, 2, 12, 0, 0, 0, time.UTC)
+
+	tests := map[string]struct {
+		line     string
+		expected time.Time
+		found    bool
+	}{
+		"RFC 3339 syslog": {
+			line:     "2022-08-07T21:18:18.123456+02:00 myhost sshd[1234]: session opened",
+			expected: time.Date(2022, time.August, 7, 19, 18, 18, 123456000, time.UTC),
+			found:    true,
+		},
+		"BSD syslog in the reference year": {
+			line:     "Jan  2 11:59:59 myhost kernel: started",
+			expected: time.Date(2023, time.January, 2, 11, 59, 59, 0, time.UTC),
+			found:    true,
+		},
+		"BSD syslog after the reference is from the year before": {
+			line:     "Dec 31 23:59:59 myhost kernel: started",
+			expected: time.Date(2022, time.December, 31, 23, 59, 59, 0, time.UTC),
+			found:    true,
+		},
+		"Common log format": {
+			line:     `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326`,
+			expected: time.Date(2000, time.October, 10, 20, 55, 36, 0, time.UTC),
+			found:    true,
+		},
+		"No timestamp": {
+			line: "  at com.example.Main.main(Main.java:10)",
+		},
+		"Bracketed value that is not a timestamp": {
+			line: "[INFO] started",
+		},
+		"Empty line": {
+			line: "",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			actual, found := ParseTimestamp(test.line, reference)
+
+			assert.Equal(tt, test.found, found)
+			assert.True(tt, test.expected.Equal(actual), "expected %s, got %s", test.expected, actual)
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package logparser
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer records the seek at the start of every scan, and the read and filter phases once it is over. It uses the
+// global provider, so nothing is recorded until one is set.
+var tracer = otel.Tracer("github.com/skormos/varlog-parser/internal/logparser")
+
+// RecordPhases records a span for reading the file and one for filtering its lines, each covering the whole scan from
+// the time it started until now, along with the time spent in that phase. Reads and filtering alternate for every chunk
+// and line, so they are recorded as two spans once the scan is over, rather than as thousands of spans while it runs.
+func RecordPhases(ctx context.Context, started time.Time, stats ScanStats) {
+	ended := trace.WithTimestamp(time.Now())
+
+	_, read := tracer.Start(ctx, "Scan.Read", trace.WithTimestamp(started), trace.WithAttributes(
+		attribute.Int64("varlog.scan.bytes", stats.Bytes),
+		attribute.Int64("varlog.scan.read_time_us", stats.ReadTime.Microseconds()),
+	))
+	read.End(ended)
+
+	_, filter := tracer.Start(ctx, "Scan.Filter", trace.WithTimestamp(started), trace.WithAttributes(
+		attribute.Int64("varlog.scan.lines", stats.Lines),
+		attribute.Int64("varlog.scan.matched", stats.Matched),
+		attribute.Int64("varlog.scan.filter_time_us", stats.FilterTime.Microseconds()),
+	))
+	filter.End(ended)
+}
+
+// endSpan marks the span as failed when there is an error, then ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
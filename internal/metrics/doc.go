@@ -0,0 +1,3 @@
+// Package metrics records how the service behaves as Prometheus metrics, from http requests down to the bytes and lines
+// read by every scan.
+package metrics
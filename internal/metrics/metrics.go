@@ -0,0 +1,200 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/skormos/varlog-parser/internal/logparser"
+)
+
+const (
+	namespace = "varlog"
+
+	// unmatchedRoute is the route label for requests that did not match any route, so arbitrary paths can't create new
+	// series.
+	unmatchedRoute = "unmatched"
+)
+
+type (
+	// Metrics holds every collector, and the registry they are served from.
+	Metrics struct {
+		registry   *prometheus.Registry
+		fileLabels bool
+
+		requests        *prometheus.CounterVec
+		requestDuration *prometheus.HistogramVec
+		scanBytes       *prometheus.CounterVec
+		scanLines       *prometheus.CounterVec
+		scanMatched     *prometheus.CounterVec
+		parseErrors     *prometheus.CounterVec
+		openFiles       prometheus.Gauge
+		cacheLookups    *prometheus.CounterVec
+	}
+
+	// Option defines the function signature for helper methods to update the Metrics when they are created.
+	Option func(m *Metrics)
+)
+
+// New registers every collector, along with the Go runtime and process collectors, in a new registry.
+func New(options ...Option) *Metrics {
+	m := &Metrics{registry: prometheus.NewRegistry()}
+	for _, optionFn := range options {
+		optionFn(m)
+	}
+
+	scanLabels := []string{"root"}
+	if m.fileLabels {
+		scanLabels = append(scanLabels, "file")
+	}
+
+	m.requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Number of http requests, by route, method and status.",
+	}, []string{"route", "method", "status"})
+	m.requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Time taken to respond to http requests, by route, method and status.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"route", "method", "status"})
+	m.scanBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "scan",
+		Name:      "bytes_total",
+		Help:      "Number of bytes read from log files.",
+	}, scanLabels)
+	m.scanLines = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "scan",
+		Name:      "lines_total",
+		Help:      "Number of lines read from log files, whether or not they matched the filter.",
+	}, scanLabels)
+	m.scanMatched = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "scan",
+		Name:      "matched_lines_total",
+		Help:      "Number of lines read from log files that matched the filter. Divide by lines_total for the match ratio.",
+	}, scanLabels)
+	m.parseErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "scan",
+		Name:      "errors_total",
+		Help:      "Number of scans that failed with an error, not counting cancelled requests.",
+	}, scanLabels)
+	m.openFiles = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "open_files",
+		Help:      "Number of log files currently open.",
+	})
+
+	m.cacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "cache",
+		Name:      "lookups_total",
+		Help:      "Number of lookups in the result cache, by whether the file was unchanged, had grown, or was missed.",
+	}, []string{"outcome"})
+
+	m.registry.MustRegister(
+		m.requests,
+		m.requestDuration,
+		m.scanBytes,
+		m.scanLines,
+		m.scanMatched,
+		m.parseErrors,
+		m.openFiles,
+		m.cacheLookups,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	return m
+}
+
+// WithFileLabels adds the file name as a label on the scan metrics. Every file read creates new series, so this should
+// only be enabled when the number of files is small and known.
+func WithFileLabels(enabled bool) Option {
+	return func(m *Metrics) {
+		m.fileLabels = enabled
+	}
+}
+
+// Handler serves every metric in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// Middleware records the count and duration of every request. Requests are labelled with the chi route pattern rather
+// than the path, so file names never become labels.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(recorder, r)
+
+		status := recorder.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		route := unmatchedRoute
+		if routeCtx := chi.RouteContext(r.Context()); routeCtx != nil && routeCtx.RoutePattern() != "" {
+			route = routeCtx.RoutePattern()
+		}
+
+		labels := prometheus.Labels{"route": route, "method": methodLabel(r.Method), "status": strconv.Itoa(status)}
+		m.requests.With(labels).Inc()
+		m.requestDuration.With(labels).Observe(time.Since(start).Seconds())
+	})
+}
+
+// methodLabel returns the method for the standard methods, and "other" for the rest, which clients can make up.
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete,
+		http.MethodOptions, http.MethodConnect, http.MethodTrace:
+		return method
+	default:
+		return "other"
+	}
+}
+
+// FileOpened counts a log file as open, until FileClosed is called.
+func (m *Metrics) FileOpened() {
+	m.openFiles.Inc()
+}
+
+// FileClosed counts a log file opened with FileOpened as closed.
+func (m *Metrics) FileClosed() {
+	m.openFiles.Dec()
+}
+
+// Scanned records the work done by a single scan of a file, and whether it failed.
+func (m *Metrics) Scanned(root, file string, stats logparser.ScanStats, failed bool) {
+	labels := prometheus.Labels{"root": root}
+	if m.fileLabels {
+		labels["file"] = file
+	}
+
+	m.scanBytes.With(labels).Add(float64(stats.Bytes))
+	m.scanLines.With(labels).Add(float64(stats.Lines))
+	m.scanMatched.With(labels).Add(float64(stats.Matched))
+	if failed {
+		m.parseErrors.With(labels).Inc()
+	}
+}
+
+// CacheLookup counts a lookup in the result cache by its outcome.
+func (m *Metrics) CacheLookup(outcome string) {
+	m.cacheLookups.WithLabelValues(outcome).Inc()
+}
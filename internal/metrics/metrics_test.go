@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skormos/varlog-parser/internal/logparser"
+)
+
+func TestMetrics_Middleware(t *testing.T) {
+	m := New()
+
+	router := chi.NewRouter()
+	router.Use(m.Middleware)
+	router.Get("/api/varlog/{filename}", func(w http.ResponseWriter, r *http.Request) {
+		if chi.URLParam(r, "filename") == "missing.log" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	for _, target := range []string{"/api/varlog/syslog", "/api/varlog/auth.log", "/api/varlog/missing.log", "/elsewhere"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("BREW", "/api/varlog/syslog", nil))
+
+	expected := `
+# HELP varlog_http_requests_total Number of http requests, by route, method and status.
+# TYPE varlog_http_requests_total counter
+varlog_http_requests_total{method="GET",route="/api/varlog/{filename}",status="200"} 2
+varlog_http_requests_total{method="GET",route="/api/varlog/{filename}",status="404"} 1
+varlog_http_requests_total{method="GET",route="unmatched",status="404"} 1
+varlog_http_requests_total{method="other",route="unmatched",status="405"} 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(m.requests, strings.NewReader(expected)))
+	assert.Equal(t, 4, testutil.CollectAndCount(m.requestDuration))
+}
+
+func TestMetrics_Scanned(t *testing.T) {
+	tests := map[string]struct {
+		fileLabels bool
+		expected   string
+	}{
+		"Files are not labels by default": {
+			expected: `
+# HELP varlog_scan_lines_total Number of lines read from log files, whether or not they matched the filter.
+# TYPE varlog_scan_lines_total counter
+varlog_scan_lines_total{root="system"} 30
+`,
+		},
+		"Files are labels when enabled": {
+			fileLabels: true,
+			expected: `
+# HELP varlog_scan_lines_total Number of lines read from log files, whether or not they matched the filter.
+# TYPE varlog_scan_lines_total counter
+varlog_scan_lines_total{file="auth.log",root="system"} 20
+varlog_scan_lines_total{file="syslog",root="system"} 10
+`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			m := New(WithFileLabels(test.fileLabels))
+
+			m.FileOpened()
+			m.Scanned("system", "syslog", logparser.ScanStats{Bytes: 1024, Lines: 10, Matched: 2}, false)
+			m.FileClosed()
+			m.FileOpened()
+			m.Scanned("system", "auth.log", logparser.ScanStats{Bytes: 2048, Lines: 20, Matched: 0}, true)
+
+			require.NoError(tt, testutil.CollectAndCompare(m.scanLines, strings.NewReader(test.expected)))
+			assert.Equal(tt, 3072.0, sum(tt, m, "varlog_scan_bytes_total"))
+			assert.Equal(tt, 2.0, sum(tt, m, "varlog_scan_matched_lines_total"))
+			assert.Equal(tt, 1.0, sum(tt, m, "varlog_scan_errors_total"))
+			assert.Equal(tt, 1.0, testutil.ToFloat64(m.openFiles))
+		})
+	}
+}
+
+func TestMetrics_CacheLookup(t *testing.T) {
+	m := New()
+
+	m.CacheLookup("hit")
+	m.CacheLookup("hit")
+	m.CacheLookup("miss")
+
+	expected := `
+# HELP varlog_cache_lookups_total Number of lookups in the result cache, by whether the file was unchanged, had grown, or was missed.
+# TYPE varlog_cache_lookups_total counter
+varlog_cache_lookups_total{outcome="hit"} 2
+varlog_cache_lookups_total{outcome="miss"} 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(m.cacheLookups, strings.NewReader(expected)))
+}
+
+// sum adds up every series of the named metric in the registry.
+func sum(t *testing.T, m *Metrics, name string) float64 {
+	families, err := m.registry.Gather()
+	require.NoError(t, err)
+
+	total := 0.0
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			total += metric.GetCounter().GetValue()
+		}
+	}
+
+	return total
+}
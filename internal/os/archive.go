@@ -0,0 +1,437 @@
+package os
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const defaultMemberMemory = 32 << 20
+
+type (
+	archiveKind int
+
+	// ArchiveOption defines the function signature for helper methods to update values on the ArchiveHandler.
+	ArchiveOption func(handler *ArchiveHandler)
+
+	// ArchiveHandler exposes the regular file members of a tar, gzipped tar or zip archive as if they were files in a
+	// directory. The members are indexed once when the handler is created, and the archive is kept open until Close is
+	// called.
+	ArchiveHandler struct {
+		archivePath  string
+		kind         archiveKind
+		archive      *os.File
+		archiveSize  int64
+		members      map[string]archiveMember
+		memoryLimit  int64
+		spillDirPath string
+	}
+
+	archiveMember struct {
+		info fs.FileInfo
+		// offset is the position of the uncompressed member content within the archive, or -1 when the content has to
+		// be decompressed before it can be read.
+		offset  int64
+		zipFile *zip.File
+	}
+
+	// memberInfo overrides the base name reported by the archive headers with the full member path, as that is the
+	// name the member is opened with.
+	memberInfo struct {
+		fs.FileInfo
+		name string
+	}
+
+	sectionFile struct {
+		*io.SectionReader
+		info fs.FileInfo
+	}
+
+	memoryFile struct {
+		*bytes.Reader
+		info fs.FileInfo
+	}
+
+	spilledFile struct {
+		*os.File
+		info fs.FileInfo
+	}
+)
+
+const (
+	kindTar archiveKind = iota
+	kindTarGzip
+	kindZip
+)
+
+// WithMemberMemoryLimit sets the largest decompressed member size that will be buffered in memory when opened. Larger
+// compressed members are decompressed to a temporary file instead, which is removed once the member is closed.
+func WithMemberMemoryLimit(limit int64) ArchiveOption {
+	return func(handler *ArchiveHandler) {
+		handler.memoryLimit = limit
+	}
+}
+
+// WithSpillDir sets the directory used for temporary files when a member exceeds the memory limit. The default is the
+// OS temporary directory.
+func WithSpillDir(dirPath string) ArchiveOption {
+	return func(handler *ArchiveHandler) {
+		handler.spillDirPath = dirPath
+	}
+}
+
+// IsArchive reports whether the provided path has an extension of a supported archive format.
+func IsArchive(filePath string) bool {
+	_, ok := archiveKindOf(filePath)
+	return ok
+}
+
+// NewArchiveHandler opens the archive at the provided path and indexes its regular file members.
+func NewArchiveHandler(archivePath string, options ...ArchiveOption) (*ArchiveHandler, error) {
+	kind, ok := archiveKindOf(archivePath)
+	if !ok {
+		return nil, fmt.Errorf("provided path [%s] is not a supported archive", archivePath)
+	}
+
+	archive, err := os.Open(archivePath) //nolint:gosec // the archive path is provided by the operator.
+	if err != nil {
+		if os.IsPermission(err) {
+			return nil, ErrNoReadPerm
+		}
+		return nil, fmt.Errorf("could not use archive [%s] %w", archivePath, err)
+	}
+
+	info, err := archive.Stat()
+	if err != nil {
+		_ = archive.Close()
+		return nil, fmt.Errorf("could not get archive info for [%s] %w", archivePath, err)
+	}
+
+	handler := &ArchiveHandler{
+		archivePath: archivePath,
+		kind:        kind,
+		archive:     archive,
+		archiveSize: info.Size(),
+		members:     make(map[string]archiveMember),
+		memoryLimit: defaultMemberMemory,
+	}
+
+	for _, optionFn := range options {
+		optionFn(handler)
+	}
+
+	if err := handler.index(); err != nil {
+		_ = archive.Close()
+		return nil, fmt.Errorf("while indexing archive [%s] %w", archivePath, err)
+	}
+
+	return handler, nil
+}
+
+// Check validates the archive is still a regular file at its path. The members are served from the archive opened when
+// the handler was created, so they stay readable even when the path has since been removed.
+func (h *ArchiveHandler) Check() error {
+	info, err := os.Stat(h.archivePath)
+	if err != nil {
+		return fmt.Errorf("could not use archive [%s] %w", h.archivePath, err)
+	}
+
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("provided path [%s] is not a regular file", h.archivePath)
+	}
+
+	return nil
+}
+
+// Open returns the member with the provided name. Names are the slash separated paths of the members within the
+// archive. Compressed members are decompressed in full when opened, so they can be read in any direction.
+func (h *ArchiveHandler) Open(ctx context.Context, filename string) (_ File, err error) {
+	_, span := tracer.Start(ctx, "ArchiveHandler.Open", trace.WithAttributes(attribute.String(fileAttribute, filename)))
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	member, ok := h.members[filename]
+	if !ok {
+		return nil, ErrNotExists
+	}
+
+	if member.offset >= 0 {
+		return &sectionFile{
+			SectionReader: io.NewSectionReader(h.archive, member.offset, member.info.Size()),
+			info:          member.info,
+		}, nil
+	}
+
+	content, err := h.openCompressed(filename, member)
+	if err != nil {
+		return nil, fmt.Errorf("could not open member %s in archive %s: %w", filename, h.archivePath, err)
+	}
+	defer func() {
+		_ = content.Close()
+	}()
+
+	file, err := h.decompress(content, member.info)
+	if err != nil {
+		return nil, fmt.Errorf("could not decompress member %s in archive %s: %w", filename, h.archivePath, err)
+	}
+
+	return file, nil
+}
+
+// List returns the info for every regular file member in the archive, sorted by name.
+func (h *ArchiveHandler) List() ([]fs.FileInfo, error) {
+	out := make([]fs.FileInfo, 0, len(h.members))
+	for _, member := range h.members {
+		out = append(out, member.info)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Name() < out[j].Name()
+	})
+
+	return out, nil
+}
+
+// Close releases the underlying archive file. Members opened before Close must not be used afterwards.
+func (h *ArchiveHandler) Close() error {
+	return h.archive.Close()
+}
+
+func (h *ArchiveHandler) index() error {
+	switch h.kind {
+	case kindZip:
+		return h.indexZip()
+	case kindTarGzip:
+		return h.indexTar(false)
+	default:
+		return h.indexTar(true)
+	}
+}
+
+func (h *ArchiveHandler) indexZip() error {
+	reader, err := zip.NewReader(h.archive, h.archiveSize)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range reader.File {
+		if !file.Mode().IsRegular() {
+			continue
+		}
+
+		name, ok := memberName(file.Name)
+		if !ok {
+			continue
+		}
+
+		member := archiveMember{
+			info:    memberInfo{FileInfo: file.FileInfo(), name: name},
+			offset:  -1,
+			zipFile: file,
+		}
+
+		if file.Method == zip.Store {
+			offset, err := file.DataOffset()
+			if err != nil {
+				return fmt.Errorf("could not locate member %s: %w", file.Name, err)
+			}
+			member.offset = offset
+		}
+
+		h.members[name] = member
+	}
+
+	return nil
+}
+
+// indexTar walks every header in the archive. When the archive is not compressed, the position of the archive file
+// after reading a header is where the member content starts, which allows the members to be read in place.
+func (h *ArchiveHandler) indexTar(seekable bool) error {
+	stream, closeFn, err := h.tarStream()
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	reader := tar.NewReader(stream)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name, ok := memberName(header.Name)
+		if !ok {
+			continue
+		}
+
+		member := archiveMember{
+			info:   memberInfo{FileInfo: header.FileInfo(), name: name},
+			offset: -1,
+		}
+
+		if seekable {
+			if member.offset, err = h.archive.Seek(0, io.SeekCurrent); err != nil {
+				return fmt.Errorf("could not locate member %s: %w", header.Name, err)
+			}
+		}
+
+		h.members[name] = member
+	}
+}
+
+// tarStream returns a fresh reader over the uncompressed tar stream from the start of the archive.
+func (h *ArchiveHandler) tarStream() (io.Reader, func(), error) {
+	if h.kind == kindTar {
+		if _, err := h.archive.Seek(0, io.SeekStart); err != nil {
+			return nil, nil, err
+		}
+		return h.archive, func() {}, nil
+	}
+
+	gzipReader, err := gzip.NewReader(io.NewSectionReader(h.archive, 0, h.archiveSize))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return gzipReader, func() {
+		_ = gzipReader.Close()
+	}, nil
+}
+
+func (h *ArchiveHandler) openCompressed(filename string, member archiveMember) (io.ReadCloser, error) {
+	if member.zipFile != nil {
+		return member.zipFile.Open()
+	}
+
+	stream, closeFn, err := h.tarStream()
+	if err != nil {
+		return nil, err
+	}
+
+	reader := tar.NewReader(stream)
+	for {
+		header, err := reader.Next()
+		if err != nil {
+			closeFn()
+			if err == io.EOF {
+				return nil, ErrNotExists
+			}
+			return nil, err
+		}
+
+		if name, ok := memberName(header.Name); ok && name == filename && header.Typeflag == tar.TypeReg {
+			return readCloser{Reader: reader, closeFn: closeFn}, nil
+		}
+	}
+}
+
+// decompress reads the full member content either into memory, or to a temporary file when the member is larger than
+// the memory limit.
+func (h *ArchiveHandler) decompress(content io.Reader, info fs.FileInfo) (File, error) {
+	if info.Size() <= h.memoryLimit {
+		buf := bytes.NewBuffer(make([]byte, 0, info.Size()))
+		if _, err := io.Copy(buf, content); err != nil {
+			return nil, err
+		}
+
+		return &memoryFile{Reader: bytes.NewReader(buf.Bytes()), info: info}, nil
+	}
+
+	spill, err := os.CreateTemp(h.spillDirPath, "varlog-member-*")
+	if err != nil {
+		return nil, err
+	}
+
+	// the name is no longer needed once created, and removing it early guarantees nothing is left behind.
+	if err := os.Remove(spill.Name()); err != nil {
+		_ = spill.Close()
+		return nil, err
+	}
+
+	if _, err := io.Copy(spill, content); err != nil {
+		_ = spill.Close()
+		return nil, err
+	}
+
+	return &spilledFile{File: spill, info: info}, nil
+}
+
+func archiveKindOf(filePath string) (archiveKind, bool) {
+	lower := strings.ToLower(filePath)
+
+	switch {
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return kindTarGzip, true
+	case strings.HasSuffix(lower, ".tar"):
+		return kindTar, true
+	case strings.HasSuffix(lower, ".zip"):
+		return kindZip, true
+	default:
+		return 0, false
+	}
+}
+
+// memberName normalizes the path of an archive member, refusing any that would escape the archive root.
+func memberName(name string) (string, bool) {
+	cleaned := path.Clean(strings.TrimPrefix(name, "./"))
+	if cleaned == "." || strings.HasPrefix(cleaned, "/") || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", false
+	}
+
+	return cleaned, true
+}
+
+type readCloser struct {
+	io.Reader
+	closeFn func()
+}
+
+func (r readCloser) Close() error {
+	r.closeFn()
+	return nil
+}
+
+func (i memberInfo) Name() string {
+	return i.name
+}
+
+func (f *sectionFile) Close() error {
+	return nil
+}
+
+func (f *sectionFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *memoryFile) Close() error {
+	return nil
+}
+
+func (f *memoryFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *spilledFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
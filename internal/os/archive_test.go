@@ -0,0 +1,194 @@
+package os
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testArchiveMembers = map[string]string{
+	"auth.log":        "first auth line\nsecond auth line\n",
+	"var/log/syslog":  "Aug  7 21:18:18 the-host-name thisprocess[4321] Single process wrote this message.\n",
+	"../escaped.log":  "should never be listed\n",
+	"var/log/empty.l": "",
+}
+
+func writeTestTar(t *testing.T, writer io.Writer) {
+	t.Helper()
+
+	tarWriter := tar.NewWriter(writer)
+	require.NoError(t, tarWriter.WriteHeader(&tar.Header{Name: "var/log/", Typeflag: tar.TypeDir, Mode: 0755}))
+	for name, content := range testArchiveMembers {
+		require.NoError(t, tarWriter.WriteHeader(&tar.Header{
+			Name:     name,
+			Typeflag: tar.TypeReg,
+			Mode:     0644,
+			Size:     int64(len(content)),
+			ModTime:  time.Now(),
+		}))
+		_, err := tarWriter.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tarWriter.Close())
+}
+
+func writeTestZip(t *testing.T, writer io.Writer, method uint16) {
+	t.Helper()
+
+	zipWriter := zip.NewWriter(writer)
+	for name, content := range testArchiveMembers {
+		member, err := zipWriter.CreateHeader(&zip.FileHeader{Name: name, Method: method})
+		require.NoError(t, err)
+		_, err = member.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zipWriter.Close())
+}
+
+func createTestArchive(t *testing.T, name string, writeFn func(writer io.Writer)) string {
+	t.Helper()
+
+	archivePath := filepath.Join(t.TempDir(), name)
+	file, err := os.Create(archivePath)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, file.Close())
+	}()
+
+	writeFn(file)
+
+	return archivePath
+}
+
+func TestArchiveHandler(t *testing.T) {
+	archives := map[string]func(t *testing.T) string{
+		"tar": func(t *testing.T) string {
+			return createTestArchive(t, "bundle.tar", func(writer io.Writer) {
+				writeTestTar(t, writer)
+			})
+		},
+		"tar.gz": func(t *testing.T) string {
+			return createTestArchive(t, "bundle.tar.gz", func(writer io.Writer) {
+				gzipWriter := gzip.NewWriter(writer)
+				writeTestTar(t, gzipWriter)
+				require.NoError(t, gzipWriter.Close())
+			})
+		},
+		"zip stored": func(t *testing.T) string {
+			return createTestArchive(t, "bundle.zip", func(writer io.Writer) {
+				writeTestZip(t, writer, zip.Store)
+			})
+		},
+		"zip deflated": func(t *testing.T) string {
+			return createTestArchive(t, "bundle.zip", func(writer io.Writer) {
+				writeTestZip(t, writer, zip.Deflate)
+			})
+		},
+	}
+
+	memoryLimits := map[string]int64{
+		"in memory":    defaultMemberMemory,
+		"spilled file": 1,
+	}
+
+	for archiveName, createFn := range archives {
+		for limitName, limit := range memoryLimits {
+			t.Run(archiveName+" "+limitName, func(tt *testing.T) {
+				source, err := NewSource(createFn(tt))
+				require.NoError(tt, err)
+
+				handler, ok := source.(*ArchiveHandler)
+				require.True(tt, ok)
+				defer func() {
+					assert.NoError(tt, handler.Close())
+				}()
+				WithMemberMemoryLimit(limit)(handler)
+
+				infos, err := handler.List()
+				require.NoError(tt, err)
+
+				names := make([]string, 0, len(infos))
+				for _, info := range infos {
+					names = append(names, info.Name())
+				}
+				assert.Equal(tt, []string{"auth.log", "var/log/empty.l", "var/log/syslog"}, names)
+
+				for _, name := range names {
+					file, err := handler.Open(context.Background(), name)
+					require.NoError(tt, err)
+
+					// read from the end first, to confirm compressed members can be read in reverse.
+					_, err = file.Seek(-1, io.SeekEnd)
+					if testArchiveMembers[name] != "" {
+						require.NoError(tt, err)
+						last := make([]byte, 1)
+						_, err = file.Read(last)
+						require.NoError(tt, err)
+						assert.Equal(tt, "\n", string(last))
+					}
+
+					_, err = file.Seek(0, io.SeekStart)
+					require.NoError(tt, err)
+					content, err := io.ReadAll(file)
+					require.NoError(tt, err)
+					assert.Equal(tt, testArchiveMembers[name], string(content))
+
+					info, err := file.Stat()
+					require.NoError(tt, err)
+					assert.Equal(tt, name, info.Name())
+					assert.Equal(tt, int64(len(content)), info.Size())
+
+					assert.NoError(tt, file.Close())
+				}
+
+				_, err = handler.Open(context.Background(), "../escaped.log")
+				assert.Equal(tt, ErrNotExists, err)
+
+				_, err = handler.Open(context.Background(), "syslog")
+				assert.Equal(tt, ErrNotExists, err)
+			})
+		}
+	}
+}
+
+func TestNewSource(t *testing.T) {
+	tests := map[string]struct {
+		path        string
+		expectError bool
+	}{
+		"Directory returns a SafeFileHandler": {
+			path: "./testdata",
+		},
+		"Non-existent archive should return an error": {
+			path:        "./testdata/bundle.tar.gz",
+			expectError: true,
+		},
+		"Corrupt archive should return an error": {
+			path:        "./testdata/corrupt.zip",
+			expectError: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			actual, actualErr := NewSource(test.path)
+
+			if test.expectError {
+				require.Nil(tt, actual)
+				require.Error(tt, actualErr)
+			} else {
+				require.NotNil(tt, actual)
+				require.NoError(tt, actualErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+
+package os
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// Inode returns the inode number of the file, or 0 when the info was not read from a file on disk, as for archive
+// members. A file replaced by rotation has a new inode, even when its size and modification time match the old one.
+func Inode(info fs.FileInfo) uint64 {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Ino) //nolint:unconvert // the type of Ino differs between platforms.
+	}
+
+	return 0
+}
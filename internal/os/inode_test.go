@@ -0,0 +1,34 @@
+//go:build !windows
+
+package os
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInode(t *testing.T) {
+	dirPath := t.TempDir()
+	logPath := filepath.Join(dirPath, "app.log")
+	rotatedPath := filepath.Join(dirPath, "app.log.new")
+	require.NoError(t, os.WriteFile(logPath, []byte("first line\n"), 0600))
+	require.NoError(t, os.WriteFile(rotatedPath, []byte("first line\n"), 0600))
+
+	before, err := os.Stat(logPath)
+	require.NoError(t, err)
+	assert.NotZero(t, Inode(before))
+
+	// a file replaced by one with the same content has a new inode.
+	require.NoError(t, os.Rename(rotatedPath, logPath))
+	after, err := os.Stat(logPath)
+	require.NoError(t, err)
+	assert.NotEqual(t, Inode(before), Inode(after))
+
+	member := (&tar.Header{Name: "app.log", Mode: 0600, Typeflag: tar.TypeReg}).FileInfo()
+	assert.Zero(t, Inode(member))
+}
@@ -0,0 +1,8 @@
+package os
+
+import "io/fs"
+
+// Inode returns 0, as file info on windows does not carry a file index.
+func Inode(fs.FileInfo) uint64 {
+	return 0
+}
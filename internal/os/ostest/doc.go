@@ -0,0 +1,2 @@
+// Package ostest provides the files on disk that tests of the indexes read, and counts how much of them was read.
+package ostest
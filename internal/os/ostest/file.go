@@ -0,0 +1,69 @@
+package ostest
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// CountingFile counts the bytes read from the file, to tell how much of it was read.
+type CountingFile struct {
+	*os.File
+	BytesRead int64
+}
+
+func (f *CountingFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	f.BytesRead += int64(n)
+	return n, err
+}
+
+// Open opens the file for reading, which is closed once the test completes.
+func Open(t *testing.T, path string) *CountingFile {
+	t.Helper()
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = file.Close()
+	})
+
+	return &CountingFile{File: file}
+}
+
+// Stat returns the current state of the file.
+func Stat(t *testing.T, file *CountingFile) fs.FileInfo {
+	t.Helper()
+
+	info, err := file.Stat()
+	require.NoError(t, err)
+
+	return info
+}
+
+// Append appends the content to the file, which is created when it does not exist.
+func Append(t *testing.T, path, content string) {
+	t.Helper()
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	require.NoError(t, err)
+	_, err = io.WriteString(file, content)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+}
+
+// AppendLines appends a line for every number from first up to, but not including, last, formatted by the format.
+func AppendLines(t *testing.T, path, format string, first, last int) {
+	t.Helper()
+
+	var content strings.Builder
+	for i := first; i < last; i++ {
+		fmt.Fprintf(&content, format+"\n", i)
+	}
+	Append(t, path, content.String())
+}
@@ -0,0 +1,134 @@
+package os
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+)
+
+// ErrUnknownRoot is returned when a file is requested from a root name that has not been configured.
+var ErrUnknownRoot = errors.New("root does not exist")
+
+type (
+	// Root pairs a name with the path of a directory or archive that log files are served from.
+	Root struct {
+		Name string
+		Path string
+	}
+
+	// FileEntry is a single listable file, along with the name of the root it can be opened from.
+	FileEntry struct {
+		Root string
+		Info fs.FileInfo
+	}
+
+	// Roots serves files from several named Sources. When a file is not requested from a specific root, the roots are
+	// searched in the order they were provided, and the first root containing the file is used.
+	Roots struct {
+		names   []string
+		sources map[string]Source
+	}
+)
+
+// NewRoots creates a Source for every provided root. Options are applied to every root that is an archive.
+func NewRoots(roots []Root, options ...ArchiveOption) (*Roots, error) {
+	out := &Roots{
+		names:   make([]string, 0, len(roots)),
+		sources: make(map[string]Source, len(roots)),
+	}
+
+	for _, root := range roots {
+		if _, exists := out.sources[root.Name]; exists {
+			_ = out.Close()
+			return nil, fmt.Errorf("root name [%s] is used more than once", root.Name)
+		}
+
+		source, err := NewSource(root.Path, options...)
+		if err != nil {
+			_ = out.Close()
+			return nil, fmt.Errorf("could not use root [%s]: %w", root.Name, err)
+		}
+
+		out.names = append(out.names, root.Name)
+		out.sources[root.Name] = source
+	}
+
+	return out, nil
+}
+
+// Names returns the name of every root, in search order.
+func (r *Roots) Names() []string {
+	return append([]string(nil), r.names...)
+}
+
+// Open returns the file with the provided name from the named root. When the root name is empty, the file is opened
+// from the first root that contains it.
+func (r *Roots) Open(ctx context.Context, root, filename string) (File, error) {
+	if root != "" {
+		source, ok := r.sources[root]
+		if !ok {
+			return nil, ErrUnknownRoot
+		}
+		return source.Open(ctx, filename)
+	}
+
+	for _, name := range r.names {
+		file, err := r.sources[name].Open(ctx, filename)
+		if err == ErrNotExists {
+			continue
+		}
+		return file, err
+	}
+
+	return nil, ErrNotExists
+}
+
+// List returns every file from every root, in search order, and sorted by name within each root.
+func (r *Roots) List() ([]FileEntry, error) {
+	out := make([]FileEntry, 0)
+	for _, name := range r.names {
+		infos, err := r.sources[name].List()
+		if err != nil {
+			return nil, fmt.Errorf("could not list root [%s]: %w", name, err)
+		}
+
+		for _, info := range infos {
+			out = append(out, FileEntry{Root: name, Info: info})
+		}
+	}
+
+	return out, nil
+}
+
+// Check validates every root can still be served from, in the same way as when it was created. The first root that
+// can't is returned in the error.
+func (r *Roots) Check() error {
+	for _, name := range r.names {
+		checker, ok := r.sources[name].(interface{ Check() error })
+		if !ok {
+			continue
+		}
+
+		if err := checker.Check(); err != nil {
+			return fmt.Errorf("root [%s] is unavailable: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// Close releases every root that holds resources open, such as archives.
+func (r *Roots) Close() error {
+	var firstErr error
+	for _, source := range r.sources {
+		if closer, ok := source.(io.Closer); ok {
+			if err := closer.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	return firstErr
+}
@@ -0,0 +1,116 @@
+package os
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoots(t *testing.T) {
+	appsDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(appsDir, "single.log"), []byte("apps\n"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(appsDir, "apps.log"), []byte("apps\n"), 0600))
+
+	roots, err := NewRoots([]Root{{Name: "system", Path: "./testdata"}, {Name: "apps", Path: appsDir}})
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, roots.Close())
+	}()
+
+	assert.Equal(t, []string{"system", "apps"}, roots.Names())
+
+	tests := map[string]struct {
+		root          string
+		filename      string
+		expectedSize  int64
+		expectedError error
+	}{
+		"File in both roots is opened from the first root": {
+			filename:     "single.log",
+			expectedSize: 123,
+		},
+		"File in both roots is opened from the requested root": {
+			root:         "apps",
+			filename:     "single.log",
+			expectedSize: 5,
+		},
+		"File only in a later root is found": {
+			filename:     "apps.log",
+			expectedSize: 5,
+		},
+		"File not in the requested root returns ErrNotExists": {
+			root:          "system",
+			filename:      "apps.log",
+			expectedError: ErrNotExists,
+		},
+		"File in no root returns ErrNotExists": {
+			filename:      "doesnotexist.log",
+			expectedError: ErrNotExists,
+		},
+		"Unknown root returns ErrUnknownRoot": {
+			root:          "section31",
+			filename:      "single.log",
+			expectedError: ErrUnknownRoot,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			actual, actualErr := roots.Open(context.Background(), test.root, test.filename)
+
+			if test.expectedError != nil {
+				require.Nil(tt, actual)
+				require.Equal(tt, test.expectedError, actualErr)
+				return
+			}
+
+			require.NoError(tt, actualErr)
+			defer func() {
+				assert.NoError(tt, actual.Close())
+			}()
+
+			info, err := actual.Stat()
+			require.NoError(tt, err)
+			assert.Equal(tt, test.expectedSize, info.Size())
+		})
+	}
+
+	entries, err := roots.List()
+	require.NoError(t, err)
+
+	listed := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		listed = append(listed, entry.Root+":"+entry.Info.Name())
+	}
+	assert.Contains(t, listed, "system:single.log")
+	assert.Equal(t, []string{"apps:apps.log", "apps:single.log"}, listed[len(listed)-2:])
+
+	_, err = NewRoots([]Root{{Name: "system", Path: "./testdata"}, {Name: "system", Path: appsDir}})
+	assert.Error(t, err)
+}
+
+func TestRoots_Check(t *testing.T) {
+	appsDir := t.TempDir()
+	archivePath := createTestArchive(t, "logs.tar", func(writer io.Writer) {
+		writeTestTar(t, writer)
+	})
+
+	roots, err := NewRoots([]Root{{Name: "apps", Path: appsDir}, {Name: "archived", Path: archivePath}})
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, roots.Close())
+	}()
+
+	require.NoError(t, roots.Check())
+
+	require.NoError(t, os.Remove(archivePath))
+	assert.ErrorContains(t, roots.Check(), "root [archived] is unavailable")
+
+	require.NoError(t, os.Remove(appsDir))
+	assert.ErrorContains(t, roots.Check(), "root [apps] is unavailable")
+}
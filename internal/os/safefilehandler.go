@@ -1,11 +1,16 @@
 package os
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
@@ -26,18 +31,8 @@ type SafeFileHandler struct {
 func NewFileHandler(dirPath string) (*SafeFileHandler, error) {
 	dirPath = filepath.Clean(dirPath)
 
-	dirInfo, err := os.Lstat(dirPath)
-	if err != nil {
-		return nil, fmt.Errorf("could not use directory [%s] %w", dirPath, err)
-	}
-
-	if !dirInfo.IsDir() {
-		return nil, fmt.Errorf("provided path [%s] is not a directory", dirPath)
-	}
-
-	_, err = os.ReadDir(dirPath)
-	if err != nil {
-		return nil, ErrNoReadPerm
+	if err := checkDirectory(dirPath); err != nil {
+		return nil, err
 	}
 
 	return &SafeFileHandler{
@@ -45,9 +40,19 @@ func NewFileHandler(dirPath string) (*SafeFileHandler, error) {
 	}, nil
 }
 
+// Check validates the directory still exists, and is readable, in the same way as when the handler was created.
+func (h *SafeFileHandler) Check() error {
+	return checkDirectory(h.dirPath)
+}
+
 // Open is a simple wrapper around os.Open, but also joins the filename to the directory, cleans the path, checks the
 // file exists.
-func (h *SafeFileHandler) Open(filename string) (*os.File, error) {
+func (h *SafeFileHandler) Open(ctx context.Context, filename string) (_ File, err error) {
+	_, span := tracer.Start(ctx, "SafeFileHandler.Open", trace.WithAttributes(attribute.String(fileAttribute, filename)))
+	defer func() {
+		endSpan(span, err)
+	}()
+
 	if strings.ContainsRune(filename, filepath.Separator) {
 		return nil, ErrNotExists
 	}
@@ -74,3 +79,50 @@ func (h *SafeFileHandler) Open(filename string) (*os.File, error) {
 
 	return file, nil
 }
+
+// List returns the info for every regular, owner readable file in the immediate directory, sorted by name.
+// Subdirectories and anything else that could not be opened by Open are left out.
+func (h *SafeFileHandler) List() ([]fs.FileInfo, error) {
+	entries, err := os.ReadDir(h.dirPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not list directory %s: %w", h.dirPath, err)
+	}
+
+	out := make([]fs.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			// the file was removed between reading the directory and now, so it is no longer listable.
+			continue
+		}
+
+		if info.Mode().Perm()&0400 == 0 {
+			continue
+		}
+
+		out = append(out, info)
+	}
+
+	return out, nil
+}
+
+func checkDirectory(dirPath string) error {
+	dirInfo, err := os.Lstat(dirPath)
+	if err != nil {
+		return fmt.Errorf("could not use directory [%s] %w", dirPath, err)
+	}
+
+	if !dirInfo.IsDir() {
+		return fmt.Errorf("provided path [%s] is not a directory", dirPath)
+	}
+
+	if _, err := os.ReadDir(dirPath); err != nil {
+		return ErrNoReadPerm
+	}
+
+	return nil
+}
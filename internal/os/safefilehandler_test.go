@@ -1,6 +1,7 @@
 package os
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"testing"
@@ -102,7 +103,7 @@ func TestSafeFileHandler_Open(t *testing.T) {
 
 	for name, test := range genericTests {
 		t.Run(name, func(tt *testing.T) {
-			actual, actualErr := handler.Open(test.filename)
+			actual, actualErr := handler.Open(context.Background(), test.filename)
 			defer func() {
 				if actual != nil {
 					assert.NoError(tt, actualErr, actual.Close(), "closing test file")
@@ -139,7 +140,7 @@ func TestSafeFileHandler_Open(t *testing.T) {
 
 	for name, test := range specificErrorTests {
 		t.Run(name, func(tt *testing.T) {
-			actual, actualErr := handler.Open(test.filename)
+			actual, actualErr := handler.Open(context.Background(), test.filename)
 			require.Nil(tt, actual)
 			require.Equal(tt, test.expectedError, actualErr)
 		})
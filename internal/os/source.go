@@ -0,0 +1,55 @@
+package os
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+type (
+	// File is the read-only view of a single log file, regardless of where its content is sourced from. *os.File
+	// satisfies this interface.
+	File interface {
+		io.ReadSeekCloser
+		Stat() (fs.FileInfo, error)
+	}
+
+	// Source defines the operations common to every kind of log root, whether it is a directory on disk or an archive.
+	Source interface {
+		Open(ctx context.Context, filename string) (File, error)
+		List() ([]fs.FileInfo, error)
+	}
+)
+
+// NewSource inspects the provided path and returns the matching Source implementation. Paths with a recognized archive
+// extension are indexed as an ArchiveHandler, with the provided options, while everything else is expected to be a
+// directory served by a SafeFileHandler.
+func NewSource(path string, options ...ArchiveOption) (Source, error) {
+	path = filepath.Clean(path)
+
+	if !IsArchive(path) {
+		handler, err := NewFileHandler(path)
+		if err != nil {
+			return nil, err
+		}
+		return handler, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not use archive [%s] %w", path, err)
+	}
+
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("provided path [%s] is not a regular file", path)
+	}
+
+	handler, err := NewArchiveHandler(path, options...)
+	if err != nil {
+		return nil, err
+	}
+	return handler, nil
+}
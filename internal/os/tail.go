@@ -0,0 +1,45 @@
+package os
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+)
+
+// TailLength is the number of bytes before the end of the content read from a file that are kept to tell a file that
+// has only grown from one that was truncated and written again.
+const TailLength = 64
+
+// ReadTail returns up to TailLength bytes before the offset.
+func ReadTail(file io.ReadSeeker, offset int64) (string, error) {
+	length := int64(TailLength)
+	if offset < length {
+		length = offset
+	}
+
+	if _, err := file.Seek(offset-length, io.SeekStart); err != nil {
+		return "", fmt.Errorf("while seeking to the tail at offset %d: %w", offset, err)
+	}
+
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(file, buf); err != nil {
+		return "", fmt.Errorf("while reading the tail at offset %d: %w", offset, err)
+	}
+
+	return string(buf), nil
+}
+
+// HasOnlyGrown reports whether the file, of which info is the current state, still starts with the content read when
+// it had the inode, size and tail, which is only true while it has not been replaced, truncated or written again.
+func HasOnlyGrown(file io.ReadSeeker, info fs.FileInfo, inode uint64, size int64, tail string) (bool, error) {
+	if Inode(info) != inode || size > info.Size() {
+		return false, nil
+	}
+
+	current, err := ReadTail(file, size)
+	if err != nil {
+		return false, err
+	}
+
+	return current == tail, nil
+}
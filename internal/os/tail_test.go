@@ -0,0 +1,115 @@
+//go:build !windows
+
+package os
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadTail(t *testing.T) {
+	long := strings.Repeat("a", TailLength) + "tail"
+	tests := map[string]struct {
+		offset   int64
+		expected string
+	}{
+		"Empty content has no tail": {
+			offset:   0,
+			expected: "",
+		},
+		"Content shorter than the tail is read whole": {
+			offset:   3,
+			expected: "aaa",
+		},
+		"Only the bytes before the offset are read": {
+			offset:   int64(len(long)),
+			expected: long[len(long)-TailLength:],
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			tail, err := ReadTail(strings.NewReader(long), test.offset)
+			require.NoError(tt, err)
+			assert.Equal(tt, test.expected, tail)
+		})
+	}
+
+	_, err := ReadTail(strings.NewReader("short"), 10)
+	assert.Error(t, err)
+}
+
+func TestHasOnlyGrown(t *testing.T) {
+	tests := map[string]struct {
+		rewrite  func(path string) error
+		expected bool
+	}{
+		"Unchanged file": {
+			rewrite:  func(string) error { return nil },
+			expected: true,
+		},
+		"Appended file": {
+			rewrite: func(path string) error {
+				file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+				if err != nil {
+					return err
+				}
+				defer file.Close()
+				_, err = file.WriteString("third line\n")
+				return err
+			},
+			expected: true,
+		},
+		"Truncated file": {
+			rewrite:  func(path string) error { return os.Truncate(path, 4) },
+			expected: false,
+		},
+		"File written again to a greater size": {
+			rewrite: func(path string) error {
+				return os.WriteFile(path, []byte("other line\nsecond line\nthird line\n"), 0600)
+			},
+			expected: false,
+		},
+		"Replaced file": {
+			rewrite: func(path string) error {
+				replacement := path + ".new"
+				if err := os.WriteFile(replacement, []byte("first line\nsecond line\n"), 0600); err != nil {
+					return err
+				}
+				return os.Rename(replacement, path)
+			},
+			expected: false,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			path := filepath.Join(tt.TempDir(), "app.log")
+			require.NoError(tt, os.WriteFile(path, []byte("first line\nsecond line\n"), 0600))
+			before, err := os.Stat(path)
+			require.NoError(tt, err)
+			file, err := os.Open(path)
+			require.NoError(tt, err)
+			tail, err := ReadTail(file, before.Size())
+			require.NoError(tt, err)
+			require.NoError(tt, file.Close())
+
+			require.NoError(tt, test.rewrite(path))
+
+			file, err = os.Open(path)
+			require.NoError(tt, err)
+			defer file.Close()
+			after, err := file.Stat()
+			require.NoError(tt, err)
+
+			grown, err := HasOnlyGrown(file, after, Inode(before), before.Size(), tail)
+			require.NoError(tt, err)
+			assert.Equal(tt, test.expected, grown)
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package os
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// fileAttribute is the span attribute holding the name of the file being opened.
+const fileAttribute = "varlog.file"
+
+// tracer records a span for every file opened. It uses the global provider, so nothing is recorded until one is set.
+var tracer = otel.Tracer("github.com/skormos/varlog-parser/internal/os")
+
+// endSpan marks the span as failed when there is an error, then ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,3 @@
+// Package policy decides which files an authenticated principal may read, based on named allow and deny policies
+// matched against the principal, the log root and the file name.
+package policy
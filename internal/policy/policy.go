@@ -0,0 +1,157 @@
+package policy
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/skormos/varlog-parser/internal/auth"
+)
+
+const (
+	// EffectAllow grants access to the files a policy matches.
+	EffectAllow = "allow"
+	// EffectDeny refuses access to the files a policy matches, regardless of any policy that allows it.
+	EffectDeny = "deny"
+
+	// DefaultPolicy is the name reported when a request is denied because no policy allows it.
+	DefaultPolicy = "default"
+
+	// Wildcard matches every principal when used in Principals or Groups.
+	Wildcard = "*"
+)
+
+type (
+	// Policy allows or denies a set of principals access to a set of files. A principal is matched by its subject or
+	// any of its groups. Roots and Files are glob patterns as used by path.Match, so a '*' does not match the '/' in an
+	// archive member name. Empty Roots or Files match every root or file.
+	Policy struct {
+		Name       string
+		Effect     string
+		Principals []string
+		Groups     []string
+		Roots      []string
+		Files      []string
+	}
+
+	// Decision is the outcome of authorizing a request, along with the name of the policy that decided it.
+	Decision struct {
+		Allowed bool
+		Policy  string
+	}
+
+	// Set is a validated set of policies. Deny policies take precedence over allow policies, and when no policy
+	// matches the request is denied. An empty Set allows everything, so authorization is opt in.
+	Set struct {
+		policies []Policy
+	}
+)
+
+// NewSet validates every policy, and returns the first problem found.
+func NewSet(policies []Policy) (*Set, error) {
+	names := make(map[string]bool)
+
+	for i, policy := range policies {
+		if policy.Name == "" {
+			return nil, fmt.Errorf("policy %d must have a name", i)
+		}
+		if names[policy.Name] {
+			return nil, fmt.Errorf("policy name [%s] is used more than once", policy.Name)
+		}
+		names[policy.Name] = true
+
+		if policy.Effect != EffectAllow && policy.Effect != EffectDeny {
+			return nil, fmt.Errorf("policy [%s] must have an effect of %s or %s", policy.Name, EffectAllow, EffectDeny)
+		}
+
+		if len(policy.Principals) == 0 && len(policy.Groups) == 0 {
+			return nil, fmt.Errorf("policy [%s] must name at least one principal or group, or %q for everyone",
+				policy.Name, Wildcard)
+		}
+
+		for _, pattern := range append(append([]string(nil), policy.Roots...), policy.Files...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("policy [%s] has an invalid pattern %q", policy.Name, pattern)
+			}
+		}
+	}
+
+	return &Set{policies: append([]Policy(nil), policies...)}, nil
+}
+
+// Len returns the number of policies in the Set.
+func (s *Set) Len() int {
+	if s == nil {
+		return 0
+	}
+
+	return len(s.policies)
+}
+
+// Authorize decides whether the principal may read the file from the named root. A nil or empty Set allows every
+// request.
+func (s *Set) Authorize(principal auth.Principal, root, filename string) Decision {
+	if s.Len() == 0 {
+		return Decision{Allowed: true}
+	}
+
+	allowedBy := ""
+	for _, policy := range s.policies {
+		if !policy.matches(principal, root, filename) {
+			continue
+		}
+
+		if policy.Effect == EffectDeny {
+			return Decision{Allowed: false, Policy: policy.Name}
+		}
+		if allowedBy == "" {
+			allowedBy = policy.Name
+		}
+	}
+
+	if allowedBy != "" {
+		return Decision{Allowed: true, Policy: allowedBy}
+	}
+
+	return Decision{Allowed: false, Policy: DefaultPolicy}
+}
+
+func (p Policy) matches(principal auth.Principal, root, filename string) bool {
+	return p.matchesPrincipal(principal) && matchesAny(p.Roots, root) && matchesAny(p.Files, filename)
+}
+
+func (p Policy) matchesPrincipal(principal auth.Principal) bool {
+	for _, name := range p.Principals {
+		if name == Wildcard || name == principal.Subject {
+			return true
+		}
+	}
+
+	for _, group := range p.Groups {
+		if group == Wildcard {
+			return true
+		}
+		for _, member := range principal.Groups {
+			if group == member {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// matchesAny reports whether the value matches any of the patterns, or true when there are none.
+func matchesAny(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	for _, pattern := range patterns {
+		// the patterns are validated by NewSet, so the error can be ignored.
+		if matched, _ := path.Match(pattern, value); matched {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,141 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skormos/varlog-parser/internal/auth"
+)
+
+func TestSet_Authorize(t *testing.T) {
+	set, err := NewSet([]Policy{
+		{
+			Name:   "payments-team",
+			Effect: EffectAllow,
+			Groups: []string{"payments"},
+			Roots:  []string{"apps"},
+			Files:  []string{"payments-*.log"},
+		},
+		{
+			Name:       "ops-everything",
+			Effect:     EffectAllow,
+			Principals: []string{"oncall"},
+			Groups:     []string{"ops"},
+		},
+		{
+			Name:       "no-auth-logs",
+			Effect:     EffectDeny,
+			Principals: []string{Wildcard},
+			Files:      []string{"auth.log", "auth.log.*"},
+		},
+		{
+			Name:   "everyone-reads-bundles",
+			Effect: EffectAllow,
+			Groups: []string{Wildcard},
+			Roots:  []string{"bundle-*"},
+			Files:  []string{"var/log/*"},
+		},
+	})
+	require.NoError(t, err)
+
+	payments := auth.Principal{Subject: "alice", Groups: []string{"payments"}}
+	ops := auth.Principal{Subject: "bob", Groups: []string{"ops"}}
+	oncall := auth.Principal{Subject: "oncall"}
+
+	tests := map[string]struct {
+		principal auth.Principal
+		root      string
+		filename  string
+		expected  Decision
+	}{
+		"Group allowed on its own files": {
+			principal: payments,
+			root:      "apps",
+			filename:  "payments-api.log",
+			expected:  Decision{Allowed: true, Policy: "payments-team"},
+		},
+		"Group denied on other files in the same root": {
+			principal: payments,
+			root:      "apps",
+			filename:  "checkout-api.log",
+			expected:  Decision{Allowed: false, Policy: DefaultPolicy},
+		},
+		"Group denied on its file pattern in another root": {
+			principal: payments,
+			root:      "system",
+			filename:  "payments-api.log",
+			expected:  Decision{Allowed: false, Policy: DefaultPolicy},
+		},
+		"Principal allowed by subject": {
+			principal: oncall,
+			root:      "system",
+			filename:  "syslog",
+			expected:  Decision{Allowed: true, Policy: "ops-everything"},
+		},
+		"Deny takes precedence over allow": {
+			principal: ops,
+			root:      "system",
+			filename:  "auth.log.1",
+			expected:  Decision{Allowed: false, Policy: "no-auth-logs"},
+		},
+		"Wildcard group matches principals without groups": {
+			principal: auth.Anonymous(),
+			root:      "bundle-2022",
+			filename:  "var/log/syslog",
+			expected:  Decision{Allowed: true, Policy: "everyone-reads-bundles"},
+		},
+		"File patterns do not cross directories": {
+			principal: auth.Anonymous(),
+			root:      "bundle-2022",
+			filename:  "var/log/nginx/access.log",
+			expected:  Decision{Allowed: false, Policy: DefaultPolicy},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			assert.Equal(tt, test.expected, set.Authorize(test.principal, test.root, test.filename))
+		})
+	}
+}
+
+func TestSet_Empty(t *testing.T) {
+	var nilSet *Set
+	assert.Equal(t, Decision{Allowed: true}, nilSet.Authorize(auth.Anonymous(), "system", "syslog"))
+
+	empty, err := NewSet(nil)
+	require.NoError(t, err)
+	assert.Equal(t, Decision{Allowed: true}, empty.Authorize(auth.Anonymous(), "system", "syslog"))
+}
+
+func TestNewSet_Errors(t *testing.T) {
+	tests := map[string]Policy{
+		"Missing name": {
+			Effect: EffectAllow, Groups: []string{"ops"},
+		},
+		"Unknown effect": {
+			Name: "maybe", Effect: "permit", Groups: []string{"ops"},
+		},
+		"No principals or groups": {
+			Name: "nobody", Effect: EffectAllow,
+		},
+		"Invalid file pattern": {
+			Name: "broken", Effect: EffectAllow, Groups: []string{"ops"}, Files: []string{"[a-"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			_, err := NewSet([]Policy{test})
+			assert.Error(tt, err)
+		})
+	}
+
+	_, err := NewSet([]Policy{
+		{Name: "twice", Effect: EffectAllow, Groups: []string{"ops"}},
+		{Name: "twice", Effect: EffectDeny, Groups: []string{"ops"}},
+	})
+	assert.Error(t, err)
+}
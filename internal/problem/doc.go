@@ -0,0 +1,2 @@
+// Package problem writes RFC 7807 problem documents, so every listener describes its errors the same way.
+package problem
@@ -0,0 +1,72 @@
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+
+	v1 "github.com/skormos/varlog-parser/internal/api/rest/v1"
+)
+
+const (
+	// MediaType is the content type of every problem document.
+	MediaType = "application/problem+json"
+
+	typePrefix = "urn:varlog:problem:"
+)
+
+// titles are the summaries for every problem code, which never change between occurrences.
+var titles = map[v1.ProblemCode]string{
+	v1.FileNotFound:     "File not found",
+	v1.Unauthorized:     "Unauthorized",
+	v1.Forbidden:        "Forbidden",
+	v1.PermissionDenied: "Permission denied",
+	v1.InvalidParam:     "Invalid parameter",
+	v1.InvalidFilter:    "Invalid filter",
+	v1.NotAcceptable:    "Not acceptable",
+	v1.RateLimited:      "Too many requests",
+	v1.Overloaded:       "Service overloaded",
+	v1.InternalError:    "Internal server error",
+}
+
+// New returns the problem document for the code, with the path of the request as its instance. The detail is optional,
+// and is left out when empty.
+func New(r *http.Request, status int, code v1.ProblemCode, detail string) v1.Problem {
+	title, ok := titles[code]
+	if !ok {
+		title = http.StatusText(status)
+	}
+
+	instance := r.URL.Path
+	problem := v1.Problem{
+		Type:     typePrefix + string(code),
+		Title:    title,
+		Status:   status,
+		Code:     code,
+		Instance: &instance,
+	}
+	if detail != "" {
+		problem.Detail = &detail
+	}
+
+	return problem
+}
+
+// Respond writes the problem document for the code.
+func Respond(w http.ResponseWriter, r *http.Request, status int, code v1.ProblemCode, detail string) {
+	Write(w, New(r, status, code, detail))
+}
+
+// Write writes the problem document, with its status.
+func Write(w http.ResponseWriter, problem v1.Problem) {
+	bytes, err := json.Marshal(problem)
+	if err != nil {
+		// a Problem only contains strings and integers, so this can't happen in practice.
+		http.Error(w, http.StatusText(problem.Status), problem.Status)
+		return
+	}
+
+	w.Header().Set("Content-Type", MediaType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(problem.Status)
+	_, _ = w.Write(bytes)
+}
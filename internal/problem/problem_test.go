@@ -0,0 +1,58 @@
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	v1 "github.com/skormos/varlog-parser/internal/api/rest/v1"
+)
+
+func TestRespond(t *testing.T) {
+	tests := map[string]struct {
+		status        int
+		code          v1.ProblemCode
+		detail        string
+		expectedTitle string
+	}{
+		"Known code has its own title": {
+			status:        http.StatusNotFound,
+			code:          v1.FileNotFound,
+			detail:        "requested file with name could not be located",
+			expectedTitle: "File not found",
+		},
+		"Unknown code is titled after the status": {
+			status:        http.StatusTeapot,
+			code:          v1.ProblemCode("teapot"),
+			expectedTitle: "I'm a teapot",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			w := httptest.NewRecorder()
+			Respond(w, httptest.NewRequest(http.MethodGet, "/api/varlog/syslog", nil), test.status, test.code,
+				test.detail)
+
+			assert.Equal(tt, test.status, w.Code)
+			assert.Equal(tt, MediaType, w.Header().Get("Content-Type"))
+			assert.Equal(tt, "nosniff", w.Header().Get("X-Content-Type-Options"))
+
+			var problem v1.Problem
+			require.NoError(tt, json.Unmarshal(w.Body.Bytes(), &problem))
+			assert.Equal(tt, "urn:varlog:problem:"+string(test.code), problem.Type)
+			assert.Equal(tt, test.expectedTitle, problem.Title)
+			assert.Equal(tt, test.code, problem.Code)
+			assert.Equal(tt, "/api/varlog/syslog", *problem.Instance)
+			if test.detail == "" {
+				assert.Nil(tt, problem.Detail)
+			} else {
+				assert.Equal(tt, test.detail, *problem.Detail)
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package ratelimit
+
+import (
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"golang.org/x/time/rate"
+
+	"github.com/skormos/varlog-parser/internal/auth"
+)
+
+// sweepInterval is how often clients with a full bucket are forgotten, as they are no different to a new client.
+const sweepInterval = time.Minute
+
+type (
+	// ClientLimiter keeps a token bucket for every client. Every request takes a token, and tokens are added back at a
+	// steady rate up to the burst size.
+	ClientLimiter struct {
+		mu        sync.Mutex
+		limit     rate.Limit
+		burst     int
+		clients   map[string]*client
+		lastSweep time.Time
+		now       func() time.Time
+	}
+
+	client struct {
+		limiter  *rate.Limiter
+		rejected uint64
+	}
+
+	// ClientOption defines the function signature for helper methods to update the ClientLimiter when it is created.
+	ClientOption func(limiter *ClientLimiter)
+
+	// ClientStats is a snapshot of the limits, and the clients that have used some of their tokens.
+	ClientStats struct {
+		RequestsPerSecond float64       `json:"requestsPerSecond"`
+		Burst             int           `json:"burst"`
+		Clients           []ClientUsage `json:"clients"`
+	}
+
+	// ClientUsage is the state of a single client's bucket.
+	ClientUsage struct {
+		Client   string  `json:"client"`
+		Tokens   float64 `json:"tokens"`
+		Rejected uint64  `json:"rejected"`
+	}
+
+	// KeyFunc returns the name of the client that made the request.
+	KeyFunc func(r *http.Request) string
+
+	// PeerFunc returns the credentials of the process on the other end of a unix socket, and false for a request that
+	// was not made over one, or when they can't be read.
+	PeerFunc func(r *http.Request) (string, bool)
+
+	// RejectFunc responds to a request that was refused, with how long the client should wait before retrying.
+	RejectFunc func(w http.ResponseWriter, r *http.Request, retryAfter time.Duration)
+)
+
+// NewClientLimiter returns a ClientLimiter that allows every client the number of requests per second, with bursts of
+// up to the burst size. A rate of 0 or less allows every request.
+func NewClientLimiter(perSecond float64, burst int, options ...ClientOption) *ClientLimiter {
+	limiter := &ClientLimiter{
+		limit:   rate.Limit(perSecond),
+		burst:   burst,
+		clients: make(map[string]*client),
+		now:     time.Now,
+	}
+
+	for _, optionFn := range options {
+		optionFn(limiter)
+	}
+	limiter.lastSweep = limiter.now()
+
+	return limiter
+}
+
+// WithClock replaces the function used to tell the time, which is only useful for tests.
+func WithClock(now func() time.Time) ClientOption {
+	return func(limiter *ClientLimiter) {
+		limiter.now = now
+	}
+}
+
+// SetLimit replaces the rate and burst size for every client, keeping the tokens each client has left.
+func (l *ClientLimiter) SetLimit(perSecond float64, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.limit = rate.Limit(perSecond)
+	l.burst = burst
+	for _, c := range l.clients {
+		c.limiter.SetLimitAt(now, l.limit)
+		c.limiter.SetBurstAt(now, l.burst)
+	}
+}
+
+// Allow takes a token from the client's bucket. When the bucket is empty, the request is refused, and the time until
+// the next token is added is returned.
+func (l *ClientLimiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.limit <= 0 {
+		return true, 0
+	}
+
+	now := l.now()
+	l.sweep(now)
+
+	c, ok := l.clients[key]
+	if !ok {
+		c = &client{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.clients[key] = c
+	}
+
+	reservation := c.limiter.ReserveN(now, 1)
+	if delay := reservation.DelayFrom(now); !reservation.OK() || delay > 0 {
+		reservation.CancelAt(now)
+		c.rejected++
+		return false, delay
+	}
+
+	return true, 0
+}
+
+// Stats returns the limits, and the usage of every client that has made a request since its bucket was last full,
+// sorted by client.
+func (l *ClientLimiter) Stats() ClientStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	stats := ClientStats{
+		RequestsPerSecond: float64(l.limit),
+		Burst:             l.burst,
+		Clients:           make([]ClientUsage, 0, len(l.clients)),
+	}
+	for key, c := range l.clients {
+		stats.Clients = append(stats.Clients, ClientUsage{
+			Client:   key,
+			Tokens:   c.limiter.TokensAt(now),
+			Rejected: c.rejected,
+		})
+	}
+	sort.Slice(stats.Clients, func(i, j int) bool {
+		return stats.Clients[i].Client < stats.Clients[j].Client
+	})
+
+	return stats
+}
+
+// Middleware refuses requests from clients that have run out of tokens.
+func (l *ClientLimiter) Middleware(key KeyFunc, reject RejectFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			client := key(r)
+			if ok, retryAfter := l.Allow(client); !ok {
+				zerolog.Ctx(r.Context()).Debug().Msgf("client %s is over its rate limit", client)
+				SetRetryAfter(w, retryAfter)
+				reject(w, r, retryAfter)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// sweep forgets every client whose bucket has filled back up, at most once per sweep interval.
+func (l *ClientLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for key, c := range l.clients {
+		if c.limiter.TokensAt(now) >= float64(l.burst) {
+			delete(l.clients, key)
+		}
+	}
+}
+
+// ClientKey names the client by the principal the request was authenticated as, or by its address when the request
+// is anonymous, so every API key or token has its own bucket. Anonymous requests over a unix socket have no address,
+// so they all share a single bucket, unless they are named with ClientKeyWithPeer instead.
+func ClientKey(r *http.Request) string {
+	return clientKey(r, nil)
+}
+
+// ClientKeyWithPeer names the client like ClientKey, except that anonymous requests over a unix socket are named by the
+// credentials of the process that made them, so every local user has its own bucket.
+func ClientKeyWithPeer(peer PeerFunc) KeyFunc {
+	return func(r *http.Request) string {
+		return clientKey(r, peer)
+	}
+}
+
+func clientKey(r *http.Request, peer PeerFunc) string {
+	if principal, ok := auth.PrincipalFrom(r.Context()); ok && principal.Method != auth.MethodAnonymous {
+		return principal.Method + ":" + principal.Subject
+	}
+
+	if peer != nil {
+		if credentials, ok := peer(r); ok {
+			return "unix:" + credentials
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	return "ip:" + host
+}
+
+// SetRetryAfter sets the Retry-After header to the delay, rounded up to whole seconds.
+func SetRetryAfter(w http.ResponseWriter, delay time.Duration) {
+	seconds := int((delay + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+}
@@ -0,0 +1,149 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/skormos/varlog-parser/internal/auth"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (f *fakeClock) Now() time.Time {
+	return f.now
+}
+
+func TestClientLimiter_Allow(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2022, 8, 7, 21, 18, 18, 0, time.UTC)}
+	limiter := NewClientLimiter(2, 3, WithClock(clock.Now))
+
+	for i := 0; i < 3; i++ {
+		ok, _ := limiter.Allow("apikey:dashboard")
+		require.True(t, ok, "request %d should use the burst", i)
+	}
+
+	ok, retryAfter := limiter.Allow("apikey:dashboard")
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, retryAfter)
+
+	ok, _ = limiter.Allow("apikey:script")
+	assert.True(t, ok, "every client has its own bucket")
+
+	clock.now = clock.now.Add(500 * time.Millisecond)
+	ok, _ = limiter.Allow("apikey:dashboard")
+	assert.True(t, ok)
+
+	stats := limiter.Stats()
+	assert.Equal(t, 2.0, stats.RequestsPerSecond)
+	assert.Equal(t, 3, stats.Burst)
+	require.Len(t, stats.Clients, 2)
+	assert.Equal(t, ClientUsage{Client: "apikey:dashboard", Tokens: 0, Rejected: 1}, stats.Clients[0])
+	assert.Equal(t, "apikey:script", stats.Clients[1].Client)
+
+	clock.now = clock.now.Add(sweepInterval)
+	ok, _ = limiter.Allow("apikey:script")
+	assert.True(t, ok)
+	assert.Len(t, limiter.Stats().Clients, 1, "clients with a full bucket are forgotten")
+}
+
+func TestClientLimiter_SetLimit(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2022, 8, 7, 21, 18, 18, 0, time.UTC)}
+	limiter := NewClientLimiter(1, 1, WithClock(clock.Now))
+
+	ok, _ := limiter.Allow("ip:10.0.0.7")
+	require.True(t, ok)
+	ok, _ = limiter.Allow("ip:10.0.0.7")
+	require.False(t, ok)
+
+	limiter.SetLimit(0, 0)
+	ok, _ = limiter.Allow("ip:10.0.0.7")
+	assert.True(t, ok, "a rate of 0 disables the limit")
+
+	limiter.SetLimit(10, 1)
+	clock.now = clock.now.Add(100 * time.Millisecond)
+	ok, _ = limiter.Allow("ip:10.0.0.7")
+	assert.True(t, ok, "the new rate applies to existing clients")
+}
+
+func TestClientLimiter_Middleware(t *testing.T) {
+	limiter := NewClientLimiter(0.5, 1)
+	handler := limiter.Middleware(ClientKey, func(w http.ResponseWriter, _ *http.Request, _ time.Duration) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	})(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	request := func(principal *auth.Principal) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/varlog/syslog", nil)
+		if principal != nil {
+			r = r.WithContext(auth.WithPrincipal(r.Context(), *principal))
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	dashboard := &auth.Principal{Subject: "dashboard", Method: auth.MethodAPIKey}
+	assert.Equal(t, http.StatusOK, request(dashboard).Code)
+
+	refused := request(dashboard)
+	assert.Equal(t, http.StatusTooManyRequests, refused.Code)
+	assert.Equal(t, "2", refused.Header().Get("Retry-After"))
+
+	assert.Equal(t, http.StatusOK, request(nil).Code, "anonymous requests are limited by address")
+	assert.Equal(t, http.StatusTooManyRequests, request(nil).Code)
+}
+
+func TestClientKeyWithPeer(t *testing.T) {
+	peer := func(r *http.Request) (string, bool) {
+		uid := r.Header.Get("X-Test-Uid")
+		return "uid:" + uid, uid != ""
+	}
+
+	tests := map[string]struct {
+		principal  *auth.Principal
+		remoteAddr string
+		uid        string
+		expected   string
+	}{
+		"Authenticated request is named by its principal": {
+			principal:  &auth.Principal{Subject: "dashboard", Method: auth.MethodAPIKey},
+			remoteAddr: "@",
+			uid:        "1000",
+			expected:   "apikey:dashboard",
+		},
+		"Anonymous request over a unix socket is named by its peer": {
+			principal:  &auth.Principal{Subject: auth.AnonymousSubject, Method: auth.MethodAnonymous},
+			remoteAddr: "@",
+			uid:        "1000",
+			expected:   "unix:uid:1000",
+		},
+		"Anonymous request without a peer is named by its address": {
+			remoteAddr: "10.0.0.7:51234",
+			expected:   "ip:10.0.0.7",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/varlog/syslog", nil)
+			r.RemoteAddr = test.remoteAddr
+			if test.uid != "" {
+				r.Header.Set("X-Test-Uid", test.uid)
+			}
+			if test.principal != nil {
+				r = r.WithContext(auth.WithPrincipal(r.Context(), *test.principal))
+			}
+
+			assert.Equal(tt, test.expected, ClientKeyWithPeer(peer)(r))
+		})
+	}
+}
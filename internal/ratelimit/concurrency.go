@@ -0,0 +1,168 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrQueueFull is returned when every slot is in use and the queue has no room for another request.
+	ErrQueueFull = errors.New("too many requests are waiting to be served")
+	// ErrQueueTimeout is returned when a request has waited in the queue for longer than the queue timeout.
+	ErrQueueTimeout = errors.New("timed out waiting to be served")
+)
+
+type (
+	// ConcurrencyLimiter caps the number of requests doing work at once. Requests over the cap wait in a first in, first
+	// out queue for a slot to be released.
+	ConcurrencyLimiter struct {
+		mu           sync.Mutex
+		maxActive    int
+		maxQueued    int
+		queueTimeout time.Duration
+		active       int
+		queue        []chan struct{}
+		rejected     uint64
+	}
+
+	// ConcurrencyStats is a snapshot of the limits, and how many requests are using them.
+	ConcurrencyStats struct {
+		MaxActive      int    `json:"maxActive"`
+		MaxQueued      int    `json:"maxQueued"`
+		QueueTimeoutMS int64  `json:"queueTimeoutMs"`
+		Active         int    `json:"active"`
+		Queued         int    `json:"queued"`
+		Rejected       uint64 `json:"rejected"`
+	}
+)
+
+// NewConcurrencyLimiter returns a ConcurrencyLimiter that allows maxActive requests at once, and queues up to maxQueued
+// more for at most the queue timeout. A maxActive of 0 or less allows any number of requests.
+func NewConcurrencyLimiter(maxActive, maxQueued int, queueTimeout time.Duration) *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{
+		maxActive:    maxActive,
+		maxQueued:    maxQueued,
+		queueTimeout: queueTimeout,
+	}
+}
+
+// SetLimits replaces the limits. Requests already holding a slot keep it, and queued requests are given any slots the
+// new limits free up.
+func (c *ConcurrencyLimiter) SetLimits(maxActive, maxQueued int, queueTimeout time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.maxActive = maxActive
+	c.maxQueued = maxQueued
+	c.queueTimeout = queueTimeout
+	c.grant()
+}
+
+// Acquire waits for a slot, and returns the function that releases it, which must be called exactly once. If the
+// queue is full, the queue timeout passes, or the context is done first, the error is returned instead.
+func (c *ConcurrencyLimiter) Acquire(ctx context.Context) (func(), error) {
+	c.mu.Lock()
+	if c.hasSlot() && len(c.queue) == 0 {
+		c.active++
+		c.mu.Unlock()
+		return c.release, nil
+	}
+
+	if len(c.queue) >= c.maxQueued {
+		c.rejected++
+		c.mu.Unlock()
+		return nil, ErrQueueFull
+	}
+
+	ready := make(chan struct{})
+	c.queue = append(c.queue, ready)
+	timeout := c.queueTimeout
+	c.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case <-ready:
+		return c.release, nil
+	case <-timer.C:
+		err = ErrQueueTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.dequeue(ready) {
+		// the slot was granted at the same time as giving up, so it's handed on to the next request.
+		c.active--
+		c.grant()
+	}
+	if err == ErrQueueTimeout {
+		c.rejected++
+	}
+
+	return nil, err
+}
+
+// Stats returns the limits, and the number of requests holding or waiting for a slot.
+func (c *ConcurrencyLimiter) Stats() ConcurrencyStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return ConcurrencyStats{
+		MaxActive:      c.maxActive,
+		MaxQueued:      c.maxQueued,
+		QueueTimeoutMS: c.queueTimeout.Milliseconds(),
+		Active:         c.active,
+		Queued:         len(c.queue),
+		Rejected:       c.rejected,
+	}
+}
+
+// RetryAfter is how long a refused request should wait before trying again, which is the longest a request can be
+// queued for.
+func (c *ConcurrencyLimiter) RetryAfter() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.queueTimeout
+}
+
+func (c *ConcurrencyLimiter) release() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.active--
+	c.grant()
+}
+
+// grant hands free slots to the queued requests in order. The lock must be held.
+func (c *ConcurrencyLimiter) grant() {
+	for len(c.queue) > 0 && c.hasSlot() {
+		c.active++
+		close(c.queue[0])
+		c.queue = c.queue[1:]
+	}
+}
+
+// dequeue removes the request from the queue, and reports whether it was still waiting. The lock must be held.
+func (c *ConcurrencyLimiter) dequeue(ready chan struct{}) bool {
+	for i, queued := range c.queue {
+		if queued == ready {
+			c.queue = append(c.queue[:i], c.queue[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasSlot reports whether another request can start. The lock must be held.
+func (c *ConcurrencyLimiter) hasSlot() bool {
+	return c.maxActive <= 0 || c.active < c.maxActive
+}
@@ -0,0 +1,94 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConcurrencyLimiter_Acquire(t *testing.T) {
+	limiter := NewConcurrencyLimiter(1, 1, time.Minute)
+
+	release, err := limiter.Acquire(context.Background())
+	require.NoError(t, err)
+
+	acquired := make(chan func())
+	go func() {
+		queuedRelease, err := limiter.Acquire(context.Background())
+		assert.NoError(t, err)
+		acquired <- queuedRelease
+	}()
+
+	require.Eventually(t, func() bool {
+		return limiter.Stats().Queued == 1
+	}, time.Second, time.Millisecond)
+
+	_, err = limiter.Acquire(context.Background())
+	assert.ErrorIs(t, err, ErrQueueFull)
+
+	release()
+	queuedRelease := <-acquired
+	assert.Equal(t, ConcurrencyStats{
+		MaxActive:      1,
+		MaxQueued:      1,
+		QueueTimeoutMS: time.Minute.Milliseconds(),
+		Active:         1,
+		Queued:         0,
+		Rejected:       1,
+	}, limiter.Stats())
+
+	queuedRelease()
+	assert.Equal(t, 0, limiter.Stats().Active)
+}
+
+func TestConcurrencyLimiter_GiveUp(t *testing.T) {
+	limiter := NewConcurrencyLimiter(1, 5, 10*time.Millisecond)
+
+	release, err := limiter.Acquire(context.Background())
+	require.NoError(t, err)
+	defer release()
+
+	_, err = limiter.Acquire(context.Background())
+	assert.ErrorIs(t, err, ErrQueueTimeout)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = limiter.Acquire(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	stats := limiter.Stats()
+	assert.Equal(t, 0, stats.Queued)
+	assert.Equal(t, uint64(1), stats.Rejected, "only a timeout counts as a rejection")
+}
+
+func TestConcurrencyLimiter_SetLimits(t *testing.T) {
+	limiter := NewConcurrencyLimiter(1, 1, time.Minute)
+
+	release, err := limiter.Acquire(context.Background())
+	require.NoError(t, err)
+	defer release()
+
+	acquired := make(chan error)
+	go func() {
+		queuedRelease, err := limiter.Acquire(context.Background())
+		if err == nil {
+			defer queuedRelease()
+		}
+		acquired <- err
+	}()
+
+	require.Eventually(t, func() bool {
+		return limiter.Stats().Queued == 1
+	}, time.Second, time.Millisecond)
+
+	limiter.SetLimits(2, 1, time.Minute)
+	assert.NoError(t, <-acquired, "a raised limit starts queued requests")
+
+	limiter.SetLimits(0, 0, time.Minute)
+	unlimited, err := limiter.Acquire(context.Background())
+	require.NoError(t, err)
+	unlimited()
+}
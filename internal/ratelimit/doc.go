@@ -0,0 +1,4 @@
+// Package ratelimit protects the service from clients that send too many requests, with a token bucket for every
+// client, and from too much work at once, with a cap on the number of concurrent scans that queues the requests over
+// it.
+package ratelimit
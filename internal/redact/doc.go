@@ -0,0 +1,3 @@
+// Package redact replaces sensitive values, like email addresses, tokens and card numbers, in log lines before they are
+// returned to a reader.
+package redact
@@ -0,0 +1,254 @@
+package redact
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+type (
+	// Rule replaces every match of a regular expression. The replacement can refer to submatches with $1 or ${name}, as
+	// with regexp.Expand. A rule is not applied for principals in any of its exempt groups.
+	Rule struct {
+		// Preset is the name of a built-in rule. When it is set, the pattern and replacement come from the preset, and
+		// the name defaults to the preset name.
+		Preset       string
+		Name         string
+		Pattern      string
+		Replacement  string
+		ExemptGroups []string
+	}
+
+	// Redactor applies a set of rules to lines, in the order the rules were provided.
+	Redactor struct {
+		rules []compiledRule
+	}
+
+	compiledRule struct {
+		name         string
+		pattern      *regexp.Regexp
+		replacement  string
+		validate     func(match string) bool
+		exemptGroups map[string]bool
+	}
+
+	preset struct {
+		pattern     *regexp.Regexp
+		replacement string
+		validate    func(match string) bool
+	}
+)
+
+// presets are the built-in rules for common secrets. Card numbers are only replaced when they pass the Luhn check, to
+// leave other long numbers, like timestamps and ids, alone.
+var presets = map[string]preset{
+	"email": {
+		pattern:     regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`),
+		replacement: "[REDACTED:email]",
+	},
+	"bearer": {
+		pattern:     regexp.MustCompile(`(?i)\b(bearer\s+)[A-Za-z0-9._~+/-]+=*`),
+		replacement: "${1}[REDACTED:bearer]",
+	},
+	"jwt": {
+		pattern:     regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`),
+		replacement: "[REDACTED:jwt]",
+	},
+	"card": {
+		pattern:     regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`),
+		replacement: "[REDACTED:card]",
+		validate:    luhnValid,
+	},
+	"aws-access-key": {
+		pattern:     regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+		replacement: "[REDACTED:aws-access-key]",
+	},
+	"password": {
+		pattern:     regexp.MustCompile(`(?i)\b(password|passwd|pwd|secret|api[_-]?key)(\s*[=:]\s*)("[^"]*"|[^\s,;&]+)`),
+		replacement: "${1}${2}[REDACTED]",
+	},
+}
+
+// PresetNames returns the names of every built-in rule, sorted alphabetically.
+func PresetNames() []string {
+	out := make([]string, 0, len(presets))
+	for name := range presets {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+
+	return out
+}
+
+// New compiles every rule, and returns the first problem found.
+func New(rules []Rule) (*Redactor, error) {
+	redactor := &Redactor{rules: make([]compiledRule, 0, len(rules))}
+	names := make(map[string]bool)
+
+	for i, rule := range rules {
+		compiled, err := compile(rule)
+		if err != nil {
+			return nil, fmt.Errorf("redaction rule %d %w", i, err)
+		}
+
+		if names[compiled.name] {
+			return nil, fmt.Errorf("redaction rule name [%s] is used more than once", compiled.name)
+		}
+		names[compiled.name] = true
+
+		redactor.rules = append(redactor.rules, compiled)
+	}
+
+	return redactor, nil
+}
+
+func compile(rule Rule) (compiledRule, error) {
+	compiled := compiledRule{
+		name:         rule.Name,
+		replacement:  rule.Replacement,
+		exemptGroups: make(map[string]bool, len(rule.ExemptGroups)),
+	}
+	for _, group := range rule.ExemptGroups {
+		compiled.exemptGroups[group] = true
+	}
+
+	if rule.Preset != "" {
+		builtIn, ok := presets[rule.Preset]
+		if !ok {
+			return compiledRule{}, fmt.Errorf("has an unknown preset [%s], expected one of %s",
+				rule.Preset, strings.Join(PresetNames(), ", "))
+		}
+		if rule.Pattern != "" {
+			return compiledRule{}, fmt.Errorf("[%s] can't have both a preset and a pattern", rule.Preset)
+		}
+
+		if compiled.name == "" {
+			compiled.name = rule.Preset
+		}
+		if compiled.replacement == "" {
+			compiled.replacement = builtIn.replacement
+		}
+		compiled.pattern = builtIn.pattern
+		compiled.validate = builtIn.validate
+
+		return compiled, nil
+	}
+
+	if rule.Name == "" {
+		return compiledRule{}, fmt.Errorf("must have a name or a preset")
+	}
+
+	pattern, err := regexp.Compile(rule.Pattern)
+	if err != nil || rule.Pattern == "" {
+		return compiledRule{}, fmt.Errorf("[%s] has an invalid pattern %q", rule.Name, rule.Pattern)
+	}
+	compiled.pattern = pattern
+
+	if compiled.replacement == "" {
+		compiled.replacement = "[REDACTED]"
+	}
+
+	return compiled, nil
+}
+
+// For returns a Redactor with only the rules none of the groups are exempt from. It returns nil when no rule applies,
+// and a nil Redactor leaves every line unchanged.
+func (r *Redactor) For(groups []string) *Redactor {
+	if r == nil {
+		return nil
+	}
+
+	out := &Redactor{rules: make([]compiledRule, 0, len(r.rules))}
+	for _, rule := range r.rules {
+		if !rule.exempts(groups) {
+			out.rules = append(out.rules, rule)
+		}
+	}
+
+	if len(out.rules) == 0 {
+		return nil
+	}
+
+	return out
+}
+
+// Redact applies every rule to the line in order, and returns the result along with the number of values replaced.
+func (r *Redactor) Redact(line string) (string, int) {
+	if r == nil {
+		return line, 0
+	}
+
+	count := 0
+	for _, rule := range r.rules {
+		var replaced int
+		line, replaced = rule.apply(line)
+		count += replaced
+	}
+
+	return line, count
+}
+
+func (c compiledRule) exempts(groups []string) bool {
+	for _, group := range groups {
+		if c.exemptGroups[group] {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c compiledRule) apply(line string) (string, int) {
+	matches := c.pattern.FindAllStringSubmatchIndex(line, -1)
+	if len(matches) == 0 {
+		return line, 0
+	}
+
+	var builder strings.Builder
+	builder.Grow(len(line))
+
+	count := 0
+	last := 0
+	for _, match := range matches {
+		if c.validate != nil && !c.validate(line[match[0]:match[1]]) {
+			continue
+		}
+
+		builder.WriteString(line[last:match[0]])
+		builder.Write(c.pattern.ExpandString(nil, c.replacement, line, match))
+		last = match[1]
+		count++
+	}
+
+	if count == 0 {
+		return line, 0
+	}
+	builder.WriteString(line[last:])
+
+	return builder.String(), count
+}
+
+// luhnValid reports whether the digits in the value pass the Luhn checksum used by card numbers.
+func luhnValid(value string) bool {
+	sum := 0
+	double := false
+	for i := len(value) - 1; i >= 0; i-- {
+		c := value[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+
+		digit := int(c - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+
+	return sum%10 == 0
+}
@@ -0,0 +1,6 @@
+// Package searchindex keeps an inverted index of the text of log files, so a substring search only reads the parts of
+// a large file that could contain it. Every file is split into blocks of whole lines, and the index maps every
+// sequence of three bytes found in a line, its trigrams, to the blocks it was found in. A block can only contain a
+// substring when it has every trigram of the substring. The index is kept in a directory of its own, extended in the
+// background as files grow, rebuilt once a file has been rotated or truncated, and can be deleted at any time.
+package searchindex
@@ -0,0 +1,271 @@
+package searchindex
+
+import (
+	"context"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	vlos "github.com/skormos/varlog-parser/internal/os"
+)
+
+// DefaultPassInterval is the time between the end of one pass over the files and the start of the next when no other
+// interval has been provided.
+const DefaultPassInterval = time.Minute
+
+type (
+	// Source lists and opens the files that can be indexed.
+	Source interface {
+		List() ([]vlos.FileEntry, error)
+		Open(ctx context.Context, root, filename string) (vlos.File, error)
+	}
+
+	// IndexerOption defines the function signature for helper methods to update the Indexer, either when it is
+	// created or reloaded.
+	IndexerOption func(indexer *Indexer)
+
+	// Indexer updates the index of every file of its source matching its patterns, one file at a time, in passes
+	// separated by an interval. The index of a file that no longer matches, or no longer exists, is removed once a
+	// pass over every other file has completed.
+	Indexer struct {
+		logger zerolog.Logger
+		store  *Store
+		wake   chan struct{}
+
+		// inUse is read locked for the whole of a pass, so a reload can tell when the previous source is no longer
+		// in use.
+		inUse sync.RWMutex
+
+		mu       sync.Mutex
+		source   Source
+		roots    []string
+		files    []string
+		interval time.Duration
+		rebuild  bool
+		// cancel stops the pass in progress, and is nil between passes.
+		cancel context.CancelFunc
+	}
+)
+
+// WithRoots only indexes the files of the roots matching any of the glob patterns. Without any, the files of every
+// root are indexed.
+func WithRoots(patterns ...string) IndexerOption {
+	return func(indexer *Indexer) {
+		indexer.roots = patterns
+	}
+}
+
+// WithFiles only indexes the files with a name matching any of the glob patterns. Without any, no file is indexed.
+func WithFiles(patterns ...string) IndexerOption {
+	return func(indexer *Indexer) {
+		indexer.files = patterns
+	}
+}
+
+// WithPassInterval sets the time between the end of one pass and the start of the next.
+func WithPassInterval(interval time.Duration) IndexerOption {
+	return func(indexer *Indexer) {
+		indexer.interval = interval
+	}
+}
+
+// NewIndexer returns an Indexer that keeps the index of the files of the source in the store. It does nothing until
+// it is run.
+func NewIndexer(logCtx zerolog.Context, store *Store, source Source, options ...IndexerOption) *Indexer {
+	indexer := &Indexer{
+		logger: logCtx.Logger().With().Str("component", "searchindex").Logger(),
+		store:  store,
+		wake:   make(chan struct{}, 1),
+	}
+	indexer.apply(source, options...)
+
+	return indexer
+}
+
+// Run starts a pass straight away, and another every interval after the previous one ends, until the done channel is
+// closed. A pass in progress is stopped once it is, keeping the blocks indexed so far.
+func (i *Indexer) Run(done <-chan struct{}) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		i.pass(ctx)
+
+		i.mu.Lock()
+		timer := time.NewTimer(i.interval)
+		i.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-i.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// Reload replaces the source and options used from the next pass, which starts straight away. Any option not provided
+// is reset to its default. A pass in progress is stopped, and Reload blocks until it has, so the previous source it
+// returns is safe to close.
+func (i *Indexer) Reload(source Source, options ...IndexerOption) Source {
+	i.mu.Lock()
+	previous := i.source
+	i.apply(source, options...)
+	if i.cancel != nil {
+		i.cancel()
+	}
+	i.mu.Unlock()
+	i.wakeUp()
+
+	i.inUse.Lock()
+	defer i.inUse.Unlock()
+
+	return previous
+}
+
+// Rebuild removes the index of every file, then indexes them again from the start, in a pass that starts straight
+// away. A pass in progress is stopped first. Searches read the whole of every file until it has been indexed again.
+func (i *Indexer) Rebuild() {
+	i.mu.Lock()
+	i.rebuild = true
+	if i.cancel != nil {
+		i.cancel()
+	}
+	i.mu.Unlock()
+	i.wakeUp()
+}
+
+// Status reports every file that has been indexed.
+func (i *Indexer) Status() []FileStatus {
+	return i.store.Status()
+}
+
+// apply replaces the source and options, which must be done while locked once the Indexer has been created.
+func (i *Indexer) apply(source Source, options ...IndexerOption) {
+	i.source = source
+	i.roots = nil
+	i.files = nil
+	i.interval = DefaultPassInterval
+
+	for _, optionFn := range options {
+		optionFn(i)
+	}
+
+	if i.interval <= 0 {
+		i.interval = DefaultPassInterval
+	}
+}
+
+func (i *Indexer) wakeUp() {
+	select {
+	case i.wake <- struct{}{}:
+	default:
+	}
+}
+
+// pass updates the index of every matching file, then removes the index of every other file.
+func (i *Indexer) pass(ctx context.Context) {
+	i.inUse.RLock()
+	defer i.inUse.RUnlock()
+
+	i.mu.Lock()
+	ctx, cancel := context.WithCancel(ctx)
+	i.cancel = cancel
+	source, roots, files, rebuild := i.source, i.roots, i.files, i.rebuild
+	i.rebuild = false
+	i.mu.Unlock()
+
+	defer func() {
+		i.mu.Lock()
+		i.cancel = nil
+		i.mu.Unlock()
+		cancel()
+	}()
+
+	if rebuild {
+		if err := i.store.Reset(); err != nil {
+			i.logger.Err(err).Msg("while removing the search index to rebuild it")
+			return
+		}
+		i.logger.Info().Msg("search index removed, rebuilding it")
+	}
+
+	entries, err := source.List()
+	if err != nil {
+		i.logger.Err(err).Msg("while listing the files to index")
+		return
+	}
+
+	indexed := make([]File, 0)
+	for _, entry := range entries {
+		name := entry.Info.Name()
+		if !matchesAny(roots, entry.Root, true) || !matchesAny(files, name, false) {
+			continue
+		}
+		indexed = append(indexed, File{Root: entry.Root, Name: name})
+
+		if err := i.index(ctx, source, entry.Root, name); err != nil {
+			// a stopped pass has not seen every file, so no index is removed.
+			if ctx.Err() != nil {
+				return
+			}
+			i.logger.Warn().Err(err).Msgf("while indexing %s in root %s", name, entry.Root)
+		}
+	}
+
+	if err := i.store.Retain(indexed); err != nil {
+		i.logger.Err(err).Msg("while removing the search index of files no longer indexed")
+	}
+}
+
+// index updates the index of a single file.
+func (i *Indexer) index(ctx context.Context, source Source, root, name string) error {
+	file, err := source.Open(ctx, root, name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			i.logger.Err(err).Msgf("could not close file %s", name)
+		}
+	}()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	started := time.Now()
+	if err := i.store.Update(ctx, root, name, file, info); err != nil {
+		return err
+	}
+	i.logger.Debug().Msgf("indexed %s in root %s in %s", name, root, time.Since(started))
+
+	return nil
+}
+
+// matchesAny reports whether the value matches any of the glob patterns, or whether to match without any.
+func matchesAny(patterns []string, value string, matchEmpty bool) bool {
+	if len(patterns) == 0 {
+		return matchEmpty
+	}
+
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, value); matched {
+			return true
+		}
+	}
+
+	return false
+}
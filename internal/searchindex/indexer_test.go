@@ -0,0 +1,115 @@
+package searchindex
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	vlos "github.com/skormos/varlog-parser/internal/os"
+)
+
+func TestMatchesAny(t *testing.T) {
+	tests := map[string]struct {
+		patterns   []string
+		value      string
+		matchEmpty bool
+		expected   bool
+	}{
+		"No patterns match when asked to":       {value: "syslog", matchEmpty: true, expected: true},
+		"No patterns do not match otherwise":    {value: "syslog"},
+		"Exact pattern":                         {patterns: []string{"syslog"}, value: "syslog", expected: true},
+		"Glob pattern":                          {patterns: []string{"auth.log", "sys*"}, value: "syslog.1", expected: true},
+		"No matching pattern":                   {patterns: []string{"auth.log", "kern*"}, value: "syslog"},
+		"Invalid pattern never matches":         {patterns: []string{"["}, value: "[", matchEmpty: true},
+		"Glob pattern does not match a slash":   {patterns: []string{"*"}, value: "nginx/access.log"},
+		"Glob pattern with a slash matches one": {patterns: []string{"*/*"}, value: "nginx/access.log", expected: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			assert.Equal(tt, test.expected, matchesAny(test.patterns, test.value, test.matchEmpty))
+		})
+	}
+}
+
+func TestIndexer(t *testing.T) {
+	logs := t.TempDir()
+	for _, name := range []string{"syslog", "auth.log", "kern.log"} {
+		writeLines(t, filepath.Join(logs, name), 0, 10)
+	}
+
+	store, err := NewStore(t.TempDir(), WithBlockSize(2*lineLength))
+	require.NoError(t, err)
+	indexed := func() []string {
+		names := make([]string, 0)
+		for _, status := range store.Status() {
+			names = append(names, status.Root+"/"+status.Name)
+		}
+		return names
+	}
+	indexedBytes := func(name string) int64 {
+		for _, status := range store.Status() {
+			if status.Name == name {
+				return status.IndexedBytes
+			}
+		}
+		return -1
+	}
+	roots := func() *vlos.Roots {
+		roots, err := vlos.NewRoots([]vlos.Root{{Name: "system", Path: logs}})
+		require.NoError(t, err)
+		return roots
+	}
+
+	first := roots()
+	indexer := NewIndexer(zerolog.Nop().With(), store, first,
+		WithFiles("syslog", "auth.*"), WithPassInterval(10*time.Millisecond))
+
+	done := make(chan struct{})
+	stopped := make(chan error)
+	go func() {
+		stopped <- indexer.Run(done)
+	}()
+
+	// only the matching files are indexed, and kept up to date as they grow.
+	require.Eventually(t, func() bool {
+		return len(indexed()) == 2
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []string{"system/auth.log", "system/syslog"}, indexed())
+	writeLines(t, filepath.Join(logs, "syslog"), 10, 12)
+	require.Eventually(t, func() bool {
+		return indexedBytes("syslog") == 12*lineLength
+	}, time.Second, 5*time.Millisecond)
+
+	// a reload returns the previous source once it is no longer used, and the files no longer matching are removed.
+	second := roots()
+	assert.Same(t, first, indexer.Reload(second, WithRoots("sys*"), WithFiles("*.log")))
+	require.NoError(t, first.Close())
+	require.Eventually(t, func() bool {
+		names := indexed()
+		return len(names) == 2 && names[0] == "system/auth.log" && names[1] == "system/kern.log"
+	}, time.Second, 5*time.Millisecond)
+
+	// a rebuild removes every index, which is then built again from the start.
+	stray := filepath.Join(store.dir, store.key("system", "kern.log"), "00999999.seg")
+	require.NoError(t, os.WriteFile(stray, nil, 0o600))
+	indexer.Rebuild()
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(stray)
+		return os.IsNotExist(err) && len(indexed()) == 2
+	}, time.Second, 5*time.Millisecond)
+
+	close(done)
+	select {
+	case err := <-stopped:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("indexer did not stop once done was closed")
+	}
+	require.NoError(t, second.Close())
+}
@@ -0,0 +1,403 @@
+package searchindex
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	// a segment is a fixed size header, the offsets of its blocks, the postings of every trigram, then the dictionary
+	// of trigrams, which is written last as its postings offsets are only known once they have been written.
+	segmentMagic      = "VLSX"
+	segmentVersion    = 1
+	segmentHeaderSize = 32
+	dictEntrySize     = 16
+)
+
+// errCorruptSegment is returned when a segment file does not have the layout it was written with.
+var errCorruptSegment = errors.New("search index segment is corrupt")
+
+type (
+	// segment is the index of a run of consecutive blocks, which is never changed once it has been written. Only the
+	// block offsets and the dictionary are kept in memory, and the postings are read from the file when searched.
+	segment struct {
+		name string
+		path string
+		// first is the number of the first block in the segment, counting every block of the file.
+		first int64
+		// offsets is the start of every block, followed by the end of the last block.
+		offsets []int64
+		terms   []uint32
+		counts  []uint32
+		// postings is the offset of the postings of every term, and the end of the last term's.
+		postings []int64
+	}
+
+	// segmentBuilder collects the trigrams of blocks as they are read, until they are written as a segment.
+	segmentBuilder struct {
+		first    int64
+		offsets  []int64
+		postings map[uint32][]uint32
+	}
+
+	// postingsFn provides the postings of a segment in ascending order of trigram, with the blocks numbered from the
+	// first block of the segment.
+	postingsFn func(emit func(term uint32, blocks []uint32) error) error
+)
+
+func newSegmentBuilder(first, offset int64) *segmentBuilder {
+	return &segmentBuilder{
+		first:    first,
+		offsets:  []int64{offset},
+		postings: make(map[uint32][]uint32),
+	}
+}
+
+// add records the trigrams of the block that ends at the offset, and starts where the previous block ended.
+func (b *segmentBuilder) add(end int64, terms []uint32) {
+	block := uint32(len(b.offsets) - 1)
+	for _, term := range terms {
+		b.postings[term] = append(b.postings[term], block)
+	}
+	b.offsets = append(b.offsets, end)
+}
+
+func (b *segmentBuilder) blocks() int {
+	return len(b.offsets) - 1
+}
+
+// write writes the blocks added so far as the segment at the path.
+func (b *segmentBuilder) write(path string) (*segment, error) {
+	terms := make([]uint32, 0, len(b.postings))
+	for term := range b.postings {
+		terms = append(terms, term)
+	}
+	sort.Slice(terms, func(i, j int) bool { return terms[i] < terms[j] })
+
+	return writeSegment(path, b.first, b.offsets, func(emit func(term uint32, blocks []uint32) error) error {
+		for _, term := range terms {
+			if err := emit(term, b.postings[term]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// mergeSegments writes the blocks of both segments as a single segment at the path. The second segment must start
+// with the block after the last block of the first.
+func mergeSegments(path string, first, second *segment) (*segment, error) {
+	firstFile, err := os.Open(first.path)
+	if err != nil {
+		return nil, fmt.Errorf("while opening search index segment %s: %w", first.name, err)
+	}
+	defer func() { _ = firstFile.Close() }()
+
+	secondFile, err := os.Open(second.path)
+	if err != nil {
+		return nil, fmt.Errorf("while opening search index segment %s: %w", second.name, err)
+	}
+	defer func() { _ = secondFile.Close() }()
+
+	offsets := append(append(make([]int64, 0, len(first.offsets)+len(second.offsets)-1),
+		first.offsets[:len(first.offsets)-1]...), second.offsets...)
+	shift := uint32(first.blocks())
+
+	return writeSegment(path, first.first, offsets, func(emit func(term uint32, blocks []uint32) error) error {
+		i, j := 0, 0
+		for i < len(first.terms) || j < len(second.terms) {
+			var (
+				term   uint32
+				blocks []uint32
+			)
+			if j == len(second.terms) || (i < len(first.terms) && first.terms[i] <= second.terms[j]) {
+				term = first.terms[i]
+				read, err := first.read(firstFile, i)
+				if err != nil {
+					return err
+				}
+				blocks = read
+				i++
+			} else {
+				term = second.terms[j]
+			}
+
+			if j < len(second.terms) && second.terms[j] == term {
+				shifted, err := second.read(secondFile, j)
+				if err != nil {
+					return err
+				}
+				for _, block := range shifted {
+					blocks = append(blocks, block+shift)
+				}
+				j++
+			}
+
+			if err := emit(term, blocks); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// writeSegment writes the segment to a temporary file, which replaces the path once it is complete, so a segment is
+// only ever found whole.
+func writeSegment(path string, first int64, offsets []int64, postings postingsFn) (*segment, error) {
+	temp := path + ".tmp"
+	file, err := os.OpenFile(temp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("while creating search index segment %s: %w", path, err)
+	}
+
+	seg, err := encodeSegment(file, first, offsets, postings)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp, path)
+	}
+	if err != nil {
+		_ = os.Remove(temp)
+		return nil, fmt.Errorf("while writing search index segment %s: %w", path, err)
+	}
+
+	seg.path = path
+	seg.name = filepath.Base(path)
+	return seg, nil
+}
+
+func encodeSegment(file *os.File, first int64, offsets []int64, postings postingsFn) (*segment, error) {
+	seg := &segment{first: first, offsets: offsets}
+	out := bufio.NewWriter(file)
+
+	// the header is written again once the dictionary offset is known.
+	if _, err := out.Write(make([]byte, segmentHeaderSize)); err != nil {
+		return nil, err
+	}
+
+	record := make([]byte, dictEntrySize)
+	for _, offset := range offsets {
+		binary.LittleEndian.PutUint64(record, uint64(offset))
+		if _, err := out.Write(record[:8]); err != nil {
+			return nil, err
+		}
+	}
+
+	position := int64(segmentHeaderSize + 8*len(offsets))
+	varint := make([]byte, binary.MaxVarintLen32)
+	err := postings(func(term uint32, blocks []uint32) error {
+		seg.terms = append(seg.terms, term)
+		seg.counts = append(seg.counts, uint32(len(blocks)))
+		seg.postings = append(seg.postings, position)
+
+		previous := uint32(0)
+		for _, block := range blocks {
+			n := binary.PutUvarint(varint, uint64(block-previous))
+			if _, err := out.Write(varint[:n]); err != nil {
+				return err
+			}
+			position += int64(n)
+			previous = block
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	seg.postings = append(seg.postings, position)
+
+	for i, term := range seg.terms {
+		binary.LittleEndian.PutUint32(record, term)
+		binary.LittleEndian.PutUint32(record[4:], seg.counts[i])
+		binary.LittleEndian.PutUint64(record[8:], uint64(seg.postings[i]))
+		if _, err := out.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	if err := out.Flush(); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, segmentHeaderSize)
+	copy(header, segmentMagic)
+	binary.LittleEndian.PutUint32(header[4:], segmentVersion)
+	binary.LittleEndian.PutUint64(header[8:], uint64(first))
+	binary.LittleEndian.PutUint32(header[16:], uint32(len(offsets)-1))
+	binary.LittleEndian.PutUint32(header[20:], uint32(len(seg.terms)))
+	binary.LittleEndian.PutUint64(header[24:], uint64(position))
+	if _, err := file.WriteAt(header, 0); err != nil {
+		return nil, err
+	}
+
+	return seg, nil
+}
+
+// openSegment reads the block offsets and dictionary of the segment at the path.
+func openSegment(path string) (*segment, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("while opening search index segment %s: %w", path, err)
+	}
+	defer func() { _ = file.Close() }()
+
+	seg, err := decodeSegment(file)
+	if err != nil {
+		return nil, fmt.Errorf("while reading search index segment %s: %w", path, err)
+	}
+
+	seg.path = path
+	seg.name = filepath.Base(path)
+	return seg, nil
+}
+
+func decodeSegment(file *os.File) (*segment, error) {
+	header := make([]byte, segmentHeaderSize)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return nil, err
+	}
+	if string(header[:4]) != segmentMagic || binary.LittleEndian.Uint32(header[4:]) != segmentVersion {
+		return nil, errCorruptSegment
+	}
+
+	blocks := int(binary.LittleEndian.Uint32(header[16:]))
+	terms := int(binary.LittleEndian.Uint32(header[20:]))
+	dictOffset := int64(binary.LittleEndian.Uint64(header[24:]))
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if dictOffset < int64(segmentHeaderSize+8*(blocks+1)) || info.Size() != dictOffset+int64(terms*dictEntrySize) {
+		return nil, errCorruptSegment
+	}
+
+	seg := &segment{
+		first:    int64(binary.LittleEndian.Uint64(header[8:])),
+		offsets:  make([]int64, blocks+1),
+		terms:    make([]uint32, terms),
+		counts:   make([]uint32, terms),
+		postings: make([]int64, terms+1),
+	}
+
+	offsets := make([]byte, 8*(blocks+1))
+	if _, err := io.ReadFull(file, offsets); err != nil {
+		return nil, err
+	}
+	for i := range seg.offsets {
+		seg.offsets[i] = int64(binary.LittleEndian.Uint64(offsets[8*i:]))
+	}
+
+	dictionary := make([]byte, terms*dictEntrySize)
+	if _, err := file.ReadAt(dictionary, dictOffset); err != nil {
+		return nil, err
+	}
+	for i := range seg.terms {
+		record := dictionary[i*dictEntrySize:]
+		seg.terms[i] = binary.LittleEndian.Uint32(record)
+		seg.counts[i] = binary.LittleEndian.Uint32(record[4:])
+		seg.postings[i] = int64(binary.LittleEndian.Uint64(record[8:]))
+	}
+	seg.postings[terms] = dictOffset
+
+	return seg, nil
+}
+
+func (s *segment) blocks() int64 {
+	return int64(len(s.offsets) - 1)
+}
+
+// search returns the numbers of the blocks in the segment that have every one of the trigrams, counting every block
+// of the file.
+func (s *segment) search(terms []uint32) ([]int64, error) {
+	found := make([]int, 0, len(terms))
+	for _, term := range terms {
+		i := sort.Search(len(s.terms), func(i int) bool { return s.terms[i] >= term })
+		if i == len(s.terms) || s.terms[i] != term {
+			return nil, nil
+		}
+		found = append(found, i)
+	}
+
+	// the shortest postings are read first, as no candidate can be in more blocks than them.
+	sort.Slice(found, func(i, j int) bool { return s.counts[found[i]] < s.counts[found[j]] })
+
+	file, err := os.Open(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("while opening search index segment %s: %w", s.name, err)
+	}
+	defer func() { _ = file.Close() }()
+
+	var candidates []uint32
+	for n, i := range found {
+		blocks, err := s.read(file, i)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			candidates = blocks
+		} else {
+			candidates = intersect(candidates, blocks)
+		}
+		if len(candidates) == 0 {
+			return nil, nil
+		}
+	}
+
+	out := make([]int64, len(candidates))
+	for i, block := range candidates {
+		out[i] = s.first + int64(block)
+	}
+
+	return out, nil
+}
+
+// read returns the blocks the nth trigram of the dictionary was found in, numbered from the first of the segment.
+func (s *segment) read(file *os.File, n int) ([]uint32, error) {
+	encoded := make([]byte, s.postings[n+1]-s.postings[n])
+	if _, err := file.ReadAt(encoded, s.postings[n]); err != nil {
+		return nil, fmt.Errorf("while reading search index segment %s: %w", s.name, err)
+	}
+
+	blocks := make([]uint32, 0, s.counts[n])
+	previous := uint32(0)
+	for len(encoded) > 0 {
+		delta, size := binary.Uvarint(encoded)
+		if size <= 0 {
+			return nil, fmt.Errorf("while reading search index segment %s: %w", s.name, errCorruptSegment)
+		}
+		previous += uint32(delta)
+		blocks = append(blocks, previous)
+		encoded = encoded[size:]
+	}
+	if len(blocks) != int(s.counts[n]) {
+		return nil, fmt.Errorf("while reading search index segment %s: %w", s.name, errCorruptSegment)
+	}
+
+	return blocks, nil
+}
+
+// intersect returns the values in both of the ascending lists, reusing the first.
+func intersect(first, second []uint32) []uint32 {
+	out := first[:0]
+	i, j := 0, 0
+	for i < len(first) && j < len(second) {
+		switch {
+		case first[i] < second[j]:
+			i++
+		case first[i] > second[j]:
+			j++
+		default:
+			out = append(out, first[i])
+			i++
+			j++
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,639 @@
+package searchindex
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	vlos "github.com/skormos/varlog-parser/internal/os"
+)
+
+// DefaultBlockSize is the least number of bytes in a block when no other size has been provided.
+const DefaultBlockSize = 1 << 20
+
+const (
+	// segmentBlocks is the number of blocks read before they are written as a segment, which bounds the memory used
+	// while indexing a large file.
+	segmentBlocks = 64
+
+	// checkInterval is the number of lines indexed between checks of the context.
+	checkInterval = 4096
+	readSize      = 64 * 1024
+
+	manifestName    = "manifest.json"
+	manifestVersion = 1
+)
+
+// errNotDirectory is returned when the directory the index is kept in is not a directory.
+var errNotDirectory = errors.New("is not a directory")
+
+// trigramSets holds the sets used while indexing, as each one is a large bitmap.
+var trigramSets = sync.Pool{
+	New: func() interface{} { return newTrigramSet() },
+}
+
+type (
+	// Option defines the function signature for helper methods to update the Store when it is created.
+	Option func(store *Store)
+
+	// Store keeps the index of every file it is asked to update in a directory of its own, and answers which parts of
+	// the file could contain a text. It is safe for concurrent use, but only a single Store should use a directory.
+	Store struct {
+		dir       string
+		blockSize int64
+
+		mu    sync.Mutex
+		files map[string]*fileIndex
+	}
+
+	// File is the name of a file, and the root it is read from.
+	File struct {
+		Root string
+		Name string
+	}
+
+	// Range is the content of a file from the Start offset, up to but not including the End offset.
+	Range struct {
+		Start int64
+		End   int64
+	}
+
+	// Candidates are the parts of a file that could contain a text. Ranges covers the content up to IndexedSize, in
+	// ascending order, and any content after IndexedSize has not been indexed yet, so it could contain the text too.
+	Candidates struct {
+		Ranges      []Range
+		IndexedSize int64
+		// IndexedAt is when the index last caught up with the complete blocks of the file.
+		IndexedAt time.Time
+	}
+
+	// FileStatus reports how much of a file has been indexed.
+	FileStatus struct {
+		Root         string    `json:"root"`
+		Name         string    `json:"name"`
+		IndexedBytes int64     `json:"indexedBytes"`
+		Blocks       int64     `json:"blocks"`
+		Segments     int       `json:"segments"`
+		IndexedAt    time.Time `json:"indexedAt"`
+	}
+
+	// fileIndex is the index of a single file. The state is replaced as a whole while it is locked, and never changed
+	// otherwise, so it can be searched while it is being extended.
+	fileIndex struct {
+		dir  string
+		file File
+		// update is held while the index is extended, so only a single update runs at a time.
+		update sync.Mutex
+
+		mu     sync.RWMutex
+		loaded bool
+		state  *state
+	}
+
+	state struct {
+		manifest manifest
+		segments []*segment
+	}
+
+	// manifest describes the file an index is for, and lists its segments in order. It is written whenever the
+	// segments change, always after the segments it lists.
+	manifest struct {
+		Version   int       `json:"version"`
+		Root      string    `json:"root"`
+		Name      string    `json:"name"`
+		BlockSize int64     `json:"blockSize"`
+		Inode     uint64    `json:"inode"`
+		Size      int64     `json:"size"`
+		Blocks    int64     `json:"blocks"`
+		Tail      []byte    `json:"tail"`
+		IndexedAt time.Time `json:"indexedAt"`
+		Segments  []string  `json:"segments"`
+		// Next is the sequence number of the next segment written, so a name is never reused.
+		Next int `json:"next"`
+	}
+)
+
+// WithBlockSize sets the least number of bytes in a block. A block ends with the first complete line at or past the
+// size. A smaller size reads less of a file to search it, at the cost of a larger index. Changing the size rebuilds
+// every index on its next update.
+func WithBlockSize(bytes int64) Option {
+	return func(store *Store) {
+		store.blockSize = bytes
+	}
+}
+
+// NewStore returns a Store that keeps the index in the directory, which must already exist.
+func NewStore(dir string, options ...Option) (*Store, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("while opening the search index directory: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("search index directory %s %w", dir, errNotDirectory)
+	}
+
+	store := &Store{
+		dir:       dir,
+		blockSize: DefaultBlockSize,
+		files:     make(map[string]*fileIndex),
+	}
+
+	for _, optionFn := range options {
+		optionFn(store)
+	}
+
+	if store.blockSize <= 0 {
+		store.blockSize = DefaultBlockSize
+	}
+
+	return store, nil
+}
+
+// Update indexes the complete blocks of the named file of the root that have been written since it was last updated,
+// or the whole file when it has been rotated or truncated since. The file is the one opened for the name, and info
+// its current state. When the context is done part way, the blocks indexed so far are kept, and the context error is
+// returned.
+func (s *Store) Update(ctx context.Context, root, name string, file io.ReadSeeker, info fs.FileInfo) error {
+	index := s.entry(root, name)
+	index.update.Lock()
+	defer index.update.Unlock()
+
+	current := index.current(s.blockSize)
+	valid, err := current.validFor(file, info)
+	if err != nil {
+		return err
+	}
+	if !valid {
+		if current, err = s.reset(index, vlos.Inode(info)); err != nil {
+			return err
+		}
+	}
+
+	current, err = s.extend(ctx, index, current, file, info.Size())
+	if err != nil {
+		return err
+	}
+
+	next := current.clone()
+	next.manifest.IndexedAt = time.Now()
+	index.swap(next)
+
+	return nil
+}
+
+// Candidates returns the parts of the named file of the root that could contain the text, or nil when the text is
+// too short to search for, or the file has not been indexed as it is now. The file is the one opened for the name,
+// and info its current state.
+func (s *Store) Candidates(
+	root, name string,
+	file io.ReadSeeker,
+	info fs.FileInfo,
+	text string,
+) (*Candidates, error) {
+	terms := queryTrigrams(text)
+	if terms == nil {
+		return nil, nil
+	}
+
+	index := s.entry(root, name)
+	index.current(s.blockSize)
+
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+
+	current := index.state
+	valid, err := current.validFor(file, info)
+	if err != nil || !valid {
+		return nil, err
+	}
+
+	candidates := &Candidates{
+		Ranges:      make([]Range, 0),
+		IndexedSize: current.manifest.Size,
+		IndexedAt:   current.manifest.IndexedAt,
+	}
+	for _, seg := range current.segments {
+		blocks, err := seg.search(terms)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, block := range blocks {
+			start, end := seg.offsets[block-seg.first], seg.offsets[block-seg.first+1]
+			// consecutive blocks are read as a single range.
+			if n := len(candidates.Ranges); n > 0 && candidates.Ranges[n-1].End == start {
+				candidates.Ranges[n-1].End = end
+				continue
+			}
+			candidates.Ranges = append(candidates.Ranges, Range{Start: start, End: end})
+		}
+	}
+
+	return candidates, nil
+}
+
+// Status reports every file indexed since the Store was created, in order of root and name.
+func (s *Store) Status() []FileStatus {
+	s.mu.Lock()
+	indexes := make([]*fileIndex, 0, len(s.files))
+	for _, index := range s.files {
+		indexes = append(indexes, index)
+	}
+	s.mu.Unlock()
+
+	out := make([]FileStatus, 0, len(indexes))
+	for _, index := range indexes {
+		index.mu.RLock()
+		if current := index.state; current != nil {
+			out = append(out, FileStatus{
+				Root:         index.file.Root,
+				Name:         index.file.Name,
+				IndexedBytes: current.manifest.Size,
+				Blocks:       current.manifest.Blocks,
+				Segments:     len(current.segments),
+				IndexedAt:    current.manifest.IndexedAt,
+			})
+		}
+		index.mu.RUnlock()
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Root != out[j].Root {
+			return out[i].Root < out[j].Root
+		}
+		return out[i].Name < out[j].Name
+	})
+
+	return out
+}
+
+// Retain removes the index of every file but the ones provided, including any left in the directory from before
+// the Store was created.
+func (s *Store) Retain(files []File) error {
+	keep := make(map[string]bool, len(files))
+	for _, file := range files {
+		keep[s.key(file.Root, file.Name)] = true
+	}
+
+	return s.remove(func(key string) bool {
+		return !keep[key]
+	})
+}
+
+// Reset removes the index of every file, so each is indexed from the start on its next update.
+func (s *Store) Reset() error {
+	return s.remove(func(string) bool {
+		return true
+	})
+}
+
+// remove removes the index of every file with a key the function matches, from memory and from the directory.
+func (s *Store) remove(matches func(key string) bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, index := range s.files {
+		if !matches(key) {
+			continue
+		}
+
+		index.update.Lock()
+		index.swap(nil)
+		index.update.Unlock()
+		delete(s.files, key)
+	}
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("while listing the search index directory: %w", err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || !isKey(entry.Name()) || !matches(entry.Name()) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(s.dir, entry.Name())); err != nil {
+			return fmt.Errorf("while removing the search index of %s: %w", entry.Name(), err)
+		}
+	}
+
+	return nil
+}
+
+// entry returns the index of the file, which is only read from the directory once it is used.
+func (s *Store) entry(root, name string) *fileIndex {
+	key := s.key(root, name)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index, ok := s.files[key]
+	if !ok {
+		index = &fileIndex{
+			dir:  filepath.Join(s.dir, key),
+			file: File{Root: root, Name: name},
+		}
+		s.files[key] = index
+	}
+
+	return index
+}
+
+// key names the directory the index of the file is kept in. The names are hashed, so every file has a directory
+// directly in the index directory, whatever characters its name has.
+func (s *Store) key(root, name string) string {
+	sum := sha256.Sum256([]byte(root + "\x00" + name))
+	return hex.EncodeToString(sum[:16])
+}
+
+func isKey(name string) bool {
+	decoded, err := hex.DecodeString(name)
+	return err == nil && len(decoded) == 16
+}
+
+// reset replaces the index of the file with an empty one, then removes the segments of the previous index.
+func (s *Store) reset(index *fileIndex, inode uint64) (*state, error) {
+	previous := index.current(s.blockSize)
+	if err := os.MkdirAll(index.dir, 0o700); err != nil {
+		return nil, fmt.Errorf("while creating the search index of %s: %w", index.file.Name, err)
+	}
+
+	next := &state{manifest: manifest{
+		Version:   manifestVersion,
+		Root:      index.file.Root,
+		Name:      index.file.Name,
+		BlockSize: s.blockSize,
+		Inode:     inode,
+		Segments:  make([]string, 0),
+	}}
+	if previous != nil {
+		next.manifest.Next = previous.manifest.Next
+	}
+	if err := writeManifest(index.dir, next.manifest); err != nil {
+		return nil, err
+	}
+	index.swap(next)
+
+	// any segment not in the manifest is left from an update that was interrupted, and is removed with the rest.
+	entries, err := os.ReadDir(index.dir)
+	if err != nil {
+		return nil, fmt.Errorf("while listing the search index of %s: %w", index.file.Name, err)
+	}
+	for _, entry := range entries {
+		if entry.Name() != manifestName {
+			_ = os.Remove(filepath.Join(index.dir, entry.Name()))
+		}
+	}
+
+	return next, nil
+}
+
+// extend indexes the complete blocks between the end of the index and size, writing a segment every segmentBlocks
+// blocks, and once the content has been read.
+func (s *Store) extend(
+	ctx context.Context,
+	index *fileIndex,
+	current *state,
+	file io.ReadSeeker,
+	size int64,
+) (*state, error) {
+	offset := current.manifest.Size
+	if size-offset < s.blockSize {
+		return current, nil
+	}
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("while seeking to the end of the search index: %w", err)
+	}
+
+	set := trigramSets.Get().(*trigramSet)
+	defer func() {
+		set.take()
+		trigramSets.Put(set)
+	}()
+
+	reader := bufio.NewReaderSize(io.LimitReader(file, size-offset), readSize)
+	builder := newSegmentBuilder(current.manifest.Blocks, offset)
+	blockStart := offset
+	// recent is the content before the offset, from which the tail of every block is taken.
+	recent := append(make([]byte, 0, 2*vlos.TailLength), current.manifest.Tail...)
+	tail := current.manifest.Tail
+
+	var err error
+	for n := 0; ; n++ {
+		if n%checkInterval == 0 {
+			if err = ctx.Err(); err != nil {
+				break
+			}
+		}
+
+		fragment, readErr := reader.ReadSlice('\n')
+		set.write(fragment)
+		offset += int64(len(fragment))
+		if recent = append(recent, fragment...); len(recent) > vlos.TailLength {
+			recent = append(recent[:0], recent[len(recent)-vlos.TailLength:]...)
+		}
+
+		if errors.Is(readErr, bufio.ErrBufferFull) {
+			continue
+		}
+		if readErr != nil {
+			// a line still being written at the end of the content is left for the next update.
+			if !errors.Is(readErr, io.EOF) {
+				err = fmt.Errorf("while reading a line to index: %w", readErr)
+			}
+			break
+		}
+
+		if offset-blockStart < s.blockSize {
+			continue
+		}
+		builder.add(offset, set.take())
+		blockStart = offset
+		tail = append([]byte(nil), recent...)
+		if builder.blocks() == segmentBlocks {
+			if current, err = s.commit(index, current, builder, tail); err != nil {
+				return nil, err
+			}
+			builder = newSegmentBuilder(current.manifest.Blocks, offset)
+		}
+	}
+
+	if builder.blocks() > 0 {
+		var commitErr error
+		if current, commitErr = s.commit(index, current, builder, tail); commitErr != nil {
+			return nil, commitErr
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return current, nil
+}
+
+// commit writes the blocks of the builder as a new segment, and adds it to the index. The newest segments are then
+// merged while the last is at least half the size of the one before it, so a file that has grown to n blocks has at
+// most about log2(n) segments, and every block is only ever rewritten that many times.
+func (s *Store) commit(index *fileIndex, current *state, builder *segmentBuilder, tail []byte) (*state, error) {
+	next := current.clone()
+	seg, err := builder.write(filepath.Join(index.dir, next.segmentName()))
+	if err != nil {
+		return nil, err
+	}
+
+	next.segments = append(next.segments, seg)
+	next.manifest.Size = seg.offsets[len(seg.offsets)-1]
+	next.manifest.Blocks += seg.blocks()
+	next.manifest.Tail = tail
+	if err := next.save(index); err != nil {
+		return nil, err
+	}
+	current = next
+
+	for n := len(current.segments); n >= 2 && 2*current.segments[n-1].blocks() >= current.segments[n-2].blocks(); {
+		first, second := current.segments[n-2], current.segments[n-1]
+		next = current.clone()
+		merged, err := mergeSegments(filepath.Join(index.dir, next.segmentName()), first, second)
+		if err != nil {
+			return nil, err
+		}
+
+		next.segments = append(next.segments[:n-2], merged)
+		if err := next.save(index); err != nil {
+			return nil, err
+		}
+		_ = os.Remove(first.path)
+		_ = os.Remove(second.path)
+
+		current = next
+		n = len(current.segments)
+	}
+
+	return current, nil
+}
+
+// current returns the state of the index, reading it from the directory the first time it is used. An index that
+// can't be read, or was built with a different block size, is treated as missing, so it is rebuilt.
+func (i *fileIndex) current(blockSize int64) *state {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if !i.loaded {
+		i.state = i.load(blockSize)
+		i.loaded = true
+	}
+
+	return i.state
+}
+
+func (i *fileIndex) load(blockSize int64) *state {
+	data, err := os.ReadFile(filepath.Join(i.dir, manifestName))
+	if err != nil {
+		return nil
+	}
+
+	loaded := &state{}
+	if err := json.Unmarshal(data, &loaded.manifest); err != nil {
+		return nil
+	}
+	m := loaded.manifest
+	if m.Version != manifestVersion || m.BlockSize != blockSize || m.Root != i.file.Root || m.Name != i.file.Name {
+		return nil
+	}
+
+	// the segments must cover every block, one after another, up to the indexed size.
+	blocks, offset := int64(0), int64(0)
+	for _, name := range m.Segments {
+		seg, err := openSegment(filepath.Join(i.dir, name))
+		if err != nil || seg.first != blocks || seg.offsets[0] != offset {
+			return nil
+		}
+
+		loaded.segments = append(loaded.segments, seg)
+		blocks += seg.blocks()
+		offset = seg.offsets[len(seg.offsets)-1]
+	}
+	if blocks != m.Blocks || offset != m.Size {
+		return nil
+	}
+
+	return loaded
+}
+
+// swap replaces the state of the index.
+func (i *fileIndex) swap(next *state) {
+	i.mu.Lock()
+	i.state = next
+	i.loaded = true
+	i.mu.Unlock()
+}
+
+// save writes the manifest of the state, then makes it the state of the index.
+func (st *state) save(index *fileIndex) error {
+	st.manifest.Segments = make([]string, 0, len(st.segments))
+	for _, seg := range st.segments {
+		st.manifest.Segments = append(st.manifest.Segments, seg.name)
+	}
+
+	if err := writeManifest(index.dir, st.manifest); err != nil {
+		return err
+	}
+	index.swap(st)
+
+	return nil
+}
+
+// clone returns a copy of the state that can be changed without changing the state.
+func (st *state) clone() *state {
+	return &state{
+		manifest: st.manifest,
+		segments: append(make([]*segment, 0, len(st.segments)+1), st.segments...),
+	}
+}
+
+// validFor reports whether the state still describes the start of the file, which is only true while the file has
+// not been replaced, truncated or written again since it was last indexed. A nil state describes no file.
+func (st *state) validFor(file io.ReadSeeker, info fs.FileInfo) (bool, error) {
+	if st == nil {
+		return false, nil
+	}
+
+	return vlos.HasOnlyGrown(file, info, st.manifest.Inode, st.manifest.Size, string(st.manifest.Tail))
+}
+
+// segmentName returns the name of the next segment of the state, and keeps it from being used again.
+func (st *state) segmentName() string {
+	name := fmt.Sprintf("%08d.seg", st.manifest.Next)
+	st.manifest.Next++
+
+	return name
+}
+
+// writeManifest writes the manifest to a temporary file, which replaces the previous manifest once it is complete.
+func writeManifest(dir string, m manifest) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("while encoding the search index manifest of %s: %w", m.Name, err)
+	}
+
+	path := filepath.Join(dir, manifestName)
+	if err := os.WriteFile(path+".tmp", data, 0o600); err != nil {
+		return fmt.Errorf("while writing the search index manifest of %s: %w", m.Name, err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("while writing the search index manifest of %s: %w", m.Name, err)
+	}
+
+	return nil
+}
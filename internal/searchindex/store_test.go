@@ -0,0 +1,384 @@
+package searchindex
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/quick"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	vlos "github.com/skormos/varlog-parser/internal/os"
+	"github.com/skormos/varlog-parser/internal/os/ostest"
+)
+
+// corpus is a file of short lines of a few letters, so most trigrams are common to many blocks, and a query that
+// can be found in some of them.
+type corpus struct {
+	lines     []string
+	partial   string
+	query     string
+	blockSize int64
+}
+
+func (corpus) Generate(rand *rand.Rand, size int) reflect.Value {
+	word := func(n int) string {
+		var out strings.Builder
+		for i := 0; i < n; i++ {
+			out.WriteByte("abcd "[rand.Intn(5)])
+		}
+		return out.String()
+	}
+
+	lines := make([]string, rand.Intn(4*size+1))
+	for i := range lines {
+		lines[i] = word(rand.Intn(40))
+	}
+
+	return reflect.ValueOf(corpus{
+		lines:     lines,
+		partial:   word(rand.Intn(2) * rand.Intn(10)),
+		query:     word(3 + rand.Intn(4)),
+		blockSize: int64(16 + rand.Intn(112)),
+	})
+}
+
+func TestNewStore(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	require.NoError(t, os.WriteFile(file, nil, 0o600))
+
+	tests := map[string]struct {
+		dir         string
+		expectedErr bool
+	}{
+		"Existing directory": {dir: dir},
+		"Missing directory":  {dir: filepath.Join(dir, "missing"), expectedErr: true},
+		"File":               {dir: file, expectedErr: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			store, err := NewStore(test.dir)
+			if test.expectedErr {
+				assert.Error(tt, err)
+				return
+			}
+
+			require.NoError(tt, err)
+			assert.Equal(tt, int64(DefaultBlockSize), store.blockSize)
+		})
+	}
+}
+
+func TestStore_CandidatesHaveEveryMatch(t *testing.T) {
+	property := func(c corpus) bool {
+		path := filepath.Join(t.TempDir(), "messages")
+		content := strings.Join(c.lines, "\n")
+		if len(c.lines) > 0 {
+			content += "\n"
+		}
+		require.NoError(t, os.WriteFile(path, []byte(content+c.partial), 0o600))
+
+		store, err := NewStore(t.TempDir(), WithBlockSize(c.blockSize))
+		require.NoError(t, err)
+		file := ostest.Open(t, path)
+		require.NoError(t, store.Update(context.TODO(), "root", "messages", file, ostest.Stat(t, file)))
+
+		candidates, err := store.Candidates("root", "messages", file, ostest.Stat(t, file), c.query)
+		require.NoError(t, err)
+		require.NotNil(t, candidates)
+
+		for _, match := range grep(t, path, candidates.IndexedSize, c.query) {
+			if !covers(candidates.Ranges, match) {
+				t.Logf("line at %v is not a candidate for %q in %v", match, c.query, candidates)
+				return false
+			}
+		}
+
+		return true
+	}
+
+	require.NoError(t, quick.Check(property, &quick.Config{MaxCount: 300}))
+}
+
+func TestStore_Candidates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "messages")
+	lines := make([]string, 0)
+	for i := 0; i < 42; i++ {
+		lines = append(lines, fmt.Sprintf("%03d request 000000 ok", i))
+	}
+	lines[5] = "005 request 7f3a9c ok"
+	lines[6] = "006 request 7f3a9c no"
+	lines[30] = "030 request 7f3a9c ok"
+	lines[41] = "041 request 0b8e2d ok"
+	require.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600))
+
+	// every block is four lines, so the last two are left to be indexed once the next block is complete.
+	lineLength := int64(len(lines[0]) + 1)
+	store, err := NewStore(t.TempDir(), WithBlockSize(4*lineLength-1))
+	require.NoError(t, err)
+	file := ostest.Open(t, path)
+	require.NoError(t, store.Update(context.TODO(), "root", "messages", file, ostest.Stat(t, file)))
+
+	blockAt := func(block int64) Range {
+		return Range{Start: 4 * block * lineLength, End: 4 * (block + 1) * lineLength}
+	}
+
+	tests := map[string]struct {
+		text     string
+		expected *Candidates
+	}{
+		"Text found in some blocks": {
+			text:     "7f3a9c ok",
+			expected: &Candidates{Ranges: []Range{blockAt(1), blockAt(7)}},
+		},
+		"Consecutive blocks are a single range": {
+			text:     "request",
+			expected: &Candidates{Ranges: []Range{{Start: 0, End: blockAt(9).End}}},
+		},
+		"Text found in no block": {
+			text:     "7f3a9d",
+			expected: &Candidates{Ranges: []Range{}},
+		},
+		"Text only found after the indexed content": {
+			text:     "0b8e2d",
+			expected: &Candidates{Ranges: []Range{}},
+		},
+		"Text too short to search for": {
+			text: "7f",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			candidates, err := store.Candidates("root", "messages", file, ostest.Stat(tt, file), test.text)
+			require.NoError(tt, err)
+			if test.expected == nil {
+				assert.Nil(tt, candidates)
+				return
+			}
+
+			require.NotNil(tt, candidates)
+			assert.Equal(tt, test.expected.Ranges, candidates.Ranges)
+			assert.Equal(tt, blockAt(9).End, candidates.IndexedSize)
+			assert.False(tt, candidates.IndexedAt.IsZero())
+		})
+	}
+}
+
+func TestStore_Maintained(t *testing.T) {
+	logs := t.TempDir()
+	dir := t.TempDir()
+	path := filepath.Join(logs, "messages")
+	writeLines(t, path, 0, 10)
+	const blockSize = 2 * lineLength
+
+	update := func(tt *testing.T, store *Store) int64 {
+		file := ostest.Open(tt, path)
+		require.NoError(tt, store.Update(context.TODO(), "root", "messages", file, ostest.Stat(tt, file)))
+		return file.BytesRead
+	}
+	search := func(tt *testing.T, store *Store, text string) *Candidates {
+		file := ostest.Open(tt, path)
+		candidates, err := store.Candidates("root", "messages", file, ostest.Stat(tt, file), text)
+		require.NoError(tt, err)
+		return candidates
+	}
+	assertSearch := func(store *Store, text string) {
+		t.Helper()
+		assertCandidates(t, path, search(t, store, text), text)
+	}
+
+	store, err := NewStore(dir, WithBlockSize(blockSize))
+	require.NoError(t, err)
+	assert.Nil(t, search(t, store, "line 00005"), "a file that was never updated is not indexed")
+	update(t, store)
+	assertSearch(store, "line 00005")
+
+	// a line still being written is not indexed until it is complete, and only appended content is read.
+	complete := ostest.Stat(t, ostest.Open(t, path)).Size()
+	ostest.Append(t, path, "line 000")
+	update(t, store)
+	assert.Equal(t, complete, search(t, store, "line 00010").IndexedSize)
+	ostest.Append(t, path, "10\n")
+	writeLines(t, path, 11, 14)
+	read := update(t, store)
+	assert.LessOrEqual(t, read, 4*lineLength+int64(vlos.TailLength), "only the appended lines and the tail are read")
+	assertSearch(store, "line 00010")
+
+	// the newest segments are merged as the file grows, block by block.
+	for i := 14; i < 64; i += 2 {
+		writeLines(t, path, i, i+2)
+		update(t, store)
+	}
+	status := store.Status()
+	require.Len(t, status, 1)
+	assert.LessOrEqual(t, status[0].Segments, 6)
+	assertSearch(store, "line 00041")
+
+	// a new store reads the index from the directory, rather than the file.
+	reopened, err := NewStore(dir, WithBlockSize(blockSize))
+	require.NoError(t, err)
+	assertSearch(reopened, "line 00041")
+	assert.Equal(t, int64(vlos.TailLength), update(t, reopened), "only the tail is read when nothing was appended")
+
+	// a different block size needs an update to rebuild the index.
+	resized, err := NewStore(dir, WithBlockSize(blockSize+1))
+	require.NoError(t, err)
+	assert.Nil(t, search(t, resized, "line 00041"))
+
+	// a file truncated and written again is not searched until it is indexed again from the start.
+	require.NoError(t, os.Truncate(path, 0))
+	writeLines(t, path, 100, 110)
+	assert.Nil(t, search(t, reopened, "line 00105"))
+	update(t, reopened)
+	assertSearch(reopened, "line 00105")
+
+	// as is a file replaced by rotation, even when it starts with the same content.
+	require.NoError(t, os.Rename(path, path+".1"))
+	writeLines(t, path, 100, 110)
+	assert.Nil(t, search(t, reopened, "line 00105"))
+	assert.Greater(t, update(t, reopened), 8*lineLength, "the whole file is read to build the index")
+	assertSearch(reopened, "line 00105")
+
+	segments, err := filepath.Glob(filepath.Join(dir, "*", "*.seg"))
+	require.NoError(t, err)
+	assert.Len(t, segments, 1, "the segments of a rebuilt index are removed")
+}
+
+func TestStore_Cancelled(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "messages")
+	writeLines(t, path, 0, 10)
+
+	store, err := NewStore(t.TempDir(), WithBlockSize(2*lineLength))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	file := ostest.Open(t, path)
+	assert.ErrorIs(t, store.Update(ctx, "root", "messages", file, ostest.Stat(t, file)), context.Canceled)
+
+	require.NoError(t, store.Update(context.TODO(), "root", "messages", file, ostest.Stat(t, file)))
+	candidates, err := store.Candidates("root", "messages", file, ostest.Stat(t, file), "line 00009")
+	require.NoError(t, err)
+	assertCandidates(t, path, candidates, "line 00009")
+}
+
+func TestStore_RetainAndReset(t *testing.T) {
+	logs := t.TempDir()
+	dir := t.TempDir()
+	for _, name := range []string{"messages", "syslog"} {
+		writeLines(t, filepath.Join(logs, name), 0, 10)
+	}
+
+	store, err := NewStore(dir, WithBlockSize(2*lineLength))
+	require.NoError(t, err)
+	indexed := func() []string {
+		names := make([]string, 0)
+		for _, status := range store.Status() {
+			names = append(names, status.Name)
+		}
+		return names
+	}
+	indexAll := func() {
+		for _, name := range []string{"messages", "syslog"} {
+			file := ostest.Open(t, filepath.Join(logs, name))
+			require.NoError(t, store.Update(context.TODO(), "root", name, file, ostest.Stat(t, file)))
+		}
+	}
+	directories := func() int {
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		return len(entries)
+	}
+
+	indexAll()
+	assert.Equal(t, []string{"messages", "syslog"}, indexed())
+	assert.Equal(t, 2, directories())
+
+	require.NoError(t, store.Retain([]File{{Root: "root", Name: "syslog"}}))
+	assert.Equal(t, []string{"syslog"}, indexed())
+	assert.Equal(t, 1, directories())
+
+	// files the directory was not created for are left alone.
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "lost+found"), 0o700))
+	indexAll()
+	require.NoError(t, store.Reset())
+	assert.Empty(t, indexed())
+	assert.Equal(t, 1, directories())
+
+	file := ostest.Open(t, filepath.Join(logs, "syslog"))
+	candidates, err := store.Candidates("root", "syslog", file, ostest.Stat(t, file), "line 00001")
+	require.NoError(t, err)
+	assert.Nil(t, candidates)
+}
+
+// lineLength is the length of every line written by writeLines.
+const lineLength = int64(len("line 00000\n"))
+
+// writeLines appends the lines numbered from first up to, but not including, last.
+func writeLines(t *testing.T, path string, first, last int) {
+	t.Helper()
+
+	ostest.AppendLines(t, path, "line %05d", first, last)
+}
+
+// grep returns the range of every line of the file before the end offset that holds the text, read line by line
+// rather than through the index.
+func grep(t *testing.T, path string, end int64, text string) []Range {
+	t.Helper()
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	matches := make([]Range, 0)
+	offset := int64(0)
+	for _, line := range strings.SplitAfter(string(content[:end]), "\n") {
+		next := offset + int64(len(line))
+		if strings.Contains(line, text) {
+			matches = append(matches, Range{Start: offset, End: next})
+		}
+		offset = next
+	}
+
+	return matches
+}
+
+// covers reports whether the part of the file is within one of the ranges.
+func covers(ranges []Range, part Range) bool {
+	for _, r := range ranges {
+		if r.Start <= part.Start && part.End <= r.End {
+			return true
+		}
+	}
+
+	return false
+}
+
+// assertCandidates checks the candidates against a grep of the indexed content of the file: every line holding the
+// text is within a range, and every range holds at least one of them.
+func assertCandidates(t *testing.T, path string, candidates *Candidates, text string) {
+	t.Helper()
+
+	require.NotNil(t, candidates)
+	matches := grep(t, path, candidates.IndexedSize, text)
+	require.NotEmpty(t, matches, "the text is in the indexed content")
+	for _, match := range matches {
+		assert.True(t, covers(candidates.Ranges, match), "line at %v is not a candidate for %q", match, text)
+	}
+	for _, r := range candidates.Ranges {
+		found := false
+		for _, match := range matches {
+			found = found || (r.Start <= match.Start && match.End <= r.End)
+		}
+		assert.True(t, found, "range %v holds no line with %q", r, text)
+	}
+}
@@ -0,0 +1,76 @@
+package searchindex
+
+import "sort"
+
+// trigramSpace is the number of distinct trigrams, as three bytes packed into the low 24 bits of a uint32.
+const trigramSpace = 1 << 24
+
+// trigramSet collects the distinct trigrams of the lines written to it, which never span a newline. Membership is kept
+// in a bitmap of every possible trigram, so only the trigrams found have to be sorted or cleared.
+type trigramSet struct {
+	seen  []uint64
+	terms []uint32
+	// window is the last two bytes of the current line, and length how many of them there are.
+	window uint32
+	length int
+}
+
+func newTrigramSet() *trigramSet {
+	return &trigramSet{seen: make([]uint64, trigramSpace/64)}
+}
+
+// write adds the trigrams of the content, continuing the line the previous write ended in.
+func (s *trigramSet) write(content []byte) {
+	for _, b := range content {
+		if b == '\n' {
+			s.length = 0
+			continue
+		}
+
+		s.window = (s.window<<8 | uint32(b)) & (trigramSpace - 1)
+		if s.length < 2 {
+			s.length++
+			continue
+		}
+
+		if word, bit := s.window/64, uint64(1)<<(s.window%64); s.seen[word]&bit == 0 {
+			s.seen[word] |= bit
+			s.terms = append(s.terms, s.window)
+		}
+	}
+}
+
+// take returns the trigrams added since the last call in ascending order, and empties the set.
+func (s *trigramSet) take() []uint32 {
+	terms := s.terms
+	sort.Slice(terms, func(i, j int) bool { return terms[i] < terms[j] })
+	for _, term := range terms {
+		s.seen[term/64] &^= uint64(1) << (term % 64)
+	}
+
+	s.terms = make([]uint32, 0, len(terms))
+	s.length = 0
+	return terms
+}
+
+// queryTrigrams returns the distinct trigrams of the text in ascending order, or nil when it is too short to have any.
+func queryTrigrams(text string) []uint32 {
+	if len(text) < 3 {
+		return nil
+	}
+
+	terms := make([]uint32, 0, len(text)-2)
+	for i := 0; i+3 <= len(text); i++ {
+		terms = append(terms, uint32(text[i])<<16|uint32(text[i+1])<<8|uint32(text[i+2]))
+	}
+	sort.Slice(terms, func(i, j int) bool { return terms[i] < terms[j] })
+
+	distinct := terms[:1]
+	for _, term := range terms[1:] {
+		if term != distinct[len(distinct)-1] {
+			distinct = append(distinct, term)
+		}
+	}
+
+	return distinct
+}
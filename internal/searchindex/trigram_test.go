@@ -0,0 +1,62 @@
+package searchindex
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func trigram(text string) uint32 {
+	return uint32(text[0])<<16 | uint32(text[1])<<8 | uint32(text[2])
+}
+
+func TestQueryTrigrams(t *testing.T) {
+	tests := map[string]struct {
+		text     string
+		expected []uint32
+	}{
+		"Empty text has no trigrams": {
+			text: "",
+		},
+		"Text shorter than a trigram has none": {
+			text: "ab",
+		},
+		"Single trigram": {
+			text:     "abc",
+			expected: []uint32{trigram("abc")},
+		},
+		"Trigrams are sorted": {
+			text:     "cbab",
+			expected: []uint32{trigram("bab"), trigram("cba")},
+		},
+		"Repeated trigrams are only returned once": {
+			text:     "aaaab",
+			expected: []uint32{trigram("aaa"), trigram("aab")},
+		},
+		"Every byte is significant": {
+			text:     "A b\xff",
+			expected: []uint32{trigram(" b\xff"), trigram("A b")},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(tt *testing.T) {
+			assert.Equal(tt, test.expected, queryTrigrams(test.text))
+		})
+	}
+}
+
+func TestTrigramSet(t *testing.T) {
+	set := newTrigramSet()
+
+	// trigrams continue across writes, but never across a newline.
+	set.write([]byte("ab"))
+	set.write([]byte("cd\nef"))
+	set.write([]byte("g\nab"))
+	assert.Equal(t, []uint32{trigram("abc"), trigram("bcd"), trigram("efg")}, set.take())
+
+	// a line left part way is not continued once the set has been taken.
+	set.write([]byte("c\nabc"))
+	assert.Equal(t, []uint32{trigram("abc")}, set.take())
+	assert.Empty(t, set.take())
+}
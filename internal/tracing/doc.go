@@ -0,0 +1,3 @@
+// Package tracing sets up the OpenTelemetry tracer provider, and records a span for every HTTP request. The spans for
+// opening and scanning files are recorded by the packages doing the work, through the global provider.
+package tracing
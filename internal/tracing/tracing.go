@@ -0,0 +1,131 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const serviceName = "varlogd"
+
+type (
+	// Option defines the function signature for helper methods to update the provider settings when it is created.
+	Option func(s *settings)
+
+	settings struct {
+		exporter    func(ctx context.Context) (sdktrace.SpanExporter, error)
+		sampleRatio float64
+		version     string
+	}
+)
+
+// WithStdout exports every span to the writer as JSON.
+func WithStdout(writer io.Writer) Option {
+	return func(s *settings) {
+		s.exporter = func(context.Context) (sdktrace.SpanExporter, error) {
+			return stdouttrace.New(stdouttrace.WithWriter(writer))
+		}
+	}
+}
+
+// WithOTLP exports spans to the OTLP collector listening for HTTP at the endpoint, as host:port. Insecure sends the
+// spans over plain HTTP, rather than HTTPS.
+func WithOTLP(endpoint string, insecure bool) Option {
+	return func(s *settings) {
+		s.exporter = func(ctx context.Context) (sdktrace.SpanExporter, error) {
+			options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(endpoint)}
+			if insecure {
+				options = append(options, otlptracehttp.WithInsecure())
+			}
+			return otlptracehttp.New(ctx, options...)
+		}
+	}
+}
+
+// WithSampleRatio samples the ratio of traces, between 0 and 1, that are started without a sampled parent. Requests
+// that continue a trace follow the decision of their parent. Every trace is sampled by default.
+func WithSampleRatio(ratio float64) Option {
+	return func(s *settings) {
+		s.sampleRatio = ratio
+	}
+}
+
+// WithVersion records the version of the service on every span.
+func WithVersion(version string) Option {
+	return func(s *settings) {
+		s.version = version
+	}
+}
+
+// NewProvider returns a tracer provider that batches spans to the exporter. Without an exporter, it returns nil, as
+// there is nowhere to send the spans. The provider must be shut down to flush the spans it still holds.
+func NewProvider(ctx context.Context, options ...Option) (*sdktrace.TracerProvider, error) {
+	s := &settings{sampleRatio: 1}
+	for _, optionFn := range options {
+		optionFn(s)
+	}
+
+	if s.exporter == nil {
+		return nil, nil
+	}
+
+	exporter, err := s.exporter(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("while creating the trace exporter: %w", err)
+	}
+
+	attributes := []attribute.KeyValue{semconv.ServiceNameKey.String(serviceName)}
+	if s.version != "" {
+		attributes = append(attributes, semconv.ServiceVersionKey.String(s.version))
+	}
+
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, attributes...)),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(s.sampleRatio))),
+	), nil
+}
+
+// Middleware records a span for every request with the provider, continuing the trace from the W3C traceparent header
+// when the client sends one. The span is named after the route pattern once the request has been routed, and the trace
+// ID is added to the request logger as traceId, so the logs of a request can be found from its trace.
+func Middleware(provider trace.TracerProvider) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		named := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			span := trace.SpanFromContext(r.Context())
+			if traceID := span.SpanContext().TraceID(); traceID.IsValid() {
+				zerolog.Ctx(r.Context()).UpdateContext(func(c zerolog.Context) zerolog.Context {
+					return c.Str("traceId", traceID.String())
+				})
+			}
+
+			next.ServeHTTP(w, r)
+
+			if route := chi.RouteContext(r.Context()); route != nil && route.RoutePattern() != "" {
+				span.SetName(r.Method + " " + route.RoutePattern())
+				span.SetAttributes(semconv.HTTPRouteKey.String(route.RoutePattern()))
+			}
+		})
+
+		return otelhttp.NewHandler(named, "HTTP",
+			otelhttp.WithTracerProvider(provider),
+			otelhttp.WithPropagators(propagation.TraceContext{}),
+			otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+				return r.Method
+			}),
+		)
+	}
+}